@@ -1,11 +1,18 @@
 package cmd
 
 import (
+	"bytes"
 	"context"
+	"fmt"
 	"net"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/asiffer/wg-easy-vpn/export"
 	"github.com/asiffer/wg-easy-vpn/models"
+	"github.com/asiffer/wg-easy-vpn/pkg/wgeasy"
 	"github.com/asiffer/wg-easy-vpn/utils"
 	"github.com/rs/zerolog/log"
 	"github.com/urfave/cli/v3"
@@ -19,9 +26,27 @@ var addCmd = cli.Command{
 	Flags: []cli.Flag{
 		&noPSKFlag,
 		&clientFlag,
+		&fromFileFlag,
+		&outputFlag,
 		&routesFlag,
+		&excludeRoutesFlag,
 		&dnsFlag,
+		&subnetFlag,
+		&advertiseFlag,
+		&tagFlag,
+		&gatewayFlag,
+		&allGatewaysFlag,
+		&keepaliveFlag,
+		&mtuFlag,
+		&tableFlag,
+		&fwmarkFlag,
+		&unsetFlag,
 		&qrcodeFlag,
+		&clientFormatFlag,
+		&applyFlag,
+		&shareFlag,
+		&shareTTLFlag,
+		&shareURLFlag,
 	},
 	Arguments: []cli.Argument{
 		&connArg,
@@ -36,12 +61,26 @@ var addCmd = cli.Command{
 }
 
 type addConfig struct {
-	name   string
-	noPSK  bool
-	client string
-	routes []net.IPNet
-	dns    []net.IP
-	qrcode bool
+	name        string
+	noPSK       bool
+	client      string
+	fromFile    string // CSV or YAML file of clients (replaces client)
+	output      string // directory of the client configs (with fromFile or networkd)
+	routes      []net.IPNet
+	excludes    []net.IPNet
+	dns         []net.IP
+	subnets     []net.IPNet      // networks routed behind the client (site-to-site)
+	advertise   bool             // push the subnets to the other clients
+	gateway     string           // gateway the client connects to (empty = main server)
+	allGateways bool             // connect to all the gateways
+	tags        []string         // labels of the clients (kept by the server)
+	options     models.WGOptions // override the vpn defaults
+	qrcode      bool
+	format      string // output format of the client config (wg-quick, nm...)
+	apply       bool   // push the new peer to the running interface
+	share       bool   // print a one-time link instead of the config
+	shareTTL    time.Duration
+	shareURL    string // base url of the serve command
 }
 
 func buildAddCmdConfig(c *cli.Command) (*addConfig, error) {
@@ -49,65 +88,158 @@ func buildAddCmdConfig(c *cli.Command) (*addConfig, error) {
 	if err != nil {
 		return nil, err
 	}
+	excludes, err := utils.ParseIPNetList(c.StringSlice("exclude-routes"))
+	if err != nil {
+		return nil, err
+	}
 	dns, err := utils.ParseIPList(c.StringSlice("dns"))
 	if err != nil {
 		return nil, err
 	}
+	subnets, err := utils.ParseIPNetList(c.StringSlice("subnet"))
+	if err != nil {
+		return nil, err
+	}
+	options, err := overridesFromFlags(c)
+	if err != nil {
+		return nil, err
+	}
 	cfg := &addConfig{
-		name:   c.StringArg(CONNECTION_ARG),
-		noPSK:  c.Bool("no-psk"),
-		client: c.String("client"),
-		routes: routes,
-		dns:    dns,
-		qrcode: c.Bool("qrcode"),
+		name:        c.StringArg(CONNECTION_ARG),
+		noPSK:       c.Bool("no-psk"),
+		client:      c.String("client"),
+		fromFile:    c.String("from-file"),
+		output:      c.String("output"),
+		routes:      routes,
+		excludes:    excludes,
+		dns:         dns,
+		subnets:     subnets,
+		advertise:   c.Bool("advertise"),
+		gateway:     c.String("gateway"),
+		allGateways: c.Bool("all-gateways"),
+		tags:        c.StringSlice("tag"),
+		options:     options,
+		qrcode:      c.Bool("qrcode"),
+		format:      c.String("format"),
+		apply:       c.Bool("apply"),
+		share:       c.Bool("share"),
+		shareTTL:    c.Duration("share-ttl"),
+		shareURL:    c.String("share-url"),
 	}
 	log.Debug().
 		Bool("no-psk", cfg.noPSK).
 		Str("client", cfg.client).
+		Str("from-file", cfg.fromFile).
+		Str("output", cfg.output).
 		Strs("routes", utils.StringifyNetworks(cfg.routes)).
+		Strs("exclude-routes", utils.StringifyNetworks(cfg.excludes)).
 		Strs("dns", utils.StringifyIPs(cfg.dns)).
+		Strs("subnets", utils.StringifyNetworks(cfg.subnets)).
+		Bool("advertise", cfg.advertise).
+		Str("gateway", cfg.gateway).
+		Bool("all-gateways", cfg.allGateways).
+		Strs("tags", cfg.tags).
+		Uint16("keepalive", cfg.options.Keepalive).
+		Uint16("mtu", cfg.options.MTU).
+		Str("table", cfg.options.Table).
+		Str("fwmark", cfg.options.FwMark).
+		Strs("unset", cfg.options.Unset).
 		Str("name", cfg.name).
 		Bool("qrcode", cfg.qrcode).
+		Str("format", cfg.format).
+		Bool("apply", cfg.apply).
+		Bool("share", cfg.share).
+		Dur("share-ttl", cfg.shareTTL).
+		Str("share-url", cfg.shareURL).
 		Msg("Add command configuration")
 	return cfg, nil
 }
 
-func addAction(_ context.Context, config *addConfig) error {
-	// Get connection name and path
-	name, path, err := ConfigurationInfo(config.name)
-	if err != nil {
+func addAction(ctx context.Context, config *addConfig) error {
+	if config.allGateways && config.gateway != "" {
+		return fmt.Errorf("--gateway and --all-gateways are mutually exclusive")
+	}
+	if config.advertise && len(config.subnets) == 0 {
+		return fmt.Errorf("--advertise requires --subnet (nothing to advertise otherwise)")
+	}
+	if config.format == "" {
+		config.format = models.FormatWGQuick
+	}
+	if err := checkClientFormat(config.format, config.qrcode); err != nil {
 		return err
 	}
-	log.Debug().Str("name", name).Str("path", path).Msg("Parsing connection location")
+	if config.format == models.FormatNetworkd && config.output == "" {
+		return fmt.Errorf("--output is required with the %s format", models.FormatNetworkd)
+	}
+	if err := checkShare(config); err != nil {
+		return err
+	}
+	if config.fromFile != "" {
+		return addFromFileAction(ctx, config)
+	}
+	if config.client == "" {
+		return fmt.Errorf("--client or --from-file is required")
+	}
 
-	// Parse existing VPN configuration
-	file, err := utils.ParseFile(path)
+	// Get connection name
+	name, _, err := ConfigurationInfo(config.name)
 	if err != nil {
 		return err
 	}
-	log.Debug().Str("path", path).Msg("Loaded existing VPN configuration")
 
-	// Load VPN from file
-	vpn, err := models.VPNFromFile(config.name, file)
+	// Load VPN from file (locked until saved)
+	vpn, path, unlock, err := loadVPN(config.name)
 	if err != nil {
 		return err
 	}
+	defer unlock()
+	log.Debug().Str("path", path).Msg("Loaded existing VPN configuration")
 
-	clientName := config.client
+	clientName := models.CleanClientName(config.client)
+	if clientName == "" {
+		return fmt.Errorf("invalid client name %q", config.client)
+	}
+	// names identify the clients (export, REST API...)
+	for _, peer := range vpn.Peers() {
+		if peer.Name() == clientName {
+			return fmt.Errorf("a client named %s already exists in the VPN (%w)", clientName, wgeasy.ErrExists)
+		}
+	}
+	before := devicePeers(vpn)
 
 	// ips are provided by the vpn when adding the client
 	client := models.NewWGClient(nil, config.noPSK, config.dns, config.routes)
+	client.SetName(clientName)
+	client.SetExcludedRoutes(config.excludes)
+	client.SetOptions(config.options)
+	client.SetTags(config.tags)
+	client.SetGateway(config.gateway)
+	if config.allGateways {
+		client.SetGateway(models.AllGateways)
+	}
+	if len(config.subnets) > 0 {
+		// the client is a router for these subnets
+		client.SetSubnets(config.subnets)
+		postUp, postDown := generateSubnetHooks(vpn.Networks(), config.subnets)
+		client.SetPostHooks(postUp, postDown)
+		log.Debug().Strs("postUp", postUp).Strs("postDown", postDown).Msg("Site-to-site hooks configured")
+	}
 	log.Debug().
 		Str("client", clientName).
 		Bool("no-psk", config.noPSK).
 		Strs("dns", utils.StringifyIPs(config.dns)).
 		Strs("routes", utils.StringifyNetworks(config.routes)).
+		Strs("exclude-routes", utils.StringifyNetworks(config.excludes)).
 		Msg("Creating new client")
 
 	err = vpn.AddClient(client)
 	if err != nil {
 		return err
 	}
+	if config.advertise {
+		vpn.Advertise(config.subnets)
+		log.Debug().Strs("subnets", utils.StringifyNetworks(config.subnets)).Msg("Subnets advertised to the other clients")
+	}
 
 	// Get the public key from the peer representation
 	peer := client.ToPeer()
@@ -122,29 +254,264 @@ func addAction(_ context.Context, config *addConfig) error {
 	sec := clientFile.GetorCreateSection(utils.DEFAULT_SECTION)
 	sec.AddComment(clientName)
 	// fill the file with client config
-	client.PopulateClient(clientFile, vpn)
+	if err := client.PopulateClientGateway(clientFile, vpn); err != nil {
+		return err
+	}
 	clientFile.Log(log.Debug()).Msg("Populating client config file in memory")
 
-	// write to stdout
-	if config.qrcode {
-		_, err = clientFile.WriteQRCodeTo(os.Stdout)
+	// render in memory: nothing is written if the config cannot be rendered
+	var out bytes.Buffer
+	var networkd []models.NetworkdFile
+	if config.format == models.FormatNetworkd {
+		networkd, err = renderNetworkd(clientFile, name)
+	} else if config.qrcode {
+		_, err = clientFile.WriteQRCodeTo(&out)
 	} else {
-		_, err = clientFile.WriteTo(os.Stdout)
+		var rendered string
+		if rendered, err = models.RenderClient(clientFile, config.format, name); err == nil {
+			out.WriteString(rendered)
+		}
 	}
 	if err != nil {
 		return err
 	}
 
+	// store the share before saving: the private key is not lost if the
+	// share store fails
+	store := export.NewShareStore(path)
+	var token string
+	if config.share {
+		if token, err = shareClientConfig(store, out.Bytes(), clientName, config); err != nil {
+			return err
+		}
+		// the link replaces the config on stdout
+		out.Reset()
+		fmt.Fprintln(&out, export.ShareURL(config.shareURL, token))
+	}
+
 	// update server file
-	newServerFile := utils.NewFile()
-	vpn.Populate(newServerFile)
-	newServerFile.Log(log.Debug()).Msg("Populating server config file in memory")
+	if err := saveVPN(vpn, path); err != nil {
+		if config.share {
+			// the client is not added: its link must not work
+			store.Take(token, nil)
+		}
+		return err
+	}
 
-	err = newServerFile.Save(path)
+	// write to stdout (or to the output directory for systemd-networkd)
+	if networkd != nil {
+		err = writeNetworkdFiles(networkd, config.output)
+	} else {
+		_, err = out.WriteTo(os.Stdout)
+	}
 	if err != nil {
 		return err
 	}
-	log.Info().Str("path", path).Msg("Wireguard VPN configuration file updated")
 
+	if config.apply {
+		return applyPeers(ctx, name, before, devicePeers(vpn))
+	}
 	return nil
 }
+
+// addFromFileAction adds all the clients of a CSV or YAML file. The server
+// file is only updated if every client can be added.
+func addFromFileAction(ctx context.Context, config *addConfig) error {
+	switch {
+	case config.client != "":
+		return fmt.Errorf("--client and --from-file are mutually exclusive")
+	case len(config.subnets) > 0 || config.gateway != "" || config.allGateways:
+		return fmt.Errorf("--from-file cannot be combined with --subnet, --gateway or --all-gateways")
+	case config.output == "":
+		return fmt.Errorf("--output is required with --from-file")
+	}
+
+	format, err := bulkFormat(config.fromFile)
+	if err != nil {
+		return err
+	}
+	src, err := os.Open(config.fromFile)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	entries, err := models.ReadClientEntries(src, format)
+	if err != nil {
+		return fmt.Errorf("error while reading %s (%w)", config.fromFile, err)
+	}
+
+	name, _, err := ConfigurationInfo(config.name)
+	if err != nil {
+		return err
+	}
+	vpn, path, unlock, err := loadVPN(config.name)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	before := devicePeers(vpn)
+
+	existing := make(map[string]bool)
+	for _, peer := range vpn.Peers() {
+		existing[peer.Name()] = true
+	}
+	clients := make([]*models.WGClient, len(entries))
+	for i := range entries {
+		if existing[entries[i].Name] {
+			return fmt.Errorf("client %s already exists", entries[i].Name)
+		}
+		clients[i] = entries[i].Client(config.noPSK, config.dns, config.routes)
+		clients[i].SetExcludedRoutes(config.excludes)
+		clients[i].SetOptions(config.options)
+		clients[i].SetTags(config.tags)
+	}
+
+	// static addresses first so that they are not given to the other clients
+	for _, static := range []bool{true, false} {
+		for i, client := range clients {
+			if (entries[i].IP != nil) != static {
+				continue
+			}
+			if err := vpn.AddClient(client); err != nil {
+				return fmt.Errorf("client %s: %w", client.Name(), err)
+			}
+		}
+	}
+	vpn.Log(log.Debug()).Int("clients", len(clients)).Msg("Clients added in memory")
+
+	// rendered before the vpn is saved, written once it is
+	configs, err := renderClientConfigs(vpn, clients, config.format, name, config.qrcode)
+	if err != nil {
+		return err
+	}
+	if err := saveVPN(vpn, path); err != nil {
+		return err
+	}
+	if err := writeClientConfigs(configs, config.output); err != nil {
+		return err
+	}
+	log.Info().
+		Str("source", config.fromFile).
+		Int("clients", len(clients)).
+		Str("output", config.output).
+		Msg("Clients added to VPN")
+
+	if config.apply {
+		return applyPeers(ctx, name, before, devicePeers(vpn))
+	}
+	return nil
+}
+
+// checkClientFormat validates the output format of the client configs
+// (qrcodes are read by the Wireguard apps which expect wg-quick configs)
+func checkClientFormat(format string, qrcode bool) error {
+	switch format {
+	case models.FormatWGQuick:
+		return nil
+	case models.FormatNM, models.FormatNetworkd, models.FormatOpenWrt, models.FormatRouterOS:
+		if qrcode {
+			return fmt.Errorf("--qrcode is only available with the %s format", models.FormatWGQuick)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown client format %q (expected %s, %s, %s, %s or %s)", format,
+			models.FormatWGQuick, models.FormatNM, models.FormatNetworkd, models.FormatOpenWrt, models.FormatRouterOS)
+	}
+}
+
+// checkShare validates the one-time link options
+func checkShare(config *addConfig) error {
+	switch {
+	case !config.share:
+		return nil
+	case config.shareURL == "":
+		return fmt.Errorf("--share-url (or WG_EASY_VPN_URL) is required with --share")
+	case config.shareTTL <= 0:
+		return fmt.Errorf("--share-ttl must be positive")
+	case config.fromFile != "":
+		return fmt.Errorf("--share and --from-file are mutually exclusive")
+	case config.qrcode:
+		return fmt.Errorf("--share and --qrcode are mutually exclusive (the link provides the QR code)")
+	case config.format == models.FormatNetworkd:
+		return fmt.Errorf("--share is not available with the %s format", models.FormatNetworkd)
+	}
+	return nil
+}
+
+// shareClientConfig stores the rendered client config encrypted next to
+// the server config and returns the token of its one-time link
+func shareClientConfig(store *export.ShareStore, out []byte, clientName string, config *addConfig) (string, error) {
+	if _, err := store.Purge(); err != nil {
+		log.Warn().Err(err).Msg("Error while purging the expired shares")
+	}
+	token, err := store.Put(&export.Share{Name: clientName, Format: config.format, Config: out}, config.shareTTL)
+	if err != nil {
+		return "", err
+	}
+	log.Info().
+		Str("client", clientName).
+		Time("expires", time.Now().Add(config.shareTTL)).
+		Msg("Client config shared (the link works once)")
+	return token, nil
+}
+
+// bulkFormat returns the format of a bulk file from its extension
+func bulkFormat(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return models.BulkCSV, nil
+	case ".yaml", ".yml":
+		return models.BulkYAML, nil
+	default:
+		return "", fmt.Errorf("unknown format of %s (expected .csv, .yaml or .yml)", path)
+	}
+}
+
+// generateSubnetHooks generates PostUp and PostDown commands for a client
+// routing subnets behind it (site-to-site). It configures:
+//   - IP forwarding (sysctl) on the client router
+//   - iptables/ip6tables FORWARD rules between the tunnel and each subnet
+//   - MASQUERADE rules so that the subnet hosts see the traffic coming
+//     from the VPN as local (no route back needed)
+func generateSubnetHooks(networks []net.IPNet, subnets []net.IPNet) (postUp, postDown []string) {
+	needsIPv4Forwarding := false
+	needsIPv6Forwarding := false
+	for _, subnet := range subnets {
+		if subnet.IP.To4() != nil {
+			needsIPv4Forwarding = true
+		} else {
+			needsIPv6Forwarding = true
+		}
+	}
+	if needsIPv4Forwarding {
+		postUp = append(postUp, "sysctl -q -w net.ipv4.ip_forward=1")
+	}
+	if needsIPv6Forwarding {
+		postUp = append(postUp, "sysctl -q -w net.ipv6.conf.all.forwarding=1")
+	}
+
+	for _, subnet := range subnets {
+		ipv4 := subnet.IP.To4() != nil
+		iptables := "iptables"
+		if !ipv4 {
+			iptables = "ip6tables"
+		}
+		postUp = append(postUp,
+			fmt.Sprintf("%s -A FORWARD -i %%i -d %s -j ACCEPT", iptables, subnet.String()),
+			fmt.Sprintf("%s -A FORWARD -s %s -o %%i -j ACCEPT", iptables, subnet.String()),
+		)
+		postDown = append(postDown,
+			fmt.Sprintf("%s -D FORWARD -i %%i -d %s -j ACCEPT", iptables, subnet.String()),
+			fmt.Sprintf("%s -D FORWARD -s %s -o %%i -j ACCEPT", iptables, subnet.String()),
+		)
+		for _, network := range networks {
+			if (network.IP.To4() != nil) != ipv4 {
+				continue
+			}
+			base := net.IPNet{IP: network.IP.Mask(network.Mask), Mask: network.Mask}
+			postUp = append(postUp, fmt.Sprintf("%s -t nat -A POSTROUTING -s %s -d %s -j MASQUERADE", iptables, base.String(), subnet.String()))
+			postDown = append(postDown, fmt.Sprintf("%s -t nat -D POSTROUTING -s %s -d %s -j MASQUERADE", iptables, base.String(), subnet.String()))
+		}
+	}
+	return
+}
@@ -2,12 +2,17 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"net"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/asiffer/wg-easy-vpn/export"
+	"github.com/asiffer/wg-easy-vpn/models"
+	"github.com/asiffer/wg-easy-vpn/pkg/wgeasy"
 	"github.com/asiffer/wg-easy-vpn/utils"
 )
 
@@ -193,6 +198,99 @@ func TestAddAction(t *testing.T) {
 		}
 	})
 
+	t.Run("adds client with excluded routes", func(t *testing.T) {
+		dir := testDir(t)
+		configPath := setupVPN(t, dir)
+
+		oldStdout := os.Stdout
+		r, w, _ := os.Pipe()
+		os.Stdout = w
+
+		addCfg := &addConfig{
+			name:     configPath,
+			client:   "client-split",
+			routes:   []net.IPNet{{IP: net.ParseIP("10.0.0.0"), Mask: net.CIDRMask(8, 32)}},
+			excludes: []net.IPNet{{IP: net.ParseIP("10.128.0.0"), Mask: net.CIDRMask(9, 32)}},
+		}
+
+		err := addAction(context.Background(), addCfg)
+
+		w.Close()
+		os.Stdout = oldStdout
+
+		if err != nil {
+			t.Fatalf("addAction failed: %v", err)
+		}
+
+		buf := make([]byte, 4096)
+		n, _ := r.Read(buf)
+		output := string(buf[:n])
+
+		if !strings.Contains(output, "AllowedIPs = 10.0.0.0/9") {
+			t.Errorf("expected split route in client config, got: %s", output)
+		}
+	})
+
+	t.Run("adds site-to-site client", func(t *testing.T) {
+		dir := testDir(t)
+		configPath := setupVPN(t, dir)
+
+		oldStdout := os.Stdout
+		r, w, _ := os.Pipe()
+		os.Stdout = w
+
+		addCfg := &addConfig{
+			name:      configPath,
+			client:    "branch-office",
+			subnets:   []net.IPNet{{IP: net.ParseIP("192.168.50.0"), Mask: net.CIDRMask(24, 32)}},
+			advertise: true,
+		}
+
+		err := addAction(context.Background(), addCfg)
+
+		w.Close()
+		os.Stdout = oldStdout
+
+		if err != nil {
+			t.Fatalf("addAction failed: %v", err)
+		}
+
+		buf := make([]byte, 4096)
+		n, _ := r.Read(buf)
+		output := string(buf[:n])
+
+		if !strings.Contains(output, "PostUp = iptables -t nat -A POSTROUTING -s 10.0.0.0/24 -d 192.168.50.0/24 -j MASQUERADE") {
+			t.Errorf("expected masquerade rule in client config, got: %s", output)
+		}
+		if !strings.Contains(output, "PostDown = iptables -D FORWARD -i %i -d 192.168.50.0/24 -j ACCEPT") {
+			t.Errorf("expected forward rule cleanup in client config, got: %s", output)
+		}
+
+		file, _ := utils.ParseFile(configPath)
+		def, _ := file.GetSection(utils.DEFAULT_SECTION)
+		if advertised, _ := def.Get("AdvertisedRoutes"); advertised != "192.168.50.0/24" {
+			t.Errorf("expected AdvertisedRoutes '192.168.50.0/24', got '%s'", advertised)
+		}
+		peer, _ := file.GetSection("Peer")
+		if allowed, _ := peer.Get("AllowedIPs"); allowed != "10.0.0.2/32, 192.168.50.0/24" {
+			t.Errorf("expected subnet in server AllowedIPs, got '%s'", allowed)
+		}
+	})
+
+	t.Run("advertise requires a subnet", func(t *testing.T) {
+		dir := testDir(t)
+		configPath := setupVPN(t, dir)
+
+		addCfg := &addConfig{
+			name:      configPath,
+			client:    "router",
+			advertise: true,
+		}
+		if err := addAction(context.Background(), addCfg); err == nil {
+			t.Error("expected an error for --advertise without --subnet")
+		}
+	})
+
 	t.Run("adds client with custom DNS", func(t *testing.T) {
 		dir := testDir(t)
 		configPath := setupVPN(t, dir)
@@ -235,4 +333,294 @@ func TestAddAction(t *testing.T) {
 			t.Error("expected error for non-existent config")
 		}
 	})
+
+	t.Run("fails on a duplicate name", func(t *testing.T) {
+		dir := testDir(t)
+		configPath := setupVPN(t, dir)
+
+		// Suppress stdout
+		oldStdout := os.Stdout
+		_, w, _ := os.Pipe()
+		os.Stdout = w
+
+		addCfg := &addConfig{
+			name:   configPath,
+			client: "laptop",
+		}
+		if err := addAction(context.Background(), addCfg); err != nil {
+			t.Fatalf("addAction failed: %v", err)
+		}
+		err := addAction(context.Background(), &addConfig{name: configPath, client: " laptop "})
+
+		w.Close()
+		os.Stdout = oldStdout
+
+		if !errors.Is(err, wgeasy.ErrExists) {
+			t.Errorf("expected ErrExists, got %v", err)
+		}
+		vpn, _, unlock, err := loadVPN(configPath)
+		if err != nil {
+			t.Fatalf("loadVPN failed: %v", err)
+		}
+		unlock()
+		if vpn.NumberOfPeers() != 1 {
+			t.Errorf("expected 1 peer, got %d", vpn.NumberOfPeers())
+		}
+	})
+}
+
+func TestAddFromFileAction(t *testing.T) {
+	t.Run("adds all the clients", func(t *testing.T) {
+		dir := testDir(t)
+		configPath := setupVPN(t, dir)
+		output := filepath.Join(dir, "clients")
+
+		err := addAction(context.Background(), &addConfig{
+			name:     configPath,
+			fromFile: "../test/clients.csv",
+			output:   output,
+			qrcode:   true,
+		})
+		if err != nil {
+			t.Fatalf("addAction failed: %v", err)
+		}
+
+		vpn, _, unlock, err := loadVPN(configPath)
+		if err != nil {
+			t.Fatalf("loadVPN failed: %v", err)
+		}
+		unlock()
+		peers := vpn.Peers()
+		if len(peers) != 3 {
+			t.Fatalf("expected 3 peers, got %d", len(peers))
+		}
+		// bob keeps its static address, alice gets the first free one
+		addresses := map[string]string{"alice": "10.0.0.2/32", "bob": "10.0.0.10/32", "printer": "10.0.0.3/32"}
+		for _, peer := range peers {
+			if peer.AllowedIPs() != addresses[peer.Name()] {
+				t.Errorf("expected %s for %s, got %s", addresses[peer.Name()], peer.Name(), peer.AllowedIPs())
+			}
+		}
+
+		for _, name := range []string{"alice", "bob", "printer"} {
+			for _, ext := range []string{CONFIG_SUFFIX, "." + DefaultQRCodeFormat} {
+				if !utils.FileExists(filepath.Join(output, name+ext)) {
+					t.Errorf("expected %s%s in the output directory", name, ext)
+				}
+			}
+		}
+		bob, err := os.ReadFile(filepath.Join(output, "bob"+CONFIG_SUFFIX))
+		if err != nil {
+			t.Fatalf("failed to read bob config: %v", err)
+		}
+		if !strings.Contains(string(bob), "DNS = 9.9.9.9") || !strings.Contains(string(bob), "192.168.1.0/24") {
+			t.Errorf("expected the dns and routes of the file, got: %s", bob)
+		}
+		printer, err := os.ReadFile(filepath.Join(output, "printer"+CONFIG_SUFFIX))
+		if err != nil {
+			t.Fatalf("failed to read printer config: %v", err)
+		}
+		if strings.Contains(string(printer), "\nPrivateKey") {
+			t.Errorf("expected no private key for a client with its own key, got: %s", printer)
+		}
+	})
+
+	t.Run("fails atomically", func(t *testing.T) {
+		dir := testDir(t)
+		configPath := setupVPN(t, dir)
+		before, err := os.ReadFile(configPath)
+		if err != nil {
+			t.Fatalf("failed to read config: %v", err)
+		}
+
+		// the second client is outside of the vpn network
+		source := filepath.Join(dir, "clients.yaml")
+		content := "- name: alice\n- name: bob\n  ip: 192.168.1.2\n"
+		if err := os.WriteFile(source, []byte(content), 0600); err != nil {
+			t.Fatalf("failed to write source: %v", err)
+		}
+		output := filepath.Join(dir, "clients")
+		err = addAction(context.Background(), &addConfig{name: configPath, fromFile: source, output: output})
+		if err == nil || !strings.Contains(err.Error(), "client bob") {
+			t.Fatalf("expected error on bob, got %v", err)
+		}
+
+		after, err := os.ReadFile(configPath)
+		if err != nil {
+			t.Fatalf("failed to read config: %v", err)
+		}
+		if string(before) != string(after) {
+			t.Error("expected the server config to be untouched")
+		}
+		if utils.FileExists(output) {
+			t.Error("expected no client config written")
+		}
+	})
+
+	t.Run("nothing is written when a config cannot be rendered", func(t *testing.T) {
+		dir := testDir(t)
+		configPath := setupVPN(t, dir)
+		before, err := os.ReadFile(configPath)
+		if err != nil {
+			t.Fatalf("failed to read config: %v", err)
+		}
+
+		// printer keeps its private key: NetworkManager needs it
+		output := filepath.Join(dir, "clients")
+		err = addAction(context.Background(), &addConfig{name: configPath, fromFile: "../test/clients.csv", output: output, format: models.FormatNM})
+		if err == nil || !strings.Contains(err.Error(), "client printer") {
+			t.Fatalf("expected error on printer, got %v", err)
+		}
+		after, _ := os.ReadFile(configPath)
+		if string(before) != string(after) {
+			t.Error("expected the server config to be untouched")
+		}
+		if utils.FileExists(output) {
+			t.Error("expected no client config written")
+		}
+	})
+
+	t.Run("requires an output directory", func(t *testing.T) {
+		dir := testDir(t)
+		configPath := setupVPN(t, dir)
+		err := addAction(context.Background(), &addConfig{name: configPath, fromFile: "../test/clients.csv"})
+		if err == nil {
+			t.Error("expected error without --output")
+		}
+	})
+}
+
+func TestAddActionNMFormat(t *testing.T) {
+	dir := testDir(t)
+	configPath := setupVPN(t, dir)
+
+	output, err := captureStdout(t, func() error {
+		return addAction(context.Background(), &addConfig{name: configPath, client: "laptop", format: models.FormatNM})
+	})
+	if err != nil {
+		t.Fatalf("addAction failed: %v", err)
+	}
+	for _, e := range []string{"[connection]", "id=wg0", "[wireguard]", "[wireguard-peer.", "[ipv4]\naddress1=10.0.0.2/24"} {
+		if !strings.Contains(output, e) {
+			t.Errorf("expected %q in keyfile, got: %s", e, output)
+		}
+	}
+
+	err = addAction(context.Background(), &addConfig{name: configPath, client: "phone", format: models.FormatNM, qrcode: true})
+	if err == nil {
+		t.Error("expected error with --qrcode and the nm format")
+	}
+	err = addAction(context.Background(), &addConfig{name: configPath, client: "phone", format: "netplan"})
+	if err == nil {
+		t.Error("expected error with an unknown format")
+	}
+}
+
+func TestAddActionRouterFormats(t *testing.T) {
+	expected := map[string][]string{
+		models.FormatOpenWrt:  {"uci set network.wg0=interface\n", "uci set network.wg0_peer1=wireguard_wg0\n", "uci commit network\n"},
+		models.FormatRouterOS: {"/interface wireguard add name=wg0 ", "/ip address add address=10.0.0.2/24 interface=wg0\n", "/interface wireguard peers add interface=wg0 "},
+	}
+	for format, lines := range expected {
+		configPath := setupVPN(t, testDir(t))
+		output, err := captureStdout(t, func() error {
+			return addAction(context.Background(), &addConfig{name: configPath, client: "router-" + format, format: format})
+		})
+		if err != nil {
+			t.Fatalf("addAction failed (%s): %v", format, err)
+		}
+		for _, e := range lines {
+			if !strings.Contains(output, e) {
+				t.Errorf("expected %q in %s script, got: %s", e, format, output)
+			}
+		}
+	}
+}
+
+func TestAddActionNetworkdFormat(t *testing.T) {
+	dir := testDir(t)
+	configPath := setupVPN(t, dir)
+	output := filepath.Join(dir, "laptop")
+
+	err := addAction(context.Background(), &addConfig{name: configPath, client: "laptop", format: models.FormatNetworkd, output: output})
+	if err != nil {
+		t.Fatalf("addAction failed: %v", err)
+	}
+	network, err := os.ReadFile(filepath.Join(output, "wg0.network"))
+	if err != nil {
+		t.Fatalf("failed to read network file: %v", err)
+	}
+	if !strings.Contains(string(network), "Address=10.0.0.2/24") {
+		t.Errorf("expected the client address in:\n%s", network)
+	}
+
+	err = addAction(context.Background(), &addConfig{name: configPath, client: "phone", format: models.FormatNetworkd})
+	if err == nil {
+		t.Error("expected error without output directory")
+	}
+}
+
+func TestAddActionShare(t *testing.T) {
+	dir := testDir(t)
+	configPath := setupVPN(t, dir)
+
+	output, err := captureStdout(t, func() error {
+		return addAction(context.Background(), &addConfig{
+			name:     configPath,
+			client:   "laptop",
+			share:    true,
+			shareTTL: time.Hour,
+			shareURL: "https://vpn.example.com/",
+		})
+	})
+	if err != nil {
+		t.Fatalf("addAction failed: %v", err)
+	}
+	if strings.Contains(output, "PrivateKey") {
+		t.Error("the config must not be printed with --share")
+	}
+	token, ok := strings.CutPrefix(strings.TrimSpace(output), "https://vpn.example.com/share/")
+	if !ok {
+		t.Fatalf("expected a link, got %q", output)
+	}
+	share, err := export.NewShareStore(configPath).Take(token, nil)
+	if err != nil {
+		t.Fatalf("the share is not stored: %v", err)
+	}
+	if share.Name != "laptop" || !strings.Contains(string(share.Config), "PrivateKey") {
+		t.Errorf("unexpected share: %+v", share)
+	}
+
+	invalid := map[string]*addConfig{
+		"url":       {name: configPath, client: "phone", share: true, shareTTL: time.Hour},
+		"ttl":       {name: configPath, client: "phone", share: true, shareURL: "https://vpn.example.com"},
+		"qrcode":    {name: configPath, client: "phone", share: true, shareTTL: time.Hour, shareURL: "https://vpn.example.com", qrcode: true},
+		"from-file": {name: configPath, fromFile: "clients.csv", output: dir, share: true, shareTTL: time.Hour, shareURL: "https://vpn.example.com"},
+	}
+	for name, config := range invalid {
+		if err := addAction(context.Background(), config); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	// the client is not added when the share cannot be stored
+	store := export.NewShareStore(configPath)
+	if err := os.RemoveAll(store.Dir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(store.Dir(), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	config := &addConfig{name: configPath, client: "tablet", share: true, shareTTL: time.Hour, shareURL: "https://vpn.example.com"}
+	if err := addAction(context.Background(), config); err == nil {
+		t.Error("expected an error when the share store fails")
+	}
+	vpn, _, unlock, err := loadVPN(configPath)
+	if err != nil {
+		t.Fatalf("loadVPN failed: %v", err)
+	}
+	unlock()
+	if vpn.NumberOfPeers() != 1 {
+		t.Errorf("expected laptop only, got %d peers", vpn.NumberOfPeers())
+	}
 }
@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/asiffer/wg-easy-vpn/models"
+	"github.com/asiffer/wg-easy-vpn/utils"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v3"
+)
+
+// BACKUP_SUFFIX is appended to the path of an adopted file to keep the original
+const BACKUP_SUFFIX = ".bak"
+
+var adoptCmd = cli.Command{
+	Name:                  "adopt",
+	Usage:                 "Turn an existing wg-quick server config into a wg-easy-vpn managed one",
+	EnableShellCompletion: true,
+	Suggest:               true,
+	Flags: []cli.Flag{
+		&endpointFlag,
+		&adoptNetworksFlag,
+		&routesFlag,
+		&dnsFlag,
+		&portFlag,
+	},
+	Arguments: []cli.Argument{
+		&connArg,
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		config, err := buildAdoptCmdConfig(c)
+		if err != nil {
+			return err
+		}
+		return adoptAction(ctx, config)
+	},
+}
+
+type adoptConfig struct {
+	name     string
+	endpoint string
+	networks []net.IPNet // empty = inferred from the server addresses
+	routes   []net.IPNet
+	dns      []net.IP
+	port     uint16 // used when the file has no ListenPort
+}
+
+func buildAdoptCmdConfig(c *cli.Command) (*adoptConfig, error) {
+	networks, err := utils.ParseIPNetList(c.StringSlice("networks"))
+	if err != nil {
+		return nil, err
+	}
+	routes, err := utils.ParseIPNetList(c.StringSlice("routes"))
+	if err != nil {
+		return nil, err
+	}
+	dns, err := utils.ParseIPList(c.StringSlice("dns"))
+	if err != nil {
+		return nil, err
+	}
+	cfg := &adoptConfig{
+		name:     c.StringArg(CONNECTION_ARG),
+		endpoint: c.String("endpoint"),
+		networks: networks,
+		routes:   routes,
+		dns:      dns,
+		port:     c.Uint16("port"),
+	}
+	log.Debug().
+		Str("name", cfg.name).
+		Str("endpoint", cfg.endpoint).
+		Strs("networks", utils.StringifyNetworks(cfg.networks)).
+		Strs("routes", utils.StringifyNetworks(cfg.routes)).
+		Strs("dns", utils.StringifyIPs(cfg.dns)).
+		Uint16("port", cfg.port).
+		Msg("adopt command configuration")
+	return cfg, nil
+}
+
+func adoptAction(_ context.Context, config *adoptConfig) error {
+	name, path, err := ConfigurationInfo(config.name)
+	if err != nil {
+		return err
+	}
+	log.Debug().Str("name", name).Str("path", path).Msg("Parsing connection location")
+
+	unlock, err := lockConfig(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	file, err := utils.ParseFile(path)
+	if err != nil {
+		return err
+	}
+
+	iface, err := file.GetSection("Interface")
+	if err != nil {
+		return fmt.Errorf("no Interface section in %s", path)
+	}
+	if !iface.HasKey("ListenPort") {
+		iface.Set("ListenPort", fmt.Sprintf("%d", config.port))
+		log.Warn().Uint16("port", config.port).Msg("No ListenPort in the config, setting it")
+	}
+
+	vpn, err := models.VPNFromFile(name, file)
+	if err != nil {
+		return err
+	}
+	if vpn.IsManaged() {
+		return fmt.Errorf("%s is already managed by wg-easy-vpn", path)
+	}
+	if err := vpn.Adopt(config.endpoint, config.networks, config.routes, config.dns); err != nil {
+		return err
+	}
+	vpn.Log(log.Debug()).Msg("Adopting existing vpn")
+
+	// keep the original file
+	backup := path + BACKUP_SUFFIX
+	if err := os.WriteFile(backup, raw, 0600); err != nil {
+		return err
+	}
+	log.Info().Str("path", backup).Msg("Original configuration saved")
+
+	if err := saveVPN(vpn, path); err != nil {
+		return err
+	}
+	log.Info().
+		Strs("networks", utils.StringifyNetworks(vpn.Networks())).
+		Int("peers", vpn.NumberOfPeers()).
+		Msg("Wireguard VPN adopted")
+	return nil
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/asiffer/wg-easy-vpn/crypto"
+	"github.com/asiffer/wg-easy-vpn/utils"
+)
+
+func TestAdoptAction(t *testing.T) {
+	dir := testDir(t)
+	configPath := testConfigPath(t, dir, "wg0")
+	original := "[Interface]\nAddress = 10.0.0.1/24\nPrivateKey = " + crypto.NewRandomKey().Base64() + "\n" +
+		"\n# alice\n[Peer]\nPublicKey = " + crypto.NewRandomKey().Base64() + "\nAllowedIPs = 10.0.0.2/32\n"
+	if err := os.WriteFile(configPath, []byte(original), 0600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	config := &adoptConfig{name: configPath, endpoint: "vpn.example.com", port: 51820}
+	if err := adoptAction(context.Background(), config); err != nil {
+		t.Fatalf("adoptAction failed: %v", err)
+	}
+
+	backup, err := os.ReadFile(configPath + BACKUP_SUFFIX)
+	if err != nil || string(backup) != original {
+		t.Errorf("expected the original file as backup (%v)", err)
+	}
+
+	vpn, _, unlock, err := loadVPN(configPath)
+	if err != nil {
+		t.Fatalf("loadVPN failed: %v", err)
+	}
+	unlock()
+	if !vpn.IsManaged() || vpn.NumberOfPeers() != 1 || vpn.Peers()[0].Name() != "alice" {
+		t.Errorf("expected a managed vpn with alice as peer")
+	}
+	file, _ := utils.ParseFile(configPath)
+	iface, _ := file.GetSection("Interface")
+	if port, _ := iface.Get("ListenPort"); port != "51820" {
+		t.Errorf("expected ListenPort 51820, got %q", port)
+	}
+
+	// clients can now be added
+	output, err := captureStdout(t, func() error {
+		return addAction(context.Background(), &addConfig{name: configPath, client: "bob"})
+	})
+	if err != nil {
+		t.Fatalf("addAction failed: %v", err)
+	}
+	if !strings.Contains(output, "Address = 10.0.0.3/24") {
+		t.Errorf("expected bob to get 10.0.0.3, got:\n%s", output)
+	}
+
+	// a managed file cannot be adopted twice
+	if err := adoptAction(context.Background(), config); err == nil {
+		t.Error("expected an error when adopting a managed file")
+	}
+}
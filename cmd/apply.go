@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/asiffer/wg-easy-vpn/device"
+	"github.com/asiffer/wg-easy-vpn/models"
+	"github.com/asiffer/wg-easy-vpn/utils"
+	"github.com/rs/zerolog/log"
+)
+
+// devicePeers returns the peers of the main server (gateways and clients)
+// as they are configured on its interface
+func devicePeers(vpn *models.WGVPN) []device.PeerConfig {
+	servers := vpn.Servers()
+	peers := make([]device.PeerConfig, 0, len(servers)-1+vpn.NumberOfPeers())
+	// the first server is the main one
+	for _, gw := range servers[1:] {
+		relay := vpn.Relay(gw)
+		peers = append(peers, device.PeerConfig{
+			PublicKey:    relay.Public(),
+			PresharedKey: relay.PSK(),
+			AllowedIPs:   relay.AllowedNetworks(),
+		})
+	}
+	for _, peer := range vpn.PeersOf(servers[0].Name()) {
+		peers = append(peers, device.PeerConfig{
+			PublicKey:    peer.Public(),
+			PresharedKey: peer.PSK(),
+			AllowedIPs:   peer.AllowedNetworks(),
+		})
+	}
+	return peers
+}
+
+// applyPeers pushes the difference between the before and after peers to
+// the running interface, through its UAPI socket (userspace implementations)
+// or with `wg set` (kernel module)
+func applyPeers(ctx context.Context, iface string, before []device.PeerConfig, after []device.PeerConfig) error {
+	changes := device.DiffPeers(before, after)
+	if len(changes) == 0 {
+		log.Info().Str("interface", iface).Msg("No peer change to apply")
+		return nil
+	}
+	socket := device.SocketPath(iface)
+	var err error
+	if utils.FileExists(socket) {
+		err = device.NewUAPIClient(socket).SetPeers(ctx, changes)
+	} else {
+		log.Debug().Str("socket", socket).Msg("No UAPI socket, falling back to wg set")
+		err = device.SetPeersWithTool(ctx, iface, changes)
+	}
+	if err != nil {
+		return fmt.Errorf("configuration saved but not applied to %s (%w)", iface, err)
+	}
+	log.Info().
+		Str("interface", iface).
+		Int("changes", len(changes)).
+		Msg("Peer changes applied to the running interface")
+	return nil
+}
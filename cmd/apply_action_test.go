@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/asiffer/wg-easy-vpn/device"
+)
+
+// fakeInterface serves the UAPI socket of the wg0 interface and returns
+// the set requests it receives
+func fakeInterface(t *testing.T) <-chan string {
+	t.Helper()
+	oldDir := device.SocketDir
+	device.SocketDir = t.TempDir()
+	t.Cleanup(func() { device.SocketDir = oldDir })
+
+	ln, err := net.Listen("unix", device.SocketPath("wg0"))
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	requests := make(chan string, 8)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			r := bufio.NewReader(conn)
+			var sb strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil || line == "\n" {
+					break
+				}
+				sb.WriteString(line)
+			}
+			requests <- sb.String()
+			conn.Write([]byte("errno=0\n\n"))
+			conn.Close()
+		}
+	}()
+	return requests
+}
+
+func TestApplyActions(t *testing.T) {
+	dir := testDir(t)
+	configPath := setupVPN(t, dir)
+	requests := fakeInterface(t)
+
+	// a client added without --apply is not pushed
+	if _, err := captureStdout(t, func() error {
+		return addAction(context.Background(), &addConfig{name: configPath, client: "laptop"})
+	}); err != nil {
+		t.Fatalf("addAction failed: %v", err)
+	}
+
+	if _, err := captureStdout(t, func() error {
+		return addAction(context.Background(), &addConfig{name: configPath, client: "phone", apply: true})
+	}); err != nil {
+		t.Fatalf("addAction failed: %v", err)
+	}
+	req := <-requests
+	if strings.Count(req, "public_key=") != 1 || !strings.Contains(req, "allowed_ip=10.0.0.3/32") {
+		t.Errorf("expected only the new peer to be pushed, got:\n%s", req)
+	}
+	if strings.Contains(req, "remove=true") {
+		t.Errorf("unexpected removal in:\n%s", req)
+	}
+
+	vpn, _, unlock, err := loadVPN(configPath)
+	if err != nil {
+		t.Fatalf("loadVPN failed: %v", err)
+	}
+	unlock()
+	phone := vpn.Peers()[1].Public()
+	if err := rmAction(context.Background(), &rmConfig{name: configPath, peerKey: phone, apply: true}); err != nil {
+		t.Fatalf("rmAction failed: %v", err)
+	}
+	req = <-requests
+	if strings.Count(req, "public_key=") != 1 || !strings.Contains(req, "remove=true") {
+		t.Errorf("expected the removal of the peer only, got:\n%s", req)
+	}
+}
+
+func TestApplyWithoutInterface(t *testing.T) {
+	dir := testDir(t)
+	configPath := setupVPN(t, dir)
+	oldDir := device.SocketDir
+	device.SocketDir = dir
+	defer func() { device.SocketDir = oldDir }()
+
+	_, err := captureStdout(t, func() error {
+		return addAction(context.Background(), &addConfig{name: configPath, client: "laptop", apply: true})
+	})
+	if err == nil || !strings.Contains(err.Error(), "not applied") {
+		t.Errorf("expected an apply error, got %v", err)
+	}
+	// the configuration is saved anyway
+	vpn, _, unlock, err := loadVPN(configPath)
+	if err != nil {
+		t.Fatalf("loadVPN failed: %v", err)
+	}
+	unlock()
+	if vpn.NumberOfPeers() != 1 {
+		t.Errorf("expected the client to be saved, got %d peers", vpn.NumberOfPeers())
+	}
+}
@@ -14,13 +14,14 @@ import (
 )
 
 const CONNECTION_ARG = "connection"
+const SOURCE_ARG = "file"
 const SEPARATOR = string(os.PathSeparator)
 
 var NO_COLOR bool = os.Getenv("NO_COLOR") != ""
 
 var App = cli.Command{
 	EnableShellCompletion: true,
-	Commands:              []*cli.Command{&initCmd, &addCmd, &rmCmd},
+	Commands:              []*cli.Command{&initCmd, &addCmd, &rmCmd, &gatewayCmd, &meshCmd, &statusCmd, &renderCmd, &adoptCmd, &importCmd, &exportCmd, &migrateCmd, &doctorCmd, &serveCmd, &exporterCmd, &poolCmd},
 	Suggest:               true,
 }
 
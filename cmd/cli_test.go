@@ -4,6 +4,7 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/asiffer/wg-easy-vpn/utils"
@@ -133,6 +134,57 @@ func TestCLICommands(t *testing.T) {
 		}
 	})
 
+	t.Run("client options with flags", func(t *testing.T) {
+		dir := testDir(t)
+		configPath := testConfigPath(t, dir, "wg-cli-options")
+
+		initArgs := []string{"init", "--endpoint", "vpn.example.com:51820", "--keepalive", "25", "--mtu", "1420", configPath}
+		if err := initCmd.Run(context.Background(), initArgs); err != nil {
+			t.Fatalf("CLI init failed: %v", err)
+		}
+
+		output, err := captureStdout(t, func() error {
+			return addCmd.Run(context.Background(), []string{"add", "--client", "nat", "--mtu", "1280", "--fwmark", "0xca6c", configPath})
+		})
+		if err != nil {
+			t.Fatalf("CLI add failed: %v", err)
+		}
+		for _, expected := range []string{"MTU = 1280", "FwMark = 0xca6c", "PersistentKeepalive = 25"} {
+			if !strings.Contains(output, expected) {
+				t.Errorf("expected %q in client config, got: %s", expected, output)
+			}
+		}
+
+		// the client does not use the default keepalive (remembered by the server)
+		output, err = captureStdout(t, func() error {
+			return addCmd.Run(context.Background(), []string{"add", "--client", "lan", "--unset", "keepalive", configPath})
+		})
+		if err != nil {
+			t.Fatalf("CLI add failed: %v", err)
+		}
+		if strings.Contains(output, "PersistentKeepalive") || !strings.Contains(output, "MTU = 1420") {
+			t.Errorf("expected no keepalive and the default MTU, got: %s", output)
+		}
+		content, err := os.ReadFile(configPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, expected := range []string{"# wg-easy-vpn: MTU = 1280", "# wg-easy-vpn: Unset = PersistentKeepalive"} {
+			if !strings.Contains(string(content), expected) {
+				t.Errorf("expected %q in server config, got: %s", expected, content)
+			}
+		}
+
+		err = addCmd.Run(context.Background(), []string{"add", "--client", "bad", "--table", "main", configPath})
+		if err == nil {
+			t.Error("expected error for an invalid table")
+		}
+		err = addCmd.Run(context.Background(), []string{"add", "--client", "bad", "--unset", "dns", configPath})
+		if err == nil {
+			t.Error("expected error for an unknown option")
+		}
+	})
+
 	t.Run("rm command with flags", func(t *testing.T) {
 		dir := testDir(t)
 		configPath := testConfigPath(t, dir, "wg-cli-rm")
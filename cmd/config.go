@@ -28,6 +28,13 @@ const (
 const WIREGUARD_DIR = "/etc/wireguard"
 const CONFIG_SUFFIX = ".conf"
 
+// STATE_SUFFIX is inserted before the extension of the state files
+// (wg0.wg-easy.json)
+const STATE_SUFFIX = ".wg-easy"
+
+// STATE_INI stores the state in the top section of the server file
+const STATE_INI = "ini"
+
 // var (
 // 	connName     = DefaultConnectionName
 // 	serverDir    = DefaultServerConfigDirectory
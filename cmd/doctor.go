@@ -0,0 +1,243 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/asiffer/wg-easy-vpn/models"
+	"github.com/asiffer/wg-easy-vpn/utils"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v3"
+)
+
+var doctorCmd = cli.Command{
+	Name:                  "doctor",
+	Aliases:               []string{"validate"},
+	Usage:                 "Check a Wireguard VPN config (keys, addresses, endpoint, ports, forwarding, permissions)",
+	EnableShellCompletion: true,
+	Suggest:               true,
+	Flags: []cli.Flag{
+		&jsonFlag,
+	},
+	Arguments: []cli.Argument{
+		&connArg,
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		config, err := buildDoctorCmdConfig(c)
+		if err != nil {
+			return err
+		}
+		return doctorAction(ctx, config)
+	},
+}
+
+type doctorConfig struct {
+	name string
+	json bool
+}
+
+// doctorReport is the output of the --json mode
+type doctorReport struct {
+	Path     string           `json:"path"`
+	Findings []models.Finding `json:"findings"`
+	Errors   int              `json:"errors"`
+	Warnings int              `json:"warnings"`
+}
+
+// sections of a server file
+var serverSections = []string{"Interface", "Peer", "Gateway"}
+
+// sysctl files of the ip forwarding (variables for the tests)
+var (
+	ipv4ForwardingPath = "/proc/sys/net/ipv4/ip_forward"
+	ipv6ForwardingPath = "/proc/sys/net/ipv6/conf/all/forwarding"
+)
+
+func buildDoctorCmdConfig(c *cli.Command) (*doctorConfig, error) {
+	cfg := &doctorConfig{
+		name: c.StringArg(CONNECTION_ARG),
+		json: c.Bool("json"),
+	}
+	log.Debug().
+		Str("name", cfg.name).
+		Bool("json", cfg.json).
+		Msg("Doctor command configuration")
+	return cfg, nil
+}
+
+func doctorAction(_ context.Context, config *doctorConfig) error {
+	name, path, err := ConfigurationInfo(config.name)
+	if err != nil {
+		return err
+	}
+	log.Debug().Str("name", name).Str("path", path).Msg("Parsing connection location")
+
+	// strict parsing: every invalid line is a finding
+	findings := make([]models.Finding, 0)
+	file, err := utils.ParseFileWith(path, utils.ParseOptions{Strict: true, Sections: serverSections})
+	var parseErrors utils.ParseErrors
+	if errors.As(err, &parseErrors) {
+		for _, e := range parseErrors {
+			findings = append(findings, models.Finding{
+				Severity: models.SeverityError,
+				Check:    "syntax",
+				Message:  e.Error(),
+				Hint:     "fix or remove the line",
+			})
+		}
+	} else if err != nil {
+		return err
+	}
+	if err := checkLayout(name, path, file); err != nil {
+		findings = append(findings, models.Finding{
+			Severity: models.SeverityError,
+			Check:    "layout",
+			Message:  err.Error(),
+			Hint:     fmt.Sprintf("run 'wg-easy-vpn migrate %s'", name),
+		})
+	}
+	findings = append(findings, checkPermissions(path)...)
+	if def, err := file.GetSection(utils.DEFAULT_SECTION); err == nil && def.HasKey("Gateways") {
+		gatewaysPath, _ := def.Get("Gateways")
+		findings = append(findings, checkPermissions(gatewaysPath)...)
+	}
+
+	// a state file holds the peers: diagnose the full rendering
+	if def, err := file.GetSection(utils.DEFAULT_SECTION); err == nil && def.HasKey("State") {
+		statePath, _ := def.Get("State")
+		findings = append(findings, checkPermissions(statePath)...)
+		vpn, err := models.VPNFromFile(name, file)
+		if err != nil {
+			findings = append(findings, models.Finding{
+				Severity: models.SeverityError,
+				Check:    "state",
+				Message:  err.Error(),
+				Hint:     "fix the state file (or restore its backup)",
+			})
+			return printFindings(os.Stdout, path, findings, config.json)
+		}
+		vpn.SetStatePath("")
+		file = utils.NewFile()
+		vpn.Populate(file)
+	}
+
+	host := models.HostState{
+		IPv4Forwarding: readSysctlBool(ipv4ForwardingPath),
+		IPv6Forwarding: readSysctlBool(ipv6ForwardingPath),
+	}
+	findings = append(findings, models.Diagnose(file, host)...)
+	findings = append(findings, checkPortCollisions(path, file)...)
+	return printFindings(os.Stdout, path, findings, config.json)
+}
+
+// checkPermissions reports files readable by others than their owner
+// (they contain private keys)
+func checkPermissions(path string) []models.Finding {
+	info, err := os.Stat(path)
+	if err != nil {
+		return []models.Finding{{
+			Severity: models.SeverityError,
+			Check:    "permissions",
+			Message:  fmt.Sprintf("cannot stat %s (%v)", path, err),
+			Hint:     "check that the file exists",
+		}}
+	}
+	if perm := info.Mode().Perm(); perm&0077 != 0 {
+		return []models.Finding{{
+			Severity: models.SeverityError,
+			Check:    "permissions",
+			Message:  fmt.Sprintf("%s has the permissions %#o (it contains private keys)", path, perm),
+			Hint:     fmt.Sprintf("chmod 600 %s", path),
+		}}
+	}
+	return nil
+}
+
+// checkPortCollisions reports the other configs of the directory listening
+// on the same port
+func checkPortCollisions(path string, file *utils.File) []models.Finding {
+	iface, err := file.GetSection("Interface")
+	if err != nil || !iface.HasKey("ListenPort") {
+		return nil
+	}
+	port, err := iface.GetUint16("ListenPort")
+	if err != nil {
+		return []models.Finding{{
+			Severity: models.SeverityError,
+			Check:    "port",
+			Message:  fmt.Sprintf("invalid ListenPort (%v)", err),
+			Hint:     "set a port between 1 and 65535",
+		}}
+	}
+	findings := make([]models.Finding, 0)
+	others, _ := filepath.Glob(filepath.Join(filepath.Dir(path), "*"+CONFIG_SUFFIX))
+	for _, other := range others {
+		if filepath.Clean(other) == filepath.Clean(path) {
+			continue
+		}
+		f, err := utils.ParseFile(other)
+		if err != nil {
+			continue
+		}
+		sec, err := f.GetSection("Interface")
+		if err != nil {
+			continue
+		}
+		if p, err := sec.GetUint16("ListenPort"); err == nil && p == port {
+			findings = append(findings, models.Finding{
+				Severity: models.SeverityError,
+				Check:    "port",
+				Message:  fmt.Sprintf("%s listens on the port %d too", other, port),
+				Hint:     "change the ListenPort of one of the configs (and the endpoint of its clients)",
+			})
+		}
+	}
+	return findings
+}
+
+// readSysctlBool reads a 0/1 sysctl file (nil if unavailable)
+func readSysctlBool(path string) *bool {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		log.Debug().Err(err).Str("path", path).Msg("Skipping the forwarding check")
+		return nil
+	}
+	enabled := strings.TrimSpace(string(raw)) != "0"
+	return &enabled
+}
+
+// printFindings writes the findings (text or json) and fails if one of
+// them is an error
+func printFindings(w io.Writer, path string, findings []models.Finding, asJSON bool) error {
+	report := doctorReport{Path: path, Findings: findings}
+	for _, finding := range findings {
+		if finding.Severity == models.SeverityError {
+			report.Errors++
+		} else {
+			report.Warnings++
+		}
+	}
+	if asJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		for _, finding := range findings {
+			fmt.Fprintf(w, "[%s] %s: %s\n", finding.Severity, finding.Check, finding.Message)
+			fmt.Fprintf(w, "    fix: %s\n", finding.Hint)
+		}
+		fmt.Fprintf(w, "%s: %d error(s), %d warning(s)\n", path, report.Errors, report.Warnings)
+	}
+	if report.Errors > 0 {
+		return fmt.Errorf("%d error(s) found", report.Errors)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/asiffer/wg-easy-vpn/models"
+)
+
+// withForwarding fakes the sysctl files of the ip forwarding
+func withForwarding(t *testing.T, dir string, value string) {
+	t.Helper()
+	old4, old6 := ipv4ForwardingPath, ipv6ForwardingPath
+	ipv4ForwardingPath = filepath.Join(dir, "ip_forward")
+	ipv6ForwardingPath = filepath.Join(dir, "forwarding")
+	for _, path := range []string{ipv4ForwardingPath, ipv6ForwardingPath} {
+		if err := os.WriteFile(path, []byte(value+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() {
+		ipv4ForwardingPath, ipv6ForwardingPath = old4, old6
+	})
+}
+
+func TestDoctorActionHealthy(t *testing.T) {
+	dir := testDir(t)
+	withForwarding(t, dir, "1")
+	configPath := setupVPN(t, dir)
+
+	out, err := captureStdout(t, func() error {
+		return doctorAction(context.Background(), &doctorConfig{name: configPath})
+	})
+	if err != nil {
+		t.Fatalf("doctorAction failed: %v\n%s", err, out)
+	}
+	if !strings.Contains(out, "0 error(s), 0 warning(s)") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+}
+
+func TestDoctorActionJSON(t *testing.T) {
+	dir := testDir(t)
+	withForwarding(t, dir, "0")
+	configPath := setupVPN(t, dir)
+	if err := os.Chmod(configPath, 0644); err != nil {
+		t.Fatal(err)
+	}
+	// another config on the same port
+	other := "[Interface]\nPrivateKey = djmXza7K0dVhLOihJQwvz8xxpI7JfJlWK+8TLqlBK+o=\nListenPort = 51820\n"
+	if err := os.WriteFile(filepath.Join(dir, "wg1.conf"), []byte(other), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := captureStdout(t, func() error {
+		return doctorAction(context.Background(), &doctorConfig{name: configPath, json: true})
+	})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	report := doctorReport{}
+	if err := json.Unmarshal([]byte(out), &report); err != nil {
+		t.Fatalf("invalid json output (%v):\n%s", err, out)
+	}
+	checks := make(map[string]string)
+	for _, finding := range report.Findings {
+		checks[finding.Check] = finding.Severity
+	}
+	expected := map[string]string{
+		"permissions": models.SeverityError,
+		"port":        models.SeverityError,
+		"forwarding":  models.SeverityWarning,
+	}
+	for check, severity := range expected {
+		if checks[check] != severity {
+			t.Errorf("expected a %s %s finding, got %+v", check, severity, report.Findings)
+		}
+	}
+	if report.Errors != 2 || report.Warnings != 1 {
+		t.Errorf("expected 2 errors and 1 warning, got %d and %d", report.Errors, report.Warnings)
+	}
+}
+
+func TestDoctorActionState(t *testing.T) {
+	dir := testDir(t)
+	withForwarding(t, dir, "1")
+	configPath := testConfigPath(t, dir, "wg0")
+	initCfg := &initConfig{
+		endpoint: "vpn.example.com:51820",
+		networks: []net.IPNet{{IP: net.ParseIP("10.0.0.0"), Mask: net.CIDRMask(24, 32)}},
+		port:     51820,
+		conn:     configPath,
+		state:    "json",
+	}
+	if err := initAction(context.Background(), initCfg); err != nil {
+		t.Fatal(err)
+	}
+	_, err := captureStdout(t, func() error {
+		return addAction(context.Background(), &addConfig{name: configPath, client: "laptop"})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := captureStdout(t, func() error {
+		return doctorAction(context.Background(), &doctorConfig{name: configPath})
+	})
+	if err != nil {
+		t.Fatalf("doctorAction failed: %v\n%s", err, out)
+	}
+}
+
+func TestDoctorActionSyntax(t *testing.T) {
+	dir := testDir(t)
+	withForwarding(t, dir, "1")
+	configPath := setupVPN(t, dir)
+	f, err := os.OpenFile(configPath, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("[Unknown]\ngarbage\n")
+	f.Close()
+
+	out, err := captureStdout(t, func() error {
+		return doctorAction(context.Background(), &doctorConfig{name: configPath, json: true})
+	})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	report := doctorReport{}
+	if err := json.Unmarshal([]byte(out), &report); err != nil {
+		t.Fatalf("invalid json output (%v):\n%s", err, out)
+	}
+	if report.Errors != 2 {
+		t.Errorf("expected 2 syntax errors, got %+v", report.Findings)
+	}
+	for _, finding := range report.Findings {
+		if finding.Check != "syntax" || !strings.HasPrefix(finding.Message, configPath+":") {
+			t.Errorf("unexpected finding %+v", finding)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/asiffer/wg-easy-vpn/export"
+	"github.com/asiffer/wg-easy-vpn/models"
+	"github.com/asiffer/wg-easy-vpn/utils"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v3"
+)
+
+// BUNDLE_README is the name of the README inside a bundle
+const BUNDLE_README = "README.txt"
+
+var exportCmd = cli.Command{
+	Name:                  "export",
+	Usage:                 "Bundle the config of a client (with its qrcode and a README) into an archive",
+	EnableShellCompletion: true,
+	Suggest:               true,
+	Flags: []cli.Flag{
+		&exportClientFlag,
+		&bundleFlag,
+		&rotateFlag,
+		&applyFlag,
+	},
+	Arguments: []cli.Argument{
+		&connArg,
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		config, err := buildExportCmdConfig(c)
+		if err != nil {
+			return err
+		}
+		return exportAction(ctx, config)
+	},
+}
+
+type exportConfig struct {
+	name   string
+	client string
+	bundle string // path of the archive
+	rotate bool   // generate new keys (the config is complete)
+	apply  bool   // push the new keys to the running interface
+}
+
+func buildExportCmdConfig(c *cli.Command) (*exportConfig, error) {
+	cfg := &exportConfig{
+		name:   c.StringArg(CONNECTION_ARG),
+		client: c.String("client"),
+		bundle: c.String("bundle"),
+		rotate: c.Bool("rotate"),
+		apply:  c.Bool("apply"),
+	}
+	log.Debug().
+		Str("name", cfg.name).
+		Str("client", cfg.client).
+		Str("bundle", cfg.bundle).
+		Bool("rotate", cfg.rotate).
+		Bool("apply", cfg.apply).
+		Msg("export command configuration")
+	return cfg, nil
+}
+
+// exportAction bundles the config of a client as it was added. The server
+// does not keep the private key of the client: the config has none unless
+// new keys are generated (rotate).
+func exportAction(ctx context.Context, config *exportConfig) error {
+	if config.apply && !config.rotate {
+		return fmt.Errorf("--apply requires --rotate (nothing changes otherwise)")
+	}
+	format, err := export.BundleFormat(config.bundle)
+	if err != nil {
+		return err
+	}
+	vpn, path, unlock, err := loadVPN(config.name)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	name, _, err := ConfigurationInfo(config.name)
+	if err != nil {
+		return err
+	}
+
+	before := devicePeers(vpn)
+	var client *models.WGClient
+	if config.rotate {
+		if client, err = vpn.ReissueClient(config.client); err != nil {
+			return err
+		}
+		log.Info().
+			Str("client", config.client).
+			Str("public_key", client.ToPeer().Public()).
+			Msg("New keys generated for the client")
+		// the new keys are useless if they are not saved
+		if err := saveVPN(vpn, path); err != nil {
+			return err
+		}
+	} else if client, err = vpn.Client(config.client); err != nil {
+		return err
+	}
+	if subnets := client.Subnets(); len(subnets) > 0 {
+		// the hooks of add are not kept by the server
+		postUp, postDown := generateSubnetHooks(vpn.Networks(), subnets)
+		client.SetPostHooks(postUp, postDown)
+	}
+
+	files, err := bundleFiles(vpn, client, name)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := export.WriteBundle(&buf, format, files); err != nil {
+		return err
+	}
+	if err := os.WriteFile(config.bundle, buf.Bytes(), 0600); err != nil {
+		return err
+	}
+	log.Info().Str("client", config.client).Str("bundle", config.bundle).Msg("Client bundle written")
+
+	if config.apply {
+		return applyPeers(ctx, name, before, devicePeers(vpn))
+	}
+	return nil
+}
+
+// bundleFiles returns the files of the bundle of a client: its config and
+// its qrcode (named after the connection, only if the config is complete)
+// and a README
+func bundleFiles(vpn *models.WGVPN, client *models.WGClient, conn string) ([]export.BundleFile, error) {
+	file := utils.NewFile()
+	file.GetorCreateSection(utils.DEFAULT_SECTION).AddComment(client.Name())
+	if err := client.PopulateClientGateway(file, vpn); err != nil {
+		return nil, err
+	}
+
+	files := []export.BundleFile{
+		{Name: conn + CONFIG_SUFFIX, Content: []byte(file.String())},
+	}
+	// a config without private key cannot be scanned as is
+	if client.HasPrivateKey() {
+		var png bytes.Buffer
+		if err := file.WriteQRCodePNGTo(&png); err != nil {
+			return nil, err
+		}
+		files = append(files, export.BundleFile{Name: conn + "." + DefaultQRCodeFormat, Content: png.Bytes()})
+	}
+	return append(files, export.BundleFile{Name: BUNDLE_README, Content: []byte(bundleReadme(vpn, client, conn))}), nil
+}
+
+func bundleReadme(vpn *models.WGVPN, client *models.WGClient, conn string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Wireguard VPN %s\n\n", conn)
+	fmt.Fprintf(&sb, "Client:   %s\n", client.Name())
+	fmt.Fprintf(&sb, "Endpoint: %s\n", vpn.Endpoint())
+	fmt.Fprintf(&sb, "Address:  %s\n\n", client.Address())
+	if !client.HasPrivateKey() {
+		fmt.Fprintf(&sb, "The server does not know the private key of the client: set PrivateKey in %s%s\n", conn, CONFIG_SUFFIX)
+		sb.WriteString("with the key of the device (or export the client with --rotate to get new keys).\n\n")
+	}
+	fmt.Fprintf(&sb, "Linux: copy %s%s to /etc/wireguard/ and run `wg-quick up %s`.\n", conn, CONFIG_SUFFIX, conn)
+	if client.HasPrivateKey() {
+		fmt.Fprintf(&sb, "Mobile: scan %s.%s with the Wireguard app.\n", conn, DefaultQRCodeFormat)
+	}
+	fmt.Fprintf(&sb, "Desktop: import %s%s in the Wireguard app.\n", conn, CONFIG_SUFFIX)
+	if client.HasPrivateKey() {
+		sb.WriteString("\nThe config contains a private key: do not share it.\n")
+	}
+	return sb.String()
+}
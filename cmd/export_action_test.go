@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"archive/zip"
+	"context"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/asiffer/wg-easy-vpn/models"
+)
+
+func TestExportAction(t *testing.T) {
+	dir := testDir(t)
+	configPath := setupVPN(t, dir)
+	_, err := captureStdout(t, func() error {
+		return addAction(context.Background(), &addConfig{
+			name:     configPath,
+			client:   "alice",
+			dns:      []net.IP{net.ParseIP("9.9.9.9")},
+			routes:   []net.IPNet{{IP: net.ParseIP("0.0.0.0").To4(), Mask: net.CIDRMask(0, 32)}},
+			excludes: []net.IPNet{{IP: net.ParseIP("192.168.1.0").To4(), Mask: net.CIDRMask(24, 32)}},
+		})
+	})
+	if err != nil {
+		t.Fatalf("addAction failed: %v", err)
+	}
+	vpn, _, unlock, err := loadVPN(configPath)
+	if err != nil {
+		t.Fatalf("loadVPN failed: %v", err)
+	}
+	unlock()
+	old := vpn.Peers()[0].Public()
+
+	// the config as it was added, without private key (nothing changes)
+	bundle := filepath.Join(dir, "alice.zip")
+	err = exportAction(context.Background(), &exportConfig{name: configPath, client: "alice", bundle: bundle})
+	if err != nil {
+		t.Fatalf("exportAction failed: %v", err)
+	}
+	files := readBundle(t, bundle)
+	if _, ok := files["wg0.png"]; ok {
+		t.Error("expected no qrcode without private key")
+	}
+	conf := files["wg0.conf"]
+	if strings.Contains(conf, "PrivateKey =") || !strings.Contains(conf, "DNS = 9.9.9.9") || strings.Contains(conf, "192.168.1.0/24") || !strings.Contains(conf, "AllowedIPs = ") {
+		t.Errorf("unexpected client config: %s", conf)
+	}
+	if readme := files[BUNDLE_README]; !strings.Contains(readme, "--rotate") {
+		t.Errorf("expected the README to explain the missing key, got: %s", readme)
+	}
+	if reloadVPN(t, configPath).Peers()[0].Public() != old {
+		t.Errorf("expected the keys of alice to be kept")
+	}
+	if err := exportAction(context.Background(), &exportConfig{name: configPath, client: "alice", bundle: bundle, apply: true}); err == nil {
+		t.Error("expected error with --apply but without --rotate")
+	}
+
+	// new keys, same settings
+	err = exportAction(context.Background(), &exportConfig{name: configPath, client: "alice", bundle: bundle, rotate: true})
+	if err != nil {
+		t.Fatalf("exportAction failed: %v", err)
+	}
+	files = readBundle(t, bundle)
+	for _, name := range []string{"wg0.conf", "wg0.png", BUNDLE_README} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("expected %s in the bundle", name)
+		}
+	}
+	conf = files["wg0.conf"]
+	if !strings.Contains(conf, "PrivateKey =") || !strings.Contains(conf, "Address = 10.0.0.2/24") || !strings.Contains(conf, "DNS = 9.9.9.9") {
+		t.Errorf("unexpected client config: %s", conf)
+	}
+	readme := files[BUNDLE_README]
+	if !strings.Contains(readme, "vpn.example.com:51820") || !strings.Contains(readme, "10.0.0.2/24") {
+		t.Errorf("expected endpoint and address in the README, got: %s", readme)
+	}
+
+	// the server knows the new keys
+	vpn = reloadVPN(t, configPath)
+	if peers := vpn.Peers(); len(peers) != 1 || peers[0].Name() != "alice" || peers[0].Public() == old {
+		t.Errorf("expected alice with new keys")
+	}
+	if client, err := vpn.Client("alice"); err != nil || client.DNS() != "9.9.9.9" || len(client.Subnets()) != 0 {
+		t.Errorf("expected the settings of alice to be kept, got %v (%v)", client, err)
+	}
+
+	t.Run("fails on unknown client", func(t *testing.T) {
+		err := exportAction(context.Background(), &exportConfig{name: configPath, client: "bob", bundle: filepath.Join(dir, "bob.zip")})
+		if err == nil {
+			t.Error("expected error for an unknown client")
+		}
+	})
+}
+
+// readBundle returns the files of a zip bundle
+func readBundle(t *testing.T, bundle string) map[string]string {
+	t.Helper()
+	archive, err := zip.OpenReader(bundle)
+	if err != nil {
+		t.Fatalf("invalid bundle: %v", err)
+	}
+	defer archive.Close()
+	files := make(map[string]string)
+	for _, f := range archive.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatalf("failed to open %s: %v", f.Name, err)
+		}
+		content, _ := io.ReadAll(r)
+		r.Close()
+		files[f.Name] = string(content)
+	}
+	return files
+}
+
+// reloadVPN reads the vpn of a config (unlocked)
+func reloadVPN(t *testing.T, configPath string) *models.WGVPN {
+	t.Helper()
+	vpn, _, unlock, err := loadVPN(configPath)
+	if err != nil {
+		t.Fatalf("loadVPN failed: %v", err)
+	}
+	unlock()
+	return vpn
+}
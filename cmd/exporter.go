@@ -0,0 +1,221 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/asiffer/wg-easy-vpn/device"
+	"github.com/asiffer/wg-easy-vpn/models"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v3"
+)
+
+var exporterCmd = cli.Command{
+	Name:                  "exporter",
+	Usage:                 "Expose the metrics of a running Wireguard VPN to Prometheus",
+	EnableShellCompletion: true,
+	Suggest:               true,
+	Flags: []cli.Flag{
+		&exporterListenFlag,
+		&dumpFlag,
+	},
+	Arguments: []cli.Argument{
+		&connArg,
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		config, err := buildExporterCmdConfig(c)
+		if err != nil {
+			return err
+		}
+		return exporterAction(ctx, config)
+	},
+}
+
+type exporterConfig struct {
+	name   string
+	listen string
+	dump   string // file with the output of `wg show <iface> dump` (empty = kernel)
+}
+
+// METRICS_PATH is the path of the metrics (Prometheus default)
+const METRICS_PATH = "/metrics"
+
+// METRICS_PREFIX is the prefix of the names of the metrics
+const METRICS_PREFIX = "wg_easy_vpn_"
+
+func buildExporterCmdConfig(c *cli.Command) (*exporterConfig, error) {
+	cfg := &exporterConfig{
+		name:   c.StringArg(CONNECTION_ARG),
+		listen: c.String("listen"),
+		dump:   c.String("dump"),
+	}
+	log.Debug().
+		Str("name", cfg.name).
+		Str("listen", cfg.listen).
+		Str("dump", cfg.dump).
+		Msg("Exporter command configuration")
+	return cfg, nil
+}
+
+func exporterAction(ctx context.Context, config *exporterConfig) error {
+	// fail early on an unusable config
+	_, _, unlock, err := loadVPN(config.name)
+	if err != nil {
+		return err
+	}
+	unlock()
+	listener, err := net.Listen("tcp", config.listen)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+METRICS_PATH, func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		if err := scrape(r.Context(), &buf, config); err != nil {
+			log.Error().Err(err).Msg("Error while collecting the metrics")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Write(buf.Bytes())
+	})
+	httpServer := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	// stop gracefully on ctrl-c or systemctl stop
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	done := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), SHUTDOWN_TIMEOUT)
+		defer cancel()
+		done <- httpServer.Shutdown(shutdownCtx)
+	}()
+	log.Info().Str("address", listener.Addr().String()).Str("path", METRICS_PATH).Msg("Serving the metrics")
+	if err := httpServer.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return <-done
+}
+
+// scrape reads the config and the device (both may change between two
+// scrapes) and writes their metrics. The config metrics are kept when the
+// device cannot be read (wg_easy_vpn_up is 0).
+func scrape(ctx context.Context, w io.Writer, config *exporterConfig) error {
+	vpn, _, unlock, err := loadVPN(config.name)
+	if err != nil {
+		return err
+	}
+	unlock()
+	iface, _, err := ConfigurationInfo(config.name)
+	if err != nil {
+		return err
+	}
+	dev, err := readDevice(ctx, iface, config.dump)
+	if err != nil {
+		log.Warn().Err(err).Str("interface", iface).Msg("Error while reading the device")
+		dev = nil
+	}
+	return writeMetrics(w, iface, vpn, dev)
+}
+
+// metric is a metric in the Prometheus text format
+type metric struct {
+	name    string
+	help    string
+	kind    string // gauge or counter
+	samples []sample
+}
+
+type sample struct {
+	labels []string // name, value pairs
+	value  float64
+}
+
+// writeMetrics writes the metrics of the vpn and of its device (nil if it
+// is down). The peers of the device are named after the config.
+func writeMetrics(w io.Writer, iface string, vpn *models.WGVPN, dev *device.Device) error {
+	up := metric{name: "up", help: "Whether the device could be read", kind: "gauge"}
+	peers := metric{name: "peers", help: "Number of clients in the config", kind: "gauge"}
+	free := metric{name: "pool_free_addresses", help: "Addresses left for the new clients in each network", kind: "gauge"}
+	handshake := metric{name: "peer_last_handshake_seconds", help: "Unix time of the latest handshake of the peer (0 = never)", kind: "gauge"}
+	rx := metric{name: "peer_receive_bytes_total", help: "Bytes received from the peer", kind: "counter"}
+	tx := metric{name: "peer_transmit_bytes_total", help: "Bytes sent to the peer", kind: "counter"}
+	allowed := metric{name: "peer_allowed_ips", help: "Number of allowed IPs of the peer", kind: "gauge"}
+
+	peers.samples = []sample{{labels: []string{"interface", iface}, value: float64(vpn.NumberOfPeers())}}
+	for _, pool := range vpn.Pools() {
+		free.samples = append(free.samples, sample{
+			labels: []string{"interface", iface, "network", pool.Network.String()},
+			value:  float64(pool.Free()),
+		})
+	}
+	up.samples = []sample{{labels: []string{"interface", iface}, value: 0}}
+	if dev != nil {
+		up.samples[0].value = 1
+		names := make(map[string]string)
+		for _, gw := range vpn.Servers() {
+			names[gw.ToRelay().Public()] = gw.Name()
+		}
+		for _, peer := range vpn.Peers() {
+			names[peer.Public()] = peer.Name()
+		}
+		for _, p := range dev.Peers {
+			name, ok := names[p.PublicKey]
+			if !ok {
+				name = unknownPeer
+			}
+			labels := []string{"interface", iface, "name", name, "public_key", p.PublicKey}
+			last := 0.0
+			if !p.LatestHandshake.IsZero() {
+				last = float64(p.LatestHandshake.Unix())
+			}
+			handshake.samples = append(handshake.samples, sample{labels: labels, value: last})
+			rx.samples = append(rx.samples, sample{labels: labels, value: float64(p.ReceiveBytes)})
+			tx.samples = append(tx.samples, sample{labels: labels, value: float64(p.TransmitBytes)})
+			allowed.samples = append(allowed.samples, sample{labels: labels, value: float64(len(p.AllowedIPs))})
+		}
+	}
+
+	for _, m := range []metric{up, peers, free, handshake, rx, tx, allowed} {
+		if err := m.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *metric) write(w io.Writer) error {
+	name := METRICS_PREFIX + m.name
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, m.help, name, m.kind); err != nil {
+		return err
+	}
+	for _, s := range m.samples {
+		labels := make([]string, 0, len(s.labels)/2)
+		for i := 0; i+1 < len(s.labels); i += 2 {
+			labels = append(labels, fmt.Sprintf("%s=\"%s\"", s.labels[i], labelEscaper.Replace(s.labels[i+1])))
+		}
+		value := strconv.FormatFloat(s.value, 'f', -1, 64)
+		if _, err := fmt.Fprintf(w, "%s{%s} %s\n", name, strings.Join(labels, ","), value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// labelEscaper escapes the values of the labels
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExporterMetrics(t *testing.T) {
+	dir := testDir(t)
+	configPath := setupVPN(t, dir)
+	for _, client := range []string{"laptop", "phone"} {
+		_, err := captureStdout(t, func() error {
+			return addAction(context.Background(), &addConfig{name: configPath, client: client})
+		})
+		if err != nil {
+			t.Fatalf("addAction failed: %v", err)
+		}
+	}
+	vpn, _, unlock, err := loadVPN(configPath)
+	if err != nil {
+		t.Fatalf("loadVPN failed: %v", err)
+	}
+	unlock()
+	laptop := vpn.Peers()[0].Public()
+
+	// laptop is connected, phone is not on the device and a stale peer
+	// remains on the device
+	server := vpn.Servers()[0].ToRelay().Public()
+	handshake := time.Now().Add(-10 * time.Second).Unix()
+	stale := "JVzBpb4Tl6bA4iyEeTYfVbJ12fyH5Pgm29X/2F5I1yU="
+	dump := fmt.Sprintf("priv\t%s\t51820\toff\n", server) +
+		fmt.Sprintf("%s\t(none)\t203.0.113.7:41952\t10.0.0.2/32,192.168.1.0/24\t%d\t2048\t1024\toff\n", laptop, handshake) +
+		stale + "\t(none)\t(none)\t10.0.0.9/32\t0\t0\t0\toff\n"
+	dumpPath := filepath.Join(dir, "wg0.dump")
+	if err := os.WriteFile(dumpPath, []byte(dump), 0600); err != nil {
+		t.Fatalf("failed to write dump: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := scrape(context.Background(), &buf, &exporterConfig{name: configPath, dump: dumpPath}); err != nil {
+		t.Fatalf("scrape failed: %v", err)
+	}
+	output := buf.String()
+	expected := []string{
+		"# TYPE wg_easy_vpn_up gauge",
+		`wg_easy_vpn_up{interface="wg0"} 1`,
+		`wg_easy_vpn_peers{interface="wg0"} 2`,
+		// 256 - network address - server - 2 clients
+		`wg_easy_vpn_pool_free_addresses{interface="wg0",network="10.0.0.0/24"} 252`,
+		fmt.Sprintf(`wg_easy_vpn_peer_last_handshake_seconds{interface="wg0",name="laptop",public_key="%s"} %d`, laptop, handshake),
+		"# TYPE wg_easy_vpn_peer_receive_bytes_total counter",
+		fmt.Sprintf(`wg_easy_vpn_peer_receive_bytes_total{interface="wg0",name="laptop",public_key="%s"} 2048`, laptop),
+		fmt.Sprintf(`wg_easy_vpn_peer_transmit_bytes_total{interface="wg0",name="laptop",public_key="%s"} 1024`, laptop),
+		fmt.Sprintf(`wg_easy_vpn_peer_allowed_ips{interface="wg0",name="laptop",public_key="%s"} 2`, laptop),
+		fmt.Sprintf(`wg_easy_vpn_peer_last_handshake_seconds{interface="wg0",name="(unknown)",public_key="%s"} 0`, stale),
+	}
+	for _, e := range expected {
+		if !strings.Contains(output, e+"\n") {
+			t.Errorf("expected %q in the metrics:\n%s", e, output)
+		}
+	}
+	if strings.Contains(output, `name="phone"`) {
+		t.Error("the peers which are not on the device have no metrics")
+	}
+
+	// the config metrics are kept when the device is down
+	buf.Reset()
+	missing := filepath.Join(dir, "missing.dump")
+	if err := scrape(context.Background(), &buf, &exporterConfig{name: configPath, dump: missing}); err != nil {
+		t.Fatalf("scrape failed: %v", err)
+	}
+	for _, e := range []string{`wg_easy_vpn_up{interface="wg0"} 0`, `wg_easy_vpn_peers{interface="wg0"} 2`} {
+		if !strings.Contains(buf.String(), e+"\n") {
+			t.Errorf("expected %q in the metrics:\n%s", e, buf.String())
+		}
+	}
+}
+
+func TestMetricLabelEscaping(t *testing.T) {
+	var buf bytes.Buffer
+	m := metric{name: "test", help: "Test", kind: "gauge", samples: []sample{
+		{labels: []string{"name", "a\"b\\c\nd"}, value: 1.5},
+	}}
+	if err := m.write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `wg_easy_vpn_test{name="a\"b\\c\nd"} 1.5`) {
+		t.Errorf("unexpected output: %s", buf.String())
+	}
+}
+
+func TestExporterAction(t *testing.T) {
+	dir := testDir(t)
+	configPath := setupVPN(t, dir)
+
+	if err := exporterAction(context.Background(), &exporterConfig{name: filepath.Join(dir, "missing.conf"), listen: "127.0.0.1:0"}); err == nil {
+		t.Error("expected an error for a missing config")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := exporterAction(ctx, &exporterConfig{name: configPath, listen: "127.0.0.1:0"}); err != nil {
+		t.Errorf("exporterAction failed: %v", err)
+	}
+}
@@ -1,6 +1,18 @@
 package cmd
 
-import "github.com/urfave/cli/v3"
+import (
+	"fmt"
+	"time"
+
+	"github.com/asiffer/wg-easy-vpn/models"
+	"github.com/urfave/cli/v3"
+)
+
+var sourceArg = cli.StringArg{
+	Name:      SOURCE_ARG,
+	UsageText: "File to import (ex: wg0.json)",
+	Config:    cli.StringConfig{TrimSpace: true},
+}
 
 var connArg = cli.StringArg{
 	Name:      CONNECTION_ARG,
@@ -20,6 +32,11 @@ var endpointFlag = cli.StringFlag{
 	Required: true,
 }
 
+var fallbackEndpointFlag = cli.StringFlag{
+	Name:  "endpoint",
+	Usage: "Public endpoint of the Wireguard server when the legacy metadata have none",
+}
+
 var portFlag = cli.Uint16Flag{
 	Name:  "port",
 	Usage: "UDP port the Wireguard server will listen on",
@@ -33,6 +50,20 @@ var networksFlag = cli.StringSliceFlag{
 	Value:   []string{"10.8.0.0/24"},
 }
 
+var adoptNetworksFlag = cli.StringSliceFlag{
+	Name:    "networks",
+	Aliases: []string{"n"},
+	Usage:   "VPN networks (default to the networks of the Interface addresses)",
+	Value:   nil,
+}
+
+var importNetworksFlag = cli.StringSliceFlag{
+	Name:    "networks",
+	Aliases: []string{"n"},
+	Usage:   "VPN networks (default to the /24 of the wg-easy server address)",
+	Value:   nil,
+}
+
 var routesFlag = cli.StringSliceFlag{
 	Name:    "routes",
 	Aliases: []string{"r"},
@@ -40,6 +71,12 @@ var routesFlag = cli.StringSliceFlag{
 	Value:   []string{"0.0.0.0/0", "::/0"},
 }
 
+var excludeRoutesFlag = cli.StringSliceFlag{
+	Name:  "exclude-routes",
+	Usage: "Networks removed from the tunneled routes (ex: 192.168.0.0/16 for your LAN)",
+	Value: nil,
+}
+
 var dnsFlag = cli.StringSliceFlag{
 	Name:  "dns",
 	Usage: "DNS servers for the VPN clients",
@@ -62,12 +99,282 @@ var peerFlag = cli.StringFlag{
 var clientFlag = cli.StringFlag{
 	Name:     "client",
 	Aliases:  []string{"c"},
-	Usage:    "New client to add to the VPN",
+	Usage:    "New client to add to the VPN (required unless --from-file)",
+	Required: false,
+}
+
+var fromFileFlag = cli.StringFlag{
+	Name:  "from-file",
+	Usage: "Add all the clients of a CSV or YAML file (name, ip, dns, routes, public_key) at once",
+	Value: "",
+}
+
+var exportClientFlag = cli.StringFlag{
+	Name:     "client",
+	Aliases:  []string{"c"},
+	Usage:    "Client to export",
+	Required: true,
+}
+
+var rotateFlag = cli.BoolFlag{
+	Name:  "rotate",
+	Usage: "Generate new keys for the client (its previous config stops working)",
+	Value: false,
+}
+
+var bundleFlag = cli.StringFlag{
+	Name:     "bundle",
+	Aliases:  []string{"b"},
+	Usage:    "Archive of the client config, its qrcode and a README (.zip, .tar, .tar.gz or .tgz)",
+	Required: true,
+}
+
+var subnetFlag = cli.StringSliceFlag{
+	Name:  "subnet",
+	Usage: "Network routed behind the client (site-to-site, ex: 192.168.50.0/24)",
+	Value: nil,
+}
+
+var tagFlag = cli.StringSliceFlag{
+	Name:  "tag",
+	Usage: "Label of the client (kept in the state file, see init --state)",
+	Value: nil,
+}
+
+var stateFlag = cli.StringFlag{
+	Name:  "state",
+	Usage: "Store the vpn state in a structured file next to the server file: json or yaml (empty = in the server file)",
+	Value: "",
+}
+
+var convertStateFlag = cli.StringFlag{
+	Name:  "state",
+	Usage: "Move the vpn state to a structured file next to the server file (json or yaml) or back into the server file (ini)",
+	Value: "",
+}
+
+var advertiseFlag = cli.BoolFlag{
+	Name:  "advertise",
+	Usage: "Add the client subnets to the routes of the other clients",
+	Value: false,
+}
+
+var nodeFlag = cli.StringFlag{
+	Name:     "node",
+	Usage:    "Node to add/remove from the mesh",
+	Required: true,
+}
+
+var nodeEndpointFlag = cli.StringFlag{
+	Name:  "endpoint",
+	Usage: "Public endpoint (IP or domain) of the node, empty if it is not reachable (ex: node1.example.com)",
+	Value: "",
+}
+
+var outputFlag = cli.StringFlag{
+	Name:    "output",
+	Aliases: []string{"o"},
+	Usage:   "Output directory of the generated configs",
+	Value:   "",
+}
+
+var applyFlag = cli.BoolFlag{
+	Name:  "apply",
+	Usage: "Push the peer changes to the running interface (the other sessions are kept)",
+	Value: false,
+}
+
+var dumpFlag = cli.StringFlag{
+	Name:  "dump",
+	Usage: "Read the device state from a `wg show <iface> dump` output instead of the kernel (- for stdin)",
+	Value: "",
+}
+
+var gatewayFlag = cli.StringFlag{
+	Name:    "gateway",
+	Aliases: []string{"g"},
+	Usage:   "Gateway the client connects to (default to the main server, named after the connection)",
+	Value:   "",
+}
+
+var allGatewaysFlag = cli.BoolFlag{
+	Name:  "all-gateways",
+	Usage: "Connect the client to all the gateways (the routes are split between them)",
+	Value: false,
+}
+
+var gatewayNameFlag = cli.StringFlag{
+	Name:     "gateway",
+	Aliases:  []string{"g"},
+	Usage:    "Name of the gateway to add/remove/show",
+	Required: true,
+}
+
+var renderGatewayFlag = cli.StringFlag{
+	Name:    "gateway",
+	Aliases: []string{"g"},
+	Usage:   "Render the config of this gateway instead of the main server",
+	Value:   "",
+}
+
+var formatFlag = cli.StringFlag{
+	Name:    "format",
+	Aliases: []string{"f"},
+	Usage:   "Output format: wg (for wg setconf/syncconf), wg-quick or networkd (written into --output)",
+	Value:   models.FormatWGQuick,
+}
+
+var clientFormatFlag = cli.StringFlag{
+	Name:    "format",
+	Aliases: []string{"f"},
+	Usage:   "Output format of the client config: wg-quick, nm (NetworkManager keyfile), networkd (written into --output), openwrt (uci script) or routeros (RouterOS script)",
+	Value:   models.FormatWGQuick,
+}
+
+var fromFlag = cli.StringFlag{
+	Name:     "from",
+	Usage:    "Format of the imported file (wg-easy)",
 	Required: true,
 }
 
+var wgEasyPortFlag = cli.Uint16Flag{
+	Name:  "port",
+	Usage: "UDP port the wg-easy server listens on (WG_PORT)",
+	Value: 51820,
+}
+
+var keepaliveFlag = cli.Uint16Flag{
+	Name:  "keepalive",
+	Usage: "PersistentKeepalive interval (seconds) of the clients behind NAT (0 = unset)",
+	Value: 0,
+}
+
+var mtuFlag = cli.Uint16Flag{
+	Name:  "mtu",
+	Usage: "MTU of the client interfaces (0 = unset)",
+	Value: 0,
+}
+
+var tableFlag = cli.StringFlag{
+	Name:  "table",
+	Usage: "Routing table of the client interfaces (off, auto or a number)",
+	Value: "",
+}
+
+var fwmarkFlag = cli.StringFlag{
+	Name:  "fwmark",
+	Usage: "Firewall mark of the client outgoing packets (off or a 32-bit number)",
+	Value: "",
+}
+
+var unsetFlag = cli.StringSliceFlag{
+	Name:  "unset",
+	Usage: "Option of the vpn defaults the client does not use (keepalive, mtu, table or fwmark, repeatable)",
+}
+
 var wanFlag = cli.StringFlag{
 	Name:  "wan",
 	Usage: "WAN interface for NAT masquerading (auto = auto-detect, empty = disabled)",
 	Value: "",
 }
+
+// optionsFromFlags reads the client config options
+// (keepalive, mtu, table, fwmark)
+func optionsFromFlags(c *cli.Command) (models.WGOptions, error) {
+	options := models.WGOptions{
+		Keepalive: c.Uint16("keepalive"),
+		MTU:       c.Uint16("mtu"),
+		Table:     c.String("table"),
+		FwMark:    c.String("fwmark"),
+	}
+	return options, options.Validate()
+}
+
+// unsetKeys maps the options of --unset to their keys
+var unsetKeys = map[string]string{
+	"keepalive": "PersistentKeepalive",
+	"mtu":       "MTU",
+	"table":     "Table",
+	"fwmark":    "FwMark",
+}
+
+// overridesFromFlags reads the client config options overriding the vpn
+// defaults (including the ones given to --unset)
+func overridesFromFlags(c *cli.Command) (models.WGOptions, error) {
+	options, err := optionsFromFlags(c)
+	if err != nil {
+		return options, err
+	}
+	for _, option := range c.StringSlice("unset") {
+		key, ok := unsetKeys[option]
+		if !ok {
+			return options, fmt.Errorf("unknown option %q (expected keepalive, mtu, table or fwmark)", option)
+		}
+		options.Unset = append(options.Unset, key)
+	}
+	return options, nil
+}
+
+var jsonFlag = cli.BoolFlag{
+	Name:  "json",
+	Usage: "Print as JSON (for monitoring)",
+	Value: false,
+}
+
+var listenFlag = cli.StringFlag{
+	Name:  "listen",
+	Usage: "Address of the HTTP server (loopback only without TLS, behind a reverse proxy)",
+	Value: "127.0.0.1:8080",
+}
+
+var warnFlag = cli.FloatFlag{
+	Name:  "warn",
+	Usage: "Fail when the usage of a pool reaches this percentage (for cron, 0 = off)",
+}
+
+var exporterListenFlag = cli.StringFlag{
+	Name:  "listen",
+	Usage: "Address of the metrics endpoint",
+	Value: ":9586",
+}
+
+var tokenFlag = cli.StringFlag{
+	Name:    "token",
+	Usage:   "Token of the API requests (Authorization: Bearer <token>)",
+	Sources: cli.EnvVars("WG_EASY_VPN_TOKEN"),
+}
+
+var tlsCertFlag = cli.StringFlag{
+	Name:      "tls-cert",
+	Usage:     "TLS certificate of the HTTP server (PEM, with --tls-key)",
+	TakesFile: true,
+}
+
+var tlsKeyFlag = cli.StringFlag{
+	Name:      "tls-key",
+	Usage:     "TLS private key of the HTTP server (PEM, with --tls-cert)",
+	TakesFile: true,
+}
+
+var usersFlag = cli.StringFlag{
+	Name:      "users",
+	Usage:     "Users of the web UI (yaml file)",
+	TakesFile: true,
+}
+
+var shareFlag = cli.BoolFlag{
+	Name:  "share",
+	Usage: "Print a one-time link to the client config (served by serve) instead of the config",
+}
+
+var shareTTLFlag = cli.DurationFlag{
+	Name:  "share-ttl",
+	Usage: "Lifetime of the one-time link",
+	Value: 24 * time.Hour,
+}
+
+var shareURLFlag = cli.StringFlag{
+	Name:    "share-url",
+	Usage:   "Public URL of the serve command (base of the one-time links)",
+	Sources: cli.EnvVars("WG_EASY_VPN_URL"),
+}
@@ -0,0 +1,235 @@
+package cmd
+
+import (
+	"context"
+	"os"
+
+	"github.com/asiffer/wg-easy-vpn/models"
+	"github.com/asiffer/wg-easy-vpn/utils"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v3"
+)
+
+var gatewayCmd = cli.Command{
+	Name:                  "gateway",
+	Usage:                 "Manage the additional gateways (servers) of a Wireguard VPN",
+	EnableShellCompletion: true,
+	Suggest:               true,
+	Commands:              []*cli.Command{&gatewayAddCmd, &gatewayRmCmd, &gatewayShowCmd},
+}
+
+var gatewayAddCmd = cli.Command{
+	Name:                  "add",
+	Usage:                 "Add a gateway to an existing Wireguard VPN (it prints its config)",
+	EnableShellCompletion: true,
+	Suggest:               true,
+	Flags: []cli.Flag{
+		&gatewayNameFlag,
+		&endpointFlag,
+		&portFlag,
+		&wanFlag,
+	},
+	Arguments: []cli.Argument{
+		&connArg,
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		config, err := buildGatewayCmdConfig(c)
+		if err != nil {
+			return err
+		}
+		return gatewayAddAction(ctx, config)
+	},
+}
+
+var gatewayRmCmd = cli.Command{
+	Name:                  "rm",
+	Usage:                 "Remove a gateway from an existing Wireguard VPN",
+	EnableShellCompletion: true,
+	Suggest:               true,
+	Flags: []cli.Flag{
+		&gatewayNameFlag,
+	},
+	Arguments: []cli.Argument{
+		&connArg,
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		config, err := buildGatewayCmdConfig(c)
+		if err != nil {
+			return err
+		}
+		return gatewayRmAction(ctx, config)
+	},
+}
+
+var gatewayShowCmd = cli.Command{
+	Name:                  "show",
+	Usage:                 "Print the config of a gateway (to refresh it after add/rm)",
+	EnableShellCompletion: true,
+	Suggest:               true,
+	Flags: []cli.Flag{
+		&gatewayNameFlag,
+	},
+	Arguments: []cli.Argument{
+		&connArg,
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		config, err := buildGatewayCmdConfig(c)
+		if err != nil {
+			return err
+		}
+		return gatewayShowAction(ctx, config)
+	},
+}
+
+type gatewayConfig struct {
+	name     string
+	gateway  string
+	endpoint string
+	port     uint16
+	wan      string // WAN interface for NAT masquerading (empty = disabled)
+}
+
+func buildGatewayCmdConfig(c *cli.Command) (*gatewayConfig, error) {
+	cfg := &gatewayConfig{
+		name:     c.StringArg(CONNECTION_ARG),
+		gateway:  c.String("gateway"),
+		endpoint: c.String("endpoint"),
+		port:     c.Uint16("port"),
+		wan:      c.String("wan"),
+	}
+	log.Debug().
+		Str("name", cfg.name).
+		Str("gateway", cfg.gateway).
+		Str("endpoint", cfg.endpoint).
+		Uint16("port", cfg.port).
+		Str("wan", cfg.wan).
+		Msg("Gateway command configuration")
+	return cfg, nil
+}
+
+// loadVPN reads the vpn of a connection. Its config is locked (serve and
+// the other commands edit it too) until unlock is called, once the vpn
+// is saved.
+func loadVPN(raw string) (*models.WGVPN, string, func(), error) {
+	name, path, err := ConfigurationInfo(raw)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	log.Debug().Str("name", name).Str("path", path).Msg("Parsing connection location")
+
+	unlock, err := lockConfig(path)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	file, err := utils.ParseFile(path)
+	if err != nil {
+		unlock()
+		return nil, "", nil, err
+	}
+	if err := checkLayout(name, path, file); err != nil {
+		unlock()
+		return nil, "", nil, err
+	}
+	vpn, err := models.VPNFromFile(name, file)
+	if err != nil {
+		unlock()
+		return nil, "", nil, err
+	}
+	return vpn, path, unlock, nil
+}
+
+// lockConfig waits for the lock of a config. The commands which write a
+// config without loadVPN (init, import...) hold it until the end.
+func lockConfig(path string) (func(), error) {
+	lock, err := utils.LockFile(path)
+	if err != nil {
+		return nil, err
+	}
+	log.Debug().Str("path", path).Msg("Config locked")
+	return func() {
+		if err := lock.Unlock(); err != nil {
+			log.Warn().Err(err).Str("path", path).Msg("Cannot release the lock of the config")
+		}
+	}, nil
+}
+
+// saveVPN writes the server file (and the state file of the vpn, if any,
+// see WGVPN.Save). The config must be locked (loadVPN or lockConfig).
+func saveVPN(vpn *models.WGVPN, path string) error {
+	vpn.Log(log.Debug()).Msg("Saving vpn")
+	if err := vpn.Save(path); err != nil {
+		return err
+	}
+	if statePath := vpn.StatePath(); statePath != "" {
+		log.Info().Str("path", statePath).Msg("VPN state file updated")
+	}
+	log.Info().Str("path", path).Msg("Wireguard VPN configuration file updated")
+	return nil
+}
+
+func gatewayAddAction(_ context.Context, config *gatewayConfig) error {
+	vpn, path, unlock, err := loadVPN(config.name)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	gw := models.NewWGGateway(config.gateway, config.endpoint, config.port)
+	if err := vpn.AddGateway(gw); err != nil {
+		return err
+	}
+
+	// configure WAN masquerading if requested
+	if config.wan != "" {
+		wanIface, err := resolveWANInterface(config.wan)
+		if err != nil {
+			return err
+		}
+		preUp, postDown := generateMasqueradeHooks(vpn.Networks(), wanIface)
+		gw.SetHooks(preUp, postDown)
+		log.Debug().Strs("preUp", preUp).Strs("postDown", postDown).Msg("WAN masquerading hooks configured")
+	}
+	log.Info().
+		Str("gateway", gw.Name()).
+		Str("address", gw.Address()).
+		Str("endpoint", gw.Endpoint()).
+		Msg("Gateway added to VPN")
+
+	if err := saveVPN(vpn, path); err != nil {
+		return err
+	}
+	return gatewayShow(vpn, config.gateway)
+}
+
+func gatewayRmAction(_ context.Context, config *gatewayConfig) error {
+	vpn, path, unlock, err := loadVPN(config.name)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := vpn.RemoveGateway(config.gateway); err != nil {
+		return err
+	}
+	log.Info().Str("gateway", config.gateway).Msg("Gateway removed from VPN")
+	return saveVPN(vpn, path)
+}
+
+func gatewayShowAction(_ context.Context, config *gatewayConfig) error {
+	vpn, _, unlock, err := loadVPN(config.name)
+	if err != nil {
+		return err
+	}
+	unlock()
+	return gatewayShow(vpn, config.gateway)
+}
+
+// gatewayShow writes the config of a gateway to stdout
+func gatewayShow(vpn *models.WGVPN, gateway string) error {
+	file := utils.NewFile()
+	if err := vpn.PopulateGateway(gateway, file); err != nil {
+		return err
+	}
+	file.Log(log.Debug()).Msg("Populating gateway config file in memory")
+	_, err := file.WriteTo(os.Stdout)
+	return err
+}
@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/asiffer/wg-easy-vpn/models"
+	"github.com/asiffer/wg-easy-vpn/utils"
+)
+
+// captureStdout runs f and returns what it wrote to stdout
+func captureStdout(t *testing.T, f func() error) (string, error) {
+	t.Helper()
+	oldStdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	err := f()
+
+	w.Close()
+	os.Stdout = oldStdout
+
+	buf := make([]byte, 16384)
+	n, _ := r.Read(buf)
+	return string(buf[:n]), err
+}
+
+func TestGatewayActions(t *testing.T) {
+	t.Run("add prints the gateway config", func(t *testing.T) {
+		dir := testDir(t)
+		configPath := setupVPN(t, dir)
+
+		output, err := captureStdout(t, func() error {
+			return gatewayAddAction(context.Background(), &gatewayConfig{
+				name:     configPath,
+				gateway:  "london",
+				endpoint: "london.example.com:51820",
+				port:     51820,
+			})
+		})
+		if err != nil {
+			t.Fatalf("gatewayAddAction failed: %v", err)
+		}
+		if !strings.Contains(output, "Address = 10.0.0.2/24") {
+			t.Errorf("expected gateway address in output, got: %s", output)
+		}
+		if !strings.Contains(output, "Endpoint = vpn.example.com:51820") {
+			t.Errorf("expected main server as peer, got: %s", output)
+		}
+
+		// the private key of the gateway is not in the server config
+		file, _ := utils.ParseFile(configPath)
+		if file.HasSection("Gateway") {
+			t.Error("unexpected Gateway section in server config")
+		}
+		gateways, err := utils.ParseFile(configPath + models.GatewaysSuffix)
+		if err != nil || !gateways.HasSection("Gateway") {
+			t.Errorf("expected Gateway section in the gateways file (%v)", err)
+		}
+	})
+
+	t.Run("clients connect through gateways", func(t *testing.T) {
+		dir := testDir(t)
+		configPath := setupVPN(t, dir)
+		captureStdout(t, func() error {
+			return gatewayAddAction(context.Background(), &gatewayConfig{
+				name: configPath, gateway: "london", endpoint: "london.example.com:51820", port: 51820,
+			})
+		})
+
+		output, err := captureStdout(t, func() error {
+			return addAction(context.Background(), &addConfig{name: configPath, client: "alice", gateway: "london"})
+		})
+		if err != nil {
+			t.Fatalf("addAction failed: %v", err)
+		}
+		if !strings.Contains(output, "Endpoint = london.example.com:51820") {
+			t.Errorf("expected london endpoint, got: %s", output)
+		}
+
+		output, err = captureStdout(t, func() error {
+			return addAction(context.Background(), &addConfig{name: configPath, client: "bob", allGateways: true})
+		})
+		if err != nil {
+			t.Fatalf("addAction failed: %v", err)
+		}
+		if strings.Count(output, "[Peer]") != 2 {
+			t.Errorf("expected 2 peers, got: %s", output)
+		}
+
+		// the new clients are peers of the gateway
+		output, err = captureStdout(t, func() error {
+			return gatewayShowAction(context.Background(), &gatewayConfig{name: configPath, gateway: "london"})
+		})
+		if err != nil {
+			t.Fatalf("gatewayShowAction failed: %v", err)
+		}
+		if strings.Count(output, "[Peer]") != 3 {
+			t.Errorf("expected 3 peers (main server, alice, bob), got: %s", output)
+		}
+		// alice is only a peer of london: the main server routes her through it
+		content, _ := os.ReadFile(configPath)
+		if strings.Contains(string(content), "# alice") || !strings.Contains(string(content), "AllowedIPs = 10.0.0.2/32, 10.0.0.3/32") {
+			t.Errorf("expected alice behind the london relay:\n%s", content)
+		}
+		vpn, _, unlock, err := loadVPN(configPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		unlock()
+		gateways := make(map[string]string)
+		for _, peer := range vpn.Peers() {
+			gateways[peer.Name()] = peer.Gateway()
+		}
+		if len(gateways) != 2 || gateways["alice"] != "london" || gateways["bob"] != models.AllGateways {
+			t.Errorf("expected alice (london) and bob (all), got %v", gateways)
+		}
+		if err := gatewayRmAction(context.Background(), &gatewayConfig{name: configPath, gateway: "london"}); err == nil {
+			t.Error("expected error when removing the gateway of alice")
+		}
+
+		err = addAction(context.Background(), &addConfig{name: configPath, client: "eve", gateway: "london", allGateways: true})
+		if err == nil {
+			t.Error("expected error with both --gateway and --all-gateways")
+		}
+	})
+
+	t.Run("rm", func(t *testing.T) {
+		dir := testDir(t)
+		configPath := setupVPN(t, dir)
+		captureStdout(t, func() error {
+			return gatewayAddAction(context.Background(), &gatewayConfig{
+				name: configPath, gateway: "london", endpoint: "london.example.com:51820", port: 51820,
+			})
+		})
+		if err := gatewayRmAction(context.Background(), &gatewayConfig{name: configPath, gateway: "london"}); err != nil {
+			t.Fatalf("gatewayRmAction failed: %v", err)
+		}
+		file, _ := utils.ParseFile(configPath)
+		if file.HasSection("Gateway") || file.HasSection("Peer") {
+			t.Error("expected the gateway to be removed")
+		}
+		if err := gatewayRmAction(context.Background(), &gatewayConfig{name: configPath, gateway: "london"}); err == nil {
+			t.Error("expected error when removing an unknown gateway")
+		}
+	})
+}
@@ -0,0 +1,263 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/asiffer/wg-easy-vpn/models"
+	"github.com/asiffer/wg-easy-vpn/utils"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v3"
+)
+
+// FROM_WG_EASY is the format of the wg-easy (Node.js) database
+const FROM_WG_EASY = "wg-easy"
+
+var importCmd = cli.Command{
+	Name:                  "import",
+	Usage:                 "Create a Wireguard VPN from the database of another tool (wg-easy)",
+	EnableShellCompletion: true,
+	Suggest:               true,
+	Flags: []cli.Flag{
+		&fromFlag,
+		&endpointFlag,
+		&wgEasyPortFlag,
+		&importNetworksFlag,
+		&routesFlag,
+		&dnsFlag,
+		&wanFlag,
+		&outputFlag,
+	},
+	Arguments: []cli.Argument{
+		&sourceArg,
+		&connArg,
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		config, err := buildImportCmdConfig(c)
+		if err != nil {
+			return err
+		}
+		return importAction(ctx, config)
+	},
+}
+
+type importConfig struct {
+	from     string
+	source   string
+	conn     string
+	endpoint string
+	port     uint16
+	networks []net.IPNet // empty = the /24 of the server address
+	routes   []net.IPNet
+	dns      []net.IP
+	wan      string // WAN interface for NAT masquerading (empty = disabled)
+	output   string // directory of the client configs (empty = not written)
+}
+
+func buildImportCmdConfig(c *cli.Command) (*importConfig, error) {
+	networks, err := utils.ParseIPNetList(c.StringSlice("networks"))
+	if err != nil {
+		return nil, err
+	}
+	routes, err := utils.ParseIPNetList(c.StringSlice("routes"))
+	if err != nil {
+		return nil, err
+	}
+	dns, err := utils.ParseIPList(c.StringSlice("dns"))
+	if err != nil {
+		return nil, err
+	}
+	cfg := &importConfig{
+		from:     c.String("from"),
+		source:   c.StringArg(SOURCE_ARG),
+		conn:     c.StringArg(CONNECTION_ARG),
+		endpoint: c.String("endpoint"),
+		port:     c.Uint16("port"),
+		networks: networks,
+		routes:   routes,
+		dns:      dns,
+		wan:      c.String("wan"),
+		output:   c.String("output"),
+	}
+	log.Debug().
+		Str("from", cfg.from).
+		Str("source", cfg.source).
+		Str("conn", cfg.conn).
+		Str("endpoint", cfg.endpoint).
+		Uint16("port", cfg.port).
+		Strs("networks", utils.StringifyNetworks(cfg.networks)).
+		Strs("routes", utils.StringifyNetworks(cfg.routes)).
+		Strs("dns", utils.StringifyIPs(cfg.dns)).
+		Str("wan", cfg.wan).
+		Str("output", cfg.output).
+		Msg("import command configuration")
+	return cfg, nil
+}
+
+func importAction(_ context.Context, config *importConfig) error {
+	if config.from != FROM_WG_EASY {
+		return fmt.Errorf("unknown import format %q (expected %s)", config.from, FROM_WG_EASY)
+	}
+	name, path, err := ConfigurationInfo(config.conn)
+	if err != nil {
+		return err
+	}
+	log.Debug().Str("name", name).Str("path", path).Msg("Parsing connection location")
+	unlock, err := lockConfig(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if utils.FileExists(path) {
+		return fmt.Errorf("a vpn already exists at %s", path)
+	}
+
+	src, err := os.Open(config.source)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	vpn, clients, report, err := models.VPNFromWGEasy(name, src, models.WGEasySettings{
+		Endpoint: config.endpoint,
+		Port:     config.port,
+		Networks: config.networks,
+		DNS:      config.dns,
+		Routes:   config.routes,
+	})
+	if err != nil {
+		return err
+	}
+
+	// the hooks of wg-easy (WG_POST_UP...) are not in its database
+	if config.wan != "" {
+		wanIface, err := resolveWANInterface(config.wan)
+		if err != nil {
+			return err
+		}
+		preUp, postDown := generateMasqueradeHooks(vpn.Networks(), wanIface)
+		vpn.Server().SetHooks(preUp, postDown)
+	} else {
+		report = append(report, "the PostUp/PostDown rules of wg-easy are not in its database (use --wan to generate the masquerading rules)")
+	}
+	vpn.Log(log.Debug()).Msg("Importing vpn")
+
+	for _, line := range report {
+		log.Warn().Msg(line)
+	}
+
+	// rendered before the vpn is saved, written once it is
+	var configs []clientConfig
+	if config.output != "" {
+		if configs, err = renderClientConfigs(vpn, clients, models.FormatWGQuick, name, false); err != nil {
+			return err
+		}
+	}
+	if err := saveVPN(vpn, path); err != nil {
+		return err
+	}
+	if config.output != "" {
+		if err := writeClientConfigs(configs, config.output); err != nil {
+			return err
+		}
+	}
+	log.Info().
+		Str("source", config.source).
+		Int("clients", len(clients)).
+		Int("warnings", len(report)).
+		Msg("Wireguard VPN imported")
+	return nil
+}
+
+// clientConfig is the config of a client rendered in memory (see
+// renderClientConfigs)
+type clientConfig struct {
+	client   string
+	filename string // without extension, unique
+	content  string
+	qrcode   []byte                // PNG image (empty = none)
+	networkd []models.NetworkdFile // several files per client (systemd-networkd)
+	format   string
+}
+
+// renderClientConfigs renders the config of every client in memory, so
+// that nothing is written when one of them cannot be rendered
+func renderClientConfigs(vpn *models.WGVPN, clients []*models.WGClient, format string, conn string, qrcode bool) ([]clientConfig, error) {
+	rendered := make([]clientConfig, 0, len(clients))
+	used := make(map[string]bool)
+	for i, client := range clients {
+		base := utils.CleanString(client.Name())
+		if base == "" {
+			base = fmt.Sprintf("client%d", i)
+		}
+		filename := base
+		for n := 1; used[filename]; n++ {
+			filename = fmt.Sprintf("%s-%d", base, n)
+		}
+		used[filename] = true
+
+		file := utils.NewFile()
+		file.GetorCreateSection(utils.DEFAULT_SECTION).AddComment(client.Name())
+		if err := client.PopulateClient(file, vpn); err != nil {
+			return nil, fmt.Errorf("client %s: %w", client.Name(), err)
+		}
+		config := clientConfig{client: client.Name(), filename: filename, format: format}
+		if format == models.FormatNetworkd {
+			files, err := renderNetworkd(file, conn)
+			if err != nil {
+				return nil, fmt.Errorf("client %s: %w", client.Name(), err)
+			}
+			config.networkd = files
+			rendered = append(rendered, config)
+			continue
+		}
+		content, err := models.RenderClient(file, format, conn)
+		if err != nil {
+			return nil, fmt.Errorf("client %s: %w", client.Name(), err)
+		}
+		config.content = content
+		if qrcode {
+			var png bytes.Buffer
+			if err := file.WriteQRCodePNGTo(&png); err != nil {
+				return nil, fmt.Errorf("client %s: %w", client.Name(), err)
+			}
+			config.qrcode = png.Bytes()
+		}
+		rendered = append(rendered, config)
+	}
+	return rendered, nil
+}
+
+// writeClientConfigs writes the rendered configs into the output
+// directory (<name>.conf, <name>.nmconnection or <name>/ for
+// systemd-networkd, and <name>.png with qrcode)
+func writeClientConfigs(configs []clientConfig, output string) error {
+	if err := os.MkdirAll(output, 0700); err != nil {
+		return fmt.Errorf("error while creating output directory %s: %w", output, err)
+	}
+	for _, config := range configs {
+		if config.networkd != nil {
+			if err := writeNetworkdFiles(config.networkd, filepath.Join(output, config.filename)); err != nil {
+				return fmt.Errorf("client %s: %w", config.client, err)
+			}
+			continue
+		}
+		path := filepath.Join(output, config.filename+models.ClientConfigSuffix(config.format))
+		if err := os.WriteFile(path, []byte(config.content), 0600); err != nil {
+			return err
+		}
+		log.Debug().Str("client", config.client).Str("path", path).Msg("Client config written")
+		if len(config.qrcode) > 0 {
+			path = filepath.Join(output, config.filename+"."+DefaultQRCodeFormat)
+			if err := os.WriteFile(path, config.qrcode, 0600); err != nil {
+				return err
+			}
+			log.Debug().Str("client", config.client).Str("path", path).Msg("Client qrcode written")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestImportAction(t *testing.T) {
+	dir := testDir(t)
+	configPath := testConfigPath(t, dir, "wg0")
+	output := filepath.Join(dir, "clients")
+	config := &importConfig{
+		from:     FROM_WG_EASY,
+		source:   "../test/wg-easy.json",
+		conn:     configPath,
+		endpoint: "vpn.example.com:51820",
+		port:     51820,
+		output:   output,
+	}
+	if err := importAction(context.Background(), config); err != nil {
+		t.Fatalf("importAction failed: %v", err)
+	}
+
+	vpn, _, unlock, err := loadVPN(configPath)
+	if err != nil {
+		t.Fatalf("loadVPN failed: %v", err)
+	}
+	unlock()
+	if vpn.NumberOfPeers() != 3 || vpn.Peers()[0].Name() != "Alice's phone" {
+		t.Errorf("expected the 3 clients with their names")
+	}
+	// the disabled client is not a peer of the server
+	server, _ := os.ReadFile(configPath)
+	if strings.Contains(string(server), "old tablet") || len(vpn.PeersOf("wg0")) != 2 {
+		t.Errorf("expected the disabled client out of the server file:\n%s", server)
+	}
+
+	// client configs (file names are cleaned)
+	raw, err := os.ReadFile(filepath.Join(output, "Alicesphone.conf"))
+	if err != nil {
+		t.Fatalf("missing client config: %v", err)
+	}
+	for _, expected := range []string{"PrivateKey = GlVme/Khob064WhRfA5c06CBE/Kr2p9APXsBehP50Go=", "Address = 10.8.0.2/24", "Endpoint = vpn.example.com:51820"} {
+		if !strings.Contains(string(raw), expected) {
+			t.Errorf("expected %q in client config:\n%s", expected, raw)
+		}
+	}
+
+	// the vpn is not overwritten
+	if err := importAction(context.Background(), config); err == nil {
+		t.Error("expected an error when the vpn exists")
+	}
+
+	t.Run("unknown format", func(t *testing.T) {
+		err := importAction(context.Background(), &importConfig{from: "pivpn", conn: filepath.Join(dir, "wg1.conf")})
+		if err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"path/filepath"
+	"strings"
 
 	"github.com/asiffer/wg-easy-vpn/models"
 	"github.com/asiffer/wg-easy-vpn/utils"
@@ -22,8 +24,14 @@ var initCmd = cli.Command{
 		&networksFlag,
 		&dnsFlag,
 		&routesFlag,
+		&excludeRoutesFlag,
 		&portFlag,
 		&wanFlag,
+		&keepaliveFlag,
+		&mtuFlag,
+		&tableFlag,
+		&fwmarkFlag,
+		&stateFlag,
 	},
 	Arguments: []cli.Argument{
 		&connArg,
@@ -43,9 +51,12 @@ type initConfig struct {
 	networks []net.IPNet
 	dns      []net.IP
 	routes   []net.IPNet
+	excludes []net.IPNet // routes excluded from the tunnel
 	port     uint16
 	conn     string
-	wan      string // WAN interface for NAT masquerading (empty = disabled, non-empty = interface name)
+	wan      string           // WAN interface for NAT masquerading (empty = disabled, non-empty = interface name)
+	options  models.WGOptions // default options of the client configs
+	state    string           // format of the state file (empty = metadata in the server file)
 }
 
 func buildInitCmdConfig(c *cli.Command) (*initConfig, error) {
@@ -57,10 +68,18 @@ func buildInitCmdConfig(c *cli.Command) (*initConfig, error) {
 	if err != nil {
 		return nil, err
 	}
+	excludes, err := utils.ParseIPNetList(c.StringSlice("exclude-routes"))
+	if err != nil {
+		return nil, err
+	}
 	dns, err := utils.ParseIPList(c.StringSlice("dns"))
 	if err != nil {
 		return nil, err
 	}
+	options, err := optionsFromFlags(c)
+	if err != nil {
+		return nil, err
+	}
 	cfg := &initConfig{
 		noPSK:    c.Bool("no-psk"),
 		endpoint: c.String("endpoint"),
@@ -69,16 +88,25 @@ func buildInitCmdConfig(c *cli.Command) (*initConfig, error) {
 		port:     c.Uint16("port"),
 		conn:     c.StringArg(CONNECTION_ARG),
 		routes:   routes,
+		excludes: excludes,
 		wan:      c.String("wan"),
+		options:  options,
+		state:    c.String("state"),
 	}
 	log.Debug().
 		Bool("no-psk", cfg.noPSK).
 		Str("endpoint", cfg.endpoint).
 		Strs("networks", utils.StringifyNetworks(cfg.networks)).
 		Strs("routes", utils.StringifyNetworks(cfg.routes)).
+		Strs("exclude-routes", utils.StringifyNetworks(cfg.excludes)).
 		Strs("dns", utils.StringifyIPs(cfg.dns)).
 		Uint16("port", cfg.port).
 		Str("conn", cfg.conn).
+		Uint16("keepalive", cfg.options.Keepalive).
+		Uint16("mtu", cfg.options.MTU).
+		Str("table", cfg.options.Table).
+		Str("fwmark", cfg.options.FwMark).
+		Str("state", cfg.state).
 		Msg("Init command configuration")
 
 	return cfg, nil
@@ -91,20 +119,27 @@ func initAction(_ context.Context, config *initConfig) error {
 		return err
 	}
 	log.Debug().Str("name", name).Str("path", path).Msg("Parsing connection location")
+	unlock, err := lockConfig(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	statePath := ""
+	if config.state != "" {
+		if statePath, err = stateFilePath(path, config.state); err != nil {
+			return err
+		}
+	}
 
 	// create the server first (without networks)
 	server := models.NewWGServer(nil, config.noPSK, config.port)
 
 	// configure WAN masquerading if requested
 	if config.wan != "" {
-		wanIface := config.wan
-		if wanIface == "auto" {
-			detected, err := utils.GetDefaultInterface()
-			if err != nil {
-				return fmt.Errorf("failed to auto-detect WAN interface: %w", err)
-			}
-			wanIface = detected
-			log.Debug().Str("interface", wanIface).Msg("Auto-detected WAN interface")
+		wanIface, err := resolveWANInterface(config.wan)
+		if err != nil {
+			return err
 		}
 		preUp, postDown := generateMasqueradeHooks(config.networks, wanIface)
 		server.SetHooks(preUp, postDown)
@@ -123,16 +158,37 @@ func initAction(_ context.Context, config *initConfig) error {
 	if err != nil {
 		return err
 	}
+	vpn.SetExcludedRoutes(config.excludes)
+	vpn.SetOptions(config.options)
+	vpn.SetStatePath(statePath)
 	vpn.Log(log.Debug()).Msg("Creating new vpn")
 
-	file := utils.NewFile()
-	vpn.Populate(file)
-	file.Log(log.Debug()).Msg("Populating config file in memory")
-	if err := file.Save(path); err != nil {
-		return err
+	return saveVPN(vpn, path)
+}
+
+// stateFilePath returns the path of the state file of a server file in
+// the given format (wg0.conf -> wg0.wg-easy.json)
+func stateFilePath(path string, format string) (string, error) {
+	switch format {
+	case models.StateJSON, models.StateYAML:
+		return strings.TrimSuffix(path, filepath.Ext(path)) + STATE_SUFFIX + "." + format, nil
+	default:
+		return "", fmt.Errorf("unknown state format %q (expected %s or %s)", format, models.StateJSON, models.StateYAML)
+	}
+}
+
+// resolveWANInterface returns the WAN interface given by the user
+// (auto = the interface of the default route)
+func resolveWANInterface(wan string) (string, error) {
+	if wan != "auto" {
+		return wan, nil
+	}
+	detected, err := utils.GetDefaultInterface()
+	if err != nil {
+		return "", fmt.Errorf("failed to auto-detect WAN interface: %w", err)
 	}
-	log.Info().Str("path", path).Msg("Wireguard VPN configuration file created")
-	return nil
+	log.Debug().Str("interface", detected).Msg("Auto-detected WAN interface")
+	return detected, nil
 }
 
 // generateMasqueradeHooks generates PreUp and PostDown commands for NAT masquerading.
@@ -4,9 +4,11 @@ import (
 	"context"
 	"net"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/asiffer/wg-easy-vpn/models"
 	"github.com/asiffer/wg-easy-vpn/utils"
 )
 
@@ -191,3 +193,55 @@ func TestInitAction(t *testing.T) {
 		}
 	})
 }
+
+func TestInitActionState(t *testing.T) {
+	for _, format := range []string{models.StateJSON, models.StateYAML} {
+		t.Run(format, func(t *testing.T) {
+			dir := testDir(t)
+			configPath := testConfigPath(t, dir, "wg0")
+			config := &initConfig{
+				endpoint: "vpn.example.com:51820",
+				networks: []net.IPNet{{IP: net.ParseIP("10.0.0.0"), Mask: net.CIDRMask(24, 32)}},
+				port:     51820,
+				conn:     configPath,
+				state:    format,
+			}
+			if err := initAction(context.Background(), config); err != nil {
+				t.Fatalf("initAction failed: %v", err)
+			}
+			statePath := filepath.Join(dir, "wg0.wg-easy."+format)
+			if _, err := models.ReadStateFile(statePath); err != nil {
+				t.Fatalf("failed to read state: %v", err)
+			}
+
+			_, err := captureStdout(t, func() error {
+				return addAction(context.Background(), &addConfig{name: configPath, client: "laptop", tags: []string{"staff"}})
+			})
+			if err != nil {
+				t.Fatalf("addAction failed: %v", err)
+			}
+			state, err := models.ReadStateFile(statePath)
+			if err != nil {
+				t.Fatalf("failed to read state: %v", err)
+			}
+			if len(state.Peers) != 1 || state.Peers[0].Name != "laptop" || len(state.Peers[0].Tags) != 1 || state.Peers[0].CreatedAt.IsZero() {
+				t.Errorf("unexpected peers in state: %+v", state.Peers)
+			}
+
+			// the server file is rendered from the state
+			file, _ := utils.ParseFile(configPath)
+			peer, err := file.GetSection("Peer")
+			if err != nil {
+				t.Fatalf("expected the client in the server file:\n%s", file.String())
+			}
+			if public, _ := peer.Get("PublicKey"); public != state.Peers[0].PublicKey {
+				t.Errorf("expected public key %s, got %s", state.Peers[0].PublicKey, public)
+			}
+		})
+	}
+
+	err := initAction(context.Background(), &initConfig{conn: testConfigPath(t, testDir(t), "wg0"), state: "toml"})
+	if err == nil {
+		t.Error("expected error with an unknown state format")
+	}
+}
@@ -0,0 +1,319 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/asiffer/wg-easy-vpn/models"
+	"github.com/asiffer/wg-easy-vpn/utils"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v3"
+)
+
+// MESH_SUFFIX is the extension of the mesh state file
+const MESH_SUFFIX = ".mesh"
+
+var meshCmd = cli.Command{
+	Name:                  "mesh",
+	Usage:                 "Manage a full-mesh Wireguard VPN (every node is a peer of every other node)",
+	EnableShellCompletion: true,
+	Suggest:               true,
+	Commands:              []*cli.Command{&meshInitCmd, &meshAddCmd, &meshRmCmd},
+}
+
+var meshInitCmd = cli.Command{
+	Name:                  "init",
+	Usage:                 "Init a new full-mesh VPN (without node)",
+	EnableShellCompletion: true,
+	Suggest:               true,
+	Flags: []cli.Flag{
+		&noPSKFlag,
+		&networksFlag,
+		&outputFlag,
+	},
+	Arguments: []cli.Argument{
+		&connArg,
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		config, err := buildMeshInitCmdConfig(c)
+		if err != nil {
+			return err
+		}
+		return meshInitAction(ctx, config)
+	},
+}
+
+var meshAddCmd = cli.Command{
+	Name:                  "add",
+	Usage:                 "Add a node to a full-mesh VPN and regenerate the node configs",
+	EnableShellCompletion: true,
+	Suggest:               true,
+	Flags: []cli.Flag{
+		&nodeFlag,
+		&nodeEndpointFlag,
+		&portFlag,
+		&outputFlag,
+	},
+	Arguments: []cli.Argument{
+		&connArg,
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		config, err := buildMeshAddCmdConfig(c)
+		if err != nil {
+			return err
+		}
+		return meshAddAction(ctx, config)
+	},
+}
+
+var meshRmCmd = cli.Command{
+	Name:                  "rm",
+	Usage:                 "Remove a node from a full-mesh VPN and regenerate the node configs",
+	EnableShellCompletion: true,
+	Suggest:               true,
+	Flags: []cli.Flag{
+		&nodeFlag,
+		&outputFlag,
+	},
+	Arguments: []cli.Argument{
+		&connArg,
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		config, err := buildMeshRmCmdConfig(c)
+		if err != nil {
+			return err
+		}
+		return meshRmAction(ctx, config)
+	},
+}
+
+type meshInitConfig struct {
+	noPSK    bool
+	networks []net.IPNet
+	output   string
+	conn     string
+}
+
+type meshAddConfig struct {
+	name     string
+	node     string
+	endpoint string // public address of the node (empty = not reachable)
+	port     uint16
+	output   string
+}
+
+type meshRmConfig struct {
+	name   string
+	node   string
+	output string
+}
+
+func buildMeshInitCmdConfig(c *cli.Command) (*meshInitConfig, error) {
+	networks, err := utils.ParseIPNetList(c.StringSlice("networks"))
+	if err != nil {
+		return nil, err
+	}
+	cfg := &meshInitConfig{
+		noPSK:    c.Bool("no-psk"),
+		networks: networks,
+		output:   c.String("output"),
+		conn:     c.StringArg(CONNECTION_ARG),
+	}
+	log.Debug().
+		Bool("no-psk", cfg.noPSK).
+		Strs("networks", utils.StringifyNetworks(cfg.networks)).
+		Str("output", cfg.output).
+		Str("conn", cfg.conn).
+		Msg("Mesh init command configuration")
+	return cfg, nil
+}
+
+func buildMeshAddCmdConfig(c *cli.Command) (*meshAddConfig, error) {
+	cfg := &meshAddConfig{
+		name:     c.StringArg(CONNECTION_ARG),
+		node:     c.String("node"),
+		endpoint: c.String("endpoint"),
+		port:     c.Uint16("port"),
+		output:   c.String("output"),
+	}
+	log.Debug().
+		Str("name", cfg.name).
+		Str("node", cfg.node).
+		Str("endpoint", cfg.endpoint).
+		Uint16("port", cfg.port).
+		Str("output", cfg.output).
+		Msg("Mesh add command configuration")
+	return cfg, nil
+}
+
+func buildMeshRmCmdConfig(c *cli.Command) (*meshRmConfig, error) {
+	cfg := &meshRmConfig{
+		name:   c.StringArg(CONNECTION_ARG),
+		node:   c.String("node"),
+		output: c.String("output"),
+	}
+	log.Debug().
+		Str("name", cfg.name).
+		Str("node", cfg.node).
+		Str("output", cfg.output).
+		Msg("Mesh rm command configuration")
+	return cfg, nil
+}
+
+// MeshInfo returns the name of the mesh, the path to its state file
+// and the default directory of the node configs
+func MeshInfo(raw string) (string, string, string, error) {
+	name, path, err := ConfigurationInfo(raw)
+	if err != nil {
+		return "", "", "", err
+	}
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	return name, base + MESH_SUFFIX, base, nil
+}
+
+func meshInitAction(_ context.Context, config *meshInitConfig) error {
+	name, path, output, err := MeshInfo(config.conn)
+	if err != nil {
+		return err
+	}
+	if config.output != "" {
+		output = config.output
+	}
+	log.Debug().Str("name", name).Str("path", path).Str("output", output).Msg("Parsing mesh location")
+
+	unlock, err := lockConfig(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if utils.FileExists(path) {
+		return fmt.Errorf("a mesh already exists at %s", path)
+	}
+
+	mesh := models.NewWGMesh(name, config.networks, config.noPSK)
+	mesh.Log(log.Debug()).Msg("Creating new mesh")
+
+	if err := saveMesh(mesh, path); err != nil {
+		return err
+	}
+	log.Info().Str("path", path).Msg("Wireguard mesh created")
+	return nil
+}
+
+func meshAddAction(_ context.Context, config *meshAddConfig) error {
+	name, path, output, err := MeshInfo(config.name)
+	if err != nil {
+		return err
+	}
+	if config.output != "" {
+		output = config.output
+	}
+
+	if config.node == "" || utils.CleanString(config.node) != config.node {
+		return fmt.Errorf("invalid node name %q (allowed characters: %s)", config.node, utils.AllowedChars)
+	}
+
+	mesh, unlock, err := loadMesh(name, path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	node := models.NewWGMeshNode(config.node, config.endpoint, config.port)
+	if err := mesh.AddNode(node); err != nil {
+		return err
+	}
+	log.Info().
+		Str("node", node.Name()).
+		Str("address", node.Address()).
+		Str("endpoint", node.Endpoint()).
+		Msg("Node added to mesh")
+
+	if err := saveMesh(mesh, path); err != nil {
+		return err
+	}
+	log.Info().Str("path", path).Msg("Wireguard mesh updated")
+	return writeMeshConfigs(mesh, output)
+}
+
+func meshRmAction(_ context.Context, config *meshRmConfig) error {
+	name, path, output, err := MeshInfo(config.name)
+	if err != nil {
+		return err
+	}
+	if config.output != "" {
+		output = config.output
+	}
+
+	mesh, unlock, err := loadMesh(name, path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := mesh.RemoveNode(config.node); err != nil {
+		return err
+	}
+	log.Info().Str("node", config.node).Msg("Node removed from mesh")
+
+	// the config of the removed node is obsolete
+	stale := filepath.Join(output, config.node+CONFIG_SUFFIX)
+	if err := os.Remove(stale); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := saveMesh(mesh, path); err != nil {
+		return err
+	}
+	log.Info().Str("path", path).Msg("Wireguard mesh updated")
+	return writeMeshConfigs(mesh, output)
+}
+
+// loadMesh reads a mesh. Its state file is locked until unlock is called,
+// once the mesh is saved.
+func loadMesh(name string, path string) (*models.WGMesh, func(), error) {
+	unlock, err := lockConfig(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	file, err := utils.ParseFile(path)
+	if err != nil {
+		unlock()
+		return nil, nil, err
+	}
+	mesh, err := models.MeshFromFile(name, file)
+	if err != nil {
+		unlock()
+		return nil, nil, err
+	}
+	mesh.Log(log.Debug()).Str("path", path).Msg("Loaded existing mesh")
+	return mesh, unlock, nil
+}
+
+// saveMesh writes the state file of a mesh (it must be locked)
+func saveMesh(mesh *models.WGMesh, path string) error {
+	file := utils.NewFile()
+	mesh.Populate(file)
+	return file.Save(path)
+}
+
+// writeMeshConfigs (re-)generates the config of every node of the mesh
+// into the output directory (one <node>.conf file per node)
+func writeMeshConfigs(mesh *models.WGMesh, output string) error {
+	if err := os.MkdirAll(output, 0700); err != nil {
+		return fmt.Errorf("error while creating output directory %s: %w", output, err)
+	}
+	for _, node := range mesh.Nodes() {
+		file := utils.NewFile()
+		mesh.PopulateNode(node, file)
+		path := filepath.Join(output, node.Name()+CONFIG_SUFFIX)
+		if err := file.Save(path); err != nil {
+			return err
+		}
+		log.Debug().Str("node", node.Name()).Str("path", path).Msg("Node config written")
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/asiffer/wg-easy-vpn/utils"
+)
+
+// setupMesh creates a mesh and returns the path of its state file
+// (the node configs go to dir/mesh0)
+func setupMesh(t *testing.T, dir string) string {
+	t.Helper()
+	configPath := testConfigPath(t, dir, "mesh0")
+	initCfg := &meshInitConfig{
+		networks: []net.IPNet{{IP: net.ParseIP("10.9.0.0"), Mask: net.CIDRMask(24, 32)}},
+		conn:     configPath,
+	}
+	if err := meshInitAction(context.Background(), initCfg); err != nil {
+		t.Fatalf("setup mesh failed: %v", err)
+	}
+	return configPath
+}
+
+func countPeers(t *testing.T, path string) int {
+	t.Helper()
+	file, err := utils.ParseFile(path)
+	if err != nil {
+		t.Fatalf("failed to parse %s: %v", path, err)
+	}
+	count := 0
+	for _, sec := range file.Sections() {
+		if sec.Name() == "Peer" {
+			count++
+		}
+	}
+	return count
+}
+
+func TestMeshInfo(t *testing.T) {
+	name, path, output, err := MeshInfo("/tmp/mesh0.conf")
+	if err != nil {
+		t.Fatalf("MeshInfo failed: %v", err)
+	}
+	if name != "mesh0" || path != "/tmp/mesh0.mesh" || output != "/tmp/mesh0" {
+		t.Errorf("unexpected mesh info: %s %s %s", name, path, output)
+	}
+}
+
+func TestMeshActions(t *testing.T) {
+	t.Run("init creates the state file", func(t *testing.T) {
+		dir := testDir(t)
+		setupMesh(t, dir)
+		if !utils.FileExists(filepath.Join(dir, "mesh0.mesh")) {
+			t.Error("mesh state file not created")
+		}
+	})
+
+	t.Run("init fails if the mesh exists", func(t *testing.T) {
+		dir := testDir(t)
+		configPath := setupMesh(t, dir)
+		err := meshInitAction(context.Background(), &meshInitConfig{conn: configPath})
+		if err == nil {
+			t.Error("expected error when the mesh already exists")
+		}
+	})
+
+	t.Run("add regenerates every node config", func(t *testing.T) {
+		dir := testDir(t)
+		configPath := setupMesh(t, dir)
+		output := filepath.Join(dir, "mesh0")
+
+		nodes := []*meshAddConfig{
+			{name: configPath, node: "paris", endpoint: "paris.example.com", port: 51820},
+			{name: configPath, node: "london", endpoint: "london.example.com", port: 51820},
+			{name: configPath, node: "laptop", port: 51820},
+		}
+		for _, cfg := range nodes {
+			if err := meshAddAction(context.Background(), cfg); err != nil {
+				t.Fatalf("meshAddAction failed: %v", err)
+			}
+		}
+
+		for _, cfg := range nodes {
+			path := filepath.Join(output, cfg.node+".conf")
+			if n := countPeers(t, path); n != 2 {
+				t.Errorf("%s: expected 2 peers, got %d", cfg.node, n)
+			}
+		}
+
+		raw, _ := os.ReadFile(filepath.Join(output, "laptop.conf"))
+		if !strings.Contains(string(raw), "Endpoint = paris.example.com:51820") {
+			t.Errorf("expected paris endpoint in laptop config, got: %s", raw)
+		}
+	})
+
+	t.Run("add rejects invalid names", func(t *testing.T) {
+		dir := testDir(t)
+		configPath := setupMesh(t, dir)
+		err := meshAddAction(context.Background(), &meshAddConfig{name: configPath, node: "../evil"})
+		if err == nil {
+			t.Error("expected error with an invalid node name")
+		}
+	})
+
+	t.Run("rm regenerates and removes the node config", func(t *testing.T) {
+		dir := testDir(t)
+		configPath := setupMesh(t, dir)
+		output := filepath.Join(dir, "out")
+
+		for _, node := range []string{"a", "b", "c"} {
+			cfg := &meshAddConfig{name: configPath, node: node, port: 51820, output: output}
+			if err := meshAddAction(context.Background(), cfg); err != nil {
+				t.Fatalf("meshAddAction failed: %v", err)
+			}
+		}
+
+		if err := meshRmAction(context.Background(), &meshRmConfig{name: configPath, node: "b", output: output}); err != nil {
+			t.Fatalf("meshRmAction failed: %v", err)
+		}
+		if utils.FileExists(filepath.Join(output, "b.conf")) {
+			t.Error("expected the config of the removed node to be deleted")
+		}
+		for _, node := range []string{"a", "c"} {
+			if n := countPeers(t, filepath.Join(output, node+".conf")); n != 1 {
+				t.Errorf("%s: expected 1 peer, got %d", node, n)
+			}
+		}
+
+		if err := meshRmAction(context.Background(), &meshRmConfig{name: configPath, node: "b", output: output}); err == nil {
+			t.Error("expected error when removing an unknown node")
+		}
+	})
+}
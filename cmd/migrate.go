@@ -0,0 +1,217 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/asiffer/wg-easy-vpn/models"
+	"github.com/asiffer/wg-easy-vpn/utils"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v3"
+)
+
+var migrateCmd = cli.Command{
+	Name:                  "migrate",
+	Usage:                 "Convert a config written by an older wg-easy-vpn to the current layout (or move its state)",
+	EnableShellCompletion: true,
+	Suggest:               true,
+	Flags: []cli.Flag{
+		&fallbackEndpointFlag,
+		&convertStateFlag,
+	},
+	Arguments: []cli.Argument{
+		&connArg,
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		config, err := buildMigrateCmdConfig(c)
+		if err != nil {
+			return err
+		}
+		return migrateAction(ctx, config)
+	},
+}
+
+type migrateConfig struct {
+	name     string
+	endpoint string // used when the legacy metadata have none
+	state    string // json or yaml (state file), ini (server file), empty = unchanged
+}
+
+func buildMigrateCmdConfig(c *cli.Command) (*migrateConfig, error) {
+	cfg := &migrateConfig{
+		name:     c.StringArg(CONNECTION_ARG),
+		endpoint: c.String("endpoint"),
+		state:    c.String("state"),
+	}
+	log.Debug().
+		Str("name", cfg.name).
+		Str("endpoint", cfg.endpoint).
+		Str("state", cfg.state).
+		Msg("Migrate command configuration")
+	return cfg, nil
+}
+
+func migrateAction(_ context.Context, config *migrateConfig) error {
+	name, path, err := ConfigurationInfo(config.name)
+	if err != nil {
+		return err
+	}
+	log.Debug().Str("name", name).Str("path", path).Msg("Parsing connection location")
+
+	unlock, err := lockConfig(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	file, err := utils.ParseFile(path)
+	if err != nil {
+		return err
+	}
+	version, err := models.LayoutVersion(file)
+	if err != nil {
+		return err
+	}
+	log.Debug().Int("version", version).Msg("Config layout detected")
+
+	var vpn *models.WGVPN
+	switch {
+	case version == models.ConfigVersion && config.state == "":
+		log.Info().Str("path", path).Int("version", version).Msg("Config already up to date")
+		return nil
+	case version > models.ConfigVersion:
+		return fmt.Errorf("unsupported config version %d (expected %d or lower)", version, models.ConfigVersion)
+	case version == models.ConfigVersion, version == models.LayoutEmbedded:
+		if vpn, err = models.VPNFromFile(name, file); err != nil {
+			return err
+		}
+	default:
+		if vpn, err = migrateLegacy(name, path, file, config.endpoint); err != nil {
+			return err
+		}
+	}
+	previous, gateways := vpn.StatePath(), vpn.GatewaysPath()
+	if err := convertState(vpn, path, config.state); err != nil {
+		return err
+	}
+
+	// keep the original file
+	backup := path + BACKUP_SUFFIX
+	if err := os.WriteFile(backup, raw, 0600); err != nil {
+		return err
+	}
+	log.Info().Str("path", backup).Msg("Original configuration saved")
+
+	if err := saveVPN(vpn, path); err != nil {
+		return err
+	}
+	if previous != "" && previous != vpn.StatePath() {
+		log.Info().Str("path", previous).Msg("The previous state file is no longer used, remove it once the migration is checked")
+	}
+	if gateways != "" && vpn.StatePath() != "" {
+		log.Info().Str("path", gateways).Msg("The gateways are moved to the state file, remove the previous file once the migration is checked")
+	}
+	log.Info().
+		Int("from", version).
+		Int("to", models.ConfigVersion).
+		Str("state", vpn.StatePath()).
+		Int("peers", vpn.NumberOfPeers()).
+		Msg("Wireguard VPN migrated")
+	return nil
+}
+
+// convertState moves the state of the vpn to a state file in the given
+// format (json or yaml) or into the server file (ini)
+func convertState(vpn *models.WGVPN, path string, format string) error {
+	switch format {
+	case "":
+		return nil
+	case STATE_INI:
+		vpn.SetStatePath("")
+		return nil
+	default:
+		statePath, err := stateFilePath(path, format)
+		if err != nil {
+			return fmt.Errorf("%w (or %s)", err, STATE_INI)
+		}
+		vpn.SetStatePath(statePath)
+		return nil
+	}
+}
+
+// migrateLegacy reads the vpn from the legacy layout (metadata in
+// .wg-easy-vpn.conf and client configs in clients/)
+func migrateLegacy(name string, path string, file *utils.File, endpoint string) (*models.WGVPN, error) {
+	metadataPath := legacyMetadata(name, path)
+	if metadataPath == "" {
+		return nil, fmt.Errorf("%s has no wg-easy-vpn metadata (use adopt for a plain wg-quick config)", path)
+	}
+	metadata, err := utils.ParseFile(metadataPath)
+	if err != nil {
+		return nil, err
+	}
+	if endpoint != "" {
+		// the flag fills the gap of the legacy metadata
+		if sec, err := metadata.GetSection(name); err == nil && !sec.HasKey("Endpoint") {
+			sec.Set("Endpoint", endpoint)
+		}
+	}
+
+	clients := make(map[string]*utils.File)
+	clientDir := filepath.Join(filepath.Dir(path), filepath.Base(DefaultClientConfigDirectory))
+	entries, _ := filepath.Glob(filepath.Join(clientDir, "*"+CONFIG_SUFFIX))
+	for _, entry := range entries {
+		client, err := utils.ParseFile(entry)
+		if err != nil {
+			log.Warn().Err(err).Str("path", entry).Msg("Skipping legacy client config")
+			continue
+		}
+		clients[strings.TrimSuffix(filepath.Base(entry), CONFIG_SUFFIX)] = client
+	}
+	log.Debug().Str("metadata", metadataPath).Int("clients", len(clients)).Msg("Reading legacy layout")
+
+	vpn, err := models.MigrateLegacy(name, file, metadata, clients)
+	if err != nil {
+		return nil, err
+	}
+	log.Info().
+		Str("metadata", metadataPath).
+		Str("clients", clientDir).
+		Msg("The legacy metadata and client configs are no longer used, remove them once the migration is checked")
+	return vpn, nil
+}
+
+// legacyMetadata returns the path of the legacy metadata of a connection
+// (empty if there is none)
+func legacyMetadata(name string, path string) string {
+	metadataPath := filepath.Join(filepath.Dir(path), DefaultMetadataFile)
+	metadata, err := utils.ParseFile(metadataPath)
+	if err != nil {
+		return ""
+	}
+	if _, err := metadata.GetSection(name); err != nil {
+		return ""
+	}
+	return metadataPath
+}
+
+// checkLayout refuses the configs of an older layout which cannot be
+// read as they are (the unversioned ones are upgraded when saved)
+func checkLayout(name string, path string, file *utils.File) error {
+	version, err := models.LayoutVersion(file)
+	if err != nil {
+		return err
+	}
+	if version == models.LayoutPlain {
+		if metadataPath := legacyMetadata(name, path); metadataPath != "" {
+			return fmt.Errorf("%s has the legacy layout (metadata in %s), run 'wg-easy-vpn migrate %s' first", path, metadataPath, name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/asiffer/wg-easy-vpn/models"
+	"github.com/asiffer/wg-easy-vpn/utils"
+)
+
+// setupLegacy copies the legacy layout (server file, metadata and client
+// configs) into a temporary directory
+func setupLegacy(t *testing.T) string {
+	t.Helper()
+	dir := testDir(t)
+	if err := os.Mkdir(filepath.Join(dir, "clients"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"wg0.conf", DefaultMetadataFile, filepath.Join("clients", "client0.conf")} {
+		content, err := os.ReadFile(filepath.Join("../test/legacy", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), content, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return filepath.Join(dir, "wg0.conf")
+}
+
+func TestMigrateActionLegacy(t *testing.T) {
+	configPath := setupLegacy(t)
+
+	// the legacy layout must be migrated first
+	err := addAction(context.Background(), &addConfig{name: configPath, client: "laptop"})
+	if err == nil || !strings.Contains(err.Error(), "migrate") {
+		t.Fatalf("expected a migration error, got %v", err)
+	}
+
+	if err := migrateAction(context.Background(), &migrateConfig{name: configPath}); err != nil {
+		t.Fatalf("migrateAction failed: %v", err)
+	}
+	if _, err := os.Stat(configPath + BACKUP_SUFFIX); err != nil {
+		t.Errorf("expected a backup of the original file: %v", err)
+	}
+	file, err := utils.ParseFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version, _ := models.LayoutVersion(file); version != models.ConfigVersion {
+		t.Errorf("expected version %d, got %d", models.ConfigVersion, version)
+	}
+	peer, _ := file.GetSection("Peer")
+	if comments := peer.Comments(); len(comments) == 0 || comments[0] != "client0" {
+		t.Errorf("expected the peer to be named client0:\n%s", file.String())
+	}
+
+	// the migrated vpn is usable
+	_, err = captureStdout(t, func() error {
+		return addAction(context.Background(), &addConfig{name: configPath, client: "laptop"})
+	})
+	if err != nil {
+		t.Fatalf("addAction failed after migration: %v", err)
+	}
+}
+
+func TestMigrateActionEmbedded(t *testing.T) {
+	dir := testDir(t)
+	configPath := setupVPN(t, dir)
+
+	// remove the version stamp (1.0b1 layout)
+	file, _ := utils.ParseFile(configPath)
+	content := strings.Replace(file.String(), "Version = 2\n", "", 1)
+	if err := os.WriteFile(configPath, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := migrateAction(context.Background(), &migrateConfig{name: configPath}); err != nil {
+		t.Fatalf("migrateAction failed: %v", err)
+	}
+	if _, err := os.Stat(configPath + BACKUP_SUFFIX); err != nil {
+		t.Errorf("expected a backup of the original file: %v", err)
+	}
+	file, _ = utils.ParseFile(configPath)
+	if version, _ := models.LayoutVersion(file); version != models.ConfigVersion {
+		t.Errorf("expected version %d, got %d", models.ConfigVersion, version)
+	}
+
+	// nothing to do
+	os.Remove(configPath + BACKUP_SUFFIX)
+	if err := migrateAction(context.Background(), &migrateConfig{name: configPath}); err != nil {
+		t.Fatalf("migrateAction failed: %v", err)
+	}
+	if _, err := os.Stat(configPath + BACKUP_SUFFIX); err == nil {
+		t.Errorf("no backup expected for an up to date config")
+	}
+}
+
+func TestMigrateActionState(t *testing.T) {
+	dir := testDir(t)
+	configPath := setupVPN(t, dir)
+	_, err := captureStdout(t, func() error {
+		return addAction(context.Background(), &addConfig{name: configPath, client: "laptop", tags: []string{"staff"}})
+	})
+	if err != nil {
+		t.Fatalf("addAction failed: %v", err)
+	}
+
+	// server file -> state file
+	if err := migrateAction(context.Background(), &migrateConfig{name: configPath, state: models.StateYAML}); err != nil {
+		t.Fatalf("migrateAction failed: %v", err)
+	}
+	statePath := filepath.Join(dir, "wg0.wg-easy.yaml")
+	state, err := models.ReadStateFile(statePath)
+	if err != nil {
+		t.Fatalf("failed to read state: %v", err)
+	}
+	if len(state.Peers) != 1 || state.Peers[0].Name != "laptop" || state.Peers[0].CreatedAt.IsZero() {
+		t.Errorf("unexpected peers in state: %+v", state.Peers)
+	}
+	file, _ := utils.ParseFile(configPath)
+	def, _ := file.GetSection(utils.DEFAULT_SECTION)
+	if ref, _ := def.Get("State"); ref != statePath || def.HasKey("Network") {
+		t.Errorf("expected the server file to reference the state:\n%s", file.String())
+	}
+
+	// state file -> server file
+	if err := migrateAction(context.Background(), &migrateConfig{name: configPath, state: STATE_INI}); err != nil {
+		t.Fatalf("migrateAction failed: %v", err)
+	}
+	vpn, _, unlock, err := loadVPN(configPath)
+	if err != nil {
+		t.Fatalf("loadVPN failed: %v", err)
+	}
+	unlock()
+	if vpn.StatePath() != "" || vpn.NumberOfPeers() != 1 || vpn.Peers()[0].Name() != "laptop" {
+		t.Errorf("expected the state in the server file, got %s with %d peers", vpn.StatePath(), vpn.NumberOfPeers())
+	}
+	// nothing is lost
+	if peer := vpn.Peers()[0]; !slices.Equal(peer.Tags(), []string{"staff"}) || !peer.CreatedAt().Equal(state.Peers[0].CreatedAt) {
+		t.Errorf("expected the tags and the creation date, got %v %v", peer.Tags(), peer.CreatedAt())
+	}
+
+	if err := migrateAction(context.Background(), &migrateConfig{name: configPath, state: "toml"}); err == nil {
+		t.Error("expected error with an unknown state format")
+	}
+}
+
+func TestMigrateActionPlain(t *testing.T) {
+	dir := testDir(t)
+	configPath := testConfigPath(t, dir, "wg0")
+	content, _ := os.ReadFile("../test/testfile.conf")
+	os.WriteFile(configPath, content, 0600)
+	if err := migrateAction(context.Background(), &migrateConfig{name: configPath}); err == nil {
+		t.Error("expected error for a plain wg-quick config")
+	}
+}
@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v3"
+)
+
+var poolCmd = cli.Command{
+	Name:                  "pool",
+	Usage:                 "Show the usage of the address pools (networks) of a Wireguard VPN",
+	EnableShellCompletion: true,
+	Suggest:               true,
+	Flags: []cli.Flag{
+		&warnFlag,
+		&jsonFlag,
+	},
+	Arguments: []cli.Argument{
+		&connArg,
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		config, err := buildPoolCmdConfig(c)
+		if err != nil {
+			return err
+		}
+		return poolAction(ctx, config)
+	},
+}
+
+type poolConfig struct {
+	name string
+	warn float64 // usage (percent) above which the command fails (0 = off)
+	json bool
+}
+
+// poolReport is the usage of a network (json output)
+type poolReport struct {
+	Network  string  `json:"network"`
+	Total    uint64  `json:"total"`
+	Used     uint64  `json:"used"`
+	Reserved uint64  `json:"reserved"`
+	Free     uint64  `json:"free"`
+	Next     string  `json:"next,omitempty"`
+	Usage    float64 `json:"usage"` // percent of used and reserved addresses
+}
+
+func buildPoolCmdConfig(c *cli.Command) (*poolConfig, error) {
+	cfg := &poolConfig{
+		name: c.StringArg(CONNECTION_ARG),
+		warn: c.Float("warn"),
+		json: c.Bool("json"),
+	}
+	log.Debug().
+		Str("name", cfg.name).
+		Float64("warn", cfg.warn).
+		Bool("json", cfg.json).
+		Msg("Pool command configuration")
+	return cfg, nil
+}
+
+func poolAction(_ context.Context, config *poolConfig) error {
+	if config.warn < 0 || config.warn > 100 {
+		return fmt.Errorf("--warn must be a percentage (0-100)")
+	}
+	vpn, path, unlock, err := loadVPN(config.name)
+	if err != nil {
+		return err
+	}
+	unlock()
+	log.Debug().Str("path", path).Int("networks", len(vpn.Networks())).Msg("Loaded existing VPN configuration")
+
+	reports := make([]poolReport, 0)
+	for _, pool := range vpn.Pools() {
+		report := poolReport{
+			Network:  pool.Network.String(),
+			Total:    pool.Total,
+			Used:     pool.Used,
+			Reserved: pool.Reserved,
+			Free:     pool.Free(),
+			Usage:    100 * (float64(pool.Used) + float64(pool.Reserved)) / float64(pool.Total),
+		}
+		if pool.Next != nil {
+			report.Next = pool.Next.String()
+		}
+		reports = append(reports, report)
+	}
+	return printPools(os.Stdout, reports, config.warn, config.json)
+}
+
+// printPools writes the usage of the pools (text or json) and fails if one
+// of them is exhausted or above the warning threshold (for cron)
+func printPools(w io.Writer, reports []poolReport, warn float64, asJSON bool) error {
+	if asJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(reports); err != nil {
+			return err
+		}
+	} else {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "NETWORK\tTOTAL\tUSED\tRESERVED\tFREE\tNEXT\tUSAGE")
+		for _, r := range reports {
+			next := r.Next
+			if next == "" {
+				next = "-"
+			}
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%s\t%.1f%%\n", r.Network, r.Total, r.Used, r.Reserved, r.Free, next, r.Usage)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	alerts := 0
+	for _, r := range reports {
+		switch {
+		case r.Next == "":
+			log.Error().Str("network", r.Network).Msg("No address left for the new clients")
+			alerts++
+		case warn > 0 && r.Usage >= warn:
+			log.Warn().Str("network", r.Network).Float64("usage", r.Usage).Float64("threshold", warn).Msg("Address pool almost exhausted")
+			alerts++
+		}
+	}
+	if alerts > 0 {
+		return fmt.Errorf("%d address pool(s) exhausted or above the threshold", alerts)
+	}
+	return nil
+}
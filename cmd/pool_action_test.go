@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/asiffer/wg-easy-vpn/models"
+)
+
+// setupSmallVPN creates a VPN with a /29 network (6 client addresses)
+func setupSmallVPN(t *testing.T, dir string) string {
+	t.Helper()
+	configPath := testConfigPath(t, dir, "wg0")
+	initCfg := &initConfig{
+		endpoint: "vpn.example.com:51820",
+		networks: []net.IPNet{{IP: net.ParseIP("10.0.0.0"), Mask: net.CIDRMask(29, 32)}},
+		port:     51820,
+		conn:     configPath,
+	}
+	if err := initAction(context.Background(), initCfg); err != nil {
+		t.Fatalf("setup VPN failed: %v", err)
+	}
+	return configPath
+}
+
+func addClients(t *testing.T, configPath string, n int) error {
+	t.Helper()
+	for i := range n {
+		_, err := captureStdout(t, func() error {
+			return addAction(context.Background(), &addConfig{name: configPath, client: fmt.Sprintf("client%d", i)})
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestPoolAction(t *testing.T) {
+	dir := testDir(t)
+	configPath := setupSmallVPN(t, dir)
+	if err := addClients(t, configPath, 5); err != nil {
+		t.Fatalf("addAction failed: %v", err)
+	}
+
+	output, err := captureStdout(t, func() error {
+		return poolAction(context.Background(), &poolConfig{name: configPath})
+	})
+	if err != nil {
+		t.Fatalf("poolAction failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected header and 1 row, got: %s", output)
+	}
+	// 8 addresses: network, server, 5 clients and 10.0.0.7 left
+	for _, part := range []string{"10.0.0.0/29", " 8 ", " 5 ", " 2 ", " 1 ", "10.0.0.7", "87.5%"} {
+		if !strings.Contains(lines[1]+" ", part) {
+			t.Errorf("expected %q in %q", part, lines[1])
+		}
+	}
+
+	// threshold
+	_, err = captureStdout(t, func() error {
+		return poolAction(context.Background(), &poolConfig{name: configPath, warn: 80})
+	})
+	if err == nil {
+		t.Error("expected an error above the threshold")
+	}
+	_, err = captureStdout(t, func() error {
+		return poolAction(context.Background(), &poolConfig{name: configPath, warn: 90})
+	})
+	if err != nil {
+		t.Errorf("unexpected error below the threshold: %v", err)
+	}
+	if err := poolAction(context.Background(), &poolConfig{name: configPath, warn: 150}); err == nil {
+		t.Error("expected an error for an invalid threshold")
+	}
+
+	// exhaustion
+	_, err = captureStdout(t, func() error {
+		return addAction(context.Background(), &addConfig{name: configPath, client: "last"})
+	})
+	if err != nil {
+		t.Fatalf("addAction failed: %v", err)
+	}
+	output, err = captureStdout(t, func() error {
+		return poolAction(context.Background(), &poolConfig{name: configPath, json: true})
+	})
+	if err == nil {
+		t.Error("expected an error for an exhausted pool")
+	}
+	reports := make([]poolReport, 0)
+	if err := json.Unmarshal([]byte(output), &reports); err != nil {
+		t.Fatalf("invalid json: %v\n%s", err, output)
+	}
+	if len(reports) != 1 || reports[0].Free != 0 || reports[0].Next != "" || reports[0].Usage != 100 {
+		t.Errorf("unexpected report %+v", reports)
+	}
+
+	_, err = captureStdout(t, func() error {
+		return addAction(context.Background(), &addConfig{name: configPath, client: "one-too-many"})
+	})
+	if !errors.Is(err, models.ErrPoolExhausted) {
+		t.Errorf("expected ErrPoolExhausted, got %v", err)
+	}
+}
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/asiffer/wg-easy-vpn/models"
+	"github.com/asiffer/wg-easy-vpn/utils"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v3"
+)
+
+var renderCmd = cli.Command{
+	Name:                  "render",
+	Usage:                 "Print the server config for wg or wg-quick, or write it for systemd-networkd",
+	EnableShellCompletion: true,
+	Suggest:               true,
+	Flags: []cli.Flag{
+		&formatFlag,
+		&renderGatewayFlag,
+		&outputFlag,
+	},
+	Arguments: []cli.Argument{
+		&connArg,
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		config, err := buildRenderCmdConfig(c)
+		if err != nil {
+			return err
+		}
+		return renderAction(ctx, config)
+	},
+}
+
+type renderConfig struct {
+	name    string
+	format  string
+	gateway string // empty = main server
+	output  string // directory of the systemd-networkd files
+}
+
+func buildRenderCmdConfig(c *cli.Command) (*renderConfig, error) {
+	cfg := &renderConfig{
+		name:    c.StringArg(CONNECTION_ARG),
+		format:  c.String("format"),
+		gateway: c.String("gateway"),
+		output:  c.String("output"),
+	}
+	log.Debug().
+		Str("name", cfg.name).
+		Str("format", cfg.format).
+		Str("gateway", cfg.gateway).
+		Str("output", cfg.output).
+		Msg("render command configuration")
+	return cfg, nil
+}
+
+func renderAction(_ context.Context, config *renderConfig) error {
+	if config.format == models.FormatNetworkd && config.output == "" {
+		return fmt.Errorf("--output is required with the %s format", models.FormatNetworkd)
+	}
+	vpn, _, unlock, err := loadVPN(config.name)
+	if err != nil {
+		return err
+	}
+	unlock()
+	iface, _, err := ConfigurationInfo(config.name)
+	if err != nil {
+		return err
+	}
+
+	file := utils.NewFile()
+	if config.gateway != "" {
+		if err := vpn.PopulateGateway(config.gateway, file); err != nil {
+			return err
+		}
+	} else {
+		vpn.PopulateServer(file)
+	}
+	if config.format == models.FormatNetworkd {
+		return writeNetworkd(file, iface, config.output)
+	}
+	if err := models.StripFile(file, config.format); err != nil {
+		return err
+	}
+	file.Log(log.Debug()).Str("format", config.format).Msg("Rendering config file in memory")
+
+	_, err = file.WriteTo(os.Stdout)
+	return err
+}
+
+// writeNetworkd converts a populated config to systemd-networkd files
+// written into a directory
+func writeNetworkd(file *utils.File, iface string, output string) error {
+	files, err := renderNetworkd(file, iface)
+	if err != nil {
+		return err
+	}
+	return writeNetworkdFiles(files, output)
+}
+
+// renderNetworkd converts a populated config to systemd-networkd files in
+// memory (what cannot be converted is logged)
+func renderNetworkd(file *utils.File, iface string) ([]models.NetworkdFile, error) {
+	files, report, err := models.Networkd(file, iface)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range report {
+		log.Warn().Msg(line)
+	}
+	return files, nil
+}
+
+// writeNetworkdFiles writes systemd-networkd files into a directory
+func writeNetworkdFiles(files []models.NetworkdFile, output string) error {
+	if err := os.MkdirAll(output, 0700); err != nil {
+		return fmt.Errorf("error while creating output directory %s: %w", output, err)
+	}
+	for _, f := range files {
+		// systemd-networkd reads the key files as systemd-network
+		mode := os.FileMode(0644)
+		if f.Secret {
+			mode = 0640
+		}
+		path := filepath.Join(output, f.Name)
+		if err := os.WriteFile(path, []byte(f.Content), mode); err != nil {
+			return err
+		}
+		log.Debug().Str("path", path).Msg("systemd-networkd file written")
+	}
+	log.Info().
+		Str("output", output).
+		Str("dir", models.NetworkdDir).
+		Msg("systemd-networkd config written (install the key files as root:systemd-network)")
+	return nil
+}
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/asiffer/wg-easy-vpn/models"
+	"github.com/asiffer/wg-easy-vpn/utils"
+)
+
+func TestRenderAction(t *testing.T) {
+	dir := testDir(t)
+	configPath := setupVPN(t, dir)
+	if _, err := captureStdout(t, func() error {
+		return addAction(context.Background(), &addConfig{name: configPath, client: "laptop"})
+	}); err != nil {
+		t.Fatalf("addAction failed: %v", err)
+	}
+	if _, err := captureStdout(t, func() error {
+		return gatewayAddAction(context.Background(), &gatewayConfig{
+			name:     configPath,
+			gateway:  "london",
+			endpoint: "london.example.com:51820",
+			port:     51820,
+		})
+	}); err != nil {
+		t.Fatalf("gatewayAddAction failed: %v", err)
+	}
+
+	t.Run("wg", func(t *testing.T) {
+		output, err := captureStdout(t, func() error {
+			return renderAction(context.Background(), &renderConfig{name: configPath, format: models.FormatWG})
+		})
+		if err != nil {
+			t.Fatalf("renderAction failed: %v", err)
+		}
+		if strings.Contains(output, "Address") || strings.Contains(output, "Network") || strings.Contains(output, "[Gateway]") {
+			t.Errorf("unexpected wg-quick or wg-easy-vpn keys in:\n%s", output)
+		}
+		if strings.Count(output, "[Peer]") != 2 {
+			t.Errorf("expected the gateway and the client as peers:\n%s", output)
+		}
+	})
+
+	t.Run("gateway", func(t *testing.T) {
+		output, err := captureStdout(t, func() error {
+			return renderAction(context.Background(), &renderConfig{name: configPath, format: models.FormatWGQuick, gateway: "london"})
+		})
+		if err != nil {
+			t.Fatalf("renderAction failed: %v", err)
+		}
+		if !strings.Contains(output, "Address = 10.0.0.3/24") || !strings.Contains(output, "Endpoint = vpn.example.com:51820") {
+			t.Errorf("expected the london config:\n%s", output)
+		}
+	})
+
+	t.Run("networkd", func(t *testing.T) {
+		output := filepath.Join(dir, "networkd")
+		err := renderAction(context.Background(), &renderConfig{name: configPath, format: models.FormatNetworkd, output: output})
+		if err != nil {
+			t.Fatalf("renderAction failed: %v", err)
+		}
+		for _, name := range []string{"wg0.key", "wg0-peer2.psk", "wg0.netdev", "wg0.network"} {
+			if !utils.FileExists(filepath.Join(output, name)) {
+				t.Errorf("expected %s in the output directory", name)
+			}
+		}
+		info, err := os.Stat(filepath.Join(output, "wg0.key"))
+		if err != nil || info.Mode().Perm() != 0640 {
+			t.Errorf("expected a key file readable by its group only, got %v", info)
+		}
+		netdev, _ := os.ReadFile(filepath.Join(output, "wg0.netdev"))
+		if strings.Count(string(netdev), "[WireGuardPeer]") != 2 || !strings.Contains(string(netdev), "# london") {
+			t.Errorf("expected the gateway and the client as peers:\n%s", netdev)
+		}
+
+		err = renderAction(context.Background(), &renderConfig{name: configPath, format: models.FormatNetworkd})
+		if err == nil {
+			t.Error("expected an error without output directory")
+		}
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		_, err := captureStdout(t, func() error {
+			return renderAction(context.Background(), &renderConfig{name: configPath, format: "yaml"})
+		})
+		if err == nil {
+			t.Error("expected an error for an unknown format")
+		}
+	})
+}
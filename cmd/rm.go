@@ -5,8 +5,6 @@ import (
 	"fmt"
 
 	"github.com/asiffer/wg-easy-vpn/crypto"
-	"github.com/asiffer/wg-easy-vpn/models"
-	"github.com/asiffer/wg-easy-vpn/utils"
 	"github.com/rs/zerolog/log"
 	"github.com/urfave/cli/v3"
 )
@@ -18,6 +16,7 @@ var rmCmd = cli.Command{
 	Suggest:               true,
 	Flags: []cli.Flag{
 		&peerFlag,
+		&applyFlag,
 	},
 	Arguments: []cli.Argument{
 		&connArg,
@@ -34,40 +33,38 @@ var rmCmd = cli.Command{
 type rmConfig struct {
 	name    string
 	peerKey string
+	apply   bool // remove the peer from the running interface
 }
 
 func buildRmCmdConfig(c *cli.Command) (*rmConfig, error) {
 	cfg := &rmConfig{
 		name:    c.StringArg(CONNECTION_ARG),
 		peerKey: c.String("peer"),
+		apply:   c.Bool("apply"),
 	}
 	log.Debug().
 		Str("name", cfg.name).
 		Str("peer", cfg.peerKey).
+		Bool("apply", cfg.apply).
 		Msg("rm command configuration")
 
 	return cfg, nil
 }
 
-func rmAction(_ context.Context, config *rmConfig) error {
-	// Get connection name and path
-	_, path, err := ConfigurationInfo(config.name)
+func rmAction(ctx context.Context, config *rmConfig) error {
+	// Get connection name
+	name, _, err := ConfigurationInfo(config.name)
 	if err != nil {
 		return err
 	}
-	log.Debug().Str("path", path).Msg("Loading VPN configuration")
 
-	// Parse existing VPN configuration
-	file, err := utils.ParseFile(path)
-	if err != nil {
-		return err
-	}
-
-	// Load VPN from file
-	vpn, err := models.VPNFromFile(config.name, file)
+	// Load VPN from file (locked until saved)
+	vpn, path, unlock, err := loadVPN(config.name)
 	if err != nil {
 		return err
 	}
+	defer unlock()
+	log.Debug().Str("path", path).Msg("Loaded VPN configuration")
 
 	// Parse the public key
 	key := crypto.NewKey()
@@ -77,6 +74,7 @@ func rmAction(_ context.Context, config *rmConfig) error {
 	}
 
 	// Remove the peer
+	before := devicePeers(vpn)
 	err = vpn.RemovePeer(key)
 	if err != nil {
 		return err
@@ -84,13 +82,12 @@ func rmAction(_ context.Context, config *rmConfig) error {
 	log.Info().Str("peer", config.peerKey).Msg("Peer removed from VPN")
 
 	// Update server configuration file
-	newServerFile := utils.NewFile()
-	vpn.Populate(newServerFile)
-	err = newServerFile.Save(path)
-	if err != nil {
+	if err := saveVPN(vpn, path); err != nil {
 		return err
 	}
-	log.Info().Str("path", path).Msg("Wireguard VPN configuration updated")
 
+	if config.apply {
+		return applyPeers(ctx, name, before, devicePeers(vpn))
+	}
 	return nil
 }
@@ -0,0 +1,162 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/asiffer/wg-easy-vpn/pkg/wgeasy"
+	"github.com/asiffer/wg-easy-vpn/server"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v3"
+)
+
+var serveCmd = cli.Command{
+	Name:                  "serve",
+	Usage:                 "Manage the clients of a Wireguard VPN through a REST API and a web UI",
+	EnableShellCompletion: true,
+	Suggest:               true,
+	Flags: []cli.Flag{
+		&listenFlag,
+		&tokenFlag,
+		&usersFlag,
+		&tlsCertFlag,
+		&tlsKeyFlag,
+	},
+	Arguments: []cli.Argument{
+		&connArg,
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		config, err := buildServeCmdConfig(c)
+		if err != nil {
+			return err
+		}
+		return serveAction(ctx, config)
+	},
+}
+
+type serveConfig struct {
+	name    string
+	listen  string
+	token   string
+	users   string
+	tlsCert string // empty = plain HTTP (loopback only)
+	tlsKey  string
+}
+
+// SHUTDOWN_TIMEOUT is the time given to the pending requests when the
+// server stops
+const SHUTDOWN_TIMEOUT = 5 * time.Second
+
+func buildServeCmdConfig(c *cli.Command) (*serveConfig, error) {
+	cfg := &serveConfig{
+		name:    c.StringArg(CONNECTION_ARG),
+		listen:  c.String("listen"),
+		token:   c.String("token"),
+		users:   c.String("users"),
+		tlsCert: c.String("tls-cert"),
+		tlsKey:  c.String("tls-key"),
+	}
+	log.Debug().
+		Str("name", cfg.name).
+		Str("listen", cfg.listen).
+		Bool("token", cfg.token != "").
+		Str("users", cfg.users).
+		Str("tls-cert", cfg.tlsCert).
+		Str("tls-key", cfg.tlsKey).
+		Msg("Serve command configuration")
+	return cfg, nil
+}
+
+func serveAction(ctx context.Context, config *serveConfig) error {
+	if err := checkTLS(config); err != nil {
+		return err
+	}
+	name, path, err := ConfigurationInfo(config.name)
+	if err != nil {
+		return err
+	}
+	log.Debug().Str("name", name).Str("path", path).Msg("Parsing connection location")
+
+	// fail early on an unusable config
+	vpn, err := wgeasy.Open(path)
+	if err != nil {
+		return err
+	}
+	vpn.Close()
+	var users []server.User
+	if config.users != "" {
+		if users, err = server.ReadUsersFile(config.users); err != nil {
+			return err
+		}
+	}
+	if config.token == "" && len(users) == 0 {
+		log.Warn().Msg("Neither --token nor --users given: only the shared configs are served")
+	}
+	srv := server.New(path, config.token, users)
+	listener, err := net.Listen("tcp", config.listen)
+	if err != nil {
+		return err
+	}
+	httpServer := &http.Server{
+		Handler:           srv.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	// stop gracefully on ctrl-c or systemctl stop
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go srv.PurgeShares(ctx)
+	done := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), SHUTDOWN_TIMEOUT)
+		defer cancel()
+		done <- httpServer.Shutdown(shutdownCtx)
+	}()
+	log.Info().
+		Str("address", listener.Addr().String()).
+		Str("path", path).
+		Bool("api", config.token != "").
+		Bool("tls", config.tlsCert != "").
+		Int("users", len(users)).
+		Msg("Serving the REST API and the web UI")
+	if config.tlsCert != "" {
+		err = httpServer.ServeTLS(listener, config.tlsCert, config.tlsKey)
+	} else {
+		err = httpServer.Serve(listener)
+	}
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return <-done
+}
+
+// checkTLS refuses to serve the tokens, the passwords and the configs in
+// plain HTTP to the network: without TLS, the server must listen on a
+// loopback address (behind a reverse proxy which terminates TLS)
+func checkTLS(config *serveConfig) error {
+	if (config.tlsCert == "") != (config.tlsKey == "") {
+		return fmt.Errorf("--tls-cert and --tls-key go together")
+	}
+	if config.tlsCert != "" {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(config.listen)
+	if err != nil {
+		return fmt.Errorf("invalid listen address %q (%w)", config.listen, err)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return fmt.Errorf("%s is not a loopback address: use --tls-cert and --tls-key, or listen on 127.0.0.1 behind a reverse proxy", config.listen)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServeAction(t *testing.T) {
+	dir := testDir(t)
+	configPath := setupVPN(t, dir)
+
+	t.Run("rejects an invalid users file", func(t *testing.T) {
+		users := filepath.Join(dir, "users.yaml")
+		if err := os.WriteFile(users, []byte("- name: alice\n  password: plain\n  role: user\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		err := serveAction(context.Background(), &serveConfig{name: configPath, listen: "127.0.0.1:0", users: users})
+		if err == nil {
+			t.Error("expected an error for a plain password")
+		}
+	})
+
+	t.Run("requires a managed config", func(t *testing.T) {
+		// a copy: the config is locked next to it
+		content, err := os.ReadFile("../test/wg0.conf")
+		if err != nil {
+			t.Fatal(err)
+		}
+		plain := filepath.Join(dir, "plain.conf")
+		if err := os.WriteFile(plain, content, 0600); err != nil {
+			t.Fatal(err)
+		}
+		err = serveAction(context.Background(), &serveConfig{name: plain, listen: "127.0.0.1:0", token: "secret"})
+		if err == nil {
+			t.Error("expected an error for a plain config")
+		}
+	})
+
+	t.Run("requires TLS out of loopback", func(t *testing.T) {
+		for _, listen := range []string{":8080", "0.0.0.0:8080", "192.0.2.1:8080"} {
+			err := serveAction(context.Background(), &serveConfig{name: configPath, listen: listen, token: "secret"})
+			if err == nil || !strings.Contains(err.Error(), "--tls-cert") {
+				t.Errorf("%s: expected a TLS error, got %v", listen, err)
+			}
+		}
+		err := serveAction(context.Background(), &serveConfig{name: configPath, listen: "127.0.0.1:0", token: "secret", tlsCert: "cert.pem"})
+		if err == nil {
+			t.Error("expected an error without --tls-key")
+		}
+	})
+
+	t.Run("serves TLS", func(t *testing.T) {
+		cert, key := writeTestCertificate(t, dir)
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		err := serveAction(ctx, &serveConfig{name: configPath, listen: "0.0.0.0:0", token: "secret", tlsCert: cert, tlsKey: key})
+		if err != nil {
+			t.Errorf("serveAction failed: %v", err)
+		}
+	})
+
+	t.Run("stops with the context", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		err := serveAction(ctx, &serveConfig{name: configPath, listen: "127.0.0.1:0", token: "secret"})
+		if err != nil {
+			t.Errorf("serveAction failed: %v", err)
+		}
+	})
+}
+
+// writeTestCertificate writes a self-signed certificate and its key (PEM)
+func writeTestCertificate(t *testing.T, dir string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawKey, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPath, keyPath := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: rawKey}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certPath, keyPath
+}
@@ -0,0 +1,220 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/asiffer/wg-easy-vpn/device"
+	"github.com/asiffer/wg-easy-vpn/models"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v3"
+)
+
+var statusCmd = cli.Command{
+	Name:                  "status",
+	Usage:                 "Show the live state (handshakes, transfer) of the peers of a running Wireguard VPN",
+	EnableShellCompletion: true,
+	Suggest:               true,
+	Flags: []cli.Flag{
+		&dumpFlag,
+	},
+	Arguments: []cli.Argument{
+		&connArg,
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		config, err := buildStatusCmdConfig(c)
+		if err != nil {
+			return err
+		}
+		return statusAction(ctx, config)
+	},
+}
+
+type statusConfig struct {
+	name string
+	dump string // file with the output of `wg show <iface> dump` (empty = kernel)
+}
+
+// peerStatus is a row of the status table
+type peerStatus struct {
+	name      string
+	endpoint  string
+	handshake time.Time
+	rx        uint64
+	tx        uint64
+	state     string
+}
+
+const (
+	stateOnline  = "online"
+	stateOffline = "offline"
+	// the peer is in the config but not on the device
+	stateNotLoaded = "not loaded"
+	// the client is kept in the config but it is not a peer
+	stateDisabled = "disabled"
+	// the peer is on the device but not in the config
+	unknownPeer = "(unknown)"
+)
+
+func buildStatusCmdConfig(c *cli.Command) (*statusConfig, error) {
+	cfg := &statusConfig{
+		name: c.StringArg(CONNECTION_ARG),
+		dump: c.String("dump"),
+	}
+	log.Debug().
+		Str("name", cfg.name).
+		Str("dump", cfg.dump).
+		Msg("status command configuration")
+	return cfg, nil
+}
+
+func statusAction(ctx context.Context, config *statusConfig) error {
+	vpn, _, unlock, err := loadVPN(config.name)
+	if err != nil {
+		return err
+	}
+	unlock()
+	iface, _, err := ConfigurationInfo(config.name)
+	if err != nil {
+		return err
+	}
+
+	dev, err := readDevice(ctx, iface, config.dump)
+	if err != nil {
+		return err
+	}
+	log.Debug().
+		Str("interface", iface).
+		Str("public_key", dev.PublicKey).
+		Int("peers", len(dev.Peers)).
+		Msg("Device state retrieved")
+
+	now := time.Now()
+	return printStatus(os.Stdout, peersStatus(vpn, dev, now), now)
+}
+
+// readDevice returns the state of the interface, either from the kernel
+// or from a dump file
+func readDevice(ctx context.Context, iface string, dump string) (*device.Device, error) {
+	switch dump {
+	case "":
+		return device.Dump(ctx, iface)
+	case "-":
+		return device.ParseDump(os.Stdin)
+	default:
+		f, err := os.Open(dump)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return device.ParseDump(f)
+	}
+}
+
+// peersStatus joins the peers of the vpn (clients and gateways) with the
+// device state (by public key). Peers only known by one side are kept.
+func peersStatus(vpn *models.WGVPN, dev *device.Device, now time.Time) []peerStatus {
+	names := make(map[string]string)
+	order := make([]string, 0)
+	for _, gw := range vpn.Servers() {
+		public := gw.ToRelay().Public()
+		if public == dev.PublicKey {
+			// the device itself
+			continue
+		}
+		names[public] = gw.Name()
+		order = append(order, public)
+	}
+	disabled := make(map[string]bool)
+	for _, peer := range vpn.Peers() {
+		names[peer.Public()] = peer.Name()
+		order = append(order, peer.Public())
+		disabled[peer.Public()] = peer.Disabled()
+	}
+
+	rows := make([]peerStatus, 0, len(order))
+	for _, public := range order {
+		row := peerStatus{name: names[public], state: stateNotLoaded}
+		if disabled[public] {
+			row.state = stateDisabled
+		}
+		if row.name == "" {
+			row.name = public
+		}
+		if p := dev.Peer(public); p != nil {
+			row.endpoint = p.Endpoint
+			row.handshake = p.LatestHandshake
+			row.rx = p.ReceiveBytes
+			row.tx = p.TransmitBytes
+			row.state = stateOffline
+			if p.Online(now) {
+				row.state = stateOnline
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	for _, p := range dev.Peers {
+		if _, ok := names[p.PublicKey]; ok {
+			continue
+		}
+		row := peerStatus{
+			name:      unknownPeer,
+			endpoint:  p.Endpoint,
+			handshake: p.LatestHandshake,
+			rx:        p.ReceiveBytes,
+			tx:        p.TransmitBytes,
+			state:     stateOffline,
+		}
+		if p.Online(now) {
+			row.state = stateOnline
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func printStatus(w io.Writer, rows []peerStatus, now time.Time) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tENDPOINT\tLATEST HANDSHAKE\tRX\tTX\tSTATUS")
+	for _, row := range rows {
+		endpoint := row.endpoint
+		if endpoint == "" {
+			endpoint = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			row.name,
+			endpoint,
+			formatHandshake(row.handshake, now),
+			formatBytes(row.rx),
+			formatBytes(row.tx),
+			row.state,
+		)
+	}
+	return tw.Flush()
+}
+
+func formatHandshake(handshake time.Time, now time.Time) string {
+	if handshake.IsZero() {
+		return "never"
+	}
+	return fmt.Sprintf("%s ago", now.Sub(handshake).Round(time.Second))
+}
+
+// formatBytes prints a size with binary prefixes (1.5 MiB)
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asiffer/wg-easy-vpn/device"
+)
+
+func TestStatusAction(t *testing.T) {
+	dir := testDir(t)
+	configPath := setupVPN(t, dir)
+	for _, client := range []string{"laptop", "phone"} {
+		_, err := captureStdout(t, func() error {
+			return addAction(context.Background(), &addConfig{name: configPath, client: client})
+		})
+		if err != nil {
+			t.Fatalf("addAction failed: %v", err)
+		}
+	}
+
+	vpn, _, unlock, err := loadVPN(configPath)
+	if err != nil {
+		t.Fatalf("loadVPN failed: %v", err)
+	}
+	unlock()
+	peers := vpn.Peers()
+	if len(peers) != 2 || peers[0].Name() != "laptop" || peers[1].Name() != "phone" {
+		t.Fatalf("expected named peers laptop and phone")
+	}
+
+	// laptop is connected, phone is not on the device and a stale
+	// peer remains on the device
+	server := vpn.Servers()[0].ToRelay().Public()
+	handshake := time.Now().Add(-10 * time.Second).Unix()
+	dump := fmt.Sprintf("priv\t%s\t51820\toff\n", server) +
+		fmt.Sprintf("%s\t(none)\t203.0.113.7:41952\t10.0.0.2/32\t%d\t2048\t1024\toff\n", peers[0].Public(), handshake) +
+		"JVzBpb4Tl6bA4iyEeTYfVbJ12fyH5Pgm29X/2F5I1yU=\t(none)\t(none)\t10.0.0.9/32\t0\t0\t0\toff\n"
+	dumpPath := filepath.Join(dir, "wg0.dump")
+	if err := os.WriteFile(dumpPath, []byte(dump), 0600); err != nil {
+		t.Fatalf("failed to write dump: %v", err)
+	}
+
+	output, err := captureStdout(t, func() error {
+		return statusAction(context.Background(), &statusConfig{name: configPath, dump: dumpPath})
+	})
+	if err != nil {
+		t.Fatalf("statusAction failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected header and 3 rows, got: %s", output)
+	}
+	expected := []struct {
+		name  string
+		parts []string
+	}{
+		{"laptop", []string{"203.0.113.7:41952", "2.0 KiB", "1.0 KiB", stateOnline}},
+		{"phone", []string{"never", stateNotLoaded}},
+		{unknownPeer, []string{"never", stateOffline}},
+	}
+	for i, e := range expected {
+		line := lines[i+1]
+		if !strings.HasPrefix(line, e.name) {
+			t.Errorf("row %d: expected %s, got: %s", i, e.name, line)
+		}
+		for _, part := range e.parts {
+			if !strings.Contains(line, part) {
+				t.Errorf("row %d: expected %q in %q", i, part, line)
+			}
+		}
+	}
+}
+
+func TestPeersStatusGateways(t *testing.T) {
+	dir := testDir(t)
+	configPath := setupVPN(t, dir)
+	_, err := captureStdout(t, func() error {
+		return gatewayAddAction(context.Background(), &gatewayConfig{
+			name:     configPath,
+			gateway:  "london",
+			endpoint: "london.example.com:51820",
+			port:     51820,
+		})
+	})
+	if err != nil {
+		t.Fatalf("gatewayAddAction failed: %v", err)
+	}
+	vpn, _, unlock, err := loadVPN(configPath)
+	if err != nil {
+		t.Fatalf("loadVPN failed: %v", err)
+	}
+	unlock()
+
+	// status of the main server: the gateway is one of its peers
+	dev := &device.Device{PublicKey: vpn.Servers()[0].ToRelay().Public()}
+	rows := peersStatus(vpn, dev, time.Now())
+	if len(rows) != 1 || rows[0].name != "london" {
+		t.Fatalf("expected the london gateway only, got %v", rows)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		input    uint64
+		expected string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1536, "1.5 KiB"},
+		{1048576, "1.0 MiB"},
+		{5 << 30, "5.0 GiB"},
+	}
+	for _, tt := range tests {
+		if got := formatBytes(tt.input); got != tt.expected {
+			t.Errorf("formatBytes(%d) = %s, expected %s", tt.input, got, tt.expected)
+		}
+	}
+}
@@ -1,7 +1,10 @@
 package crypto
 
 import (
+	"bytes"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
 	"fmt"
 
@@ -120,3 +123,16 @@ func (psk PresharedKey) UpdateFromBase64(s string) error {
 	}
 	return psk.UpdateFromBytes(raw)
 }
+
+// DerivePresharedKey derives the preshared key of a pair of peers from
+// a common secret (HMAC-SHA256 of both public keys). The result does not
+// depend on the order of the keys so both peers get the same PSK.
+func DerivePresharedKey(secret PresharedKey, a Key, b Key) PresharedKey {
+	if bytes.Compare(a, b) > 0 {
+		a, b = b, a
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(a)
+	mac.Write(b)
+	return PresharedKey(mac.Sum(nil))
+}
@@ -207,3 +207,24 @@ func TestPublicKeyDerivation(t *testing.T) {
 		t.Error("Multiple calls to Public() should return same result")
 	}
 }
+
+func TestDerivePresharedKey(t *testing.T) {
+	secret := NewRandomPresharedKey()
+	a := NewRandomKey().Public()
+	b := NewRandomKey().Public()
+	c := NewRandomKey().Public()
+
+	ab := DerivePresharedKey(secret, a, b)
+	if len(ab) != PSKLen {
+		t.Fatalf("Expected PSK length %d, got %d", PSKLen, len(ab))
+	}
+	if ab.Base64() != DerivePresharedKey(secret, b, a).Base64() {
+		t.Error("Derived PSK should not depend on the order of the keys")
+	}
+	if ab.Base64() == DerivePresharedKey(secret, a, c).Base64() {
+		t.Error("Two pairs should not share the same PSK")
+	}
+	if ab.Base64() == DerivePresharedKey(NewRandomPresharedKey(), a, b).Base64() {
+		t.Error("Two secrets should not give the same PSK")
+	}
+}
@@ -0,0 +1,193 @@
+// Package device reads and updates the state of a running Wireguard interface
+package device
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/asiffer/wg-easy-vpn/utils"
+)
+
+// OnlineTimeout is the maximum age of the latest handshake of an online
+// peer (wireguard renews the session every 2 minutes while it is used)
+const OnlineTimeout = 3 * time.Minute
+
+// none is the value of the empty fields in the dump
+const none = "(none)"
+
+// Device is the state of a Wireguard interface
+type Device struct {
+	PrivateKey string
+	PublicKey  string
+	ListenPort uint16
+	FwMark     uint32
+	Peers      []Peer
+}
+
+// Peer is the state of a peer of a Wireguard interface
+type Peer struct {
+	PublicKey           string
+	PresharedKey        string
+	Endpoint            string // empty if the peer has never been reached
+	AllowedIPs          []net.IPNet
+	LatestHandshake     time.Time // zero if no handshake happened
+	ReceiveBytes        uint64
+	TransmitBytes       uint64
+	PersistentKeepalive uint16 // seconds (0 = off)
+}
+
+// Online returns whether the peer has completed a handshake recently
+func (p *Peer) Online(now time.Time) bool {
+	if p.LatestHandshake.IsZero() {
+		return false
+	}
+	return now.Sub(p.LatestHandshake) < OnlineTimeout
+}
+
+// Peer returns the peer with the given public key (nil if not found)
+func (d *Device) Peer(public string) *Peer {
+	for i := range d.Peers {
+		if d.Peers[i].PublicKey == public {
+			return &d.Peers[i]
+		}
+	}
+	return nil
+}
+
+// Dump runs `wg show <iface> dump` and parses its output
+func Dump(ctx context.Context, iface string) (*Device, error) {
+	out, err := exec.CommandContext(ctx, "wg", "show", iface, "dump").Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return nil, fmt.Errorf("error while reading interface %s (%s)", iface, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, fmt.Errorf("error while reading interface %s (%w)", iface, err)
+	}
+	return ParseDump(bytes.NewReader(out))
+}
+
+// ParseDump parses the output of `wg show <iface> dump`. The first line
+// describes the interface, the next ones its peers (tab separated fields)
+func ParseDump(r io.Reader) (*Device, error) {
+	scanner := bufio.NewScanner(r)
+	var dev *Device
+	lineno := 0
+	for scanner.Scan() {
+		lineno++
+		line := strings.TrimRight(scanner.Text(), "\r\n")
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if dev == nil {
+			d, err := parseInterface(fields)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineno, err)
+			}
+			dev = d
+			continue
+		}
+		peer, err := parsePeer(fields)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineno, err)
+		}
+		dev.Peers = append(dev.Peers, *peer)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if dev == nil {
+		return nil, fmt.Errorf("empty dump")
+	}
+	return dev, nil
+}
+
+func parseInterface(fields []string) (*Device, error) {
+	if len(fields) != 4 {
+		return nil, fmt.Errorf("invalid interface line (expected 4 fields, got %d)", len(fields))
+	}
+	port, err := strconv.ParseUint(fields[2], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid listen port %q (%w)", fields[2], err)
+	}
+	fwmark, err := parseFwMark(fields[3])
+	if err != nil {
+		return nil, err
+	}
+	return &Device{
+		PrivateKey: optional(fields[0]),
+		PublicKey:  optional(fields[1]),
+		ListenPort: uint16(port),
+		FwMark:     fwmark,
+	}, nil
+}
+
+func parsePeer(fields []string) (*Peer, error) {
+	if len(fields) != 8 {
+		return nil, fmt.Errorf("invalid peer line (expected 8 fields, got %d)", len(fields))
+	}
+	peer := &Peer{
+		PublicKey:    fields[0],
+		PresharedKey: optional(fields[1]),
+		Endpoint:     optional(fields[2]),
+	}
+
+	if ips := optional(fields[3]); ips != "" {
+		allowed, err := utils.ParseIPNetList(strings.Split(ips, ","))
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed ips %q (%w)", fields[3], err)
+		}
+		peer.AllowedIPs = allowed
+	}
+
+	handshake, err := strconv.ParseInt(fields[4], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid latest handshake %q (%w)", fields[4], err)
+	}
+	if handshake > 0 {
+		peer.LatestHandshake = time.Unix(handshake, 0)
+	}
+
+	if peer.ReceiveBytes, err = strconv.ParseUint(fields[5], 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid received bytes %q (%w)", fields[5], err)
+	}
+	if peer.TransmitBytes, err = strconv.ParseUint(fields[6], 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid transmitted bytes %q (%w)", fields[6], err)
+	}
+
+	if fields[7] != "off" {
+		keepalive, err := strconv.ParseUint(fields[7], 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid persistent keepalive %q (%w)", fields[7], err)
+		}
+		peer.PersistentKeepalive = uint16(keepalive)
+	}
+	return peer, nil
+}
+
+func parseFwMark(raw string) (uint32, error) {
+	if raw == "off" {
+		return 0, nil
+	}
+	mark, err := strconv.ParseUint(raw, 0, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid fwmark %q (%w)", raw, err)
+	}
+	return uint32(mark), nil
+}
+
+// optional turns the "(none)" placeholder into an empty string
+func optional(field string) string {
+	if field == none {
+		return ""
+	}
+	return field
+}
@@ -0,0 +1,141 @@
+package device
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDump(t *testing.T) {
+	f, err := os.Open("../test/wg0.dump")
+	if err != nil {
+		t.Fatalf("failed to open fixture: %v", err)
+	}
+	defer f.Close()
+
+	dev, err := ParseDump(f)
+	if err != nil {
+		t.Fatalf("ParseDump failed: %v", err)
+	}
+
+	if dev.PublicKey != "q4OQ6Ez3jvvB4lmjy3yCBl3HBQaEsh9aSJ9vmYVdh1c=" {
+		t.Errorf("unexpected public key %s", dev.PublicKey)
+	}
+	if dev.ListenPort != 51027 {
+		t.Errorf("expected listen port 51027, got %d", dev.ListenPort)
+	}
+	if dev.FwMark != 0 {
+		t.Errorf("expected no fwmark, got %d", dev.FwMark)
+	}
+	if len(dev.Peers) != 3 {
+		t.Fatalf("expected 3 peers, got %d", len(dev.Peers))
+	}
+
+	t.Run("connected peer", func(t *testing.T) {
+		p := dev.Peer("+k5f1ALR7Q+BS5EtJhTl2ABgh3DG8h48sHAZIAIRkU0=")
+		if p == nil {
+			t.Fatal("peer not found")
+		}
+		if p.Endpoint != "203.0.113.7:41952" {
+			t.Errorf("unexpected endpoint %s", p.Endpoint)
+		}
+		if p.PresharedKey == "" {
+			t.Error("expected a preshared key")
+		}
+		if !p.LatestHandshake.Equal(time.Unix(1760000000, 0)) {
+			t.Errorf("unexpected handshake %v", p.LatestHandshake)
+		}
+		if p.ReceiveBytes != 1048576 || p.TransmitBytes != 524288 {
+			t.Errorf("unexpected transfer rx=%d tx=%d", p.ReceiveBytes, p.TransmitBytes)
+		}
+		if p.PersistentKeepalive != 25 {
+			t.Errorf("expected keepalive 25, got %d", p.PersistentKeepalive)
+		}
+	})
+
+	t.Run("several allowed ips", func(t *testing.T) {
+		p := dev.Peers[1]
+		if len(p.AllowedIPs) != 2 || p.AllowedIPs[1].String() != "192.168.10.0/24" {
+			t.Errorf("unexpected allowed ips %v", p.AllowedIPs)
+		}
+		if p.PresharedKey != "" {
+			t.Errorf("expected no preshared key, got %s", p.PresharedKey)
+		}
+	})
+
+	t.Run("never connected peer", func(t *testing.T) {
+		p := dev.Peers[2]
+		if p.Endpoint != "" {
+			t.Errorf("expected no endpoint, got %s", p.Endpoint)
+		}
+		if !p.LatestHandshake.IsZero() {
+			t.Errorf("expected no handshake, got %v", p.LatestHandshake)
+		}
+		if p.PersistentKeepalive != 0 {
+			t.Errorf("expected keepalive off, got %d", p.PersistentKeepalive)
+		}
+	})
+
+	if dev.Peer("unknown") != nil {
+		t.Error("expected nil for an unknown peer")
+	}
+}
+
+func TestParseDumpErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"empty", ""},
+		{"interface fields", "priv\tpub\t51820\n"},
+		{"listen port", "priv\tpub\tport\toff\n"},
+		{"fwmark", "priv\tpub\t51820\tmark\n"},
+		{"peer fields", "priv\tpub\t51820\toff\npub\t(none)\t(none)\n"},
+		{"allowed ips", "priv\tpub\t51820\toff\npub\t(none)\t(none)\t10.0.0.300/32\t0\t0\t0\toff\n"},
+		{"handshake", "priv\tpub\t51820\toff\npub\t(none)\t(none)\t10.0.0.2/32\tnow\t0\t0\toff\n"},
+		{"transfer", "priv\tpub\t51820\toff\npub\t(none)\t(none)\t10.0.0.2/32\t0\t-1\t0\toff\n"},
+		{"keepalive", "priv\tpub\t51820\toff\npub\t(none)\t(none)\t10.0.0.2/32\t0\t0\t0\talways\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseDump(strings.NewReader(tt.input)); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestParseDumpFwMark(t *testing.T) {
+	dev, err := ParseDump(strings.NewReader("priv\tpub\t51820\t0xca6c\n"))
+	if err != nil {
+		t.Fatalf("ParseDump failed: %v", err)
+	}
+	if dev.FwMark != 0xca6c {
+		t.Errorf("expected fwmark 0xca6c, got %#x", dev.FwMark)
+	}
+	if len(dev.Peers) != 0 {
+		t.Errorf("expected no peer, got %d", len(dev.Peers))
+	}
+}
+
+func TestPeerOnline(t *testing.T) {
+	now := time.Unix(1760000000, 0)
+	tests := []struct {
+		name      string
+		handshake time.Time
+		expected  bool
+	}{
+		{"never", time.Time{}, false},
+		{"recent", now.Add(-30 * time.Second), true},
+		{"stale", now.Add(-OnlineTimeout), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := Peer{LatestHandshake: tt.handshake}
+			if p.Online(now) != tt.expected {
+				t.Errorf("Online() = %v, expected %v", !tt.expected, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package device
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SocketDir is the directory of the UAPI sockets (one <iface>.sock per
+// interface, created by the userspace implementations like wireguard-go)
+var SocketDir = "/var/run/wireguard"
+
+// uapiTimeout bounds a UAPI exchange when the context has no deadline
+const uapiTimeout = 5 * time.Second
+
+// keyLen is the length of the keys (in bytes)
+const keyLen = 32
+
+// PeerConfig is the configuration of a peer pushed to a device
+type PeerConfig struct {
+	PublicKey    string // base64
+	PresharedKey string // base64 (empty = none)
+	AllowedIPs   []net.IPNet
+	Remove       bool // remove the peer from the device
+}
+
+// equal returns whether both configs lead to the same device state
+func (p PeerConfig) equal(other PeerConfig) bool {
+	if p.PublicKey != other.PublicKey || p.PresharedKey != other.PresharedKey {
+		return false
+	}
+	if len(p.AllowedIPs) != len(other.AllowedIPs) {
+		return false
+	}
+	for i := range p.AllowedIPs {
+		if p.AllowedIPs[i].String() != other.AllowedIPs[i].String() {
+			return false
+		}
+	}
+	return true
+}
+
+// DiffPeers returns the changes turning the before peers into the after
+// ones: removed peers first, then the new and the modified ones (unchanged
+// peers are left out so that their sessions are kept)
+func DiffPeers(before []PeerConfig, after []PeerConfig) []PeerConfig {
+	old := make(map[string]PeerConfig, len(before))
+	for _, p := range before {
+		old[p.PublicKey] = p
+	}
+	kept := make(map[string]bool, len(after))
+	for _, p := range after {
+		kept[p.PublicKey] = true
+	}
+
+	changes := make([]PeerConfig, 0)
+	for _, p := range before {
+		if !kept[p.PublicKey] {
+			changes = append(changes, PeerConfig{PublicKey: p.PublicKey, Remove: true})
+		}
+	}
+	for _, p := range after {
+		if o, ok := old[p.PublicKey]; ok && o.equal(p) {
+			continue
+		}
+		changes = append(changes, p)
+	}
+	return changes
+}
+
+// SocketPath returns the path of the UAPI socket of an interface
+func SocketPath(iface string) string {
+	return filepath.Join(SocketDir, iface+".sock")
+}
+
+// UAPIClient talks to a Wireguard device through its UAPI socket
+// (https://www.wireguard.com/xplatform/)
+type UAPIClient struct {
+	path string
+}
+
+// NewUAPIClient creates a client of the given UAPI socket
+func NewUAPIClient(path string) *UAPIClient {
+	return &UAPIClient{path: path}
+}
+
+// SetPeers pushes peer changes to the device. The other peers (and
+// their sessions) are untouched.
+func (c *UAPIClient) SetPeers(ctx context.Context, peers []PeerConfig) error {
+	var sb strings.Builder
+	if err := encodeSet(&sb, peers); err != nil {
+		return err
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", c.path)
+	if err != nil {
+		return fmt.Errorf("error while connecting to %s (%w)", c.path, err)
+	}
+	defer conn.Close()
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(uapiTimeout)
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(conn, sb.String()); err != nil {
+		return fmt.Errorf("error while writing to %s (%w)", c.path, err)
+	}
+	return readErrno(bufio.NewReader(conn))
+}
+
+// encodeSet writes a UAPI set operation (keys are hex encoded)
+func encodeSet(w io.Writer, peers []PeerConfig) error {
+	fmt.Fprintln(w, "set=1")
+	for _, p := range peers {
+		public, err := hexKey(p.PublicKey)
+		if err != nil {
+			return fmt.Errorf("invalid public key %s (%w)", p.PublicKey, err)
+		}
+		fmt.Fprintf(w, "public_key=%s\n", public)
+		if p.Remove {
+			fmt.Fprintln(w, "remove=true")
+			continue
+		}
+		// a zero key removes the preshared key
+		psk := strings.Repeat("0", 2*keyLen)
+		if p.PresharedKey != "" {
+			if psk, err = hexKey(p.PresharedKey); err != nil {
+				return fmt.Errorf("invalid preshared key of %s (%w)", p.PublicKey, err)
+			}
+		}
+		fmt.Fprintf(w, "preshared_key=%s\n", psk)
+		fmt.Fprintln(w, "replace_allowed_ips=true")
+		for _, ipnet := range p.AllowedIPs {
+			fmt.Fprintf(w, "allowed_ip=%s\n", ipnet.String())
+		}
+	}
+	// an empty line ends the operation
+	_, err := fmt.Fprintln(w)
+	return err
+}
+
+// readErrno reads the response of the device (errno=0 on success)
+func readErrno(r *bufio.Reader) error {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("error while reading device response (%w)", err)
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			return fmt.Errorf("missing errno in device response")
+		}
+		key, value, found := strings.Cut(line, "=")
+		if !found || key != "errno" {
+			continue
+		}
+		errno, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid errno %q", value)
+		}
+		if errno != 0 {
+			return fmt.Errorf("device returned errno %d", errno)
+		}
+		return nil
+	}
+}
+
+func hexKey(b64 string) (string, error) {
+	raw, err := base64.StdEncoding.DecodeString(b64)
+	if err != nil {
+		return "", err
+	}
+	if len(raw) != keyLen {
+		return "", fmt.Errorf("bad key length %d (expected %d)", len(raw), keyLen)
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+// SetPeersWithTool pushes peer changes with `wg set` (kernel interfaces
+// have no UAPI socket)
+func SetPeersWithTool(ctx context.Context, iface string, peers []PeerConfig) error {
+	for _, p := range peers {
+		cmd := exec.CommandContext(ctx, "wg", wgSetArgs(iface, p)...)
+		// the preshared key is read from stdin (not visible in ps)
+		cmd.Stdin = strings.NewReader(p.PresharedKey + "\n")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			if msg := strings.TrimSpace(string(out)); msg != "" {
+				return fmt.Errorf("error while setting peer %s (%s)", p.PublicKey, msg)
+			}
+			return fmt.Errorf("error while setting peer %s (%w)", p.PublicKey, err)
+		}
+	}
+	return nil
+}
+
+// wgSetArgs returns the arguments of `wg set` for a peer change
+func wgSetArgs(iface string, p PeerConfig) []string {
+	args := []string{"set", iface, "peer", p.PublicKey}
+	if p.Remove {
+		return append(args, "remove")
+	}
+	// /dev/null removes the preshared key
+	psk := "/dev/null"
+	if p.PresharedKey != "" {
+		psk = "/dev/stdin"
+	}
+	allowed := make([]string, len(p.AllowedIPs))
+	for i, ipnet := range p.AllowedIPs {
+		allowed[i] = ipnet.String()
+	}
+	return append(args, "preshared-key", psk, "allowed-ips", strings.Join(allowed, ","))
+}
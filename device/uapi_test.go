@@ -0,0 +1,211 @@
+package device
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	pub0 = "+k5f1ALR7Q+BS5EtJhTl2ABgh3DG8h48sHAZIAIRkU0="
+	pub1 = "JVzBpb4Tl6bA4iyEeTYfVbJ12fyH5Pgm29X/2F5I1yU="
+	pub2 = "Yq2dmsCtVuAYfUkUt6GG1GzA7hQXIbgyJEMmbMITPQ4="
+	psk0 = "2AhLxS8AcOUdmzX6KVrgZmvHP5raJ4GDvBvH8zwH/5c="
+)
+
+func mustParseNets(t *testing.T, l ...string) []net.IPNet {
+	t.Helper()
+	out := make([]net.IPNet, len(l))
+	for i, s := range l {
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			t.Fatalf("invalid network %s: %v", s, err)
+		}
+		out[i] = *n
+	}
+	return out
+}
+
+// fakeDevice listens on a unix socket, records the requests and answers
+// with the given errno
+func fakeDevice(t *testing.T, errno string) (string, <-chan string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "wg0.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("failed to listen on %s: %v", path, err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	requests := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		var sb strings.Builder
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if line == "\n" {
+				break
+			}
+			sb.WriteString(line)
+		}
+		requests <- sb.String()
+		conn.Write([]byte("errno=" + errno + "\n\n"))
+	}()
+	return path, requests
+}
+
+func TestSetPeers(t *testing.T) {
+	path, requests := fakeDevice(t, "0")
+	client := NewUAPIClient(path)
+
+	err := client.SetPeers(context.Background(), []PeerConfig{
+		{PublicKey: pub1, Remove: true},
+		{PublicKey: pub0, PresharedKey: psk0, AllowedIPs: mustParseNets(t, "10.0.0.2/32", "192.168.1.0/24")},
+		{PublicKey: pub2, AllowedIPs: mustParseNets(t, "10.0.0.4/32")},
+	})
+	if err != nil {
+		t.Fatalf("SetPeers failed: %v", err)
+	}
+
+	req := <-requests
+	lines := strings.Split(strings.TrimSuffix(req, "\n"), "\n")
+	want := []string{
+		"set=1",
+		"public_key=" + mustHex(t, pub1),
+		"remove=true",
+		"public_key=" + mustHex(t, pub0),
+		"preshared_key=" + mustHex(t, psk0),
+		"replace_allowed_ips=true",
+		"allowed_ip=10.0.0.2/32",
+		"allowed_ip=192.168.1.0/24",
+		"public_key=" + mustHex(t, pub2),
+		"preshared_key=" + strings.Repeat("0", 64),
+		"replace_allowed_ips=true",
+		"allowed_ip=10.0.0.4/32",
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("unexpected request:\n%s", req)
+	}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Errorf("line %d = %q, expected %q", i, lines[i], want[i])
+		}
+	}
+}
+
+func mustHex(t *testing.T, b64 string) string {
+	t.Helper()
+	h, err := hexKey(b64)
+	if err != nil {
+		t.Fatalf("hexKey(%s) failed: %v", b64, err)
+	}
+	return h
+}
+
+func TestSetPeersErrors(t *testing.T) {
+	t.Run("device error", func(t *testing.T) {
+		path, _ := fakeDevice(t, "22")
+		err := NewUAPIClient(path).SetPeers(context.Background(), []PeerConfig{{PublicKey: pub0}})
+		if err == nil || !strings.Contains(err.Error(), "errno 22") {
+			t.Errorf("expected errno error, got %v", err)
+		}
+	})
+
+	t.Run("no device", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "wg9.sock")
+		if err := NewUAPIClient(path).SetPeers(context.Background(), nil); err == nil {
+			t.Error("expected a connection error")
+		}
+	})
+
+	t.Run("invalid key", func(t *testing.T) {
+		path, _ := fakeDevice(t, "0")
+		err := NewUAPIClient(path).SetPeers(context.Background(), []PeerConfig{{PublicKey: "invalid"}})
+		if err == nil {
+			t.Error("expected an invalid key error")
+		}
+	})
+}
+
+func TestDiffPeers(t *testing.T) {
+	before := []PeerConfig{
+		{PublicKey: pub0, PresharedKey: psk0, AllowedIPs: mustParseNets(t, "10.0.0.2/32")},
+		{PublicKey: pub1, AllowedIPs: mustParseNets(t, "10.0.0.3/32")},
+	}
+
+	t.Run("no change", func(t *testing.T) {
+		if changes := DiffPeers(before, before); len(changes) != 0 {
+			t.Errorf("expected no change, got %v", changes)
+		}
+	})
+
+	t.Run("added and removed", func(t *testing.T) {
+		after := []PeerConfig{
+			before[0],
+			{PublicKey: pub2, AllowedIPs: mustParseNets(t, "10.0.0.4/32")},
+		}
+		changes := DiffPeers(before, after)
+		if len(changes) != 2 {
+			t.Fatalf("expected 2 changes, got %v", changes)
+		}
+		if changes[0].PublicKey != pub1 || !changes[0].Remove {
+			t.Errorf("expected removal of %s first, got %v", pub1, changes[0])
+		}
+		if changes[1].PublicKey != pub2 || changes[1].Remove {
+			t.Errorf("expected addition of %s, got %v", pub2, changes[1])
+		}
+	})
+
+	t.Run("modified", func(t *testing.T) {
+		after := []PeerConfig{
+			before[0],
+			{PublicKey: pub1, AllowedIPs: mustParseNets(t, "10.0.0.3/32", "192.168.1.0/24")},
+		}
+		changes := DiffPeers(before, after)
+		if len(changes) != 1 || changes[0].PublicKey != pub1 || len(changes[0].AllowedIPs) != 2 {
+			t.Errorf("expected update of %s, got %v", pub1, changes)
+		}
+	})
+}
+
+func TestWgSetArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		peer     PeerConfig
+		expected string
+	}{
+		{
+			name:     "remove",
+			peer:     PeerConfig{PublicKey: pub0, Remove: true},
+			expected: "set wg0 peer " + pub0 + " remove",
+		},
+		{
+			name:     "with psk",
+			peer:     PeerConfig{PublicKey: pub0, PresharedKey: psk0, AllowedIPs: mustParseNets(t, "10.0.0.2/32", "fd00::2/128")},
+			expected: "set wg0 peer " + pub0 + " preshared-key /dev/stdin allowed-ips 10.0.0.2/32,fd00::2/128",
+		},
+		{
+			name:     "without psk",
+			peer:     PeerConfig{PublicKey: pub0, AllowedIPs: mustParseNets(t, "10.0.0.2/32")},
+			expected: "set wg0 peer " + pub0 + " preshared-key /dev/null allowed-ips 10.0.0.2/32",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := strings.Join(wgSetArgs("wg0", tt.peer), " "); got != tt.expected {
+				t.Errorf("wgSetArgs() = %s, expected %s", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package export
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// formats of the bundles
+const (
+	BundleZip   = "zip"
+	BundleTar   = "tar"
+	BundleTarGz = "tar.gz"
+)
+
+// BundleFile is a file of a bundle
+type BundleFile struct {
+	Name    string
+	Content []byte
+}
+
+// BundleFormat returns the format of a bundle from its filename
+func BundleFormat(filename string) (string, error) {
+	lower := strings.ToLower(filename)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return BundleZip, nil
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return BundleTarGz, nil
+	case strings.HasSuffix(lower, ".tar"):
+		return BundleTar, nil
+	default:
+		return "", fmt.Errorf("unknown bundle format of %s (expected .zip, .tar, .tar.gz or .tgz)", filename)
+	}
+}
+
+// WriteBundle writes the files into an archive. The files are only
+// readable by their owner (they contain private keys).
+func WriteBundle(w io.Writer, format string, files []BundleFile) error {
+	switch format {
+	case BundleZip:
+		return writeZip(w, files)
+	case BundleTar:
+		return writeTar(w, files)
+	case BundleTarGz:
+		gz := gzip.NewWriter(w)
+		if err := writeTar(gz, files); err != nil {
+			return err
+		}
+		return gz.Close()
+	default:
+		return fmt.Errorf("unknown bundle format %q", format)
+	}
+}
+
+func writeZip(w io.Writer, files []BundleFile) error {
+	archive := zip.NewWriter(w)
+	now := time.Now()
+	for _, f := range files {
+		header := &zip.FileHeader{Name: f.Name, Method: zip.Deflate, Modified: now}
+		header.SetMode(0600)
+		fw, err := archive.CreateHeader(header)
+		if err != nil {
+			return fmt.Errorf("error while adding %s to the bundle (%w)", f.Name, err)
+		}
+		if _, err := fw.Write(f.Content); err != nil {
+			return fmt.Errorf("error while adding %s to the bundle (%w)", f.Name, err)
+		}
+	}
+	return archive.Close()
+}
+
+func writeTar(w io.Writer, files []BundleFile) error {
+	archive := tar.NewWriter(w)
+	now := time.Now()
+	for _, f := range files {
+		header := &tar.Header{
+			Name:    f.Name,
+			Mode:    0600,
+			Size:    int64(len(f.Content)),
+			ModTime: now,
+		}
+		if err := archive.WriteHeader(header); err != nil {
+			return fmt.Errorf("error while adding %s to the bundle (%w)", f.Name, err)
+		}
+		if _, err := archive.Write(f.Content); err != nil {
+			return fmt.Errorf("error while adding %s to the bundle (%w)", f.Name, err)
+		}
+	}
+	return archive.Close()
+}
@@ -0,0 +1,90 @@
+package export
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+)
+
+var bundleFiles = []BundleFile{
+	{Name: "wg0.conf", Content: []byte("[Interface]\n")},
+	{Name: "README.txt", Content: []byte("hello\n")},
+}
+
+func TestBundleFormat(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"alice.zip", BundleZip},
+		{"alice.ZIP", BundleZip},
+		{"alice.tar", BundleTar},
+		{"alice.tar.gz", BundleTarGz},
+		{"alice.tgz", BundleTarGz},
+	}
+	for _, tt := range tests {
+		got, err := BundleFormat(tt.input)
+		if err != nil || got != tt.expected {
+			t.Errorf("BundleFormat(%s) = %s, %v, expected %s", tt.input, got, err, tt.expected)
+		}
+	}
+	if _, err := BundleFormat("alice.rar"); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+func TestWriteBundleZip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteBundle(&buf, BundleZip, bundleFiles); err != nil {
+		t.Fatalf("WriteBundle failed: %v", err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("invalid zip: %v", err)
+	}
+	if len(archive.File) != len(bundleFiles) {
+		t.Fatalf("expected %d files, got %d", len(bundleFiles), len(archive.File))
+	}
+	for i, f := range archive.File {
+		if f.Name != bundleFiles[i].Name || f.Mode().Perm() != 0600 {
+			t.Errorf("unexpected file %s (%v)", f.Name, f.Mode())
+		}
+		r, err := f.Open()
+		if err != nil {
+			t.Fatalf("failed to open %s: %v", f.Name, err)
+		}
+		content, _ := io.ReadAll(r)
+		r.Close()
+		if !bytes.Equal(content, bundleFiles[i].Content) {
+			t.Errorf("unexpected content of %s: %q", f.Name, content)
+		}
+	}
+}
+
+func TestWriteBundleTarGz(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteBundle(&buf, BundleTarGz, bundleFiles); err != nil {
+		t.Fatalf("WriteBundle failed: %v", err)
+	}
+	gz, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("invalid gzip: %v", err)
+	}
+	archive := tar.NewReader(gz)
+	for i := range bundleFiles {
+		header, err := archive.Next()
+		if err != nil {
+			t.Fatalf("failed to read file %d: %v", i, err)
+		}
+		content, _ := io.ReadAll(archive)
+		if header.Name != bundleFiles[i].Name || !bytes.Equal(content, bundleFiles[i].Content) {
+			t.Errorf("unexpected file %s: %q", header.Name, content)
+		}
+	}
+	if _, err := archive.Next(); err != io.EOF {
+		t.Errorf("expected end of archive, got %v", err)
+	}
+}
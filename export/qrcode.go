@@ -6,6 +6,7 @@ import (
 	"image/color"
 	"io"
 
+	"github.com/boombuler/barcode"
 	qrc "github.com/boombuler/barcode/qr"
 	// qrcode "github.com/skip2/go-qrcode"
 )
@@ -56,6 +57,29 @@ func QRCodeToString(img image.Image) string {
 }
 
 func Encode(r io.Reader) (image.Image, error) {
+	qr, err := encodeQR(r)
+	if err != nil {
+		return nil, err
+	}
+	return addBorder(to16bitsGrayScale(qr), terminalBorder), nil
+}
+
+// EncodeImage encodes the input to a QR code sized for an image file
+// (at least standardWidth pixels, plus a white border)
+func EncodeImage(r io.Reader) (image.Image, error) {
+	qr, err := encodeQR(r)
+	if err != nil {
+		return nil, err
+	}
+	width := max(standardWidth, qr.Bounds().Dx())
+	scaled, err := barcode.Scale(qr, width, width)
+	if err != nil {
+		return nil, fmt.Errorf("error while scaling QRCode (%w)", err)
+	}
+	return addBorder(to16bitsGrayScale(scaled), standardBorder), nil
+}
+
+func encodeQR(r io.Reader) (barcode.Barcode, error) {
 	//  create en empty byte array
 	p := make([]byte, RawConfigMaxLength)
 	// read input
@@ -70,8 +94,7 @@ func Encode(r io.Reader) (image.Image, error) {
 	if err != nil {
 		return nil, fmt.Errorf("error while encoding to QRCode (%w)", err)
 	}
-
-	return addBorder(to16bitsGrayScale(qr), terminalBorder), nil
+	return qr, nil
 }
 
 func newGray16White(r image.Rectangle) *image.Gray16 {
@@ -501,3 +501,18 @@ func TestEncodeWithBytesReader(t *testing.T) {
 		}
 	})
 }
+
+func TestEncodeImage(t *testing.T) {
+	img, err := EncodeImage(strings.NewReader("[Interface]\nAddress = 10.0.0.2/24\n"))
+	if err != nil {
+		t.Fatalf("EncodeImage failed: %v", err)
+	}
+	bounds := img.Bounds()
+	if bounds.Dx() < standardWidth+2*standardBorder || bounds.Dx() != bounds.Dy() {
+		t.Errorf("unexpected image size %v", bounds)
+	}
+	// the border is white
+	if r, _, _, _ := img.At(0, 0).RGBA(); r != 0xffff {
+		t.Errorf("expected a white border, got %d", r)
+	}
+}
@@ -0,0 +1,251 @@
+package export
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SHARE_PREFIX is the path of the one-time links served by `serve`
+const SHARE_PREFIX = "/share"
+
+// SHARE_SUFFIX is the suffix of the directory of the shared configs (next
+// to the server config)
+const SHARE_SUFFIX = ".shares"
+
+// ErrShareNotFound is returned for unknown, expired or already used shares
+var ErrShareNotFound = errors.New("the link has expired or was already used")
+
+// ShareURL returns the link of a share served by a server at base
+func ShareURL(base string, token string) string {
+	return strings.TrimSuffix(base, "/") + SHARE_PREFIX + "/" + token
+}
+
+// Share is a client config shared through a one-time link
+type Share struct {
+	Name   string `json:"name"`
+	Format string `json:"format"`
+	Config []byte `json:"config"`
+}
+
+// sealedShare is a share on disk: the config is encrypted with a key
+// derived from the token, which is never stored
+type sealedShare struct {
+	Expires time.Time `json:"expires"`
+	Nonce   []byte    `json:"nonce"`
+	Data    []byte    `json:"data"`
+}
+
+// ShareStore keeps the shares of a vpn. The shares are files named after a
+// hash of their token; they are removed when they are read or expired.
+type ShareStore struct {
+	dir string
+}
+
+// NewShareStore returns the store of the shares of a server config
+func NewShareStore(configPath string) *ShareStore {
+	return &ShareStore{dir: configPath + SHARE_SUFFIX}
+}
+
+// Dir returns the directory of the shares
+func (s *ShareStore) Dir() string {
+	return s.dir
+}
+
+// Put stores an encrypted share for the given duration and returns its
+// token
+func (s *ShareStore) Put(share *Share, ttl time.Duration) (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(secret)
+	id, aead, err := shareKeys(token)
+	if err != nil {
+		return "", err
+	}
+	plain, err := json.Marshal(share)
+	if err != nil {
+		return "", err
+	}
+	sealed := sealedShare{
+		Expires: time.Now().Add(ttl).UTC().Truncate(time.Second),
+		Nonce:   make([]byte, aead.NonceSize()),
+	}
+	if _, err := rand.Read(sealed.Nonce); err != nil {
+		return "", err
+	}
+	sealed.Data = aead.Seal(nil, sealed.Nonce, plain, sealed.additionalData())
+	raw, err := json.Marshal(sealed)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return "", fmt.Errorf("error while creating the shares directory (%w)", err)
+	}
+	if err := os.WriteFile(filepath.Join(s.dir, id), raw, 0600); err != nil {
+		return "", fmt.Errorf("error while storing the share (%w)", err)
+	}
+	return token, nil
+}
+
+// Expires returns the expiration of a share (ErrShareNotFound if it does
+// not exist anymore)
+func (s *ShareStore) Expires(token string) (time.Time, error) {
+	id, _, err := shareKeys(token)
+	if err != nil {
+		return time.Time{}, err
+	}
+	sealed, err := readSealed(filepath.Join(s.dir, id))
+	if err != nil {
+		return time.Time{}, err
+	}
+	if time.Now().After(sealed.Expires) {
+		wipe(filepath.Join(s.dir, id))
+		return time.Time{}, ErrShareNotFound
+	}
+	return sealed.Expires, nil
+}
+
+// Take decrypts a share and wipes it, so that it is returned only once. If
+// check fails, the share is kept and the error is returned.
+func (s *ShareStore) Take(token string, check func(*Share) error) (*Share, error) {
+	id, aead, err := shareKeys(token)
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(s.dir, id)
+	// the rename claims the share (concurrent requests get ErrShareNotFound)
+	claimed := path + ".taken"
+	if err := os.Rename(path, claimed); err != nil {
+		return nil, ErrShareNotFound
+	}
+	sealed, err := readSealed(claimed)
+	if err != nil {
+		wipe(claimed)
+		return nil, err
+	}
+	if time.Now().After(sealed.Expires) {
+		wipe(claimed)
+		return nil, ErrShareNotFound
+	}
+	plain, err := aead.Open(nil, sealed.Nonce, sealed.Data, sealed.additionalData())
+	if err != nil {
+		wipe(claimed)
+		return nil, fmt.Errorf("error while decrypting the share (%w)", err)
+	}
+	share := &Share{}
+	if err := json.Unmarshal(plain, share); err != nil {
+		wipe(claimed)
+		return nil, fmt.Errorf("error while decoding the share (%w)", err)
+	}
+	if check != nil {
+		if err := check(share); err != nil {
+			if rerr := os.Rename(claimed, path); rerr != nil {
+				wipe(claimed)
+			}
+			return nil, err
+		}
+	}
+	if err := wipe(claimed); err != nil {
+		return nil, err
+	}
+	return share, nil
+}
+
+// Purge wipes the expired shares and returns their number
+func (s *ShareStore) Purge() (int, error) {
+	entries, err := os.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	purged := 0
+	now := time.Now()
+	for _, entry := range entries {
+		path := filepath.Join(s.dir, entry.Name())
+		sealed, err := readSealed(path)
+		switch {
+		case errors.Is(err, ErrShareNotFound):
+			// taken meanwhile
+			continue
+		case err == nil && !now.After(sealed.Expires):
+			continue
+		}
+		// expired (unreadable leftovers are useless without their token)
+		if err := wipe(path); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// additionalData binds the expiration to the encrypted config
+func (sealed *sealedShare) additionalData() []byte {
+	return []byte(sealed.Expires.Format(time.RFC3339))
+}
+
+// shareKeys derives the file name and the cipher of a share from its token
+func shareKeys(token string) (string, cipher.AEAD, error) {
+	secret, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(secret) != 32 {
+		return "", nil, ErrShareNotFound
+	}
+	id, err := hkdf.Key(sha256.New, secret, nil, "wg-easy-vpn share id", 16)
+	if err != nil {
+		return "", nil, err
+	}
+	key, err := hkdf.Key(sha256.New, secret, nil, "wg-easy-vpn share key", 32)
+	if err != nil {
+		return "", nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", nil, err
+	}
+	return hex.EncodeToString(id), aead, nil
+}
+
+func readSealed(path string) (*sealedShare, error) {
+	raw, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrShareNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	sealed := &sealedShare{}
+	if err := json.Unmarshal(raw, sealed); err != nil {
+		return nil, fmt.Errorf("invalid share %s (%w)", filepath.Base(path), err)
+	}
+	return sealed, nil
+}
+
+// wipe overwrites a share with zeros before removing it
+func wipe(path string) error {
+	if info, err := os.Stat(path); err == nil {
+		os.WriteFile(path, make([]byte, info.Size()), 0600)
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error while wiping the share (%w)", err)
+	}
+	return nil
+}
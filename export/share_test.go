@@ -0,0 +1,119 @@
+package export
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestShare() *Share {
+	return &Share{Name: "laptop", Format: "wg-quick", Config: []byte("[Interface]\nPrivateKey = secret\n")}
+}
+
+func TestShareStore(t *testing.T) {
+	store := NewShareStore(filepath.Join(t.TempDir(), "wg0.conf"))
+	token, err := store.Put(newTestShare(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the config is not stored in clear
+	entries, err := os.ReadDir(store.Dir())
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected one share, got %v (%v)", entries, err)
+	}
+	raw, _ := os.ReadFile(filepath.Join(store.Dir(), entries[0].Name()))
+	if bytes.Contains(raw, []byte("secret")) || strings.Contains(entries[0].Name(), token) {
+		t.Error("the share is stored in clear")
+	}
+
+	if _, err := store.Expires(token); err != nil {
+		t.Errorf("the share must exist: %v", err)
+	}
+	share, err := store.Take(token, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if share.Name != "laptop" || !bytes.Contains(share.Config, []byte("secret")) {
+		t.Errorf("unexpected share: %+v", share)
+	}
+	if _, err := store.Take(token, nil); !errors.Is(err, ErrShareNotFound) {
+		t.Errorf("a share must be taken only once, got %v", err)
+	}
+	if entries, _ := os.ReadDir(store.Dir()); len(entries) != 0 {
+		t.Errorf("the share was not wiped: %v", entries)
+	}
+}
+
+func TestShareStoreInvalidToken(t *testing.T) {
+	store := NewShareStore(filepath.Join(t.TempDir(), "wg0.conf"))
+	if _, err := store.Put(newTestShare(), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range []string{"", "short", strings.Repeat("A", 43), "../../../etc/passwd"} {
+		if _, err := store.Take(token, nil); !errors.Is(err, ErrShareNotFound) {
+			t.Errorf("%q: expected ErrShareNotFound, got %v", token, err)
+		}
+	}
+}
+
+func TestShareStoreCheck(t *testing.T) {
+	store := NewShareStore(filepath.Join(t.TempDir(), "wg0.conf"))
+	token, err := store.Put(newTestShare(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refused := fmt.Errorf("refused")
+	if _, err := store.Take(token, func(*Share) error { return refused }); err != refused {
+		t.Errorf("expected the error of the check, got %v", err)
+	}
+	// the share is kept
+	if _, err := store.Take(token, nil); err != nil {
+		t.Errorf("the share must be kept after a failed check: %v", err)
+	}
+}
+
+func TestShareStoreExpiration(t *testing.T) {
+	store := NewShareStore(filepath.Join(t.TempDir(), "wg0.conf"))
+	expired, err := store.Put(newTestShare(), -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid, err := store.Put(newTestShare(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Expires(expired); !errors.Is(err, ErrShareNotFound) {
+		t.Errorf("expected ErrShareNotFound, got %v", err)
+	}
+
+	if _, err := store.Put(newTestShare(), -time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	purged, err := store.Purge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged != 1 {
+		t.Errorf("expected 1 purged share, got %d", purged)
+	}
+	if _, err := store.Take(valid, nil); err != nil {
+		t.Errorf("the valid share must be kept: %v", err)
+	}
+	if purged, err := NewShareStore(filepath.Join(t.TempDir(), "none.conf")).Purge(); err != nil || purged != 0 {
+		t.Errorf("expected nothing to purge, got %d (%v)", purged, err)
+	}
+}
+
+func TestShareURL(t *testing.T) {
+	for _, base := range []string{"https://vpn.example.com", "https://vpn.example.com/"} {
+		if url := ShareURL(base, "abc"); url != "https://vpn.example.com/share/abc" {
+			t.Errorf("unexpected url %s", url)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package models
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/asiffer/wg-easy-vpn/utils"
+)
+
+// IsManaged returns whether the vpn has its wg-easy-vpn metadata (a plain
+// wg-quick config has neither endpoint nor networks)
+func (vpn *WGVPN) IsManaged() bool {
+	return vpn.endpoint != "" && len(vpn.networks) > 0
+}
+
+// Adopt sets the metadata of a vpn loaded from a plain wg-quick config so
+// that it can be managed. When networks are not given, they are inferred
+// from the addresses of the server. The existing peers are kept but their
+// AllowedIPs must not overlap.
+func (vpn *WGVPN) Adopt(endpoint string, networks []net.IPNet, routes []net.IPNet, dns []net.IP) error {
+	if vpn.server == nil {
+		return fmt.Errorf("no Interface section")
+	}
+	if endpoint == "" {
+		return fmt.Errorf("an endpoint is required")
+	}
+	if len(networks) == 0 {
+		networks = inferNetworks(vpn.server.address)
+	}
+	for _, addr := range vpn.server.address {
+		if !containsIP(networks, addr.IP) {
+			return fmt.Errorf("server address %s is outside of the networks %s",
+				addr.IP.String(), strings.Join(utils.StringifyNetworks(networks), ", "))
+		}
+	}
+	if err := vpn.checkOverlaps(); err != nil {
+		return err
+	}
+
+	vpn.endpoint = endpoint
+	vpn.networks = networks
+	vpn.routes = routes
+	vpn.dns = dns
+	return nil
+}
+
+// checkOverlaps returns an error listing the peers whose AllowedIPs overlap
+// (wireguard would route the shared addresses to one of them only)
+func (vpn *WGVPN) checkOverlaps() error {
+	conflicts := make([]string, 0)
+	for i, a := range vpn.peers {
+		for _, b := range vpn.peers[i+1:] {
+			for _, na := range a.allowedIPs {
+				for _, nb := range b.allowedIPs {
+					if utils.NetworksOverlap(na, nb) {
+						conflicts = append(conflicts, fmt.Sprintf("%s (%s) and %s (%s)",
+							peerLabel(a), na.String(), peerLabel(b), nb.String()))
+					}
+				}
+			}
+		}
+	}
+	if len(conflicts) > 0 {
+		return fmt.Errorf("overlapping AllowedIPs: %s", strings.Join(conflicts, "; "))
+	}
+	return nil
+}
+
+// inferNetworks returns the networks of the given addresses (10.0.0.1/24
+// gives 10.0.0.0/24)
+func inferNetworks(addresses []net.IPNet) []net.IPNet {
+	networks := make([]net.IPNet, 0, len(addresses))
+	for _, addr := range addresses {
+		n := net.IPNet{IP: addr.IP.Mask(addr.Mask), Mask: addr.Mask}
+		if utils.FindNetwork(n, networks) < 0 {
+			networks = append(networks, n)
+		}
+	}
+	return networks
+}
+
+func containsIP(networks []net.IPNet, ip net.IP) bool {
+	for _, n := range networks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// peerLabel returns the name of the peer or its public key
+func peerLabel(peer *WGClientAsPeer) string {
+	if peer.name != "" {
+		return peer.name
+	}
+	return peer.Public()
+}
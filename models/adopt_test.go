@@ -0,0 +1,102 @@
+package models
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/asiffer/wg-easy-vpn/crypto"
+	"github.com/asiffer/wg-easy-vpn/utils"
+)
+
+// handWrittenVPN loads a plain wg-quick config with the given peers
+// (allowed ips)
+func handWrittenVPN(t *testing.T, peers ...string) *WGVPN {
+	t.Helper()
+	content := "[Interface]\nAddress = 10.0.0.1/24, fd00::1/64\nListenPort = 51820\n" +
+		"PrivateKey = " + crypto.NewRandomKey().Base64() + "\nMTU = 1380\nPreDown = echo down\n"
+	for i, allowed := range peers {
+		content += fmt.Sprintf("\n# peer%d\n[Peer]\nPublicKey = %s\nAllowedIPs = %s\nPersistentKeepalive = 25\n",
+			i, crypto.NewRandomKey().Base64(), allowed)
+	}
+	path := filepath.Join(t.TempDir(), "wg0.conf")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	file, err := utils.ParseFile(path)
+	if err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+	vpn, err := VPNFromFile("wg0", file)
+	if err != nil {
+		t.Fatalf("failed to load vpn: %v", err)
+	}
+	return vpn
+}
+
+func TestWGVPNAdopt(t *testing.T) {
+	t.Run("infers the networks", func(t *testing.T) {
+		vpn := handWrittenVPN(t, "10.0.0.2/32", "10.0.0.3/32, 192.168.1.0/24")
+		if vpn.IsManaged() {
+			t.Fatal("a plain config should not be managed")
+		}
+		if err := vpn.Adopt("vpn.example.com:51820", nil, nil, nil); err != nil {
+			t.Fatalf("Adopt failed: %v", err)
+		}
+		if !vpn.IsManaged() {
+			t.Error("the vpn should be managed after Adopt")
+		}
+		got := strings.Join(utils.StringifyNetworks(vpn.Networks()), ",")
+		if got != "10.0.0.0/24,fd00::/64" {
+			t.Errorf("networks = %s, expected 10.0.0.0/24,fd00::/64", got)
+		}
+		// the next address skips the existing peers
+		networks, err := vpn.ProvideNetworks()
+		if err != nil {
+			t.Fatalf("ProvideNetworks failed: %v", err)
+		}
+		if networks[0].IP.String() != "10.0.0.4" {
+			t.Errorf("expected 10.0.0.4, got %s", networks[0].IP.String())
+		}
+	})
+
+	t.Run("keeps the unmanaged keys and names", func(t *testing.T) {
+		vpn := handWrittenVPN(t, "10.0.0.2/32")
+		if err := vpn.Adopt("vpn.example.com:51820", nil, nil, nil); err != nil {
+			t.Fatalf("Adopt failed: %v", err)
+		}
+		file := utils.NewFile()
+		vpn.Populate(file)
+		out := file.String()
+		for _, expected := range []string{"MTU = 1380", "PreDown = echo down", "# peer0", "PersistentKeepalive = 25", "Endpoint = vpn.example.com:51820"} {
+			if !strings.Contains(out, expected) {
+				t.Errorf("expected %q in:\n%s", expected, out)
+			}
+		}
+	})
+
+	t.Run("overlapping peers", func(t *testing.T) {
+		vpn := handWrittenVPN(t, "10.0.0.2/32, 192.168.0.0/16", "10.0.0.3/32, 192.168.1.0/24")
+		err := vpn.Adopt("vpn.example.com:51820", nil, nil, nil)
+		if err == nil || !strings.Contains(err.Error(), "peer0 (192.168.0.0/16) and peer1 (192.168.1.0/24)") {
+			t.Errorf("expected an overlap error, got %v", err)
+		}
+	})
+
+	t.Run("server outside of the networks", func(t *testing.T) {
+		vpn := handWrittenVPN(t)
+		networks := []net.IPNet{{IP: net.ParseIP("10.1.0.0"), Mask: net.CIDRMask(16, 32)}}
+		if err := vpn.Adopt("vpn.example.com:51820", networks, nil, nil); err == nil {
+			t.Error("expected an error")
+		}
+	})
+
+	t.Run("missing endpoint", func(t *testing.T) {
+		if err := handWrittenVPN(t).Adopt("", nil, nil, nil); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
@@ -0,0 +1,224 @@
+package models
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/asiffer/wg-easy-vpn/crypto"
+	"github.com/asiffer/wg-easy-vpn/utils"
+	"gopkg.in/yaml.v3"
+)
+
+// formats of the bulk client files
+const (
+	BulkCSV  = "csv"
+	BulkYAML = "yaml"
+)
+
+// ClientEntry is a client to provision (a row of a bulk file)
+type ClientEntry struct {
+	Name      string
+	IP        net.IP      // nil = first free address
+	DNS       []net.IP    // empty = default
+	Routes    []net.IPNet // empty = default
+	PublicKey crypto.Key  // nil = generated key pair
+}
+
+// Client creates the client of the entry (without addresses, they are
+// assigned by WGVPN.AddClient). The dns and the routes of the entry
+// override the given ones.
+func (entry *ClientEntry) Client(noPSK bool, dns []net.IP, routes []net.IPNet) *WGClient {
+	if len(entry.DNS) > 0 {
+		dns = entry.DNS
+	}
+	if len(entry.Routes) > 0 {
+		routes = entry.Routes
+	}
+	client := NewWGClient(nil, noPSK, dns, routes)
+	client.SetName(entry.Name)
+	if entry.IP != nil {
+		client.SetStaticIP(entry.IP)
+	}
+	if entry.PublicKey != nil {
+		client.SetPublicKey(entry.PublicKey)
+	}
+	return client
+}
+
+// yamlClientEntry is an item of a bulk YAML file
+type yamlClientEntry struct {
+	Name      string   `yaml:"name"`
+	IP        string   `yaml:"ip"`
+	DNS       []string `yaml:"dns"`
+	Routes    []string `yaml:"routes"`
+	PublicKey string   `yaml:"public_key"`
+}
+
+// ReadClientEntries reads the clients of a bulk file. A CSV file has a
+// header (name, ip, dns, routes, public_key: only name is required), the
+// lists are separated by semicolons or spaces (or commas within quotes).
+// A YAML file is a list of
+// objects with the same keys. The whole file is rejected if an entry is
+// invalid.
+func ReadClientEntries(r io.Reader, format string) ([]ClientEntry, error) {
+	var entries []ClientEntry
+	var err error
+	switch format {
+	case BulkCSV:
+		entries, err = readCSVEntries(r)
+	case BulkYAML:
+		entries, err = readYAMLEntries(r)
+	default:
+		return nil, fmt.Errorf("unknown format %q (expected %s or %s)", format, BulkCSV, BulkYAML)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := checkEntries(entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func readCSVEntries(r io.Reader) ([]ClientEntry, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("empty csv file")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error while reading csv header (%w)", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, h := range header {
+		h = strings.ToLower(strings.TrimSpace(h))
+		switch h {
+		case "name", "ip", "dns", "routes", "public_key":
+		default:
+			return nil, fmt.Errorf("unknown csv column %q", h)
+		}
+		if _, ok := columns[h]; ok {
+			return nil, fmt.Errorf("duplicate csv column %q", h)
+		}
+		columns[h] = i
+	}
+	if _, ok := columns["name"]; !ok {
+		return nil, fmt.Errorf("missing csv column \"name\"")
+	}
+
+	entries := make([]ClientEntry, 0)
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error while reading csv (%w)", err)
+		}
+		line, _ := reader.FieldPos(0)
+		field := func(column string) string {
+			if i, ok := columns[column]; ok {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		entry, err := newClientEntry(
+			field("name"),
+			field("ip"),
+			splitList(field("dns")),
+			splitList(field("routes")),
+			field("public_key"),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func readYAMLEntries(r io.Reader) ([]ClientEntry, error) {
+	decoder := yaml.NewDecoder(r)
+	decoder.KnownFields(true)
+	var items []yamlClientEntry
+	if err := decoder.Decode(&items); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("error while decoding yaml (%w)", err)
+	}
+	entries := make([]ClientEntry, 0, len(items))
+	for i, item := range items {
+		entry, err := newClientEntry(item.Name, item.IP, item.DNS, item.Routes, item.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("client %d: %w", i+1, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// newClientEntry parses the fields of an entry
+func newClientEntry(name string, ip string, dns []string, routes []string, public string) (ClientEntry, error) {
+	entry := ClientEntry{Name: CleanClientName(name)}
+	if entry.Name == "" {
+		return entry, fmt.Errorf("missing name")
+	}
+	var err error
+	if ip = strings.TrimSpace(ip); ip != "" {
+		if entry.IP = parseIP(ip); entry.IP == nil {
+			return entry, fmt.Errorf("client %s: invalid ip %q", entry.Name, ip)
+		}
+	}
+	if entry.DNS, err = utils.ParseIPList(dns); err != nil {
+		return entry, fmt.Errorf("client %s: %w", entry.Name, err)
+	}
+	if entry.Routes, err = utils.ParseIPNetList(routes); err != nil {
+		return entry, fmt.Errorf("client %s: %w", entry.Name, err)
+	}
+	if public = strings.TrimSpace(public); public != "" {
+		entry.PublicKey = crypto.NewKey()
+		if err := entry.PublicKey.UpdateFromBase64(public); err != nil {
+			return entry, fmt.Errorf("client %s: invalid public key (%w)", entry.Name, err)
+		}
+	}
+	return entry, nil
+}
+
+// checkEntries ensures that the names, the addresses and the public keys
+// of the entries are unique
+func checkEntries(entries []ClientEntry) error {
+	names := make(map[string]bool, len(entries))
+	ips := make(map[string]string, len(entries))
+	keys := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		if names[entry.Name] {
+			return fmt.Errorf("duplicate client %s", entry.Name)
+		}
+		names[entry.Name] = true
+		if entry.IP != nil {
+			if other, ok := ips[entry.IP.String()]; ok {
+				return fmt.Errorf("clients %s and %s have the same ip %s", other, entry.Name, entry.IP.String())
+			}
+			ips[entry.IP.String()] = entry.Name
+		}
+		if entry.PublicKey != nil {
+			if other, ok := keys[entry.PublicKey.Base64()]; ok {
+				return fmt.Errorf("clients %s and %s have the same public key", other, entry.Name)
+			}
+			keys[entry.PublicKey.Base64()] = entry.Name
+		}
+	}
+	return nil
+}
+
+// splitList splits a list field of a csv file (ex: 1.1.1.1;8.8.8.8)
+func splitList(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == ';' || r == ',' || r == ' ' || r == '\t'
+	})
+}
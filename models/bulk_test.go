@@ -0,0 +1,123 @@
+package models
+
+import (
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/asiffer/wg-easy-vpn/crypto"
+)
+
+func newBulkVPN(t *testing.T) *WGVPN {
+	t.Helper()
+	server := NewWGServer(nil, false, 51820)
+	networks := []net.IPNet{{IP: net.ParseIP("10.0.0.0"), Mask: net.CIDRMask(24, 32)}}
+	vpn, err := NewWGVPN("wg0", server, "vpn.example.com:51820", networks, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create VPN: %v", err)
+	}
+	return vpn
+}
+
+func TestReadClientEntries(t *testing.T) {
+	for _, format := range []string{BulkCSV, BulkYAML} {
+		t.Run(format, func(t *testing.T) {
+			f, err := os.Open("../test/clients." + format)
+			if err != nil {
+				t.Fatalf("failed to open fixture: %v", err)
+			}
+			defer f.Close()
+			entries, err := ReadClientEntries(f, format)
+			if err != nil {
+				t.Fatalf("ReadClientEntries failed: %v", err)
+			}
+			if len(entries) != 3 {
+				t.Fatalf("expected 3 entries, got %d", len(entries))
+			}
+			alice, bob, printer := entries[0], entries[1], entries[2]
+			if alice.Name != "alice" || alice.IP != nil || alice.PublicKey != nil || len(alice.DNS) != 0 {
+				t.Errorf("unexpected entry %+v", alice)
+			}
+			if bob.IP.String() != "10.0.0.10" || len(bob.DNS) != 1 || len(bob.Routes) != 2 {
+				t.Errorf("unexpected entry %+v", bob)
+			}
+			if printer.PublicKey.Base64() != "JVzBpb4Tl6bA4iyEeTYfVbJ12fyH5Pgm29X/2F5I1yU=" {
+				t.Errorf("unexpected public key %s", printer.PublicKey.Base64())
+			}
+		})
+	}
+}
+
+func TestReadClientEntriesInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		input    string
+		expected string
+	}{
+		{"unknown column", BulkCSV, "name,email\nalice,a@example.com\n", "unknown csv column"},
+		{"missing name column", BulkCSV, "ip\n10.0.0.2\n", "missing csv column"},
+		{"missing name", BulkCSV, "name,ip\nalice,\n,10.0.0.2\n", "line 3: missing name"},
+		{"invalid ip", BulkCSV, "name,ip\nalice,10.0.0\n", "invalid ip"},
+		{"invalid route", BulkCSV, "name,routes\nalice,10.0.0.0\n", "error while parsing IPNet"},
+		{"invalid key", BulkCSV, "name,public_key\nalice,abc\n", "invalid public key"},
+		{"duplicate name", BulkCSV, "name\nalice\nalice\n", "duplicate client alice"},
+		{"duplicate ip", BulkCSV, "name,ip\nalice,10.0.0.2\nbob,10.0.0.2\n", "same ip"},
+		{"unknown key", BulkYAML, "- name: alice\n  email: a@example.com\n", "field email not found"},
+		{"yaml missing name", BulkYAML, "- ip: 10.0.0.2\n", "client 1: missing name"},
+		{"unknown format", "json", "[]", "unknown format"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReadClientEntries(strings.NewReader(tt.input), tt.format)
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("expected error containing %q, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestAddClientStaticIP(t *testing.T) {
+	vpn := newBulkVPN(t)
+
+	client := NewWGClient(nil, false, nil, nil)
+	client.SetStaticIP(net.ParseIP("10.0.0.50").To4())
+	if err := vpn.AddClient(client); err != nil {
+		t.Fatalf("AddClient failed: %v", err)
+	}
+	if client.Address() != "10.0.0.50/24" {
+		t.Errorf("expected static address 10.0.0.50/24, got %s", client.Address())
+	}
+
+	for _, ip := range []string{"10.0.0.50", "10.0.0.1", "10.0.0.0", "10.1.0.2"} {
+		other := NewWGClient(nil, false, nil, nil)
+		other.SetStaticIP(net.ParseIP(ip).To4())
+		if err := vpn.AddClient(other); err == nil {
+			t.Errorf("expected error for static address %s", ip)
+		}
+	}
+}
+
+func TestAddClientPublicKey(t *testing.T) {
+	vpn := newBulkVPN(t)
+	public := crypto.NewRandomKey().Public()
+
+	client := NewWGClient(nil, false, nil, nil)
+	client.SetPublicKey(public)
+	if err := vpn.AddClient(client); err != nil {
+		t.Fatalf("AddClient failed: %v", err)
+	}
+	if vpn.peers[0].Public() != public.Base64() {
+		t.Errorf("expected peer public key %s, got %s", public.Base64(), vpn.peers[0].Public())
+	}
+	if strings.Contains(client.String(), "PrivateKey") {
+		t.Errorf("expected no private key in %s", client.String())
+	}
+
+	again := NewWGClient(nil, false, nil, nil)
+	again.SetPublicKey(public)
+	if err := vpn.AddClient(again); err == nil {
+		t.Error("expected error for a public key already used")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net"
 	"strings"
+	"unicode"
 
 	"github.com/asiffer/wg-easy-vpn/crypto"
 	"github.com/asiffer/wg-easy-vpn/utils"
@@ -12,8 +13,15 @@ import (
 // WGClient is a particular node which tries to reach a server
 type WGClient struct {
 	WGNode
-	dns    []net.IP
-	routes []net.IPNet
+	name     string
+	dns      []net.IP
+	routes   []net.IPNet
+	excludes []net.IPNet
+	subnets  []net.IPNet // networks routed behind the client (site-to-site)
+	options  WGOptions   // override the vpn defaults
+	static   net.IP      // address requested by the client (nil = first free one)
+	gateway  string      // server it connects to (empty = main server, AllGateways = every one)
+	tags     []string    // labels of the client (kept by the server)
 }
 
 // NewWGClient creates a new client
@@ -36,10 +44,88 @@ func (client *WGClient) DNS() string {
 	return strings.Join(strDNS, ", ")
 }
 
+// Name returns the name of the client
+func (client *WGClient) Name() string {
+	return client.name
+}
+
+// SetName sets the name of the client (kept on the server side, see
+// CleanClientName)
+func (client *WGClient) SetName(name string) {
+	client.name = CleanClientName(name)
+}
+
+// CleanClientName returns a name as it is stored: names are comments of
+// the server file, so the spaces and the control characters (newlines...)
+// are collapsed to a single space
+func CleanClientName(name string) string {
+	fields := strings.FieldsFunc(name, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsControl(r)
+	})
+	return strings.Join(fields, " ")
+}
+
+// SetPublicKey sets the public key of a client which keeps its private
+// key (its config has no PrivateKey)
+func (client *WGClient) SetPublicKey(public crypto.Key) {
+	client.private = nil
+	client.public = public
+}
+
+// SetStaticIP sets the address of the client in the network containing
+// it (the other networks still provide the first free address)
+func (client *WGClient) SetStaticIP(ip net.IP) {
+	client.static = ip
+}
+
+// SetTags sets the labels of the client (kept by the server)
+func (client *WGClient) SetTags(tags []string) {
+	client.tags = tags
+}
+
+// SetExcludedRoutes sets the networks removed from the client routes
+// (in addition to the ones excluded by the vpn)
+func (client *WGClient) SetExcludedRoutes(excludes []net.IPNet) {
+	client.excludes = excludes
+}
+
+// SetOptions sets the options of the client (the non-zero values
+// override the vpn defaults)
+func (client *WGClient) SetOptions(options WGOptions) {
+	client.options = options
+}
+
+// SetGateway sets the server the client connects to (empty for the main
+// server, AllGateways for every server). The other servers route its
+// addresses through this one.
+func (client *WGClient) SetGateway(name string) {
+	client.gateway = name
+}
+
+// SetSubnets sets the networks routed behind the client (site-to-site).
+// They are appended to the AllowedIPs of the client on the server side.
+func (client *WGClient) SetSubnets(subnets []net.IPNet) {
+	client.subnets = subnets
+}
+
+// Subnets returns the networks routed behind the client
+func (client *WGClient) Subnets() []net.IPNet {
+	return client.subnets
+}
+
 // ToPeer turns a WGClient into a Peer
 func (client *WGClient) ToPeer() *WGClientAsPeer {
+	peer := client.WGNode.ToPeer()
+	peer.allowedIPs = append(peer.allowedIPs, client.subnets...)
 	return &WGClientAsPeer{
-		WGPeer: *client.WGNode.ToPeer(),
+		WGPeer:   *peer,
+		name:     client.name,
+		tags:     client.tags,
+		options:  client.options,
+		gateway:  client.gateway,
+		dns:      client.dns,
+		routes:   client.routes,
+		excludes: client.excludes,
 	}
 }
 
@@ -60,16 +146,18 @@ func (client *WGClient) Populate(section *utils.Section) {
 }
 
 // PopulateClient writes the client config into a file
-func (client *WGClient) PopulateClient(file *utils.File, vpn *WGVPN) {
+func (client *WGClient) PopulateClient(file *utils.File, vpn *WGVPN) error {
+	routes, err := client.routesIn(vpn)
+	if err != nil {
+		return err
+	}
+	options := vpn.options.Merge(client.options)
+
 	// client section ([Interface])
 	sec := file.AddSection("Interface")
 	client.Populate(sec)
+	options.PopulateInterface(sec)
 
-	// use client routes if provided
-	routes := vpn.routes
-	if len(client.routes) > 0 {
-		routes = client.routes
-	}
 	// server as peer
 	peer := vpn.server.ToPeer(routes, vpn.endpoint)
 	// add client PSK to server as peer
@@ -78,4 +166,104 @@ func (client *WGClient) PopulateClient(file *utils.File, vpn *WGVPN) {
 	// Peer section
 	sec = file.AddSection("Peer")
 	peer.Populate(sec)
+	options.PopulatePeer(sec)
+	return nil
+}
+
+// PopulateClientGateway writes the client config into a file for the
+// server it connects to (see SetGateway)
+func (client *WGClient) PopulateClientGateway(file *utils.File, vpn *WGVPN) error {
+	switch client.gateway {
+	case "", vpn.name:
+		return client.PopulateClient(file, vpn)
+	case AllGateways:
+		return client.PopulateClientAll(file, vpn)
+	default:
+		return client.PopulateClientVia(file, vpn, client.gateway)
+	}
+}
+
+// PopulateClientVia writes the client config into a file. The client
+// reaches the VPN through the given gateway (the main server is named
+// after the vpn)
+func (client *WGClient) PopulateClientVia(file *utils.File, vpn *WGVPN, gateway string) error {
+	gw, err := vpn.Gateway(gateway)
+	if err != nil {
+		return err
+	}
+	return client.populateClientWith(file, vpn, []*WGGateway{gw})
+}
+
+// PopulateClientAll writes the client config into a file. Every gateway
+// is a peer of the client and the routes are split between them (they
+// do not overlap)
+func (client *WGClient) PopulateClientAll(file *utils.File, vpn *WGVPN) error {
+	return client.populateClientWith(file, vpn, vpn.Servers())
+}
+
+func (client *WGClient) populateClientWith(file *utils.File, vpn *WGVPN, gateways []*WGGateway) error {
+	routes, err := client.routesIn(vpn)
+	if err != nil {
+		return err
+	}
+	if len(routes) == 0 {
+		// same default as WGServer.ToPeer
+		routes = []net.IPNet{utils.IPv4ZeroNet, utils.IPv6ZeroNet}
+	}
+	options := vpn.options.Merge(client.options)
+
+	sec := file.AddSection("Interface")
+	client.Populate(sec)
+	options.PopulateInterface(sec)
+
+	groups := utils.SplitNetworks(routes, len(gateways))
+	for i, gw := range gateways {
+		peer := gw.WGServer.ToPeer(groups[i], gw.endpoint)
+		if len(groups[i]) == 0 {
+			// nothing left to route: the gateway itself only
+			peer.allowedIPs = gw.WGNode.ToPeer().allowedIPs
+		}
+		peer.psk = crypto.PresharedKey(client.psk)
+
+		sec = file.AddSection("Peer")
+		if len(gateways) > 1 {
+			sec.AddComment(gw.name)
+		}
+		peer.Populate(sec)
+		options.PopulatePeer(sec)
+	}
+	return nil
+}
+
+// routesIn returns the networks the client tunnels through the vpn
+// (empty for every destination). It fails when the exclusions remove
+// every route: the config would fall back to a full tunnel.
+func (client *WGClient) routesIn(vpn *WGVPN) ([]net.IPNet, error) {
+	// use client routes if provided
+	routes := vpn.routes
+	if len(client.routes) > 0 {
+		routes = client.routes
+	}
+	// add the subnets advertised by the other peers (site-to-site)
+	advertised := make([]net.IPNet, 0)
+	for _, subnet := range vpn.advertised {
+		if utils.FindNetwork(subnet, client.subnets) < 0 {
+			advertised = append(advertised, subnet)
+		}
+	}
+	// remove the excluded networks (split tunnelling)
+	excludes := append(append([]net.IPNet{}, vpn.excludes...), client.excludes...)
+	if len(advertised) == 0 && len(excludes) == 0 {
+		return routes, nil
+	}
+	if len(routes) == 0 {
+		// same default as WGServer.ToPeer
+		routes = []net.IPNet{utils.IPv4ZeroNet, utils.IPv6ZeroNet}
+	}
+	routes = append(append([]net.IPNet{}, routes...), advertised...)
+	if routes = utils.ExcludeNetworks(routes, excludes); len(routes) == 0 {
+		return nil, fmt.Errorf("the excluded routes (%s) remove every route of the client",
+			strings.Join(utils.StringifyNetworks(excludes), ", "))
+	}
+	return routes, nil
 }
@@ -98,6 +98,14 @@ func TestWGClientDNS(t *testing.T) {
 	})
 }
 
+func TestWGClientSetName(t *testing.T) {
+	client := NewWGClient(nil, false, nil, nil)
+	client.SetName(" Alice's\tphone\n[Interface]\r\nPostUp = id\x00 ")
+	if client.Name() != "Alice's phone [Interface] PostUp = id" {
+		t.Errorf("expected a single line name, got %q", client.Name())
+	}
+}
+
 func TestWGClientToPeer(t *testing.T) {
 	ipnet := []net.IPNet{{IP: net.ParseIP("10.0.0.2"), Mask: net.CIDRMask(24, 32)}}
 	dns := []net.IP{net.ParseIP("1.1.1.1")}
@@ -296,6 +304,53 @@ func TestWGClientPopulateClient(t *testing.T) {
 			t.Error("PresharedKey mismatch")
 		}
 	})
+
+	t.Run("excluded routes are removed from AllowedIPs", func(t *testing.T) {
+		clientNet := []net.IPNet{{IP: net.ParseIP("10.0.0.5"), Mask: net.CIDRMask(24, 32)}}
+		clientRoutes := []net.IPNet{{IP: net.ParseIP("192.168.0.0"), Mask: net.CIDRMask(16, 32)}}
+		client := NewWGClient(clientNet, false, dns, clientRoutes)
+		client.SetExcludedRoutes([]net.IPNet{{IP: net.ParseIP("192.168.128.0"), Mask: net.CIDRMask(17, 32)}})
+
+		vpnWithExcludes := *vpn
+		vpnWithExcludes.SetExcludedRoutes([]net.IPNet{{IP: net.ParseIP("192.168.0.0"), Mask: net.CIDRMask(18, 32)}})
+
+		file := utils.NewFile()
+		client.PopulateClient(file, &vpnWithExcludes)
+
+		allowedIPs, _ := file.Sections()[1].Get("AllowedIPs")
+		if allowedIPs != "192.168.64.0/18" {
+			t.Errorf("expected AllowedIPs '192.168.64.0/18', got '%s'", allowedIPs)
+		}
+	})
+
+	t.Run("excluding every route is an error", func(t *testing.T) {
+		clientNet := []net.IPNet{{IP: net.ParseIP("10.0.0.6"), Mask: net.CIDRMask(24, 32)}}
+		clientRoutes := []net.IPNet{{IP: net.ParseIP("10.0.0.0"), Mask: net.CIDRMask(8, 32)}}
+		client := NewWGClient(clientNet, false, dns, clientRoutes)
+		client.SetExcludedRoutes(clientRoutes)
+
+		if err := client.PopulateClient(utils.NewFile(), vpn); err == nil {
+			t.Error("expected an error instead of a full tunnel")
+		}
+	})
+
+	t.Run("exclusions apply to the default routes", func(t *testing.T) {
+		clientNet := []net.IPNet{{IP: net.ParseIP("10.0.0.7"), Mask: net.CIDRMask(24, 32)}}
+		client := NewWGClient(clientNet, false, dns, nil)
+		client.SetExcludedRoutes([]net.IPNet{{IP: net.ParseIP("128.0.0.0"), Mask: net.CIDRMask(1, 32)}})
+
+		vpnWithoutRoutes := *vpn
+		vpnWithoutRoutes.routes = nil
+
+		file := utils.NewFile()
+		if err := client.PopulateClient(file, &vpnWithoutRoutes); err != nil {
+			t.Fatalf("PopulateClient failed: %v", err)
+		}
+		allowedIPs, _ := file.Sections()[1].Get("AllowedIPs")
+		if allowedIPs != "0.0.0.0/1, ::/0" {
+			t.Errorf("expected AllowedIPs '0.0.0.0/1, ::/0', got '%s'", allowedIPs)
+		}
+	})
 }
 
 func TestWGClientDualStack(t *testing.T) {
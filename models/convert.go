@@ -0,0 +1,149 @@
+package models
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/asiffer/wg-easy-vpn/utils"
+)
+
+// RenderClient renders a populated client config in the given format (conn
+// is the name of the connection). The networkd format is made of several
+// files, see Networkd.
+func RenderClient(f *utils.File, format string, conn string) (string, error) {
+	switch format {
+	case FormatWGQuick, "":
+		return f.String(), nil
+	case FormatNM:
+		return NMKeyfile(f, conn)
+	case FormatOpenWrt:
+		return OpenWrt(f, conn)
+	case FormatRouterOS:
+		return RouterOS(f, conn)
+	default:
+		return "", fmt.Errorf("cannot render a client config in the %q format", format)
+	}
+}
+
+// ClientConfigSuffix returns the extension of the client configs rendered
+// in the given format
+func ClientConfigSuffix(format string) string {
+	switch format {
+	case FormatNM:
+		return ".nmconnection"
+	case FormatOpenWrt:
+		return ".uci" // uci batch script
+	case FormatRouterOS:
+		return ".rsc"
+	default:
+		return ".conf"
+	}
+}
+
+// interfaceSettings are the settings of a populated config (wg-quick)
+// converted to the formats of other tools
+type interfaceSettings struct {
+	section   *utils.Section // [Interface] (hooks...)
+	comments  []string       // comments of the DEFAULT section (name)
+	private   string
+	addresses []net.IPNet
+	dns       []net.IP
+	options   WGOptions
+	peers     []peerSettings
+}
+
+// peerSettings are the settings of a [Peer] section
+type peerSettings struct {
+	comments  []string
+	public    string
+	psk       string // empty = none
+	allowed   []net.IPNet
+	endpoint  string // empty = none
+	keepalive string // empty = none
+}
+
+// readInterfaceSettings reads a populated config. The private key is
+// required by the other tools.
+func readInterfaceSettings(f *utils.File) (*interfaceSettings, error) {
+	sec, err := f.GetSection("Interface")
+	if err != nil {
+		return nil, fmt.Errorf("missing Interface section")
+	}
+	settings := &interfaceSettings{section: sec, dns: make([]net.IP, 0), peers: make([]peerSettings, 0)}
+	if def, err := f.GetSection(utils.DEFAULT_SECTION); err == nil {
+		settings.comments = def.Comments()
+	}
+	if settings.private, err = sec.Get("PrivateKey"); err != nil {
+		return nil, fmt.Errorf("the private key is required")
+	}
+	if settings.addresses, err = sec.GetNetworks("Address"); err != nil {
+		return nil, err
+	}
+	if sec.HasKey("DNS") {
+		if settings.dns, err = sec.GetIPArray("DNS"); err != nil {
+			return nil, err
+		}
+	}
+	if settings.options, err = OptionsFromSection(sec); err != nil {
+		return nil, err
+	}
+
+	for _, p := range f.Sections() {
+		if p.Name() != "Peer" {
+			continue
+		}
+		peer := peerSettings{comments: plainComments(p)}
+		if peer.public, err = p.Get("PublicKey"); err != nil {
+			return nil, fmt.Errorf("missing peer public key")
+		}
+		if peer.allowed, err = p.GetNetworks("AllowedIPs"); err != nil {
+			return nil, err
+		}
+		peer.psk, _ = p.Get("PresharedKey")
+		peer.endpoint, _ = p.Get("Endpoint")
+		peer.keepalive, _ = p.Get("PersistentKeepalive")
+		settings.peers = append(settings.peers, peer)
+	}
+	return settings, nil
+}
+
+// networksOf returns the networks of one family (IPv4 or IPv6)
+func networksOf(networks []net.IPNet, v4 bool) []net.IPNet {
+	out := make([]net.IPNet, 0)
+	for _, n := range networks {
+		if (n.IP.To4() != nil) == v4 {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// ipsOf returns the addresses of one family (IPv4 or IPv6)
+func ipsOf(ips []net.IP, v4 bool) []net.IP {
+	out := make([]net.IP, 0)
+	for _, ip := range ips {
+		if (ip.To4() != nil) == v4 {
+			out = append(out, ip)
+		}
+	}
+	return out
+}
+
+// isDefaultRoute returns whether the network is 0.0.0.0/0 or ::/0
+func isDefaultRoute(n net.IPNet) bool {
+	ones, _ := n.Mask.Size()
+	return ones == 0
+}
+
+// splitEndpoint splits host:port (the port is empty when missing)
+func splitEndpoint(endpoint string) (string, string) {
+	host, port, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		return endpoint, ""
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return endpoint, ""
+	}
+	return host, port
+}
@@ -0,0 +1,247 @@
+package models
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/asiffer/wg-easy-vpn/crypto"
+	"github.com/asiffer/wg-easy-vpn/utils"
+)
+
+// severities of the findings
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Finding is a problem of a config found by Diagnose
+type Finding struct {
+	Severity string `json:"severity"`
+	Check    string `json:"check"`
+	Message  string `json:"message"`
+	Hint     string `json:"hint"`
+}
+
+// HostState is what is known about the host running the server (nil =
+// unknown, the check is skipped)
+type HostState struct {
+	IPv4Forwarding *bool
+	IPv6Forwarding *bool
+}
+
+// doctorPeer is a peer section read leniently (invalid values are
+// reported, not returned as errors)
+type doctorPeer struct {
+	label   string
+	public  string // empty = invalid
+	allowed []net.IPNet
+}
+
+// Diagnose checks a server file (embedded metadata). Unlike VPNFromFile,
+// it does not stop at the first problem.
+func Diagnose(f *utils.File, host HostState) []Finding {
+	findings := make([]Finding, 0)
+	report := func(severity, check, hint, format string, args ...any) {
+		findings = append(findings, Finding{
+			Severity: severity,
+			Check:    check,
+			Message:  fmt.Sprintf(format, args...),
+			Hint:     hint,
+		})
+	}
+
+	// metadata
+	var networks, routes []net.IPNet
+	def, err := f.GetSection(utils.DEFAULT_SECTION)
+	managed := err == nil && (def.HasKey("Network") || def.HasKey("Endpoint"))
+	if !managed {
+		report(SeverityWarning, "metadata", "run 'wg-easy-vpn adopt' (or 'migrate' for an older wg-easy-vpn config)",
+			"the config has no wg-easy-vpn metadata")
+	} else {
+		if endpoint, _ := def.Get("Endpoint"); endpoint == "" {
+			report(SeverityError, "endpoint", "set Endpoint in the top section of the config",
+				"the server has no endpoint (client configs cannot reach it)")
+		}
+		if networks, err = def.GetNetworks("Network"); err != nil {
+			report(SeverityError, "network", "set Network in the top section of the config (ex: 10.8.0.0/24)",
+				"invalid or missing networks (%v)", err)
+		}
+		routes, _ = def.GetNetworks("Routes")
+		if len(routes) == 0 {
+			routes = []net.IPNet{utils.IPv4ZeroNet, utils.IPv6ZeroNet}
+		}
+	}
+
+	// keys of the servers (the gateways have a generated peer section)
+	keys := make(map[string]string)
+	gateways := make(map[string]bool)
+	servers := make([]string, 0)
+	for _, sec := range f.Sections() {
+		label := ""
+		switch sec.Name() {
+		case "Interface":
+			label = "server"
+		case "Gateway":
+			name, _ := sec.Get("Name")
+			label = "gateway " + name
+			if endpoint, _ := sec.Get("Endpoint"); endpoint == "" {
+				report(SeverityError, "endpoint", "set Endpoint in the Gateway section",
+					"%s has no endpoint", label)
+			}
+		default:
+			continue
+		}
+		servers = append(servers, label)
+		private, err := sec.Get("PrivateKey")
+		if err != nil || !validKey(private) {
+			report(SeverityError, "keys", "generate a new key with 'wg genkey' (the clients need the new public key)",
+				"%s has an invalid private key", label)
+			continue
+		}
+		k := crypto.NewKey()
+		k.UpdateFromBase64(private)
+		public := k.Public().Base64()
+		if other, ok := keys[public]; ok {
+			report(SeverityError, "duplicate-key", "generate a new key with 'wg genkey' for one of them",
+				"%s and %s have the same private key", other, label)
+			continue
+		}
+		keys[public] = label
+		if sec.Name() == "Gateway" {
+			gateways[public] = true
+		}
+	}
+	if len(servers) == 0 {
+		report(SeverityError, "interface", "the config must have an Interface section", "no server (Interface section)")
+	}
+
+	// peers
+	peers := make([]doctorPeer, 0)
+	for _, sec := range f.Sections() {
+		if sec.Name() != "Peer" {
+			continue
+		}
+		peer := doctorPeer{label: fmt.Sprintf("peer #%d", len(peers)+1)}
+		if name, _ := peerMetadata(sec); name != "" {
+			peer.label = name
+		}
+		public, _ := sec.Get("PublicKey")
+		if !validKey(public) {
+			report(SeverityError, "keys", "remove the peer and add the client again",
+				"%s has an invalid public key %q", peer.label, public)
+		} else {
+			peer.public = public
+		}
+		if sec.HasKey("PresharedKey") {
+			if psk, _ := sec.Get("PresharedKey"); !validKey(psk) {
+				report(SeverityError, "keys", "remove the PresharedKey or generate a new one with 'wg genpsk'",
+					"%s has an invalid preshared key", peer.label)
+			}
+		}
+		if peer.allowed, err = sec.GetNetworks("AllowedIPs"); err != nil {
+			report(SeverityError, "allowed-ips", "fix the AllowedIPs of the peer",
+				"%s has invalid AllowedIPs (%v)", peer.label, err)
+		}
+		if gateways[peer.public] {
+			// peer section of a gateway
+			delete(gateways, peer.public)
+			continue
+		}
+		if peer.public != "" {
+			if other, ok := keys[peer.public]; ok {
+				report(SeverityError, "duplicate-key", "remove one of them ('wg-easy-vpn rm --peer <public key>') and add it again",
+					"%s and %s have the same public key %s", other, peer.label, peer.public)
+			} else {
+				keys[peer.public] = peer.label
+			}
+		}
+		peers = append(peers, peer)
+	}
+
+	// addresses of the peers
+	forward4, forward6 := false, false
+	for _, r := range routes {
+		if !coveredBy(r, networks) {
+			forward4 = forward4 || r.IP.To4() != nil
+			forward6 = forward6 || r.IP.To4() == nil
+		}
+	}
+	for i, a := range peers {
+		for _, n := range a.allowed {
+			if isHost(n) {
+				if len(networks) > 0 && !containsIP(networks, n.IP) {
+					report(SeverityWarning, "allowed-ips", "remove the peer and add the client again (it gets an address of the networks)",
+						"%s has the address %s outside of the networks %s", a.label, n.IP.String(),
+						strings.Join(utils.StringifyNetworks(networks), ", "))
+				}
+			} else {
+				// subnet routed behind the peer (site-to-site)
+				forward4 = forward4 || n.IP.To4() != nil
+				forward6 = forward6 || n.IP.To4() == nil
+			}
+		}
+		for _, b := range peers[i+1:] {
+			for _, na := range a.allowed {
+				for _, nb := range b.allowed {
+					switch {
+					case isHost(na) && isHost(nb) && na.IP.Equal(nb.IP):
+						report(SeverityError, "shared-ip", "remove one of the peers and add it again (it gets a free address)",
+							"%s and %s share the address %s", a.label, b.label, na.IP.String())
+					case utils.NetworksOverlap(na, nb):
+						report(SeverityError, "overlap", "change the AllowedIPs of one of the peers (wireguard routes the shared addresses to one peer only)",
+							"the AllowedIPs of %s (%s) and %s (%s) overlap", a.label, na.String(), b.label, nb.String())
+					}
+				}
+			}
+		}
+	}
+
+	// ip forwarding (routes beyond the vpn networks)
+	hooks := strings.Join(hookCommands(f), "\n")
+	if forward4 && host.IPv4Forwarding != nil && !*host.IPv4Forwarding && !strings.Contains(hooks, "net.ipv4.ip_forward") {
+		report(SeverityWarning, "forwarding", "run 'sysctl -w net.ipv4.ip_forward=1' and persist it in /etc/sysctl.d (or init with --wan)",
+			"IPv4 forwarding is disabled but the clients route traffic through the server")
+	}
+	if forward6 && host.IPv6Forwarding != nil && !*host.IPv6Forwarding && !strings.Contains(hooks, "net.ipv6.conf.all.forwarding") {
+		report(SeverityWarning, "forwarding", "run 'sysctl -w net.ipv6.conf.all.forwarding=1' and persist it in /etc/sysctl.d (or init with --wan)",
+			"IPv6 forwarding is disabled but the clients route traffic through the server")
+	}
+	return findings
+}
+
+// validKey returns whether the value is a base64 encoded 32-byte key
+func validKey(value string) bool {
+	raw, err := base64.StdEncoding.DecodeString(value)
+	return err == nil && len(raw) == crypto.KeyLen
+}
+
+// isHost returns whether the network is a single address (/32 or /128)
+func isHost(n net.IPNet) bool {
+	ones, bits := n.Mask.Size()
+	return ones == bits
+}
+
+// coveredBy returns whether the network is inside one of the networks
+func coveredBy(n net.IPNet, networks []net.IPNet) bool {
+	ones, _ := n.Mask.Size()
+	for _, network := range networks {
+		size, _ := network.Mask.Size()
+		if network.Contains(n.IP) && size <= ones {
+			return true
+		}
+	}
+	return false
+}
+
+// hookCommands returns the hooks of the interface
+func hookCommands(f *utils.File) []string {
+	commands := make([]string, 0)
+	if iface, err := f.GetSection("Interface"); err == nil {
+		for _, key := range []string{"PreUp", "PostUp"} {
+			commands = append(commands, iface.GetAll(key)...)
+		}
+	}
+	return commands
+}
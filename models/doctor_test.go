@@ -0,0 +1,118 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/asiffer/wg-easy-vpn/utils"
+)
+
+// checksOf returns the checks of the findings with the given severity
+func checksOf(findings []Finding, severity string) []string {
+	checks := make([]string, 0)
+	for _, finding := range findings {
+		if finding.Severity == severity {
+			checks = append(checks, finding.Check)
+		}
+	}
+	return checks
+}
+
+func hasCheck(findings []Finding, check string) bool {
+	for _, finding := range findings {
+		if finding.Check == check {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDiagnoseHealthy(t *testing.T) {
+	f := utils.NewFile()
+	newStateVPN(t).Populate(f)
+	enabled := true
+	findings := Diagnose(f, HostState{IPv4Forwarding: &enabled, IPv6Forwarding: &enabled})
+	if len(findings) != 0 {
+		t.Errorf("expected no findings, got %+v", findings)
+	}
+}
+
+func TestDiagnoseProblems(t *testing.T) {
+	f := utils.NewFile()
+	newStateVPN(t).Populate(f)
+	def, _ := f.GetSection(utils.DEFAULT_SECTION)
+	def.Set("Endpoint", "")
+	var laptop *utils.Section
+	for _, sec := range f.Sections() {
+		if sec.Name() == "Peer" && len(sec.Comments()) > 0 && sec.Comments()[0] == "laptop" {
+			laptop = sec
+		}
+	}
+	public, _ := laptop.Get("PublicKey")
+	allowed, _ := laptop.Get("AllowedIPs")
+
+	// same key and address as the laptop
+	dup := f.AddSection("Peer")
+	dup.AddComment("copy")
+	dup.Set("PublicKey", public)
+	dup.Set("AllowedIPs", allowed)
+	// invalid keys, address outside of the networks
+	bad := f.AddSection("Peer")
+	bad.AddComment("bad")
+	bad.Set("PublicKey", "not-a-key")
+	bad.Set("PresharedKey", "c2hvcnQ=")
+	bad.Set("AllowedIPs", "192.168.1.9/32")
+	// subnet overlapping the laptop
+	site := f.AddSection("Peer")
+	site.AddComment("site")
+	site.Set("PublicKey", "+k5f1ALR7Q+BS5EtJhTl2ABgh3DG8h48sHAZIAIRkU0=")
+	site.Set("AllowedIPs", "10.0.0.0/28")
+
+	disabled := false
+	findings := Diagnose(f, HostState{IPv4Forwarding: &disabled})
+	for _, check := range []string{"endpoint", "duplicate-key", "shared-ip", "keys", "overlap"} {
+		if !hasCheck(findings, check) {
+			t.Errorf("expected a %s finding, got %v", check, checksOf(findings, SeverityError))
+		}
+	}
+	for _, check := range []string{"allowed-ips", "forwarding"} {
+		found := false
+		for _, finding := range findings {
+			found = found || (finding.Check == check && finding.Severity == SeverityWarning)
+		}
+		if !found {
+			t.Errorf("expected a %s warning, got %+v", check, findings)
+		}
+	}
+	for _, finding := range findings {
+		if finding.Hint == "" {
+			t.Errorf("finding without hint: %+v", finding)
+		}
+		if finding.Check == "duplicate-key" && !strings.Contains(finding.Message, "copy") {
+			t.Errorf("expected the peer name in %q", finding.Message)
+		}
+	}
+}
+
+func TestDiagnoseForwardingHook(t *testing.T) {
+	f := utils.NewFile()
+	newStateVPN(t).Populate(f)
+	iface, _ := f.GetSection("Interface")
+	iface.Add("PreUp", "sysctl -w net.ipv4.ip_forward=1")
+	disabled := false
+	findings := Diagnose(f, HostState{IPv4Forwarding: &disabled})
+	if hasCheck(findings, "forwarding") {
+		t.Errorf("the sysctl hook enables forwarding, got %+v", findings)
+	}
+}
+
+func TestDiagnosePlain(t *testing.T) {
+	f, err := utils.ParseFile("../test/wg0.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	findings := Diagnose(f, HostState{})
+	if len(findings) != 1 || findings[0].Check != "metadata" || findings[0].Severity != SeverityWarning {
+		t.Errorf("expected a metadata warning only, got %+v", findings)
+	}
+}
@@ -0,0 +1,78 @@
+// gateway.go
+//
+//
+
+package models
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/asiffer/wg-easy-vpn/utils"
+)
+
+// WGGateway is an additional server of the VPN (relay in another
+// region for instance). It shares the networks and the clients of the
+// main server but it has its own key, endpoint and port
+type WGGateway struct {
+	WGServer
+	name     string // name of the gateway
+	endpoint string // public address of the gateway
+}
+
+// NewWGGateway creates a new gateway (addresses are provided by the vpn)
+func NewWGGateway(name string, endpoint string, port uint16) *WGGateway {
+	return &WGGateway{
+		WGServer: *NewWGServer(nil, true, port),
+		name:     name,
+		endpoint: endpoint,
+	}
+}
+
+// Name returns the name of the gateway
+func (gw *WGGateway) Name() string {
+	return gw.name
+}
+
+// Endpoint returns the public address of the gateway
+func (gw *WGGateway) Endpoint() string {
+	return gw.endpoint
+}
+
+// Populate enriches a section with gateway attributes (vpn state)
+func (gw *WGGateway) Populate(section *utils.Section) {
+	section.Set("Name", gw.name)
+	section.Set("Endpoint", gw.endpoint)
+	gw.WGServer.Populate(section)
+}
+
+// ToRelay turns a gateway into a peer of the other gateways. Only
+// its own addresses are routed through it
+func (gw *WGGateway) ToRelay() *WGServerAsPeer {
+	return &WGServerAsPeer{
+		WGPeer:   *gw.WGNode.ToPeer(),
+		endpoint: gw.endpoint,
+	}
+}
+
+// GatewayFromSection reads a gateway from the vpn state
+func GatewayFromSection(sec *utils.Section) (*WGGateway, error) {
+	name, err := sec.Get("Name")
+	if err != nil {
+		return nil, fmt.Errorf("error while retrieving gateway name (%w)", err)
+	}
+	endpoint, err := sec.Get("Endpoint")
+	if err != nil {
+		return nil, fmt.Errorf("error while retrieving gateway %s endpoint (%w)", name, err)
+	}
+	server, err := ServerFromSection(sec)
+	if err != nil {
+		return nil, fmt.Errorf("error while retrieving gateway %s (%w)", name, err)
+	}
+	server.extra = unmanagedItems(sec, slices.Concat(serverKeys, []string{"Name", "Endpoint"})...)
+	return &WGGateway{
+		WGServer: *server,
+		name:     name,
+		endpoint: endpoint,
+	}, nil
+}
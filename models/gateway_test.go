@@ -0,0 +1,228 @@
+package models
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/asiffer/wg-easy-vpn/utils"
+)
+
+func newTestVPNWithGateway(t *testing.T) (*WGVPN, *WGGateway) {
+	t.Helper()
+	server := NewWGServer(nil, false, 51820)
+	networks := []net.IPNet{{IP: net.ParseIP("10.0.0.0"), Mask: net.CIDRMask(24, 32)}}
+	routes := []net.IPNet{utils.IPv4ZeroNet}
+	vpn, err := NewWGVPN("wg0", server, "paris.example.com:51820", networks, nil, routes)
+	if err != nil {
+		t.Fatalf("failed to create VPN: %v", err)
+	}
+	gw := NewWGGateway("london", "london.example.com:51820", 51820)
+	if err := vpn.AddGateway(gw); err != nil {
+		t.Fatalf("failed to add gateway: %v", err)
+	}
+	return vpn, gw
+}
+
+func TestWGVPNAddGateway(t *testing.T) {
+	vpn, gw := newTestVPNWithGateway(t)
+
+	if gw.Address() != "10.0.0.2/24" {
+		t.Errorf("expected gateway address 10.0.0.2/24, got %s", gw.Address())
+	}
+
+	t.Run("clients do not reuse gateway addresses", func(t *testing.T) {
+		client := NewWGClient(nil, false, nil, nil)
+		vpn.AddClient(client)
+		if client.Address() != "10.0.0.3/24" {
+			t.Errorf("expected client address 10.0.0.3/24, got %s", client.Address())
+		}
+	})
+
+	t.Run("duplicate names are rejected", func(t *testing.T) {
+		if err := vpn.AddGateway(NewWGGateway("london", "", 51820)); err == nil {
+			t.Error("expected error for a duplicate gateway")
+		}
+		if err := vpn.AddGateway(NewWGGateway("wg0", "", 51820)); err == nil {
+			t.Error("expected error for a gateway named after the main server")
+		}
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		if err := vpn.RemoveGateway("wg0"); err == nil {
+			t.Error("expected error when removing the main server")
+		}
+		if err := vpn.RemoveGateway("london"); err != nil {
+			t.Fatalf("failed to remove gateway: %v", err)
+		}
+		if len(vpn.Servers()) != 1 {
+			t.Errorf("expected 1 server, got %d", len(vpn.Servers()))
+		}
+	})
+}
+
+func TestWGVPNGatewayRoundTrip(t *testing.T) {
+	vpn, gw := newTestVPNWithGateway(t)
+	client := NewWGClient(nil, false, nil, nil)
+	vpn.AddClient(client)
+
+	file := utils.NewFile()
+	vpn.Populate(file)
+
+	parsed, err := VPNFromFile("wg0", file)
+	if err != nil {
+		t.Fatalf("failed to parse VPN: %v", err)
+	}
+	// the relay peer section of the gateway is not a client
+	if parsed.NumberOfPeers() != 1 {
+		t.Errorf("expected 1 client, got %d", parsed.NumberOfPeers())
+	}
+	parsedGw, err := parsed.Gateway("london")
+	if err != nil {
+		t.Fatalf("gateway not parsed: %v", err)
+	}
+	if parsedGw.Private() != gw.Private() || parsedGw.Endpoint() != gw.Endpoint() || parsedGw.Address() != gw.Address() {
+		t.Error("gateway mismatch after round trip")
+	}
+}
+
+func TestWGVPNPopulateGateway(t *testing.T) {
+	vpn, gw := newTestVPNWithGateway(t)
+	// 10.0.0.3 connects to the main server, 10.0.0.4 to london and
+	// 10.0.0.5 to both
+	client := NewWGClient(nil, false, nil, nil)
+	vpn.AddClient(client)
+	london := NewWGClient(nil, false, nil, nil)
+	london.SetGateway("london")
+	vpn.AddClient(london)
+	both := NewWGClient(nil, false, nil, nil)
+	both.SetGateway(AllGateways)
+	vpn.AddClient(both)
+
+	t.Run("gateway config", func(t *testing.T) {
+		file := utils.NewFile()
+		if err := vpn.PopulateGateway("london", file); err != nil {
+			t.Fatalf("PopulateGateway failed: %v", err)
+		}
+		iface, _ := file.GetSection("Interface")
+		if key, _ := iface.Get("PrivateKey"); key != gw.Private() {
+			t.Error("expected the gateway private key")
+		}
+		peers := peerSections(file)
+		if len(peers) != 3 {
+			t.Fatalf("expected 3 peers (main server, london client, both), got %d", len(peers))
+		}
+		// main server as relay of its own clients
+		if endpoint, _ := peers[0].Get("Endpoint"); endpoint != "paris.example.com:51820" {
+			t.Errorf("expected main server endpoint, got %s", endpoint)
+		}
+		if allowed, _ := peers[0].Get("AllowedIPs"); allowed != "10.0.0.1/32, 10.0.0.3/32" {
+			t.Errorf("expected main server and client addresses, got %s", allowed)
+		}
+		// clients
+		if psk, _ := peers[1].Get("PresharedKey"); psk != london.PSK() {
+			t.Error("expected the london client PSK")
+		}
+		if psk, _ := peers[2].Get("PresharedKey"); psk != both.PSK() {
+			t.Error("expected the PSK of the client of both servers")
+		}
+	})
+
+	t.Run("main server config has the relay", func(t *testing.T) {
+		file := utils.NewFile()
+		vpn.PopulateServer(file)
+		peers := peerSections(file)
+		if len(peers) != 3 {
+			t.Fatalf("expected 3 peers (gateway, client, both), got %d", len(peers))
+		}
+		if allowed, _ := peers[0].Get("AllowedIPs"); allowed != "10.0.0.2/32, 10.0.0.4/32" {
+			t.Errorf("expected gateway and london client addresses, got %s", allowed)
+		}
+	})
+
+	t.Run("the gateways are kept apart", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "wg0.conf")
+		if err := vpn.Save(path); err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+		file, err := utils.ParseFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		def, _ := file.GetSection(utils.DEFAULT_SECTION)
+		if ref, _ := def.Get("Gateways"); ref != path+GatewaysSuffix || file.HasSection("Gateway") {
+			t.Errorf("expected a reference to the gateways file:\n%s", file.String())
+		}
+		parsed, err := VPNFromFile("wg0", file)
+		if err != nil {
+			t.Fatalf("failed to parse VPN: %v", err)
+		}
+		if parsed.NumberOfPeers() != 3 || len(parsed.PeersOf("london")) != 2 {
+			t.Errorf("expected 3 clients, 2 of london, got %d", parsed.NumberOfPeers())
+		}
+		if _, err := parsed.Gateway("london"); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("a used gateway is kept", func(t *testing.T) {
+		if err := vpn.RemoveGateway("london"); err == nil {
+			t.Error("expected error when removing the gateway of a client")
+		}
+	})
+
+	t.Run("unknown gateway", func(t *testing.T) {
+		if err := vpn.PopulateGateway("tokyo", utils.NewFile()); err == nil {
+			t.Error("expected error for an unknown gateway")
+		}
+		client := NewWGClient(nil, false, nil, nil)
+		client.SetGateway("tokyo")
+		if err := vpn.AddClient(client); err == nil {
+			t.Error("expected error for a client of an unknown gateway")
+		}
+	})
+}
+
+func TestWGClientPopulateClientGateways(t *testing.T) {
+	vpn, _ := newTestVPNWithGateway(t)
+	client := NewWGClient(nil, false, nil, nil)
+	vpn.AddClient(client)
+
+	t.Run("via a chosen gateway", func(t *testing.T) {
+		file := utils.NewFile()
+		if err := client.PopulateClientVia(file, vpn, "london"); err != nil {
+			t.Fatalf("PopulateClientVia failed: %v", err)
+		}
+		peers := peerSections(file)
+		if len(peers) != 1 {
+			t.Fatalf("expected 1 peer, got %d", len(peers))
+		}
+		if endpoint, _ := peers[0].Get("Endpoint"); endpoint != "london.example.com:51820" {
+			t.Errorf("expected london endpoint, got %s", endpoint)
+		}
+		if allowed, _ := peers[0].Get("AllowedIPs"); allowed != "0.0.0.0/0" {
+			t.Errorf("expected all the routes, got %s", allowed)
+		}
+		if err := client.PopulateClientVia(utils.NewFile(), vpn, "tokyo"); err == nil {
+			t.Error("expected error for an unknown gateway")
+		}
+	})
+
+	t.Run("all gateways split the routes", func(t *testing.T) {
+		file := utils.NewFile()
+		client.PopulateClientAll(file, vpn)
+		peers := peerSections(file)
+		if len(peers) != 2 {
+			t.Fatalf("expected 2 peers, got %d", len(peers))
+		}
+		expected := []string{"0.0.0.0/1", "128.0.0.0/1"}
+		for i, peer := range peers {
+			if allowed, _ := peer.Get("AllowedIPs"); allowed != expected[i] {
+				t.Errorf("peer %d: expected AllowedIPs %s, got %s", i, expected[i], allowed)
+			}
+			if psk, _ := peer.Get("PresharedKey"); psk != client.PSK() {
+				t.Errorf("peer %d: expected the client PSK", i)
+			}
+		}
+	})
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/asiffer/wg-easy-vpn/utils"
+)
+
+// keyfileGroup is a group of a key file ([wireguard], [WireGuardPeer]...)
+// rendered as key=value lines. The keys of some tools contain dashes so
+// they do not fit in a utils.Section.
+type keyfileGroup struct {
+	name     string
+	comments []string
+	items    []utils.KeyValue
+}
+
+func (g *keyfileGroup) set(key string, value string) {
+	g.items = append(g.items, utils.KeyValue{Key: key, Value: value})
+}
+
+// renderKeyfile writes the header comments and the groups
+func renderKeyfile(header []string, groups []*keyfileGroup) string {
+	var sb strings.Builder
+	for _, comment := range header {
+		fmt.Fprintf(&sb, "# %s\n", comment)
+	}
+	for i, g := range groups {
+		if i > 0 || sb.Len() > 0 {
+			sb.WriteString("\n")
+		}
+		for _, comment := range g.comments {
+			fmt.Fprintf(&sb, "# %s\n", comment)
+		}
+		fmt.Fprintf(&sb, "[%s]\n", g.name)
+		for _, kv := range g.items {
+			fmt.Fprintf(&sb, "%s=%s\n", kv.Key, kv.Value)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,278 @@
+// mesh.go
+//
+//
+
+package models
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/asiffer/wg-easy-vpn/crypto"
+	"github.com/asiffer/wg-easy-vpn/utils"
+	"github.com/rs/zerolog"
+)
+
+// WGMeshNode is a node of a full-mesh VPN: it is a peer of
+// every other node
+type WGMeshNode struct {
+	WGNode
+	name     string // name of the node (also the name of its config file)
+	endpoint string // public address (empty when the node is not reachable)
+	port     uint16
+}
+
+// WGMeshNodeAsPeer is a mesh node seen from another node
+type WGMeshNodeAsPeer struct {
+	WGPeer
+	endpoint string
+}
+
+// WGMesh denotes a full-mesh Wireguard VPN (no server, every node
+// knows every other node)
+type WGMesh struct {
+	name     string              // name of the connection
+	networks []net.IPNet         // common config
+	secret   crypto.PresharedKey // pairwise PSK derivation (nil = no PSK)
+	nodes    []*WGMeshNode
+}
+
+// NewWGMeshNode creates a new mesh node (without address)
+func NewWGMeshNode(name string, endpoint string, port uint16) *WGMeshNode {
+	return &WGMeshNode{
+		WGNode:   *NewWGNode(nil, true),
+		name:     name,
+		endpoint: endpoint,
+		port:     port,
+	}
+}
+
+// Name returns the name of the node
+func (node *WGMeshNode) Name() string {
+	return node.name
+}
+
+// Endpoint returns the public address of the node (host:port). It is
+// empty when the node is not publicly reachable
+func (node *WGMeshNode) Endpoint() string {
+	if node.endpoint == "" {
+		return ""
+	}
+	if _, _, err := net.SplitHostPort(node.endpoint); err == nil {
+		return node.endpoint
+	}
+	return net.JoinHostPort(node.endpoint, strconv.Itoa(int(node.port)))
+}
+
+// Populate enriches a section with the node attributes (mesh state)
+func (node *WGMeshNode) Populate(section *utils.Section) {
+	section.Set("Name", node.name)
+	section.Set("Address", node.Address())
+	section.Set("PrivateKey", node.Private())
+	section.Set("ListenPort", fmt.Sprintf("%d", node.port))
+	if node.endpoint != "" {
+		section.Set("Endpoint", node.endpoint)
+	}
+}
+
+// ToPeer turns a mesh node into a peer (its address only is allowed)
+func (node *WGMeshNode) ToPeer() *WGMeshNodeAsPeer {
+	return &WGMeshNodeAsPeer{
+		WGPeer:   *node.WGNode.ToPeer(),
+		endpoint: node.Endpoint(),
+	}
+}
+
+// Populate enriches a section with the peer attributes (the endpoint
+// is set only when the node is public)
+func (peer *WGMeshNodeAsPeer) Populate(section *utils.Section) {
+	peer.WGPeer.Populate(section)
+	if peer.endpoint != "" {
+		section.Set("Endpoint", peer.endpoint)
+	}
+}
+
+// MeshNodeFromSection reads a node from the mesh state file
+func MeshNodeFromSection(sec *utils.Section) (*WGMeshNode, error) {
+	name, err := sec.Get("Name")
+	if err != nil {
+		return nil, fmt.Errorf("error while retrieving node name (%w)", err)
+	}
+	networks, err := sec.GetNetworks("Address")
+	if err != nil {
+		return nil, fmt.Errorf("error while retrieving node %s address (%w)", name, err)
+	}
+	private, err := sec.GetKeyFromBase64("PrivateKey")
+	if err != nil {
+		return nil, fmt.Errorf("error while retrieving node %s private key (%w)", name, err)
+	}
+	port, err := sec.GetUint16("ListenPort")
+	if err != nil {
+		return nil, fmt.Errorf("error while retrieving node %s port (%w)", name, err)
+	}
+	// the endpoint is optional (private node)
+	endpoint, _ := sec.Get("Endpoint")
+
+	return &WGMeshNode{
+		WGNode: WGNode{
+			address: networks,
+			private: private,
+			psk:     nil,
+		},
+		name:     name,
+		endpoint: endpoint,
+		port:     port,
+	}, nil
+}
+
+// NewWGMesh creates a new empty mesh
+func NewWGMesh(name string, networks []net.IPNet, noPSK bool) *WGMesh {
+	mesh := &WGMesh{
+		name:     name,
+		networks: networks,
+		secret:   crypto.NewRandomPresharedKey(),
+		nodes:    make([]*WGMeshNode, 0),
+	}
+	if noPSK {
+		mesh.secret = nil
+	}
+	return mesh
+}
+
+// MeshFromFile reads a mesh from its state file
+func MeshFromFile(name string, cfg *utils.File) (*WGMesh, error) {
+	mesh := WGMesh{
+		name:  name,
+		nodes: make([]*WGMeshNode, 0),
+	}
+
+	for _, sec := range cfg.Sections() {
+		switch sec.Name() {
+		case "Node":
+			node, err := MeshNodeFromSection(sec)
+			if err != nil {
+				return nil, err
+			}
+			mesh.nodes = append(mesh.nodes, node)
+		case utils.DEFAULT_SECTION:
+			networks, err := sec.GetNetworks("Network")
+			if err == nil {
+				mesh.networks = networks
+			}
+			if sec.HasKey("PresharedSecret") {
+				raw, err := sec.GetBytesFromBase64("PresharedSecret")
+				if err != nil {
+					return nil, fmt.Errorf("error while retrieving mesh preshared secret (%w)", err)
+				}
+				secret := crypto.NewPresharedKey()
+				if err := secret.UpdateFromBytes(raw); err != nil {
+					return nil, fmt.Errorf("error while retrieving mesh preshared secret (%w)", err)
+				}
+				mesh.secret = secret
+			}
+		default:
+			// non-blocking
+		}
+	}
+	return &mesh, nil
+}
+
+// Nodes returns the nodes of the mesh
+func (mesh *WGMesh) Nodes() []*WGMeshNode {
+	return mesh.nodes
+}
+
+// GetNode returns a node given its name
+func (mesh *WGMesh) GetNode(name string) (*WGMeshNode, error) {
+	for _, node := range mesh.nodes {
+		if node.name == name {
+			return node, nil
+		}
+	}
+	return nil, fmt.Errorf("this node (%s) is not in the mesh", name)
+}
+
+// AddNode provides addresses to the node and appends it to the mesh
+func (mesh *WGMesh) AddNode(node *WGMeshNode) error {
+	if _, err := mesh.GetNode(node.name); err == nil {
+		return fmt.Errorf("a node named %s already exists in the mesh", node.name)
+	}
+	reserved := make([]net.IP, 0)
+	for _, other := range mesh.nodes {
+		for _, n := range other.address {
+			reserved = append(reserved, utils.CopyIP(n.IP))
+		}
+	}
+	ips, err := provideNetworks(mesh.networks, reserved)
+	if err != nil {
+		return err
+	}
+	node.address = ips
+	mesh.nodes = append(mesh.nodes, node)
+	return nil
+}
+
+// RemoveNode does what it says
+func (mesh *WGMesh) RemoveNode(name string) error {
+	for i, node := range mesh.nodes {
+		if node.name == name {
+			mesh.nodes = append(mesh.nodes[:i], mesh.nodes[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("this node (%s) is not in the mesh", name)
+}
+
+// Populate writes the mesh state into a file
+func (mesh *WGMesh) Populate(f *utils.File) {
+	def := f.GetorCreateSection(utils.DEFAULT_SECTION)
+	def.AddComment("Full-mesh state generated by wg-easy-vpn")
+	def.AddComment("It is not a wireguard configuration file")
+	if len(mesh.networks) > 0 {
+		def.Set("Network", strings.Join(utils.StringifyNetworks(mesh.networks), ","))
+	}
+	if mesh.secret != nil {
+		def.Set("PresharedSecret", mesh.secret.Base64())
+	}
+	for _, node := range mesh.nodes {
+		node.Populate(f.AddSection("Node"))
+	}
+}
+
+// PopulateNode writes the wireguard config of a node: every other
+// node of the mesh is a peer
+func (mesh *WGMesh) PopulateNode(node *WGMeshNode, f *utils.File) {
+	def := f.GetorCreateSection(utils.DEFAULT_SECTION)
+	def.AddComment(node.name)
+
+	sec := f.AddSection("Interface")
+	node.WGNode.Populate(sec)
+	sec.Set("ListenPort", fmt.Sprintf("%d", node.port))
+
+	for _, other := range mesh.nodes {
+		if other == node {
+			continue
+		}
+		peer := other.ToPeer()
+		if mesh.secret != nil {
+			peer.psk = crypto.DerivePresharedKey(mesh.secret, node.private.Public(), other.private.Public())
+		}
+		sec = f.AddSection("Peer")
+		sec.AddComment(other.name)
+		peer.Populate(sec)
+	}
+}
+
+func (mesh *WGMesh) Log(event *zerolog.Event) *zerolog.Event {
+	names := make([]string, len(mesh.nodes))
+	for i, node := range mesh.nodes {
+		names[i] = node.name
+	}
+	return event.
+		Str("name", mesh.name).
+		Strs("networks", utils.StringifyNetworks(mesh.networks)).
+		Bool("psk", mesh.secret != nil).
+		Strs("nodes", names)
+}
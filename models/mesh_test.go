@@ -0,0 +1,223 @@
+package models
+
+import (
+	"net"
+	"testing"
+
+	"github.com/asiffer/wg-easy-vpn/crypto"
+	"github.com/asiffer/wg-easy-vpn/utils"
+)
+
+func newTestMesh(t *testing.T, noPSK bool) *WGMesh {
+	t.Helper()
+	networks := []net.IPNet{{IP: net.ParseIP("10.9.0.0"), Mask: net.CIDRMask(24, 32)}}
+	mesh := NewWGMesh("mesh0", networks, noPSK)
+	for _, node := range []*WGMeshNode{
+		NewWGMeshNode("paris", "paris.example.com", 51820),
+		NewWGMeshNode("london", "203.0.113.7:51000", 51000),
+		NewWGMeshNode("laptop", "", 51820),
+	} {
+		if err := mesh.AddNode(node); err != nil {
+			t.Fatalf("failed to add node %s: %v", node.Name(), err)
+		}
+	}
+	return mesh
+}
+
+func peerSections(f *utils.File) []*utils.Section {
+	peers := make([]*utils.Section, 0)
+	for _, sec := range f.Sections() {
+		if sec.Name() == "Peer" {
+			peers = append(peers, sec)
+		}
+	}
+	return peers
+}
+
+func TestWGMeshNodeEndpoint(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		port     uint16
+		expected string
+	}{
+		{"paris.example.com", 51820, "paris.example.com:51820"},
+		{"203.0.113.7:51000", 51820, "203.0.113.7:51000"},
+		{"2001:db8::1", 51820, "[2001:db8::1]:51820"},
+		{"", 51820, ""},
+	}
+	for _, tt := range tests {
+		node := NewWGMeshNode("node", tt.endpoint, tt.port)
+		if node.Endpoint() != tt.expected {
+			t.Errorf("Endpoint() = %q, expected %q", node.Endpoint(), tt.expected)
+		}
+	}
+}
+
+func TestWGMeshAddNode(t *testing.T) {
+	mesh := newTestMesh(t, false)
+
+	expected := []string{"10.9.0.1/24", "10.9.0.2/24", "10.9.0.3/24"}
+	for i, node := range mesh.Nodes() {
+		if node.Address() != expected[i] {
+			t.Errorf("node %s: expected address %s, got %s", node.Name(), expected[i], node.Address())
+		}
+	}
+
+	if err := mesh.AddNode(NewWGMeshNode("paris", "", 51820)); err == nil {
+		t.Error("expected error when adding a duplicate node name")
+	}
+}
+
+func TestWGMeshRemoveNode(t *testing.T) {
+	mesh := newTestMesh(t, false)
+
+	if err := mesh.RemoveNode("london"); err != nil {
+		t.Fatalf("failed to remove node: %v", err)
+	}
+	if len(mesh.Nodes()) != 2 {
+		t.Errorf("expected 2 nodes, got %d", len(mesh.Nodes()))
+	}
+	if err := mesh.RemoveNode("london"); err == nil {
+		t.Error("expected error when removing an unknown node")
+	}
+
+	// the address of the removed node is reused
+	node := NewWGMeshNode("berlin", "", 51820)
+	mesh.AddNode(node)
+	if node.Address() != "10.9.0.2/24" {
+		t.Errorf("expected address 10.9.0.2/24, got %s", node.Address())
+	}
+}
+
+func TestWGMeshPopulateNode(t *testing.T) {
+	mesh := newTestMesh(t, false)
+	paris, _ := mesh.GetNode("paris")
+	london, _ := mesh.GetNode("london")
+	laptop, _ := mesh.GetNode("laptop")
+
+	t.Run("every other node is a peer", func(t *testing.T) {
+		file := utils.NewFile()
+		mesh.PopulateNode(laptop, file)
+
+		iface, err := file.GetSection("Interface")
+		if err != nil {
+			t.Fatal("expected Interface section")
+		}
+		if port, _ := iface.Get("ListenPort"); port != "51820" {
+			t.Errorf("expected ListenPort 51820, got %s", port)
+		}
+
+		peers := peerSections(file)
+		if len(peers) != 2 {
+			t.Fatalf("expected 2 peers, got %d", len(peers))
+		}
+		for i, node := range []*WGMeshNode{paris, london} {
+			public, _ := peers[i].Get("PublicKey")
+			if public != node.private.Public().Base64() {
+				t.Errorf("peer %d: expected public key of %s", i, node.Name())
+			}
+			endpoint, _ := peers[i].Get("Endpoint")
+			if endpoint != node.Endpoint() {
+				t.Errorf("peer %d: expected endpoint %s, got %s", i, node.Endpoint(), endpoint)
+			}
+			allowed, _ := peers[i].Get("AllowedIPs")
+			if allowed != node.address[0].IP.String()+"/32" {
+				t.Errorf("peer %d: unexpected AllowedIPs %s", i, allowed)
+			}
+		}
+	})
+
+	t.Run("private nodes have no endpoint", func(t *testing.T) {
+		file := utils.NewFile()
+		mesh.PopulateNode(paris, file)
+		peers := peerSections(file)
+		if peers[1].HasKey("Endpoint") {
+			t.Error("expected no Endpoint for the laptop")
+		}
+	})
+
+	t.Run("both sides of a pair share the PSK", func(t *testing.T) {
+		parisFile := utils.NewFile()
+		mesh.PopulateNode(paris, parisFile)
+		londonFile := utils.NewFile()
+		mesh.PopulateNode(london, londonFile)
+
+		fromParis, _ := peerSections(parisFile)[0].Get("PresharedKey")
+		fromLondon, _ := peerSections(londonFile)[0].Get("PresharedKey")
+		if fromParis == "" || fromParis != fromLondon {
+			t.Errorf("PSK mismatch between paris (%s) and london (%s)", fromParis, fromLondon)
+		}
+		toLaptop, _ := peerSections(parisFile)[1].Get("PresharedKey")
+		if toLaptop == fromParis {
+			t.Error("expected a different PSK for each pair")
+		}
+	})
+
+	t.Run("no PSK", func(t *testing.T) {
+		mesh := newTestMesh(t, true)
+		file := utils.NewFile()
+		mesh.PopulateNode(mesh.Nodes()[0], file)
+		for _, peer := range peerSections(file) {
+			if peer.HasKey("PresharedKey") {
+				t.Error("expected no PresharedKey")
+			}
+		}
+	})
+}
+
+func TestMeshRoundTrip(t *testing.T) {
+	original := newTestMesh(t, false)
+
+	file := utils.NewFile()
+	original.Populate(file)
+
+	parsed, err := MeshFromFile("mesh0", file)
+	if err != nil {
+		t.Fatalf("failed to parse mesh: %v", err)
+	}
+	if len(parsed.Nodes()) != len(original.Nodes()) {
+		t.Fatalf("expected %d nodes, got %d", len(original.Nodes()), len(parsed.Nodes()))
+	}
+	for i, node := range parsed.Nodes() {
+		other := original.Nodes()[i]
+		if node.Name() != other.Name() || node.Address() != other.Address() ||
+			node.Private() != other.Private() || node.Endpoint() != other.Endpoint() {
+			t.Errorf("node %d mismatch: %s vs %s", i, node.Name(), other.Name())
+		}
+	}
+	if parsed.secret.Base64() != original.secret.Base64() {
+		t.Error("preshared secret mismatch")
+	}
+	if len(parsed.networks) != 1 {
+		t.Errorf("expected 1 network, got %d", len(parsed.networks))
+	}
+
+	// same PSK before and after reloading
+	a, b := original.Nodes()[0], original.Nodes()[1]
+	before := crypto.DerivePresharedKey(original.secret, a.private.Public(), b.private.Public())
+	after := crypto.DerivePresharedKey(parsed.secret, parsed.Nodes()[0].private.Public(), parsed.Nodes()[1].private.Public())
+	if before.Base64() != after.Base64() {
+		t.Error("PSK changed after reloading the mesh")
+	}
+}
+
+func TestMeshNodeFromSection(t *testing.T) {
+	t.Run("missing name", func(t *testing.T) {
+		sec := utils.NewSection("Node")
+		sec.Set("Address", "10.9.0.1/24")
+		if _, err := MeshNodeFromSection(sec); err == nil {
+			t.Error("expected error without Name")
+		}
+	})
+
+	t.Run("bad private key", func(t *testing.T) {
+		sec := utils.NewSection("Node")
+		sec.Set("Name", "paris")
+		sec.Set("Address", "10.9.0.1/24")
+		sec.Set("PrivateKey", "notbase64!")
+		sec.Set("ListenPort", "51820")
+		if _, err := MeshNodeFromSection(sec); err == nil {
+			t.Error("expected error with a bad private key")
+		}
+	})
+}
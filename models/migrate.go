@@ -0,0 +1,138 @@
+package models
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/asiffer/wg-easy-vpn/utils"
+)
+
+// layouts of the server files (Version key of the DEFAULT section)
+const (
+	// LayoutPlain has no metadata: plain wg-quick config or legacy layout
+	// (metadata in .wg-easy-vpn.conf, client configs in clients/)
+	LayoutPlain = 0
+	// LayoutEmbedded has its metadata in the DEFAULT section (1.0b1)
+	LayoutEmbedded = 1
+	// ConfigVersion is the current layout (versioned DEFAULT section)
+	ConfigVersion = 2
+)
+
+// LayoutVersion returns the layout of a server file
+func LayoutVersion(f *utils.File) (int, error) {
+	def, err := f.GetSection(utils.DEFAULT_SECTION)
+	if err != nil {
+		return LayoutPlain, nil
+	}
+	if def.HasKey("Version") {
+		version, err := def.GetInt("Version")
+		if err != nil {
+			return 0, fmt.Errorf("invalid config version (%w)", err)
+		}
+		return version, nil
+	}
+	for _, key := range []string{"Endpoint", "Network", "State"} {
+		if def.HasKey(key) {
+			return LayoutEmbedded, nil
+		}
+	}
+	return LayoutPlain, nil
+}
+
+// MigrateLegacy creates a vpn from the legacy layout: a plain server file,
+// its metadata (section named after the connection in .wg-easy-vpn.conf)
+// and the client configs (by name) which give the names of the unnamed
+// peers and the routes of the clients (the configs of the other
+// connections are ignored).
+func MigrateLegacy(name string, server *utils.File, metadata *utils.File, clients map[string]*utils.File) (*WGVPN, error) {
+	meta, err := metadata.GetSection(name)
+	if err != nil {
+		return nil, fmt.Errorf("no %s section in the legacy metadata", name)
+	}
+	vpn, err := VPNFromFile(name, server)
+	if err != nil {
+		return nil, err
+	}
+	if vpn.server == nil {
+		return nil, fmt.Errorf("no Interface section")
+	}
+
+	endpoint, _ := meta.Get("Endpoint")
+	if endpoint == "" {
+		// the legacy server files kept it as a comment of the interface
+		iface, _ := server.GetSection("Interface")
+		for _, comment := range iface.Comments() {
+			if key, value, ok := strings.Cut(comment, "="); ok && strings.TrimSpace(key) == "Endpoint" {
+				endpoint = strings.TrimSpace(value)
+			}
+		}
+	}
+	var dns []net.IP
+	if meta.HasKey("DNS") {
+		if dns, err = meta.GetIPArray("DNS"); err != nil {
+			return nil, fmt.Errorf("invalid legacy DNS (%w)", err)
+		}
+	}
+	var networks []net.IPNet
+	if meta.HasKey("Network") {
+		if networks, err = meta.GetNetworks("Network"); err != nil {
+			return nil, fmt.Errorf("invalid legacy Network (%w)", err)
+		}
+		networks = inferNetworks(networks)
+	}
+	var routes []net.IPNet
+	if meta.HasKey("Routes") {
+		if routes, err = meta.GetNetworks("Routes"); err != nil {
+			return nil, fmt.Errorf("invalid legacy Routes (%w)", err)
+		}
+	}
+
+	// names and routes from the client configs
+	routesOf := make(map[string]bool)
+	for clientName, f := range clients {
+		iface, err := f.GetSection("Interface")
+		if err != nil {
+			continue
+		}
+		private, err := iface.GetKeyFromBase64("PrivateKey")
+		if err != nil {
+			continue
+		}
+		peer := vpn.peerByKey(private.Public().Base64())
+		if peer == nil {
+			// client of another connection
+			continue
+		}
+		if peer.name == "" {
+			peer.name = clientName
+		}
+		if sec, err := f.GetSection("Peer"); err == nil {
+			if allowed, err := sec.GetNetworks("AllowedIPs"); err == nil {
+				routesOf[strings.Join(utils.StringifyNetworks(allowed), ",")] = true
+				if routes == nil {
+					routes = allowed
+				}
+			}
+		}
+	}
+	if len(routesOf) > 1 && !meta.HasKey("Routes") {
+		// the clients do not agree: default routes
+		routes = nil
+	}
+
+	if err := vpn.Adopt(endpoint, networks, routes, dns); err != nil {
+		return nil, err
+	}
+	return vpn, nil
+}
+
+// peerByKey returns the client with the given public key (nil if none)
+func (vpn *WGVPN) peerByKey(public string) *WGClientAsPeer {
+	for _, peer := range vpn.peers {
+		if peer.Public() == public {
+			return peer
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/asiffer/wg-easy-vpn/utils"
+)
+
+func TestLayoutVersion(t *testing.T) {
+	tests := map[string]int{
+		"plain":     LayoutPlain,
+		"embedded":  LayoutEmbedded,
+		"versioned": ConfigVersion,
+	}
+	for name, expected := range tests {
+		t.Run(name, func(t *testing.T) {
+			file := utils.NewFile()
+			def := file.GetorCreateSection(utils.DEFAULT_SECTION)
+			switch name {
+			case "embedded":
+				def.Set("Endpoint", "vpn.example.com")
+			case "versioned":
+				newBulkVPN(t).Populate(file)
+			}
+			version, err := LayoutVersion(file)
+			if err != nil {
+				t.Fatalf("LayoutVersion failed: %v", err)
+			}
+			if version != expected {
+				t.Errorf("expected version %d, got %d", expected, version)
+			}
+		})
+	}
+
+	file := utils.NewFile()
+	file.GetorCreateSection(utils.DEFAULT_SECTION).Set("Version", "99")
+	if _, err := VPNFromFile("wg0", file); err == nil {
+		t.Errorf("expected error with a future version")
+	}
+}
+
+func TestMigrateLegacy(t *testing.T) {
+	server, err := utils.ParseFile("../test/legacy/wg0.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata, err := utils.ParseFile("../test/legacy/.wg-easy-vpn.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := utils.ParseFile("../test/legacy/clients/client0.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := utils.ParseFile("../test/testfile.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vpn, err := MigrateLegacy("wg0", server, metadata, map[string]*utils.File{"client0": client, "other": other})
+	if err != nil {
+		t.Fatalf("MigrateLegacy failed: %v", err)
+	}
+	if vpn.Endpoint() != "example.com" {
+		t.Errorf("expected the endpoint of the interface comment, got %q", vpn.Endpoint())
+	}
+	if networks := utils.StringifyNetworks(vpn.Networks()); len(networks) != 1 || networks[0] != "10.0.0.0/24" {
+		t.Errorf("unexpected networks %v", networks)
+	}
+	if dns := utils.StringifyIPs(vpn.DNS()); len(dns) != 1 || dns[0] != "1.1.1.1" {
+		t.Errorf("unexpected dns %v", dns)
+	}
+	if vpn.NumberOfPeers() != 1 || vpn.Peers()[0].Name() != "client0" {
+		t.Fatalf("expected the peer to be named after its client config")
+	}
+	// routes of the client config
+	if routes := utils.StringifyNetworks(vpn.routes); len(routes) != 1 || routes[0] != "0.0.0.0/0" {
+		t.Errorf("unexpected routes %v", routes)
+	}
+
+	if _, err := MigrateLegacy("wg1", server, metadata, nil); err == nil {
+		t.Errorf("expected error without metadata for the connection")
+	}
+}
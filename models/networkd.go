@@ -0,0 +1,197 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/asiffer/wg-easy-vpn/utils"
+)
+
+const (
+	// FormatNetworkd is the systemd-networkd format (.netdev and .network)
+	FormatNetworkd = "networkd"
+	// NetworkdDir is the directory of the systemd-networkd configs (the
+	// key files are referenced from there)
+	NetworkdDir = "/etc/systemd/network"
+	// networkdFullTunnelMark is the firewall mark and the routing table
+	// of a full tunnel (same as wg-quick)
+	networkdFullTunnelMark = "51820"
+)
+
+// NetworkdFile is a file of a systemd-networkd config
+type NetworkdFile struct {
+	Name    string
+	Content string
+	Secret  bool // key file (readable by systemd-networkd only)
+}
+
+// Networkd converts a populated config (server, gateway or client) to
+// systemd-networkd files: <iface>.netdev, <iface>.network and the key
+// files they reference. It also returns what cannot be converted (the
+// hooks except the masquerading rules).
+func Networkd(f *utils.File, iface string) ([]NetworkdFile, []string, error) {
+	settings, err := readInterfaceSettings(f)
+	if err != nil {
+		return nil, nil, err
+	}
+	options := settings.options
+
+	keyFile := iface + ".key"
+	files := []NetworkdFile{{Name: keyFile, Content: settings.private + "\n", Secret: true}}
+
+	// peers
+	peers := make([]*keyfileGroup, 0, len(settings.peers))
+	fullTunnel := false
+	for i, p := range settings.peers {
+		peer := &keyfileGroup{name: "WireGuardPeer", comments: p.comments}
+		peer.set("PublicKey", p.public)
+		if p.psk != "" {
+			pskFile := fmt.Sprintf("%s-peer%d.psk", iface, i+1)
+			files = append(files, NetworkdFile{Name: pskFile, Content: p.psk + "\n", Secret: true})
+			peer.set("PresharedKeyFile", NetworkdDir+"/"+pskFile)
+		}
+		peer.set("AllowedIPs", strings.Join(utils.StringifyNetworks(p.allowed), ","))
+		if p.endpoint != "" {
+			peer.set("Endpoint", p.endpoint)
+		}
+		if p.keepalive != "" {
+			peer.set("PersistentKeepalive", p.keepalive)
+		}
+		if slices.ContainsFunc(p.allowed, isDefaultRoute) {
+			fullTunnel = true
+		}
+		peers = append(peers, peer)
+	}
+
+	// routes to the allowed ips (wg-quick Table)
+	fwmark := options.FwMark
+	if fwmark == "off" {
+		fwmark = ""
+	}
+	table := ""
+	rules := false
+	switch options.Table {
+	case "off":
+	case "", "auto":
+		table = "main"
+		if fullTunnel {
+			// the tunnel packets (marked) use the main table, the other
+			// ones the tunnel table
+			table = networkdFullTunnelMark
+			if fwmark == "" {
+				fwmark = networkdFullTunnelMark
+			}
+			rules = true
+		}
+	default:
+		table = options.Table
+	}
+
+	netdev := &keyfileGroup{name: "NetDev"}
+	netdev.set("Name", iface)
+	netdev.set("Kind", "wireguard")
+	if options.MTU > 0 {
+		netdev.set("MTUBytes", fmt.Sprint(options.MTU))
+	}
+	wireguard := &keyfileGroup{name: "WireGuard"}
+	wireguard.set("PrivateKeyFile", NetworkdDir+"/"+keyFile)
+	if port, err := settings.section.Get("ListenPort"); err == nil {
+		wireguard.set("ListenPort", port)
+	}
+	if fwmark != "" {
+		wireguard.set("FirewallMark", fwmark)
+	}
+	if table != "" {
+		wireguard.set("RouteTable", table)
+	}
+
+	// network
+	match := &keyfileGroup{name: "Match"}
+	match.set("Name", iface)
+	network := &keyfileGroup{name: "Network"}
+	for _, a := range settings.addresses {
+		network.set("Address", a.String())
+	}
+	for _, ip := range settings.dns {
+		network.set("DNS", ip.String())
+	}
+	if len(settings.dns) > 0 && fullTunnel {
+		// all the dns queries go through the tunnel
+		network.set("DNSDefaultRoute", "true")
+		network.set("Domains", "~.")
+	}
+	masquerade, forward, report := networkdHooks(settings.section)
+	if masquerade != "" {
+		network.set("IPMasquerade", masquerade)
+	} else if forward != "" {
+		network.set("IPForward", forward)
+	}
+	groups := []*keyfileGroup{match, network}
+	if rules {
+		mark := &keyfileGroup{name: "RoutingPolicyRule"}
+		mark.set("FirewallMark", fwmark)
+		mark.set("InvertRule", "true")
+		mark.set("Table", table)
+		mark.set("Priority", "10")
+		mark.set("Family", "both")
+		suppress := &keyfileGroup{name: "RoutingPolicyRule"}
+		suppress.set("Table", "main")
+		suppress.set("SuppressPrefixLength", "0")
+		suppress.set("Priority", "9")
+		suppress.set("Family", "both")
+		groups = append(groups, mark, suppress)
+	}
+
+	header := settings.comments
+	files = append(files,
+		NetworkdFile{
+			Name:    iface + ".netdev",
+			Content: renderKeyfile(header, append([]*keyfileGroup{netdev, wireguard}, peers...)),
+		},
+		NetworkdFile{
+			Name:    iface + ".network",
+			Content: renderKeyfile(header, groups),
+		},
+	)
+	return files, report, nil
+}
+
+// networkdHooks converts the hooks of an interface: the masquerading
+// rules and the ip forwarding become IPMasquerade and IPForward (ipv4,
+// ipv6 or both), the other hooks are reported
+func networkdHooks(sec *utils.Section) (masquerade string, forward string, report []string) {
+	var masq4, masq6, fwd4, fwd6 bool
+	report = make([]string, 0)
+	for _, key := range []string{"PreUp", "PostUp", "PreDown", "PostDown"} {
+		for _, cmd := range sec.GetAll(key) {
+			switch {
+			case strings.Contains(cmd, "MASQUERADE") && strings.HasPrefix(cmd, "ip6tables"):
+				masq6 = true
+			case strings.Contains(cmd, "MASQUERADE") && strings.HasPrefix(cmd, "iptables"):
+				masq4 = true
+			case strings.Contains(cmd, "net.ipv6.conf.all.forwarding"):
+				fwd6 = true
+			case strings.Contains(cmd, "net.ipv4.ip_forward"):
+				fwd4 = true
+			default:
+				report = append(report, fmt.Sprintf("%s hook dropped: %s", key, cmd))
+			}
+		}
+	}
+	return networkdFamily(masq4, masq6), networkdFamily(fwd4 || masq4, fwd6 || masq6), report
+}
+
+// networkdFamily returns the value of IPMasquerade or IPForward
+func networkdFamily(v4 bool, v6 bool) string {
+	switch {
+	case v4 && v6:
+		return "both"
+	case v4:
+		return "ipv4"
+	case v6:
+		return "ipv6"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,102 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/asiffer/wg-easy-vpn/utils"
+)
+
+// networkdFiles indexes the files by name
+func networkdFiles(t *testing.T, f *utils.File) (map[string]NetworkdFile, []string) {
+	t.Helper()
+	files, report, err := Networkd(f, "wg0")
+	if err != nil {
+		t.Fatalf("Networkd failed: %v", err)
+	}
+	out := make(map[string]NetworkdFile, len(files))
+	for _, file := range files {
+		out[file.Name] = file
+	}
+	return out, report
+}
+
+func TestNetworkdServer(t *testing.T) {
+	vpn := newRenderVPN(t)
+	vpn.server.SetHooks(
+		[]string{"sysctl -q -w net.ipv4.ip_forward=1", "iptables -t nat -A POSTROUTING -s 10.0.0.0/24 -o eth0 -j MASQUERADE"},
+		[]string{"iptables -t nat -D POSTROUTING -s 10.0.0.0/24 -o eth0 -j MASQUERADE"},
+	)
+	file := utils.NewFile()
+	vpn.PopulateServer(file)
+
+	files, report := networkdFiles(t, file)
+	if len(files) != 4 {
+		t.Fatalf("expected key, psk, netdev and network files, got %d", len(files))
+	}
+	if !files["wg0.key"].Secret || files["wg0.key"].Content != vpn.server.Private()+"\n" {
+		t.Errorf("unexpected key file %+v", files["wg0.key"])
+	}
+	if !files["wg0-peer1.psk"].Secret {
+		t.Error("expected the psk file to be secret")
+	}
+
+	netdev := files["wg0.netdev"].Content
+	for _, e := range []string{
+		"[NetDev]\nName=wg0\nKind=wireguard\n",
+		"[WireGuard]\nPrivateKeyFile=/etc/systemd/network/wg0.key\nListenPort=51820\nRouteTable=main\n",
+		"# laptop\n[WireGuardPeer]\nPublicKey=" + vpn.peers[0].Public() + "\n" +
+			"PresharedKeyFile=/etc/systemd/network/wg0-peer1.psk\nAllowedIPs=10.0.0.2/32\n",
+	} {
+		if !strings.Contains(netdev, e) {
+			t.Errorf("expected %q in:\n%s", e, netdev)
+		}
+	}
+	if strings.Contains(netdev, vpn.peers[0].PSK()) {
+		t.Error("expected the psk in a separate file")
+	}
+
+	network := files["wg0.network"].Content
+	if !strings.Contains(network, "[Network]\nAddress=10.0.0.1/24\nIPMasquerade=ipv4\n") {
+		t.Errorf("unexpected network file:\n%s", network)
+	}
+	// the FORWARD rule of the render vpn is not converted
+	if len(report) != 1 || !strings.Contains(report[0], "FORWARD") {
+		t.Errorf("expected the FORWARD hook reported, got %v", report)
+	}
+}
+
+func TestNetworkdClientFullTunnel(t *testing.T) {
+	files, report := networkdFiles(t, newNMClientFile())
+	if len(report) != 0 {
+		t.Errorf("unexpected report %v", report)
+	}
+	netdev := files["wg0.netdev"].Content
+	// Table = off: no route
+	if strings.Contains(netdev, "RouteTable") || !strings.Contains(netdev, "MTUBytes=1380") {
+		t.Errorf("unexpected netdev file:\n%s", netdev)
+	}
+	if !strings.Contains(netdev, "Endpoint=vpn.example.com:51820\nPersistentKeepalive=25\n") {
+		t.Errorf("expected endpoint and keepalive in:\n%s", netdev)
+	}
+
+	file := newNMClientFile()
+	iface, _ := file.GetSection("Interface")
+	iface.Set("Table", "auto")
+	files, _ = networkdFiles(t, file)
+	netdev = files["wg0.netdev"].Content
+	if !strings.Contains(netdev, "FirewallMark=51820\nRouteTable=51820\n") {
+		t.Errorf("expected the full tunnel table in:\n%s", netdev)
+	}
+	network := files["wg0.network"].Content
+	for _, e := range []string{
+		"Address=10.0.0.2/24\nAddress=fd00::2/64\n",
+		"DNS=1.1.1.1\nDNS=2606:4700:4700::1111\nDNSDefaultRoute=true\nDomains=~.\n",
+		"[RoutingPolicyRule]\nFirewallMark=51820\nInvertRule=true\nTable=51820\n",
+		"[RoutingPolicyRule]\nTable=main\nSuppressPrefixLength=0\n",
+	} {
+		if !strings.Contains(network, e) {
+			t.Errorf("expected %q in:\n%s", e, network)
+		}
+	}
+}
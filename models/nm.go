@@ -0,0 +1,110 @@
+package models
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+
+	"github.com/asiffer/wg-easy-vpn/crypto"
+	"github.com/asiffer/wg-easy-vpn/utils"
+)
+
+// FormatNM is the NetworkManager keyfile format (.nmconnection)
+const FormatNM = "nm"
+
+// NMKeyfile converts a populated client file (wg-quick) to a NetworkManager
+// keyfile. The connection and the interface are named after id.
+func NMKeyfile(f *utils.File, id string) (string, error) {
+	settings, err := readInterfaceSettings(f)
+	if err != nil {
+		return "", err
+	}
+	options := settings.options
+
+	connection := &keyfileGroup{name: "connection"}
+	connection.set("id", id)
+	uuid, err := nmUUID(settings.private)
+	if err != nil {
+		return "", err
+	}
+	connection.set("uuid", uuid)
+	connection.set("type", "wireguard")
+	connection.set("interface-name", id)
+	connection.set("autoconnect", "false")
+
+	wireguard := &keyfileGroup{name: "wireguard"}
+	wireguard.set("private-key", settings.private)
+	wireguard.set("private-key-flags", "0")
+	if options.MTU > 0 {
+		wireguard.set("mtu", fmt.Sprint(options.MTU))
+	}
+	if options.FwMark != "" && options.FwMark != "off" {
+		wireguard.set("fwmark", options.FwMark)
+	}
+	if options.Table == "off" {
+		// no route to the allowed ips
+		wireguard.set("peer-routes", "false")
+	}
+
+	groups := []*keyfileGroup{connection, wireguard}
+	for _, p := range settings.peers {
+		peer := &keyfileGroup{name: "wireguard-peer." + p.public}
+		if p.endpoint != "" {
+			peer.set("endpoint", p.endpoint)
+		}
+		if p.psk != "" {
+			peer.set("preshared-key", p.psk)
+			peer.set("preshared-key-flags", "0")
+		}
+		if p.keepalive != "" {
+			peer.set("persistent-keepalive", p.keepalive)
+		}
+		peer.set("allowed-ips", nmList(utils.StringifyNetworks(p.allowed)))
+		groups = append(groups, peer)
+	}
+
+	for _, v4 := range []bool{true, false} {
+		family := &keyfileGroup{name: "ipv4"}
+		if !v4 {
+			family.name = "ipv6"
+		}
+		addresses := networksOf(settings.addresses, v4)
+		if len(addresses) == 0 {
+			family.set("method", "disabled")
+			groups = append(groups, family)
+			continue
+		}
+		for i, a := range addresses {
+			family.set(fmt.Sprintf("address%d", i+1), a.String())
+		}
+		if servers := ipsOf(settings.dns, v4); len(servers) > 0 {
+			family.set("dns", nmList(utils.StringifyIPs(servers)))
+		}
+		if options.Table != "" && options.Table != "off" && options.Table != "auto" {
+			family.set("route-table", options.Table)
+		}
+		family.set("method", "manual")
+		groups = append(groups, family)
+	}
+	return renderKeyfile(settings.comments, groups), nil
+}
+
+// nmList formats a list value (semicolon terminated)
+func nmList(values []string) string {
+	return strings.Join(values, ";") + ";"
+}
+
+// nmUUID derives the uuid of the connection from the public key so that
+// importing the same config twice does not create two connections (the
+// uuid is not secret, it must not depend on the private key)
+func nmUUID(private string) (string, error) {
+	key := crypto.NewKey()
+	if err := key.UpdateFromBase64(private); err != nil {
+		return "", fmt.Errorf("invalid private key (%w)", err)
+	}
+	sum := sha256.Sum256([]byte("wg-easy-vpn:" + key.Public().Base64()))
+	b := sum[:16]
+	b[6] = (b[6] & 0x0f) | 0x50 // version 5 (name based)
+	b[8] = (b[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
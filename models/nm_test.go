@@ -0,0 +1,103 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/asiffer/wg-easy-vpn/utils"
+)
+
+func newNMClientFile() *utils.File {
+	file := utils.NewFile()
+	file.GetorCreateSection(utils.DEFAULT_SECTION).AddComment("laptop")
+	iface := file.AddSection("Interface")
+	iface.Set("Address", "10.0.0.2/24, fd00::2/64")
+	iface.Set("PrivateKey", "wDx8ruBJgk2ZmDwgHkZfnoaSdfCgXUb4MwJ87psOJGE=")
+	iface.Set("DNS", "1.1.1.1, 2606:4700:4700::1111")
+	iface.Set("MTU", "1380")
+	iface.Set("Table", "off")
+	peer := file.AddSection("Peer")
+	peer.Set("AllowedIPs", "0.0.0.0/0, ::/0")
+	peer.Set("PublicKey", "IYIgnBITiOdCJUyg/c0jpPi0+OWVhcWw/CS5FIpG024=")
+	peer.Set("PresharedKey", "dHx7qhkvUVPxTK+doFUtSz972uYylXuHiRq0wA0V414=")
+	peer.Set("Endpoint", "vpn.example.com:51820")
+	peer.Set("PersistentKeepalive", "25")
+	return file
+}
+
+func TestNMKeyfile(t *testing.T) {
+	keyfile, err := NMKeyfile(newNMClientFile(), "wg0")
+	if err != nil {
+		t.Fatalf("NMKeyfile failed: %v", err)
+	}
+
+	expected := []string{
+		"# laptop\n",
+		"[connection]\nid=wg0\nuuid=",
+		"type=wireguard\ninterface-name=wg0\nautoconnect=false\n",
+		"[wireguard]\nprivate-key=wDx8ruBJgk2ZmDwgHkZfnoaSdfCgXUb4MwJ87psOJGE=\nprivate-key-flags=0\nmtu=1380\npeer-routes=false\n",
+		"[wireguard-peer.IYIgnBITiOdCJUyg/c0jpPi0+OWVhcWw/CS5FIpG024=]\n" +
+			"endpoint=vpn.example.com:51820\n" +
+			"preshared-key=dHx7qhkvUVPxTK+doFUtSz972uYylXuHiRq0wA0V414=\n" +
+			"preshared-key-flags=0\n" +
+			"persistent-keepalive=25\n" +
+			"allowed-ips=0.0.0.0/0;::/0;\n",
+		"[ipv4]\naddress1=10.0.0.2/24\ndns=1.1.1.1;\nmethod=manual\n",
+		"[ipv6]\naddress1=fd00::2/64\ndns=2606:4700:4700::1111;\nmethod=manual\n",
+	}
+	for _, e := range expected {
+		if !strings.Contains(keyfile, e) {
+			t.Errorf("expected %q in:\n%s", e, keyfile)
+		}
+	}
+	if strings.Contains(keyfile, " = ") {
+		t.Errorf("expected key=value pairs without spaces:\n%s", keyfile)
+	}
+
+	// the uuid is stable
+	again, _ := NMKeyfile(newNMClientFile(), "wg0")
+	if again != keyfile {
+		t.Error("expected the same keyfile for the same config")
+	}
+}
+
+func TestNMUUID(t *testing.T) {
+	if _, err := nmUUID("not a key"); err == nil {
+		t.Error("expected an error for an invalid private key")
+	}
+	uuid, err := nmUUID("wDx8ruBJgk2ZmDwgHkZfnoaSdfCgXUb4MwJ87psOJGE=")
+	if err != nil {
+		t.Fatalf("nmUUID failed: %v", err)
+	}
+	if len(uuid) != 36 || uuid[14] != '5' {
+		t.Errorf("expected a version 5 uuid, got %s", uuid)
+	}
+	// derived from the public key, not from the private one
+	sum := sha256.Sum256([]byte("wg-easy-vpn:IYIgnBITiOdCJUyg/c0jpPi0+OWVhcWw/CS5FIpG024="))
+	if !strings.HasPrefix(uuid, hex.EncodeToString(sum[:4])) {
+		t.Errorf("the uuid %s is not derived from the public key", uuid)
+	}
+}
+
+func TestNMKeyfileIPv4Only(t *testing.T) {
+	file := newNMClientFile()
+	iface, _ := file.GetSection("Interface")
+	iface.Set("Address", "10.0.0.2/24")
+	keyfile, err := NMKeyfile(file, "wg0")
+	if err != nil {
+		t.Fatalf("NMKeyfile failed: %v", err)
+	}
+	if !strings.Contains(keyfile, "[ipv6]\nmethod=disabled\n") {
+		t.Errorf("expected ipv6 disabled:\n%s", keyfile)
+	}
+}
+
+func TestNMKeyfileWithoutPrivateKey(t *testing.T) {
+	file := utils.NewFile()
+	file.AddSection("Interface").Set("Address", "10.0.0.2/24")
+	if _, err := NMKeyfile(file, "wg0"); err == nil {
+		t.Error("expected error without private key")
+	}
+}
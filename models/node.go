@@ -13,8 +13,10 @@ import (
 type WGNode struct {
 	address  []net.IPNet
 	private  crypto.Key
+	public   crypto.Key // set when only the public key is known (nil private key)
 	psk      crypto.PresharedKey
 	preUp    []string
+	postUp   []string
 	postDown []string
 }
 
@@ -37,6 +39,12 @@ func (node *WGNode) Private() string {
 	return node.private.Base64()
 }
 
+// HasPrivateKey returns whether the private key of the node is known
+// (the server does not keep the ones of the clients)
+func (node *WGNode) HasPrivateKey() bool {
+	return node.private != nil
+}
+
 // PSK returns the pre shared key as a base64 encoded string
 func (node *WGNode) PSK() string {
 	return node.psk.Base64()
@@ -50,7 +58,9 @@ func (node *WGNode) Address() string {
 func (node *WGNode) String() string {
 	s := ""
 	s += fmt.Sprintf("Address = %s\n", node.Address())
-	s += fmt.Sprintf("PrivateKey = %s\n", node.Private())
+	if node.private != nil {
+		s += fmt.Sprintf("PrivateKey = %s\n", node.Private())
+	}
 	if node.psk != nil {
 		s += fmt.Sprintf("PresharedKey = %s\n", node.PSK())
 	}
@@ -60,10 +70,18 @@ func (node *WGNode) String() string {
 // Section fills a section with node attributes
 func (node *WGNode) Populate(section *utils.Section) {
 	section.Set("Address", node.Address())
-	section.Set("PrivateKey", node.Private())
+	if node.private != nil {
+		section.Set("PrivateKey", node.Private())
+	} else {
+		// the node keeps its private key
+		section.AddComment("PrivateKey kept by the client (public key " + node.public.Base64() + ")")
+	}
 	for _, cmd := range node.preUp {
 		section.Add("PreUp", cmd)
 	}
+	for _, cmd := range node.postUp {
+		section.Add("PostUp", cmd)
+	}
 	for _, cmd := range node.postDown {
 		section.Add("PostDown", cmd)
 	}
@@ -75,6 +93,13 @@ func (node *WGNode) SetHooks(preUp, postDown []string) {
 	node.postDown = postDown
 }
 
+// SetPostHooks sets the PostUp and PostDown hooks for this node
+// (run once the interface exists)
+func (node *WGNode) SetPostHooks(postUp, postDown []string) {
+	node.postUp = postUp
+	node.postDown = postDown
+}
+
 // ToPeer turns a Node into a Peer
 func (node *WGNode) ToPeer() *WGPeer {
 	allowedIPs := make([]net.IPNet, len(node.address))
@@ -91,9 +116,13 @@ func (node *WGNode) ToPeer() *WGPeer {
 		}
 	}
 
+	public := node.public
+	if node.private != nil {
+		public = node.private.Public()
+	}
 	return &WGPeer{
 		allowedIPs: allowedIPs,
-		public:     node.private.Public(),
+		public:     public,
 		psk:        node.psk,
 	}
 }
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/asiffer/wg-easy-vpn/utils"
+)
+
+// FormatOpenWrt is the OpenWrt format (uci script)
+const FormatOpenWrt = "openwrt"
+
+// OpenWrt converts a populated client file (wg-quick) to a uci script
+// creating the network.<iface> interface and its wireguard_<iface> peers.
+// The script replaces a previous interface of the same name.
+func OpenWrt(f *utils.File, iface string) (string, error) {
+	settings, err := readInterfaceSettings(f)
+	if err != nil {
+		return "", err
+	}
+	options := settings.options
+	section := "network." + iface
+	peerType := "wireguard_" + iface
+
+	var sb strings.Builder
+	for _, comment := range settings.comments {
+		fmt.Fprintf(&sb, "# %s\n", comment)
+	}
+	// remove the previous interface and its peers
+	fmt.Fprintf(&sb, "uci -q delete %s\n", section)
+	fmt.Fprintf(&sb, "while uci -q delete network.@%s[0]; do :; done\n", peerType)
+
+	fmt.Fprintf(&sb, "uci set %s=interface\n", section)
+	fmt.Fprintf(&sb, "uci set %s.proto=%s\n", section, uciQuote("wireguard"))
+	fmt.Fprintf(&sb, "uci set %s.private_key=%s\n", section, uciQuote(settings.private))
+	for _, a := range settings.addresses {
+		fmt.Fprintf(&sb, "uci add_list %s.addresses=%s\n", section, uciQuote(a.String()))
+	}
+	if options.MTU > 0 {
+		fmt.Fprintf(&sb, "uci set %s.mtu=%s\n", section, uciQuote(fmt.Sprint(options.MTU)))
+	}
+	if options.FwMark != "" && options.FwMark != "off" {
+		fmt.Fprintf(&sb, "uci set %s.fwmark=%s\n", section, uciQuote(options.FwMark))
+	}
+	for _, ip := range settings.dns {
+		fmt.Fprintf(&sb, "uci add_list %s.dns=%s\n", section, uciQuote(ip.String()))
+	}
+
+	// routes to the allowed ips (wg-quick Table)
+	routes := "1"
+	if options.Table == "off" {
+		routes = "0"
+	}
+	for i, p := range settings.peers {
+		peer := fmt.Sprintf("network.%s_peer%d", iface, i+1)
+		fmt.Fprintf(&sb, "uci set %s=%s\n", peer, peerType)
+		if len(p.comments) > 0 {
+			fmt.Fprintf(&sb, "uci set %s.description=%s\n", peer, uciQuote(p.comments[0]))
+		}
+		fmt.Fprintf(&sb, "uci set %s.public_key=%s\n", peer, uciQuote(p.public))
+		if p.psk != "" {
+			fmt.Fprintf(&sb, "uci set %s.preshared_key=%s\n", peer, uciQuote(p.psk))
+		}
+		for _, n := range p.allowed {
+			fmt.Fprintf(&sb, "uci add_list %s.allowed_ips=%s\n", peer, uciQuote(n.String()))
+		}
+		fmt.Fprintf(&sb, "uci set %s.route_allowed_ips=%s\n", peer, uciQuote(routes))
+		if p.endpoint != "" {
+			host, port := splitEndpoint(p.endpoint)
+			fmt.Fprintf(&sb, "uci set %s.endpoint_host=%s\n", peer, uciQuote(host))
+			if port != "" {
+				fmt.Fprintf(&sb, "uci set %s.endpoint_port=%s\n", peer, uciQuote(port))
+			}
+		}
+		if p.keepalive != "" {
+			fmt.Fprintf(&sb, "uci set %s.persistent_keepalive=%s\n", peer, uciQuote(p.keepalive))
+		}
+	}
+	sb.WriteString("uci commit network\n")
+	return sb.String(), nil
+}
+
+// uciQuote quotes a value for the shell
+func uciQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
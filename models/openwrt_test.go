@@ -0,0 +1,93 @@
+package models
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/asiffer/wg-easy-vpn/utils"
+)
+
+// newRouterClientFile is a split tunnel client with a gateway
+func newRouterClientFile() *utils.File {
+	file := utils.NewFile()
+	file.GetorCreateSection(utils.DEFAULT_SECTION).AddComment("office router")
+	iface := file.AddSection("Interface")
+	iface.Set("Address", "10.0.0.2/24, fd00::2/64")
+	iface.Set("PrivateKey", "wDx8ruBJgk2ZmDwgHkZfnoaSdfCgXUb4MwJ87psOJGE=")
+	iface.Set("DNS", "10.0.0.1")
+	iface.Set("MTU", "1380")
+	peer := file.AddSection("Peer")
+	peer.Set("AllowedIPs", "10.0.0.0/24, 192.168.1.0/24, fd00::/64")
+	peer.Set("PublicKey", "IYIgnBITiOdCJUyg/c0jpPi0+OWVhcWw/CS5FIpG024=")
+	peer.Set("PresharedKey", "dHx7qhkvUVPxTK+doFUtSz972uYylXuHiRq0wA0V414=")
+	peer.Set("Endpoint", "vpn.example.com:51820")
+	peer.Set("PersistentKeepalive", "25")
+	gateway := file.AddSection("Peer")
+	gateway.AddComment("london")
+	gateway.Set("AllowedIPs", "172.16.0.0/16")
+	gateway.Set("PublicKey", "JVzBpb4Tl6bA4iyEeTYfVbJ12fyH5Pgm29X/2F5I1yU=")
+	gateway.Set("Endpoint", "[2001:db8::1]:52820")
+	return file
+}
+
+// checkGolden compares the output to a file of the test directory
+func checkGolden(t *testing.T, golden string, out string) {
+	t.Helper()
+	expected, err := os.ReadFile("../test/" + golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != string(expected) {
+		t.Errorf("output differs from %s:\n%s", golden, out)
+	}
+}
+
+func TestOpenWrt(t *testing.T) {
+	out, err := OpenWrt(newRouterClientFile(), "wg0")
+	if err != nil {
+		t.Fatalf("OpenWrt failed: %v", err)
+	}
+	checkGolden(t, "client.uci", out)
+}
+
+func TestOpenWrtFullTunnel(t *testing.T) {
+	out, err := OpenWrt(newNMClientFile(), "wg0")
+	if err != nil {
+		t.Fatalf("OpenWrt failed: %v", err)
+	}
+	for _, s := range []string{
+		"uci add_list network.wg0_peer1.allowed_ips='0.0.0.0/0'\n",
+		"uci add_list network.wg0_peer1.allowed_ips='::/0'\n",
+		// Table = off
+		"uci set network.wg0_peer1.route_allowed_ips='0'\n",
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("missing %q in:\n%s", s, out)
+		}
+	}
+}
+
+func TestOpenWrtQuote(t *testing.T) {
+	file := newRouterClientFile()
+	file.AddSection("Peer").AddComment("bob's gateway")
+	peer := file.Sections()[len(file.Sections())-1]
+	peer.Set("AllowedIPs", "172.17.0.0/16")
+	peer.Set("PublicKey", "FUbQrV3zTSRk2PXWHGEvk4APJn4ySKMzMIaDOkMQsko=")
+	out, err := OpenWrt(file, "wg0")
+	if err != nil {
+		t.Fatalf("OpenWrt failed: %v", err)
+	}
+	if !strings.Contains(out, `uci set network.wg0_peer3.description='bob'\''s gateway'`) {
+		t.Errorf("bad quoting:\n%s", out)
+	}
+}
+
+func TestOpenWrtNoPrivateKey(t *testing.T) {
+	file := newRouterClientFile()
+	iface, _ := file.GetSection("Interface")
+	iface.Keep("Address", "DNS")
+	if _, err := OpenWrt(file, "wg0"); err == nil {
+		t.Errorf("an error was expected")
+	}
+}
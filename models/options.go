@@ -0,0 +1,143 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/asiffer/wg-easy-vpn/utils"
+)
+
+// OptionKeys are the keys of the options (the values of Unset)
+var OptionKeys = []string{"PersistentKeepalive", "MTU", "Table", "FwMark"}
+
+// WGOptions are the optional settings of a client config. Zero values
+// are not rendered (and are overridden by the vpn defaults)
+type WGOptions struct {
+	Keepalive uint16   `json:"keepalive,omitempty" yaml:"keepalive,omitempty"` // PersistentKeepalive (seconds) of the server peer
+	MTU       uint16   `json:"mtu,omitempty" yaml:"mtu,omitempty"`             // MTU of the interface
+	Table     string   `json:"table,omitempty" yaml:"table,omitempty"`         // routing table (off, auto or a table number)
+	FwMark    string   `json:"fwmark,omitempty" yaml:"fwmark,omitempty"`       // firewall mark of the outgoing packets (off or a 32-bit number)
+	Unset     []string `json:"unset,omitempty" yaml:"unset,omitempty"`         // keys of the vpn defaults the client does not use (see OptionKeys)
+}
+
+// OptionsFromSection reads the options from a section (missing keys
+// are left to their zero value)
+func OptionsFromSection(sec *utils.Section) (WGOptions, error) {
+	opts := WGOptions{}
+	if sec.HasKey("PersistentKeepalive") {
+		keepalive, err := sec.GetUint16("PersistentKeepalive")
+		if err != nil {
+			return opts, fmt.Errorf("error while retrieving PersistentKeepalive (%w)", err)
+		}
+		opts.Keepalive = keepalive
+	}
+	if sec.HasKey("MTU") {
+		mtu, err := sec.GetUint16("MTU")
+		if err != nil {
+			return opts, fmt.Errorf("error while retrieving MTU (%w)", err)
+		}
+		opts.MTU = mtu
+	}
+	opts.Table, _ = sec.Get("Table")
+	opts.FwMark, _ = sec.Get("FwMark")
+	if unset, err := sec.Get("Unset"); err == nil {
+		for _, key := range strings.Split(unset, ",") {
+			if key = strings.TrimSpace(key); key != "" {
+				opts.Unset = append(opts.Unset, key)
+			}
+		}
+	}
+	return opts, opts.Validate()
+}
+
+// IsZero returns whether no option is set (nor unset)
+func (opts WGOptions) IsZero() bool {
+	return opts.Keepalive == 0 && opts.MTU == 0 && opts.Table == "" && opts.FwMark == "" && len(opts.Unset) == 0
+}
+
+// Validate checks the Table, FwMark and Unset values
+func (opts WGOptions) Validate() error {
+	for _, key := range opts.Unset {
+		if !slices.Contains(OptionKeys, key) {
+			return fmt.Errorf("invalid Unset key %q (expected %s)", key, strings.Join(OptionKeys, ", "))
+		}
+	}
+	switch opts.Table {
+	case "", "off", "auto":
+	default:
+		if _, err := strconv.ParseUint(opts.Table, 10, 32); err != nil {
+			return fmt.Errorf("invalid Table %q (expected off, auto or a number)", opts.Table)
+		}
+	}
+	switch opts.FwMark {
+	case "", "off":
+	default:
+		if _, err := strconv.ParseUint(opts.FwMark, 0, 32); err != nil {
+			return fmt.Errorf("invalid FwMark %q (expected off or a 32-bit number)", opts.FwMark)
+		}
+	}
+	return nil
+}
+
+// Merge returns the options where the non-zero values of override
+// replace the ones of opts (and its Unset keys clear them)
+func (opts WGOptions) Merge(override WGOptions) WGOptions {
+	opts.Unset = nil
+	for _, key := range override.Unset {
+		switch key {
+		case "PersistentKeepalive":
+			opts.Keepalive = 0
+		case "MTU":
+			opts.MTU = 0
+		case "Table":
+			opts.Table = ""
+		case "FwMark":
+			opts.FwMark = ""
+		}
+	}
+	if override.Keepalive > 0 {
+		opts.Keepalive = override.Keepalive
+	}
+	if override.MTU > 0 {
+		opts.MTU = override.MTU
+	}
+	if override.Table != "" {
+		opts.Table = override.Table
+	}
+	if override.FwMark != "" {
+		opts.FwMark = override.FwMark
+	}
+	return opts
+}
+
+// Populate writes all the options into a section (vpn defaults or
+// client overrides)
+func (opts WGOptions) Populate(section *utils.Section) {
+	opts.PopulateInterface(section)
+	opts.PopulatePeer(section)
+	if len(opts.Unset) > 0 {
+		section.Set("Unset", strings.Join(opts.Unset, ","))
+	}
+}
+
+// PopulateInterface writes the interface options (MTU, Table, FwMark)
+func (opts WGOptions) PopulateInterface(section *utils.Section) {
+	if opts.MTU > 0 {
+		section.Set("MTU", fmt.Sprintf("%d", opts.MTU))
+	}
+	if opts.Table != "" {
+		section.Set("Table", opts.Table)
+	}
+	if opts.FwMark != "" {
+		section.Set("FwMark", opts.FwMark)
+	}
+}
+
+// PopulatePeer writes the peer options (PersistentKeepalive)
+func (opts WGOptions) PopulatePeer(section *utils.Section) {
+	if opts.Keepalive > 0 {
+		section.Set("PersistentKeepalive", fmt.Sprintf("%d", opts.Keepalive))
+	}
+}
@@ -0,0 +1,170 @@
+package models
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/asiffer/wg-easy-vpn/utils"
+)
+
+func TestWGOptionsValidate(t *testing.T) {
+	valid := []WGOptions{
+		{},
+		{Table: "off", FwMark: "off"},
+		{Table: "auto"},
+		{Table: "1234", FwMark: "0xca6c"},
+		{FwMark: "51820"},
+		{Unset: []string{"PersistentKeepalive", "MTU"}},
+	}
+	for _, opts := range valid {
+		if err := opts.Validate(); err != nil {
+			t.Errorf("Validate(%+v) failed: %v", opts, err)
+		}
+	}
+
+	invalid := []WGOptions{
+		{Table: "main"},
+		{Table: "-1"},
+		{FwMark: "mark"},
+		{FwMark: "0x1ffffffff"},
+		{Unset: []string{"DNS"}},
+	}
+	for _, opts := range invalid {
+		if err := opts.Validate(); err == nil {
+			t.Errorf("Validate(%+v) should fail", opts)
+		}
+	}
+}
+
+func TestWGOptionsMerge(t *testing.T) {
+	defaults := WGOptions{Keepalive: 25, MTU: 1420, Table: "auto"}
+	merged := defaults.Merge(WGOptions{MTU: 1280, FwMark: "0x1"})
+
+	expected := WGOptions{Keepalive: 25, MTU: 1280, Table: "auto", FwMark: "0x1"}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Errorf("Merge() = %+v, expected %+v", merged, expected)
+	}
+
+	// the client does not use the default keepalive
+	merged = defaults.Merge(WGOptions{Unset: []string{"PersistentKeepalive", "Table"}, MTU: 1280})
+	expected = WGOptions{MTU: 1280}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Errorf("Merge() = %+v, expected %+v", merged, expected)
+	}
+}
+
+func TestWGOptionsRoundTrip(t *testing.T) {
+	original := WGOptions{Keepalive: 25, MTU: 1420, Table: "off", FwMark: "0xca6c", Unset: []string{"MTU"}}
+	sec := utils.NewSection(utils.DEFAULT_SECTION)
+	original.Populate(sec)
+
+	parsed, err := OptionsFromSection(sec)
+	if err != nil {
+		t.Fatalf("OptionsFromSection failed: %v", err)
+	}
+	if !reflect.DeepEqual(parsed, original) {
+		t.Errorf("round trip: got %+v, expected %+v", parsed, original)
+	}
+
+	t.Run("invalid values", func(t *testing.T) {
+		sec := utils.NewSection(utils.DEFAULT_SECTION)
+		sec.Set("MTU", "big")
+		if _, err := OptionsFromSection(sec); err == nil {
+			t.Error("expected error for an invalid MTU")
+		}
+	})
+}
+
+func TestWGClientPopulateClientOptions(t *testing.T) {
+	server := NewWGServer(nil, false, 51820)
+	networks := []net.IPNet{{IP: net.ParseIP("10.0.0.0"), Mask: net.CIDRMask(24, 32)}}
+	vpn, _ := NewWGVPN("wg0", server, "vpn.example.com:51820", networks, nil, nil)
+	vpn.SetOptions(WGOptions{Keepalive: 25, MTU: 1420})
+
+	t.Run("vpn defaults", func(t *testing.T) {
+		client := NewWGClient(nil, false, nil, nil)
+		vpn.AddClient(client)
+		file := utils.NewFile()
+		client.PopulateClient(file, vpn)
+
+		iface := file.Sections()[0]
+		if mtu, _ := iface.Get("MTU"); mtu != "1420" {
+			t.Errorf("expected MTU 1420, got '%s'", mtu)
+		}
+		if iface.HasKey("Table") || iface.HasKey("FwMark") {
+			t.Error("expected no Table/FwMark")
+		}
+		peer := file.Sections()[1]
+		if keepalive, _ := peer.Get("PersistentKeepalive"); keepalive != "25" {
+			t.Errorf("expected PersistentKeepalive 25, got '%s'", keepalive)
+		}
+	})
+
+	t.Run("client overrides", func(t *testing.T) {
+		client := NewWGClient(nil, false, nil, nil)
+		client.SetOptions(WGOptions{Keepalive: 10, Table: "off", FwMark: "0x1"})
+		vpn.AddClient(client)
+		file := utils.NewFile()
+		client.PopulateClient(file, vpn)
+
+		iface := file.Sections()[0]
+		if mtu, _ := iface.Get("MTU"); mtu != "1420" {
+			t.Errorf("expected MTU 1420, got '%s'", mtu)
+		}
+		if table, _ := iface.Get("Table"); table != "off" {
+			t.Errorf("expected Table off, got '%s'", table)
+		}
+		if fwmark, _ := iface.Get("FwMark"); fwmark != "0x1" {
+			t.Errorf("expected FwMark 0x1, got '%s'", fwmark)
+		}
+		peer := file.Sections()[1]
+		if keepalive, _ := peer.Get("PersistentKeepalive"); keepalive != "10" {
+			t.Errorf("expected PersistentKeepalive 10, got '%s'", keepalive)
+		}
+	})
+
+	t.Run("defaults are remembered", func(t *testing.T) {
+		file := utils.NewFile()
+		vpn.Populate(file)
+		parsed, err := VPNFromFile("wg0", file)
+		if err != nil {
+			t.Fatalf("failed to parse VPN: %v", err)
+		}
+		if !reflect.DeepEqual(parsed.options, vpn.options) {
+			t.Errorf("expected options %+v, got %+v", vpn.options, parsed.options)
+		}
+		// the server interface is not affected
+		iface, _ := file.GetSection("Interface")
+		if iface.HasKey("MTU") {
+			t.Error("expected no MTU in the server interface")
+		}
+	})
+
+	t.Run("overrides are remembered", func(t *testing.T) {
+		client := NewWGClient(nil, false, nil, nil)
+		client.SetName("phone")
+		options := WGOptions{MTU: 1280, Unset: []string{"PersistentKeepalive"}}
+		client.SetOptions(options)
+		vpn.AddClient(client)
+
+		file := utils.NewFile()
+		vpn.Populate(file)
+		parsed, err := VPNFromFile("wg0", file)
+		if err != nil {
+			t.Fatalf("failed to parse VPN: %v", err)
+		}
+		peer := parsed.Peers()[len(parsed.Peers())-1]
+		if peer.Name() != "phone" || !reflect.DeepEqual(peer.Options(), options) {
+			t.Errorf("expected phone with %+v, got %s with %+v", options, peer.Name(), peer.Options())
+		}
+		// in the state file too
+		parsed, err = VPNFromState("wg0", vpn.State())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if peer := parsed.Peers()[len(parsed.Peers())-1]; !reflect.DeepEqual(peer.Options(), options) {
+			t.Errorf("expected %+v in the state, got %+v", options, peer.Options())
+		}
+	})
+}
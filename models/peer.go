@@ -3,7 +3,9 @@ package models
 import (
 	"fmt"
 	"net"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/asiffer/wg-easy-vpn/crypto"
 	"github.com/asiffer/wg-easy-vpn/utils"
@@ -25,6 +27,59 @@ type WGServerAsPeer struct {
 // WGClientAsPeer is a server seen from a client (peer of a client)
 type WGClientAsPeer struct {
 	WGPeer
+	name      string           // name of the client (stored as a comment)
+	createdAt time.Time        // creation date (metadata)
+	tags      []string         // labels of the client (metadata)
+	options   WGOptions        // overrides of the vpn defaults (metadata)
+	gateway   string           // server it connects to (metadata, empty = main server)
+	dns       []net.IP         // dns of its config (metadata)
+	routes    []net.IPNet      // routes of its config (metadata, empty = vpn routes)
+	excludes  []net.IPNet      // routes excluded from its config (metadata)
+	disabled  bool             // kept but not a peer of the servers (metadata)
+	extra     []utils.KeyValue // keys not managed by wg-easy-vpn (Endpoint...)
+}
+
+// PeerMetadataPrefix starts the comments of a peer section which keep the
+// settings of the client config (wireguard ignores them)
+const PeerMetadataPrefix = "wg-easy-vpn:"
+
+// peerMetadata returns the name of a peer (its first comment) and its
+// settings as a section (the prefixed comments)
+func peerMetadata(sec *utils.Section) (string, *utils.Section) {
+	name := ""
+	meta := utils.NewSection("Metadata")
+	for _, comment := range sec.Comments() {
+		text, ok := strings.CutPrefix(comment, PeerMetadataPrefix)
+		if !ok {
+			if name == "" {
+				name = comment
+			}
+			continue
+		}
+		if key, value, found := strings.Cut(text, "="); found {
+			meta.Set(strings.TrimSpace(key), strings.TrimSpace(value))
+		}
+	}
+	return name, meta
+}
+
+// plainComments returns the comments of a peer section without its
+// settings (the name first)
+func plainComments(sec *utils.Section) []string {
+	comments := make([]string, 0, len(sec.Comments()))
+	for _, comment := range sec.Comments() {
+		if !strings.HasPrefix(comment, PeerMetadataPrefix) {
+			comments = append(comments, comment)
+		}
+	}
+	return comments
+}
+
+// populateMetadata writes the settings of a peer as prefixed comments
+func populateMetadata(section *utils.Section, meta *utils.Section) {
+	for _, kv := range meta.Items() {
+		section.AddComment(fmt.Sprintf("%s %s = %s", PeerMetadataPrefix, kv.Key, kv.Value))
+	}
 }
 
 func PeerFromSection(sec *utils.Section) (*WGClientAsPeer, error) {
@@ -53,6 +108,51 @@ func PeerFromSection(sec *utils.Section) (*WGClientAsPeer, error) {
 		psk = nil
 	}
 
+	// Name (first comment of the section, if any) and settings
+	name, meta := peerMetadata(sec)
+	options, err := OptionsFromSection(meta)
+	if err != nil {
+		return nil, fmt.Errorf("error while retrieving peer options (%w)", err)
+	}
+	var createdAt time.Time
+	if value, err := meta.Get("CreatedAt"); err == nil {
+		if createdAt, err = time.Parse(time.RFC3339, value); err != nil {
+			return nil, fmt.Errorf("error while retrieving peer creation date (%w)", err)
+		}
+	}
+	gateway, _ := meta.Get("Gateway")
+	var dns []net.IP
+	if meta.HasKey("DNS") {
+		if dns, err = meta.GetIPArray("DNS"); err != nil {
+			return nil, fmt.Errorf("error while retrieving peer dns (%w)", err)
+		}
+	}
+	var routes, excludes []net.IPNet
+	if meta.HasKey("Routes") {
+		if routes, err = meta.GetNetworks("Routes"); err != nil {
+			return nil, fmt.Errorf("error while retrieving peer routes (%w)", err)
+		}
+	}
+	if meta.HasKey("ExcludeRoutes") {
+		if excludes, err = meta.GetNetworks("ExcludeRoutes"); err != nil {
+			return nil, fmt.Errorf("error while retrieving peer excluded routes (%w)", err)
+		}
+	}
+	disabled := false
+	if value, err := meta.Get("Disabled"); err == nil {
+		if disabled, err = strconv.ParseBool(value); err != nil {
+			return nil, fmt.Errorf("error while retrieving peer status (%w)", err)
+		}
+	}
+	var tags []string
+	if value, err := meta.Get("Tags"); err == nil {
+		for _, tag := range strings.Split(value, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+
 	// return peer
 	return &WGClientAsPeer{
 		WGPeer: WGPeer{
@@ -60,6 +160,16 @@ func PeerFromSection(sec *utils.Section) (*WGClientAsPeer, error) {
 			public:     pubkey,
 			psk:        psk,
 		},
+		name:      name,
+		createdAt: createdAt,
+		tags:      tags,
+		options:   options,
+		gateway:   gateway,
+		dns:       dns,
+		routes:    routes,
+		excludes:  excludes,
+		disabled:  disabled,
+		extra:     unmanagedItems(sec, "PublicKey", "AllowedIPs", "PresharedKey"),
 	}, nil
 
 }
@@ -73,6 +183,11 @@ func (peer *WGPeer) AllowedIPs() string {
 	return strings.Join(str, ", ")
 }
 
+// AllowedNetworks returns the allowed addresses
+func (peer *WGPeer) AllowedNetworks() []net.IPNet {
+	return peer.allowedIPs
+}
+
 // Public returns the peer public key base64 encoded
 func (peer *WGPeer) Public() string {
 	return peer.public.Base64()
@@ -112,3 +227,70 @@ func (server *WGServerAsPeer) Populate(section *utils.Section) {
 	server.WGPeer.Populate(section)
 	section.Set("Endpoint", server.endpoint)
 }
+
+// Name returns the name of the client (empty if unknown)
+func (peer *WGClientAsPeer) Name() string {
+	return peer.name
+}
+
+// CreatedAt returns the creation date of the client (zero if unknown)
+func (peer *WGClientAsPeer) CreatedAt() time.Time {
+	return peer.createdAt
+}
+
+// Tags returns the labels of the client
+func (peer *WGClientAsPeer) Tags() []string {
+	return peer.tags
+}
+
+// Gateway returns the server the client connects to (empty for the main
+// server, AllGateways for every server)
+func (peer *WGClientAsPeer) Gateway() string {
+	return peer.gateway
+}
+
+// Disabled returns whether the client is disabled (it keeps its addresses
+// but it is not a peer of the servers)
+func (peer *WGClientAsPeer) Disabled() bool {
+	return peer.disabled
+}
+
+// Options returns the options overriding the vpn defaults
+func (peer *WGClientAsPeer) Options() WGOptions {
+	return peer.options
+}
+
+// Populate enriches a section with client attributes
+func (peer *WGClientAsPeer) Populate(section *utils.Section) {
+	if peer.name != "" {
+		section.AddComment(peer.name)
+	}
+	meta := utils.NewSection("Metadata")
+	if !peer.createdAt.IsZero() {
+		meta.Set("CreatedAt", peer.createdAt.Format(time.RFC3339))
+	}
+	if len(peer.tags) > 0 {
+		meta.Set("Tags", strings.Join(peer.tags, ","))
+	}
+	if peer.gateway != "" {
+		meta.Set("Gateway", peer.gateway)
+	}
+	if peer.disabled {
+		meta.Set("Disabled", "true")
+	}
+	if len(peer.dns) > 0 {
+		meta.Set("DNS", strings.Join(utils.StringifyIPs(peer.dns), ","))
+	}
+	if len(peer.routes) > 0 {
+		meta.Set("Routes", strings.Join(utils.StringifyNetworks(peer.routes), ","))
+	}
+	if len(peer.excludes) > 0 {
+		meta.Set("ExcludeRoutes", strings.Join(utils.StringifyNetworks(peer.excludes), ","))
+	}
+	peer.options.Populate(meta)
+	populateMetadata(section, meta)
+	peer.WGPeer.Populate(section)
+	for _, kv := range peer.extra {
+		section.Add(kv.Key, kv.Value)
+	}
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"net"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -335,6 +336,36 @@ func TestPeerRoundTrip(t *testing.T) {
 	}
 }
 
+func TestPeerRoundTripWithName(t *testing.T) {
+	client := NewWGClient([]net.IPNet{
+		{IP: net.ParseIP("10.0.0.2"), Mask: net.CIDRMask(32, 32)},
+	}, false, nil, nil)
+	client.SetName("laptop")
+
+	file := utils.NewFile()
+	client.ToPeer().Populate(file.AddSection("Peer"))
+	// the name is stored as a comment and must survive a save/parse cycle
+	path := filepath.Join(t.TempDir(), "wg0.conf")
+	if err := file.Save(path); err != nil {
+		t.Fatalf("failed to save file: %v", err)
+	}
+	parsedFile, err := utils.ParseFile(path)
+	if err != nil {
+		t.Fatalf("failed to parse file: %v", err)
+	}
+	section, err := parsedFile.GetSection("Peer")
+	if err != nil {
+		t.Fatalf("missing Peer section: %v", err)
+	}
+	parsed, err := PeerFromSection(section)
+	if err != nil {
+		t.Fatalf("failed to parse peer: %v", err)
+	}
+	if parsed.Name() != "laptop" {
+		t.Errorf("expected name 'laptop', got '%s'", parsed.Name())
+	}
+}
+
 func TestWGServerAsPeerEndpoint(t *testing.T) {
 	peer := &WGServerAsPeer{
 		WGPeer: WGPeer{
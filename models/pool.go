@@ -0,0 +1,78 @@
+package models
+
+import (
+	"errors"
+	"math"
+	"net"
+)
+
+// ErrPoolExhausted is returned when a network of the vpn has no address
+// left for a new client
+var ErrPoolExhausted = errors.New("address pool exhausted")
+
+// Pool is the usage of a network of the vpn. The counts saturate at the
+// max uint64 (huge IPv6 networks).
+type Pool struct {
+	Network  net.IPNet
+	Total    uint64 // addresses of the network
+	Used     uint64 // addresses of the clients
+	Reserved uint64 // network address, server and gateways addresses
+	Next     net.IP // address of the next client (nil if exhausted)
+}
+
+// Free returns the number of addresses left for the new clients
+func (p *Pool) Free() uint64 {
+	if p.Used+p.Reserved >= p.Total {
+		return 0
+	}
+	return p.Total - p.Used - p.Reserved
+}
+
+// Pools returns the usage of the networks of the vpn
+func (vpn *WGVPN) Pools() []Pool {
+	reserved := make([]net.IP, 0)
+	for _, n := range vpn.server.address {
+		reserved = append(reserved, n.IP)
+	}
+	for _, gw := range vpn.gateways {
+		for _, n := range gw.address {
+			reserved = append(reserved, n.IP)
+		}
+	}
+	used := make([]net.IP, 0)
+	for _, client := range vpn.peers {
+		for _, n := range client.allowedIPs {
+			used = append(used, n.IP)
+		}
+	}
+
+	taken := append(append([]net.IP{}, reserved...), used...)
+	pools := make([]Pool, 0, len(vpn.networks))
+	for _, n := range vpn.networks {
+		ones, bits := n.Mask.Size()
+		pool := Pool{
+			Network:  net.IPNet{IP: n.IP.Mask(n.Mask), Mask: n.Mask},
+			Total:    math.MaxUint64,
+			Reserved: 1, // network address
+		}
+		if bits-ones < 64 {
+			pool.Total = 1 << uint(bits-ones)
+		}
+		pool.Used = countIn(pool.Network, used)
+		pool.Reserved += countIn(pool.Network, reserved)
+		pool.Next = nextFree(pool.Network, taken)
+		pools = append(pools, pool)
+	}
+	return pools
+}
+
+// countIn returns the number of distinct addresses of the network
+func countIn(network net.IPNet, ips []net.IP) uint64 {
+	seen := make(map[string]bool)
+	for _, ip := range ips {
+		if network.Contains(ip) && !ip.Equal(network.IP) {
+			seen[ip.String()] = true
+		}
+	}
+	return uint64(len(seen))
+}
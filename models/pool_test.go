@@ -0,0 +1,91 @@
+package models
+
+import (
+	"errors"
+	"math"
+	"net"
+	"testing"
+)
+
+func TestWGVPNPools(t *testing.T) {
+	server := NewWGServer([]net.IPNet{
+		{IP: net.ParseIP("10.0.0.1"), Mask: net.CIDRMask(24, 32)},
+		{IP: net.ParseIP("fd00::1"), Mask: net.CIDRMask(64, 128)},
+	}, true, 51820)
+	vpn := &WGVPN{
+		server: server,
+		networks: []net.IPNet{
+			{IP: net.ParseIP("10.0.0.0"), Mask: net.CIDRMask(24, 32)},
+			{IP: net.ParseIP("fd00::"), Mask: net.CIDRMask(64, 128)},
+		},
+		gateways: []*WGGateway{
+			{name: "paris", WGServer: *NewWGServer([]net.IPNet{{IP: net.ParseIP("10.0.0.254"), Mask: net.CIDRMask(24, 32)}}, true, 51820)},
+		},
+		peers: []*WGClientAsPeer{
+			{WGPeer: WGPeer{allowedIPs: []net.IPNet{
+				{IP: net.ParseIP("10.0.0.2"), Mask: net.CIDRMask(32, 32)},
+				{IP: net.ParseIP("fd00::2"), Mask: net.CIDRMask(128, 128)},
+				// site-to-site subnet
+				{IP: net.ParseIP("192.168.1.0"), Mask: net.CIDRMask(24, 32)},
+			}}},
+			{WGPeer: WGPeer{allowedIPs: []net.IPNet{{IP: net.ParseIP("10.0.0.3"), Mask: net.CIDRMask(32, 32)}}}},
+		},
+	}
+
+	pools := vpn.Pools()
+	if len(pools) != 2 {
+		t.Fatalf("expected 2 pools, got %d", len(pools))
+	}
+	v4 := pools[0]
+	if v4.Network.String() != "10.0.0.0/24" || v4.Total != 256 || v4.Used != 2 || v4.Reserved != 3 {
+		t.Errorf("unexpected IPv4 pool %+v", v4)
+	}
+	if v4.Free() != 251 {
+		t.Errorf("expected 251 free addresses, got %d", v4.Free())
+	}
+	if v4.Next.String() != "10.0.0.4" {
+		t.Errorf("expected 10.0.0.4 as next address, got %v", v4.Next)
+	}
+	v6 := pools[1]
+	if v6.Total != math.MaxUint64 || v6.Used != 1 || v6.Reserved != 2 || v6.Next.String() != "fd00::3" {
+		t.Errorf("unexpected IPv6 pool %+v", v6)
+	}
+
+	full := Pool{Total: 4, Used: 3, Reserved: 2}
+	if full.Free() != 0 {
+		t.Errorf("expected no free address, got %d", full.Free())
+	}
+}
+
+func TestWGVPNPoolExhausted(t *testing.T) {
+	// /30: 10.0.0.1 (server), 10.0.0.2 and 10.0.0.3 for the clients
+	server := NewWGServer([]net.IPNet{{IP: net.ParseIP("10.0.0.1"), Mask: net.CIDRMask(30, 32)}}, true, 51820)
+	vpn := &WGVPN{
+		server:   server,
+		networks: []net.IPNet{{IP: net.ParseIP("10.0.0.0"), Mask: net.CIDRMask(30, 32)}},
+		peers:    make([]*WGClientAsPeer, 0),
+	}
+	for _, name := range []string{"laptop", "phone"} {
+		client := NewWGClient(nil, true, nil, nil)
+		client.SetName(name)
+		if err := vpn.AddClient(client); err != nil {
+			t.Fatalf("AddClient failed: %v", err)
+		}
+	}
+
+	pool := vpn.Pools()[0]
+	if pool.Free() != 0 || pool.Next != nil {
+		t.Errorf("expected an exhausted pool, got %+v", pool)
+	}
+	if _, err := vpn.ProvideNetworks(); !errors.Is(err, ErrPoolExhausted) {
+		t.Errorf("expected ErrPoolExhausted, got %v", err)
+	}
+	client := NewWGClient(nil, true, nil, nil)
+	client.SetName("tablet")
+	if err := vpn.AddClient(client); !errors.Is(err, ErrPoolExhausted) {
+		t.Errorf("expected ErrPoolExhausted, got %v", err)
+	}
+	if vpn.NumberOfPeers() != 2 {
+		t.Errorf("the client must not be added, got %d peers", vpn.NumberOfPeers())
+	}
+}
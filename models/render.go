@@ -0,0 +1,50 @@
+package models
+
+import (
+	"fmt"
+
+	"github.com/asiffer/wg-easy-vpn/utils"
+)
+
+const (
+	// FormatWG is the format read by `wg setconf` and `wg syncconf`
+	FormatWG = "wg"
+	// FormatWGQuick is the format read by `wg-quick`
+	FormatWGQuick = "wg-quick"
+)
+
+// peerKeys are the keys of a peer section understood by both tools
+var peerKeys = []string{"PublicKey", "PresharedKey", "AllowedIPs", "Endpoint", "PersistentKeepalive"}
+
+// interfaceKeys are the keys of the interface section understood by each tool
+var interfaceKeys = map[string][]string{
+	FormatWG: {"PrivateKey", "ListenPort", "FwMark"},
+	FormatWGQuick: {
+		"Address", "DNS", "MTU", "Table", "PreUp", "PostUp", "PreDown", "PostDown", "SaveConfig",
+		"PrivateKey", "ListenPort", "FwMark",
+	},
+}
+
+// StripFile removes from a populated file (server or gateway config) the
+// keys the given tool does not understand, like the wg-easy-vpn metadata
+// of the DEFAULT section. Comments are kept.
+func StripFile(f *utils.File, format string) error {
+	keys, ok := interfaceKeys[format]
+	if !ok {
+		return fmt.Errorf("unknown format %q (expected %s or %s)", format, FormatWG, FormatWGQuick)
+	}
+	for _, sec := range f.Sections() {
+		switch sec.Name() {
+		case utils.DEFAULT_SECTION:
+			// comments only
+			sec.Keep()
+		case "Interface":
+			sec.Keep(keys...)
+		case "Peer":
+			sec.Keep(peerKeys...)
+		default:
+			return fmt.Errorf("section %s cannot be rendered to the %s format", sec.Name(), format)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package models
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/asiffer/wg-easy-vpn/utils"
+)
+
+func newRenderVPN(t *testing.T) *WGVPN {
+	t.Helper()
+	server := NewWGServer(nil, false, 51820)
+	server.SetPostHooks([]string{"iptables -A FORWARD -i %i -j ACCEPT"}, []string{"iptables -D FORWARD -i %i -j ACCEPT"})
+	networks := []net.IPNet{{IP: net.ParseIP("10.0.0.0"), Mask: net.CIDRMask(24, 32)}}
+	vpn, err := NewWGVPN("wg0", server, "vpn.example.com:51820", networks, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create VPN: %v", err)
+	}
+	client := NewWGClient(nil, false, nil, nil)
+	client.SetName("laptop")
+	if err := vpn.AddClient(client); err != nil {
+		t.Fatalf("failed to add client: %v", err)
+	}
+	return vpn
+}
+
+func TestStripFile(t *testing.T) {
+	t.Run("wg format", func(t *testing.T) {
+		file := utils.NewFile()
+		newRenderVPN(t).PopulateServer(file)
+		if err := StripFile(file, FormatWG); err != nil {
+			t.Fatalf("StripFile failed: %v", err)
+		}
+		out := file.String()
+		for _, key := range []string{"Address", "PostUp", "PostDown"} {
+			if strings.Contains(out, key) {
+				t.Errorf("%s should not be rendered for wg:\n%s", key, out)
+			}
+		}
+		for _, expected := range []string{"PrivateKey = ", "ListenPort = 51820", "# laptop", "PublicKey = ", "PresharedKey = ", "AllowedIPs = 10.0.0.2/32"} {
+			if !strings.Contains(out, expected) {
+				t.Errorf("expected %q in:\n%s", expected, out)
+			}
+		}
+	})
+
+	t.Run("wg-quick format", func(t *testing.T) {
+		file := utils.NewFile()
+		newRenderVPN(t).PopulateServer(file)
+		if err := StripFile(file, FormatWGQuick); err != nil {
+			t.Fatalf("StripFile failed: %v", err)
+		}
+		out := file.String()
+		for _, expected := range []string{"Address = 10.0.0.1/24", "PostUp = ", "PostDown = ", "ListenPort = 51820"} {
+			if !strings.Contains(out, expected) {
+				t.Errorf("expected %q in:\n%s", expected, out)
+			}
+		}
+	})
+
+	t.Run("metadata are removed", func(t *testing.T) {
+		file := utils.NewFile()
+		newRenderVPN(t).Populate(file)
+		// the full state has Gateway sections only when gateways exist
+		if err := StripFile(file, FormatWGQuick); err != nil {
+			t.Fatalf("StripFile failed: %v", err)
+		}
+		out := file.String()
+		for _, key := range []string{"Endpoint", "Network", "Routes"} {
+			if strings.Contains(out, key) {
+				t.Errorf("%s should not be rendered:\n%s", key, out)
+			}
+		}
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		if err := StripFile(utils.NewFile(), "json"); err == nil {
+			t.Error("expected an error for an unknown format")
+		}
+	})
+
+	t.Run("unknown section", func(t *testing.T) {
+		file := utils.NewFile()
+		file.AddSection("Gateway").Set("Name", "london")
+		if err := StripFile(file, FormatWG); err == nil {
+			t.Error("expected an error for a Gateway section")
+		}
+	})
+}
@@ -0,0 +1,109 @@
+package models
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/asiffer/wg-easy-vpn/utils"
+)
+
+// FormatRouterOS is the MikroTik RouterOS format (.rsc script)
+const FormatRouterOS = "routeros"
+
+// RouterOS converts a populated client file (wg-quick) to a RouterOS
+// script adding the interface, its addresses, its peers and the routes to
+// their allowed ips. The default routes are not added (they would also
+// route the endpoint through the tunnel) and the DNS is only a hint.
+func RouterOS(f *utils.File, iface string) (string, error) {
+	settings, err := readInterfaceSettings(f)
+	if err != nil {
+		return "", err
+	}
+	options := settings.options
+
+	var sb strings.Builder
+	for _, comment := range settings.comments {
+		fmt.Fprintf(&sb, "# %s\n", comment)
+	}
+	sb.WriteString("/interface wireguard add name=" + iface)
+	if options.MTU > 0 {
+		fmt.Fprintf(&sb, " mtu=%d", options.MTU)
+	}
+	sb.WriteString(" private-key=" + rosQuote(settings.private))
+	if len(settings.comments) > 0 {
+		sb.WriteString(" comment=" + rosQuote(settings.comments[0]))
+	}
+	sb.WriteString("\n")
+
+	for _, a := range settings.addresses {
+		if a.IP.To4() != nil {
+			fmt.Fprintf(&sb, "/ip address add address=%s interface=%s\n", a.String(), iface)
+		} else {
+			fmt.Fprintf(&sb, "/ipv6 address add address=%s interface=%s advertise=no\n", a.String(), iface)
+		}
+	}
+
+	routes := make([]net.IPNet, 0)
+	for _, p := range settings.peers {
+		sb.WriteString("/interface wireguard peers add interface=" + iface)
+		sb.WriteString(" public-key=" + rosQuote(p.public))
+		if p.psk != "" {
+			sb.WriteString(" preshared-key=" + rosQuote(p.psk))
+		}
+		sb.WriteString(" allowed-address=" + strings.Join(utils.StringifyNetworks(p.allowed), ","))
+		if p.endpoint != "" {
+			host, port := splitEndpoint(p.endpoint)
+			sb.WriteString(" endpoint-address=" + host)
+			if port != "" {
+				sb.WriteString(" endpoint-port=" + port)
+			}
+		}
+		if p.keepalive != "" {
+			sb.WriteString(" persistent-keepalive=" + p.keepalive + "s")
+		}
+		if len(p.comments) > 0 {
+			sb.WriteString(" comment=" + rosQuote(p.comments[0]))
+		}
+		sb.WriteString("\n")
+		routes = append(routes, p.allowed...)
+	}
+
+	// routes to the allowed ips (wg-quick Table)
+	if options.Table != "off" {
+		for _, n := range routes {
+			switch {
+			case isDefaultRoute(n):
+				fmt.Fprintf(&sb, "# full tunnel: route %s through %s once the endpoint has its own route\n", n.String(), iface)
+			case isConnected(n, settings.addresses):
+				// already routed by the address
+			case n.IP.To4() != nil:
+				fmt.Fprintf(&sb, "/ip route add dst-address=%s gateway=%s\n", n.String(), iface)
+			default:
+				fmt.Fprintf(&sb, "/ipv6 route add dst-address=%s gateway=%s\n", n.String(), iface)
+			}
+		}
+	}
+	if len(settings.dns) > 0 {
+		fmt.Fprintf(&sb, "# dns: /ip dns set servers=%s\n", strings.Join(utils.StringifyIPs(settings.dns), ","))
+	}
+	return sb.String(), nil
+}
+
+// isConnected returns whether the network is the one of an address
+func isConnected(n net.IPNet, addresses []net.IPNet) bool {
+	for _, a := range addresses {
+		ones, bits := a.Mask.Size()
+		nOnes, nBits := n.Mask.Size()
+		if ones == nOnes && bits == nBits && a.IP.Mask(a.Mask).Equal(n.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// rosQuote quotes a value of a RouterOS command
+func rosQuote(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`)
+	return `"` + replacer.Replace(value) + `"`
+}
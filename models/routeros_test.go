@@ -0,0 +1,38 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRouterOS(t *testing.T) {
+	out, err := RouterOS(newRouterClientFile(), "wg0")
+	if err != nil {
+		t.Fatalf("RouterOS failed: %v", err)
+	}
+	checkGolden(t, "client.rsc", out)
+}
+
+func TestRouterOSFullTunnel(t *testing.T) {
+	file := newNMClientFile()
+	out, err := RouterOS(file, "wg0")
+	if err != nil {
+		t.Fatalf("RouterOS failed: %v", err)
+	}
+	// Table = off
+	if strings.Contains(out, "route") {
+		t.Errorf("unexpected route in:\n%s", out)
+	}
+
+	iface, _ := file.GetSection("Interface")
+	iface.Set("Table", "auto")
+	if out, err = RouterOS(file, "wg0"); err != nil {
+		t.Fatalf("RouterOS failed: %v", err)
+	}
+	if strings.Contains(out, "route add") {
+		t.Errorf("the default routes must not be added:\n%s", out)
+	}
+	if !strings.Contains(out, "# full tunnel: route 0.0.0.0/0 through wg0") {
+		t.Errorf("missing full tunnel hint in:\n%s", out)
+	}
+}
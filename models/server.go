@@ -3,6 +3,7 @@ package models
 import (
 	"fmt"
 	"net"
+	"slices"
 
 	"github.com/asiffer/wg-easy-vpn/utils"
 )
@@ -10,9 +11,13 @@ import (
 // WGServer is a particular node which listens on a new UDP port
 type WGServer struct {
 	WGNode
-	port uint16
+	port  uint16
+	extra []utils.KeyValue // keys not managed by wg-easy-vpn (MTU, PreDown...)
 }
 
+// serverKeys are the interface keys managed by wg-easy-vpn
+var serverKeys = []string{"Address", "PrivateKey", "ListenPort", "PreUp", "PostUp", "PostDown"}
+
 // NewWGServer creates a new server
 func NewWGServer(ipnet []net.IPNet, noPSK bool, port uint16) *WGServer {
 	return &WGServer{
@@ -50,6 +55,9 @@ func (server *WGServer) String() string {
 func (server *WGServer) Populate(section *utils.Section) {
 	server.WGNode.Populate(section)
 	section.Set("ListenPort", fmt.Sprintf("%d", server.port))
+	for _, kv := range server.extra {
+		section.Add(kv.Key, kv.Value)
+	}
 }
 
 func ServerFromSection(sec *utils.Section) (*WGServer, error) {
@@ -57,7 +65,6 @@ func ServerFromSection(sec *utils.Section) (*WGServer, error) {
 	if err != nil {
 		return nil, err
 	}
-	fmt.Println("networks:", networks)
 
 	// PrivateKey
 	private, err := sec.GetKeyFromBase64("PrivateKey")
@@ -73,10 +80,26 @@ func ServerFromSection(sec *utils.Section) (*WGServer, error) {
 
 	return &WGServer{
 		WGNode: WGNode{
-			address: networks,
-			private: private,
-			psk:     nil,
+			address:  networks,
+			private:  private,
+			psk:      nil,
+			preUp:    sec.GetAll("PreUp"),
+			postUp:   sec.GetAll("PostUp"),
+			postDown: sec.GetAll("PostDown"),
 		},
-		port: port,
+		port:  port,
+		extra: unmanagedItems(sec, serverKeys...),
 	}, nil
 }
+
+// unmanagedItems returns the key/value pairs of a section whose key is
+// not in the managed ones (they are written back untouched)
+func unmanagedItems(sec *utils.Section, managed ...string) []utils.KeyValue {
+	var extra []utils.KeyValue
+	for _, kv := range sec.Items() {
+		if !slices.Contains(managed, kv.Key) {
+			extra = append(extra, kv)
+		}
+	}
+	return extra
+}
@@ -210,6 +210,31 @@ func TestServerFromSection(t *testing.T) {
 		}
 	})
 
+	t.Run("hooks are kept", func(t *testing.T) {
+		section := utils.NewSection("Interface")
+		section.Set("Address", "10.0.0.1/24")
+		section.Set("PrivateKey", "wDx8ruBJgk2ZmDwgHkZfnoaSdfCgXUb4MwJ87psOJGE=")
+		section.Set("ListenPort", "51820")
+		section.Add("PreUp", "sysctl -q -w net.ipv4.ip_forward=1")
+		section.Add("PreUp", "iptables -t nat -A POSTROUTING -s 10.0.0.0/24 -o eth0 -j MASQUERADE")
+		section.Add("PostDown", "iptables -t nat -D POSTROUTING -s 10.0.0.0/24 -o eth0 -j MASQUERADE")
+
+		server, err := ServerFromSection(section)
+		if err != nil {
+			t.Fatalf("failed to parse server: %v", err)
+		}
+
+		if len(server.preUp) != 2 {
+			t.Errorf("expected 2 PreUp hooks, got %d", len(server.preUp))
+		}
+		if len(server.postDown) != 1 {
+			t.Errorf("expected 1 PostDown hook, got %d", len(server.postDown))
+		}
+		if len(server.postUp) != 0 {
+			t.Errorf("expected no PostUp hook, got %d", len(server.postUp))
+		}
+	})
+
 	t.Run("dual stack addresses", func(t *testing.T) {
 		section := utils.NewSection("Interface")
 		section.Set("Address", "10.0.0.1/24, fd00::1/64")
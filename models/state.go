@@ -0,0 +1,385 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/asiffer/wg-easy-vpn/crypto"
+	"github.com/asiffer/wg-easy-vpn/utils"
+	"gopkg.in/yaml.v3"
+)
+
+// StateVersion is the version of the schema of the state files
+const StateVersion = 1
+
+// formats of the state files
+const (
+	StateJSON = "json"
+	StateYAML = "yaml"
+)
+
+// State is the structured state of a vpn (alternative to the metadata
+// embedded in the server file). The server file is rendered from it.
+type State struct {
+	Version          int            `json:"version" yaml:"version"`
+	Endpoint         string         `json:"endpoint" yaml:"endpoint"`
+	DNS              []string       `json:"dns,omitempty" yaml:"dns,omitempty"`
+	Networks         []string       `json:"networks" yaml:"networks"`
+	Routes           []string       `json:"routes,omitempty" yaml:"routes,omitempty"`
+	ExcludeRoutes    []string       `json:"exclude_routes,omitempty" yaml:"exclude_routes,omitempty"`
+	AdvertisedRoutes []string       `json:"advertised_routes,omitempty" yaml:"advertised_routes,omitempty"`
+	Options          WGOptions      `json:"options" yaml:"options"`
+	Server           StateServer    `json:"server" yaml:"server"`
+	Gateways         []StateGateway `json:"gateways,omitempty" yaml:"gateways,omitempty"`
+	Peers            []StatePeer    `json:"peers" yaml:"peers"`
+}
+
+// StateServer is the interface of a server
+type StateServer struct {
+	Address    []string         `json:"address" yaml:"address"`
+	PrivateKey string           `json:"private_key" yaml:"private_key"`
+	ListenPort uint16           `json:"listen_port" yaml:"listen_port"`
+	PreUp      []string         `json:"pre_up,omitempty" yaml:"pre_up,omitempty"`
+	PostUp     []string         `json:"post_up,omitempty" yaml:"post_up,omitempty"`
+	PostDown   []string         `json:"post_down,omitempty" yaml:"post_down,omitempty"`
+	Extra      []utils.KeyValue `json:"extra,omitempty" yaml:"extra,omitempty"`
+}
+
+// StateGateway is an additional server
+type StateGateway struct {
+	Name        string `json:"name" yaml:"name"`
+	Endpoint    string `json:"endpoint" yaml:"endpoint"`
+	StateServer `yaml:",inline"`
+}
+
+// StatePeer is a client of the vpn
+type StatePeer struct {
+	Name          string           `json:"name,omitempty" yaml:"name,omitempty"`
+	CreatedAt     time.Time        `json:"created_at,omitzero" yaml:"created_at,omitempty"`
+	Tags          []string         `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Options       WGOptions        `json:"options,omitzero" yaml:"options,omitempty"`
+	Gateway       string           `json:"gateway,omitempty" yaml:"gateway,omitempty"`
+	DNS           []string         `json:"dns,omitempty" yaml:"dns,omitempty"`
+	Routes        []string         `json:"routes,omitempty" yaml:"routes,omitempty"`
+	ExcludeRoutes []string         `json:"exclude_routes,omitempty" yaml:"exclude_routes,omitempty"`
+	Disabled      bool             `json:"disabled,omitempty" yaml:"disabled,omitempty"`
+	PublicKey     string           `json:"public_key" yaml:"public_key"`
+	PresharedKey  string           `json:"preshared_key,omitempty" yaml:"preshared_key,omitempty"`
+	AllowedIPs    []string         `json:"allowed_ips" yaml:"allowed_ips"`
+	Extra         []utils.KeyValue `json:"extra,omitempty" yaml:"extra,omitempty"`
+}
+
+// StateFormat returns the format of a state file from its extension
+func StateFormat(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return StateJSON, nil
+	case ".yaml", ".yml":
+		return StateYAML, nil
+	default:
+		return "", fmt.Errorf("unknown format of %s (expected .json, .yaml or .yml)", path)
+	}
+}
+
+// ReadState reads a state (unknown fields are rejected)
+func ReadState(r io.Reader, format string) (*State, error) {
+	state := &State{}
+	switch format {
+	case StateJSON:
+		decoder := json.NewDecoder(r)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(state); err != nil {
+			return nil, fmt.Errorf("error while decoding json state (%w)", err)
+		}
+	case StateYAML:
+		decoder := yaml.NewDecoder(r)
+		decoder.KnownFields(true)
+		if err := decoder.Decode(state); err != nil {
+			return nil, fmt.Errorf("error while decoding yaml state (%w)", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown format %q (expected %s or %s)", format, StateJSON, StateYAML)
+	}
+	switch {
+	case state.Version == 0:
+		return nil, fmt.Errorf("missing state version")
+	case state.Version > StateVersion:
+		return nil, fmt.Errorf("unsupported state version %d (expected %d or lower)", state.Version, StateVersion)
+	}
+	return state, nil
+}
+
+// ReadStateFile reads a state file (the format is given by the extension)
+func ReadStateFile(path string) (*State, error) {
+	format, err := StateFormat(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error while opening state file (%w)", err)
+	}
+	defer f.Close()
+	return ReadState(f, format)
+}
+
+// Write writes the state in the given format
+func (state *State) Write(w io.Writer, format string) error {
+	switch format {
+	case StateJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(state)
+	case StateYAML:
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(state); err != nil {
+			return err
+		}
+		return encoder.Close()
+	default:
+		return fmt.Errorf("unknown format %q (expected %s or %s)", format, StateJSON, StateYAML)
+	}
+}
+
+// Save writes the state file atomically (only readable by its owner, it
+// contains the private keys of the servers)
+func (state *State) Save(path string) error {
+	format, err := StateFormat(path)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := state.Write(&buf, format); err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(path, buf.Bytes(), 0600)
+}
+
+// Save writes the server file and the state file of the vpn, if any (all
+// atomically). The state is written first: it is the source of the
+// server file, which the next save renders again if writing it failed.
+// Without state file, the gateways are written to path+GatewaysSuffix
+// (only readable by its owner, it contains their private keys).
+func (vpn *WGVPN) Save(path string) error {
+	if vpn.statePath != "" {
+		if err := vpn.State().Save(vpn.statePath); err != nil {
+			return fmt.Errorf("error while saving state (%w)", err)
+		}
+	} else if vpn.gwPath != "" || vpn.hasGateways() {
+		if vpn.gwPath == "" {
+			vpn.gwPath = path + GatewaysSuffix
+		}
+		gateways := utils.NewFile()
+		vpn.PopulateGateways(gateways)
+		if err := gateways.Save(vpn.gwPath); err != nil {
+			return fmt.Errorf("error while saving gateways (%w)", err)
+		}
+	}
+	file := utils.NewFile()
+	vpn.Populate(file)
+	if err := file.Save(path); err != nil {
+		return fmt.Errorf("error while saving %s (%w)", path, err)
+	}
+	return nil
+}
+
+// State returns the structured state of the vpn
+func (vpn *WGVPN) State() *State {
+	state := &State{
+		Version:          StateVersion,
+		Endpoint:         vpn.endpoint,
+		DNS:              utils.StringifyIPs(vpn.dns),
+		Networks:         utils.StringifyNetworks(vpn.networks),
+		Routes:           utils.StringifyNetworks(vpn.routes),
+		ExcludeRoutes:    utils.StringifyNetworks(vpn.excludes),
+		AdvertisedRoutes: utils.StringifyNetworks(vpn.advertised),
+		Options:          vpn.options,
+		Server:           stateServer(vpn.server),
+		Gateways:         make([]StateGateway, 0, len(vpn.gateways)),
+		Peers:            make([]StatePeer, 0, len(vpn.peers)),
+	}
+	for _, gw := range vpn.gateways {
+		state.Gateways = append(state.Gateways, StateGateway{
+			Name:        gw.name,
+			Endpoint:    gw.endpoint,
+			StateServer: stateServer(&gw.WGServer),
+		})
+	}
+	for _, peer := range vpn.peers {
+		p := StatePeer{
+			Name:          peer.name,
+			CreatedAt:     peer.createdAt,
+			Tags:          peer.tags,
+			Options:       peer.options,
+			Gateway:       peer.gateway,
+			DNS:           utils.StringifyIPs(peer.dns),
+			Routes:        utils.StringifyNetworks(peer.routes),
+			ExcludeRoutes: utils.StringifyNetworks(peer.excludes),
+			Disabled:      peer.disabled,
+			PublicKey:     peer.Public(),
+			AllowedIPs:    utils.StringifyNetworks(peer.allowedIPs),
+			Extra:         peer.extra,
+		}
+		if peer.psk != nil {
+			p.PresharedKey = peer.PSK()
+		}
+		state.Peers = append(state.Peers, p)
+	}
+	return state
+}
+
+func stateServer(server *WGServer) StateServer {
+	return StateServer{
+		Address:    utils.StringifyNetworks(server.address),
+		PrivateKey: server.Private(),
+		ListenPort: server.port,
+		PreUp:      server.preUp,
+		PostUp:     server.postUp,
+		PostDown:   server.postDown,
+		Extra:      server.extra,
+	}
+}
+
+// VPNFromState creates a vpn from its structured state
+func VPNFromState(name string, state *State) (*WGVPN, error) {
+	vpn := &WGVPN{
+		name:     name,
+		endpoint: state.Endpoint,
+		options:  state.Options,
+		gateways: make([]*WGGateway, 0, len(state.Gateways)),
+		peers:    make([]*WGClientAsPeer, 0, len(state.Peers)),
+	}
+	var err error
+	if vpn.dns, err = utils.ParseIPList(state.DNS); err != nil {
+		return nil, fmt.Errorf("invalid dns (%w)", err)
+	}
+	if vpn.networks, err = parseAddresses(state.Networks); err != nil {
+		return nil, fmt.Errorf("invalid networks (%w)", err)
+	}
+	if vpn.routes, err = parseAddresses(state.Routes); err != nil {
+		return nil, fmt.Errorf("invalid routes (%w)", err)
+	}
+	if vpn.excludes, err = parseAddresses(state.ExcludeRoutes); err != nil {
+		return nil, fmt.Errorf("invalid exclude_routes (%w)", err)
+	}
+	if vpn.advertised, err = parseAddresses(state.AdvertisedRoutes); err != nil {
+		return nil, fmt.Errorf("invalid advertised_routes (%w)", err)
+	}
+	if err := vpn.options.Validate(); err != nil {
+		return nil, err
+	}
+	if vpn.server, err = serverFromState(state.Server); err != nil {
+		return nil, fmt.Errorf("invalid server (%w)", err)
+	}
+	for _, g := range state.Gateways {
+		server, err := serverFromState(g.StateServer)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gateway %s (%w)", g.Name, err)
+		}
+		vpn.gateways = append(vpn.gateways, &WGGateway{WGServer: *server, name: g.Name, endpoint: g.Endpoint})
+	}
+	for i, p := range state.Peers {
+		peer, err := peerFromState(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid peer %d (%w)", i+1, err)
+		}
+		if peer.gateway != "" && peer.gateway != AllGateways {
+			if _, err := vpn.Gateway(peer.gateway); err != nil {
+				return nil, fmt.Errorf("invalid peer %d (%w)", i+1, err)
+			}
+		}
+		vpn.peers = append(vpn.peers, peer)
+	}
+	return vpn, nil
+}
+
+func serverFromState(s StateServer) (*WGServer, error) {
+	address, err := parseAddresses(s.Address)
+	if err != nil {
+		return nil, err
+	}
+	private := crypto.NewKey()
+	if err := private.UpdateFromBase64(s.PrivateKey); err != nil {
+		return nil, fmt.Errorf("invalid private key (%w)", err)
+	}
+	return &WGServer{
+		WGNode: WGNode{
+			address:  address,
+			private:  private,
+			preUp:    s.PreUp,
+			postUp:   s.PostUp,
+			postDown: s.PostDown,
+		},
+		port:  s.ListenPort,
+		extra: s.Extra,
+	}, nil
+}
+
+func peerFromState(p StatePeer) (*WGClientAsPeer, error) {
+	public := crypto.NewKey()
+	if err := public.UpdateFromBase64(p.PublicKey); err != nil {
+		return nil, fmt.Errorf("invalid public key (%w)", err)
+	}
+	var psk crypto.PresharedKey
+	if p.PresharedKey != "" {
+		psk = crypto.NewPresharedKey()
+		if err := psk.UpdateFromBase64(p.PresharedKey); err != nil {
+			return nil, fmt.Errorf("invalid preshared key (%w)", err)
+		}
+	}
+	allowed, err := parseAddresses(p.AllowedIPs)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.Options.Validate(); err != nil {
+		return nil, err
+	}
+	dns, err := utils.ParseIPList(p.DNS)
+	if err != nil {
+		return nil, fmt.Errorf("invalid dns (%w)", err)
+	}
+	routes, err := parseAddresses(p.Routes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid routes (%w)", err)
+	}
+	excludes, err := parseAddresses(p.ExcludeRoutes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exclude_routes (%w)", err)
+	}
+	return &WGClientAsPeer{
+		WGPeer:    WGPeer{allowedIPs: allowed, public: public, psk: psk},
+		name:      p.Name,
+		createdAt: p.CreatedAt,
+		tags:      p.Tags,
+		options:   p.Options,
+		gateway:   p.Gateway,
+		dns:       dns,
+		routes:    routes,
+		excludes:  excludes,
+		disabled:  p.Disabled,
+		extra:     p.Extra,
+	}, nil
+}
+
+// parseAddresses parses networks like utils.Section.GetNetworks (the
+// address is kept: 10.0.0.1/24 is not 10.0.0.0/24)
+func parseAddresses(values []string) ([]net.IPNet, error) {
+	networks := make([]net.IPNet, 0, len(values))
+	for _, value := range values {
+		ip, network, err := net.ParseCIDR(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("error while parsing network %s", value)
+		}
+		network.IP = ip
+		networks = append(networks, *network)
+	}
+	return networks, nil
+}
@@ -0,0 +1,131 @@
+package models
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/asiffer/wg-easy-vpn/utils"
+)
+
+// newStateVPN is a vpn with a gateway, a tagged client and unmanaged keys
+func newStateVPN(t *testing.T) *WGVPN {
+	t.Helper()
+	vpn := newBulkVPN(t)
+	vpn.dns = []net.IP{net.ParseIP("1.1.1.1")}
+	vpn.SetOptions(WGOptions{Keepalive: 25, MTU: 1380})
+	vpn.server.extra = []utils.KeyValue{{Key: "SaveConfig", Value: "false"}}
+	if err := vpn.AddGateway(NewWGGateway("london", "london.example.com:51820", 51821)); err != nil {
+		t.Fatal(err)
+	}
+	client := NewWGClient(nil, false, nil, nil)
+	client.SetName("laptop")
+	client.SetTags([]string{"staff", "paris"})
+	if err := vpn.AddClient(client); err != nil {
+		t.Fatal(err)
+	}
+	phone := NewWGClient(nil, true, nil, nil)
+	phone.SetName("phone")
+	if err := vpn.AddClient(phone); err != nil {
+		t.Fatal(err)
+	}
+	vpn.peers[1].extra = []utils.KeyValue{{Key: "Endpoint", Value: "198.51.100.7:4242"}}
+	return vpn
+}
+
+func TestStateRoundTrip(t *testing.T) {
+	vpn := newStateVPN(t)
+	expected := utils.NewFile()
+	vpn.Populate(expected)
+
+	for _, format := range []string{StateJSON, StateYAML} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := vpn.State().Write(&buf, format); err != nil {
+				t.Fatalf("Write failed: %v", err)
+			}
+			state, err := ReadState(&buf, format)
+			if err != nil {
+				t.Fatalf("ReadState failed: %v", err)
+			}
+			loaded, err := VPNFromState("wg0", state)
+			if err != nil {
+				t.Fatalf("VPNFromState failed: %v", err)
+			}
+			file := utils.NewFile()
+			loaded.Populate(file)
+			if file.String() != expected.String() {
+				t.Errorf("expected:\n%s\ngot:\n%s", expected.String(), file.String())
+			}
+
+			laptop := loaded.Peers()[0]
+			if strings.Join(laptop.Tags(), ",") != "staff,paris" {
+				t.Errorf("unexpected tags %v", laptop.Tags())
+			}
+			if !laptop.CreatedAt().Equal(vpn.Peers()[0].CreatedAt()) || laptop.CreatedAt().IsZero() {
+				t.Errorf("unexpected creation date %v", laptop.CreatedAt())
+			}
+		})
+	}
+}
+
+func TestReadStateInvalid(t *testing.T) {
+	tests := map[string]string{
+		"missing version": `{"endpoint": "vpn.example.com"}`,
+		"future version":  `{"version": 99}`,
+		"unknown field":   `{"version": 1, "name": "wg0"}`,
+		"not json":        `version: 1`,
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ReadState(strings.NewReader(content), StateJSON); err == nil {
+				t.Errorf("an error was expected")
+			}
+		})
+	}
+
+	state := newStateVPN(t).State()
+	state.Peers[0].PublicKey = "not a key"
+	if _, err := VPNFromState("wg0", state); err == nil {
+		t.Errorf("an error was expected with an invalid public key")
+	}
+}
+
+func TestVPNFromFileWithState(t *testing.T) {
+	vpn := newStateVPN(t)
+	statePath := filepath.Join(t.TempDir(), "wg0.wg-easy.yaml")
+	if err := vpn.State().Save(statePath); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if info, err := os.Stat(statePath); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("the state file must only be readable by its owner (%v)", err)
+	}
+	vpn.SetStatePath(statePath)
+
+	file := utils.NewFile()
+	vpn.Populate(file)
+	def, _ := file.GetSection(utils.DEFAULT_SECTION)
+	if path, _ := def.Get("State"); path != statePath {
+		t.Errorf("expected the state path in the server file, got %q", path)
+	}
+	if def.HasKey("Network") || def.HasKey("Endpoint") {
+		t.Errorf("the metadata must only be in the state file:\n%s", file.String())
+	}
+	if _, err := file.GetSection("Gateway"); err == nil {
+		t.Errorf("the gateways must only be in the state file:\n%s", file.String())
+	}
+
+	loaded, err := VPNFromFile("wg0", file)
+	if err != nil {
+		t.Fatalf("VPNFromFile failed: %v", err)
+	}
+	if loaded.StatePath() != statePath {
+		t.Errorf("expected state path %s, got %s", statePath, loaded.StatePath())
+	}
+	if loaded.NumberOfPeers() != 2 || len(loaded.Servers()) != 2 || loaded.Endpoint() != "vpn.example.com:51820" {
+		t.Errorf("unexpected vpn loaded from the state")
+	}
+}
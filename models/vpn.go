@@ -8,24 +8,42 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/asiffer/wg-easy-vpn/crypto"
 	"github.com/asiffer/wg-easy-vpn/utils"
 	"github.com/rs/zerolog"
 )
 
-// WGVPN denotes a Wireguard VPN (one server and several clients)
+// WGVPN denotes a Wireguard VPN (one server and several clients). Additional
+// gateways may share the clients of the main server
 type WGVPN struct {
-	name     string            // name of the connection
-	server   *WGServer         // server
-	peers    []*WGClientAsPeer // clients
-	dns      []net.IP          // common config
-	endpoint string            // common config
-	networks []net.IPNet       // common config
-	routes   []net.IPNet       // common config
+	name       string            // name of the connection
+	server     *WGServer         // server
+	gateways   []*WGGateway      // additional servers
+	peers      []*WGClientAsPeer // clients
+	dns        []net.IP          // common config
+	endpoint   string            // common config
+	networks   []net.IPNet       // common config
+	routes     []net.IPNet       // common config
+	excludes   []net.IPNet       // common config (routes excluded from the tunnel)
+	advertised []net.IPNet       // client subnets pushed to the other clients
+	options    WGOptions         // common config (client defaults)
+	statePath  string            // structured state file (empty = metadata in the server file)
+	gwPath     string            // gateways file (empty = none yet, see Save)
 }
 
+// AllGateways is the gateway of the clients which connect to every server
+const AllGateways = "*"
+
+// GatewaysSuffix is appended to the path of the server file to name the
+// file of the gateways (their private keys and the clients which are not
+// peers of the main server are kept out of the server file)
+const GatewaysSuffix = ".gateways"
+
 func NewWGVPN(name string, server *WGServer, endpoint string, networks []net.IPNet, dns []net.IP, routes []net.IPNet) (*WGVPN, error) {
 	vpn := &WGVPN{
 		name:     name,
@@ -46,7 +64,48 @@ func NewWGVPN(name string, server *WGServer, endpoint string, networks []net.IPN
 	return vpn, nil
 }
 
+// VPNFromFile reads a vpn from its server file. When the DEFAULT section
+// only references a state file (State key), the vpn is read from it.
 func VPNFromFile(name string, cfg *utils.File) (*WGVPN, error) {
+	version, err := LayoutVersion(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if version > ConfigVersion {
+		return nil, fmt.Errorf("unsupported config version %d (expected %d or lower)", version, ConfigVersion)
+	}
+	if def, err := cfg.GetSection(utils.DEFAULT_SECTION); err == nil && def.HasKey("State") {
+		path, _ := def.Get("State")
+		state, err := ReadStateFile(path)
+		if err != nil {
+			return nil, err
+		}
+		vpn, err := VPNFromState(name, state)
+		if err != nil {
+			return nil, fmt.Errorf("error while reading state %s (%w)", path, err)
+		}
+		vpn.statePath = path
+		return vpn, nil
+	}
+	if def, err := cfg.GetSection(utils.DEFAULT_SECTION); err == nil && def.HasKey("Gateways") {
+		path, _ := def.Get("Gateways")
+		gateways, err := utils.ParseFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error while reading gateways %s (%w)", path, err)
+		}
+		vpn, err := vpnFromSections(name, slices.Concat(cfg.Sections(), gateways.Sections()))
+		if err != nil {
+			return nil, err
+		}
+		vpn.gwPath = path
+		return vpn, nil
+	}
+	return vpnFromSections(name, cfg.Sections())
+}
+
+// vpnFromSections reads a vpn from the sections of the server file (and
+// of the gateways file)
+func vpnFromSections(name string, sections []*utils.Section) (*WGVPN, error) {
 	// Read server/node
 	vpn := WGVPN{
 		name:   name,
@@ -54,7 +113,7 @@ func VPNFromFile(name string, cfg *utils.File) (*WGVPN, error) {
 		peers:  make([]*WGClientAsPeer, 0),
 	}
 
-	for _, sec := range cfg.Sections() {
+	for _, sec := range sections {
 		switch sec.Name() {
 		case "Interface":
 			server, err := ServerFromSection(sec)
@@ -62,6 +121,12 @@ func VPNFromFile(name string, cfg *utils.File) (*WGVPN, error) {
 				return nil, err
 			}
 			vpn.server = server
+		case "Gateway":
+			gw, err := GatewayFromSection(sec)
+			if err != nil {
+				return nil, err
+			}
+			vpn.gateways = append(vpn.gateways, gw)
 		case "Peer":
 			peer, err := PeerFromSection(sec)
 			if err != nil {
@@ -94,11 +159,33 @@ func VPNFromFile(name string, cfg *utils.File) (*WGVPN, error) {
 			if err == nil {
 				vpn.routes = routes
 			}
+			excludes, err := sec.GetNetworks("ExcludeRoutes")
+			if err == nil {
+				vpn.excludes = excludes
+			}
+			advertised, err := sec.GetNetworks("AdvertisedRoutes")
+			if err == nil {
+				vpn.advertised = advertised
+			}
+			options, err := OptionsFromSection(sec)
+			if err != nil {
+				return nil, err
+			}
+			vpn.options = options
 		default:
 			// non-blocking
 		}
 	}
 
+	// the peer sections of the gateways are generated (they are not clients)
+	clients := make([]*WGClientAsPeer, 0, len(vpn.peers))
+	for _, peer := range vpn.peers {
+		if !vpn.isGatewayKey(peer.Public()) {
+			clients = append(clients, peer)
+		}
+	}
+	vpn.peers = clients
+
 	return &vpn, nil
 }
 
@@ -107,33 +194,217 @@ func (vpn *WGVPN) NumberOfPeers() int {
 	return len(vpn.peers)
 }
 
-// RemovePeer does what it says
+// Server returns the main server of the vpn
+func (vpn *WGVPN) Server() *WGServer {
+	return vpn.server
+}
+
+// Endpoint returns the public endpoint of the main server
+func (vpn *WGVPN) Endpoint() string {
+	return vpn.endpoint
+}
+
+// DNS returns the dns servers of the clients (unless customized)
+func (vpn *WGVPN) DNS() []net.IP {
+	return vpn.dns
+}
+
+// Peers returns the clients of the vpn
+func (vpn *WGVPN) Peers() []*WGClientAsPeer {
+	return vpn.peers
+}
+
+// RemovePeer does what it says (the subnets it advertised
+// are withdrawn)
 func (vpn *WGVPN) RemovePeer(k crypto.Key) error {
 	for i, p := range vpn.peers {
 		if k.Base64() == p.Public() {
 			vpn.peers = append(vpn.peers[:i], vpn.peers[i+1:]...)
+			advertised := make([]net.IPNet, 0, len(vpn.advertised))
+			for _, subnet := range vpn.advertised {
+				if utils.FindNetwork(subnet, p.allowedIPs) < 0 {
+					advertised = append(advertised, subnet)
+				}
+			}
+			vpn.advertised = advertised
 			return nil
 		}
 	}
 	return fmt.Errorf("this peer (%s) is not in the VPN", k.Base64())
 }
 
+// Client returns the client with the given name as it was added. The
+// server does not keep the private keys of the clients: its config has
+// no PrivateKey (see ReissueClient).
+func (vpn *WGVPN) Client(name string) (*WGClient, error) {
+	for _, p := range vpn.peers {
+		if p.name == name {
+			return vpn.clientOf(p), nil
+		}
+	}
+	return nil, fmt.Errorf("this client (%s) is not in the VPN", name)
+}
+
+// ReissueClient generates new keys (and a new preshared key if it had
+// one) for the client with the given name and returns it. Its addresses,
+// settings, gateway and unmanaged keys are kept.
+func (vpn *WGVPN) ReissueClient(name string) (*WGClient, error) {
+	for i, p := range vpn.peers {
+		if p.name != name {
+			continue
+		}
+		client := vpn.clientOf(p)
+		client.WGNode = *NewWGNode(client.address, p.psk == nil)
+		peer := client.ToPeer()
+		peer.createdAt = p.createdAt
+		peer.disabled = p.disabled
+		peer.extra = p.extra
+		vpn.peers[i] = peer
+		return client, nil
+	}
+	return nil, fmt.Errorf("this client (%s) is not in the VPN", name)
+}
+
+// clientOf rebuilds a client from its peer (without private key)
+func (vpn *WGVPN) clientOf(p *WGClientAsPeer) *WGClient {
+	addresses := make([]net.IPNet, 0, len(p.allowedIPs))
+	subnets := make([]net.IPNet, 0)
+	for _, n := range p.allowedIPs {
+		if network, ok := networkOf(vpn.networks, n.IP); ok {
+			addresses = append(addresses, net.IPNet{IP: n.IP, Mask: network.Mask})
+		} else {
+			subnets = append(subnets, n)
+		}
+	}
+	client := NewWGClient(addresses, p.psk == nil, p.dns, p.routes)
+	client.SetPublicKey(p.public)
+	client.psk = p.psk
+	client.SetName(p.name)
+	client.SetSubnets(subnets)
+	client.SetExcludedRoutes(p.excludes)
+	client.SetOptions(p.options)
+	client.SetGateway(p.gateway)
+	client.SetTags(p.tags)
+	return client
+}
+
 // PopulateServer write the vpn config into a file (server conf only)
 func (vpn *WGVPN) PopulateServer(f *utils.File) {
 	section := f.AddSection("Interface")
 	vpn.server.Populate(section)
 
+	// the other gateways
+	for _, gw := range vpn.gateways {
+		section = f.AddSection("Peer")
+		section.AddComment(gw.name)
+		vpn.Relay(gw).Populate(section)
+	}
+
+	for _, peer := range vpn.PeersOf(vpn.name) {
+		section = f.AddSection("Peer")
+		peer.Populate(section)
+	}
+}
+
+// PopulateGateways writes the gateways and the clients which do not
+// connect to the main server (or which are disabled) into a file (see
+// GatewaysSuffix)
+func (vpn *WGVPN) PopulateGateways(f *utils.File) {
+	def := f.GetorCreateSection(utils.DEFAULT_SECTION)
+	def.AddComment("The gateways of " + vpn.name + " (generated by wg-easy-vpn)")
+	for _, gw := range vpn.gateways {
+		gw.Populate(f.AddSection("Gateway"))
+	}
+	for _, peer := range vpn.peers {
+		if peer.disabled || (vpn.serverOf(peer) != vpn.name && peer.gateway != AllGateways) {
+			peer.Populate(f.AddSection("Peer"))
+		}
+	}
+}
+
+// serverOf returns the name of the server a client connects to
+// (AllGateways when it connects to every server)
+func (vpn *WGVPN) serverOf(peer *WGClientAsPeer) string {
+	if peer.gateway == "" {
+		return vpn.name
+	}
+	return peer.gateway
+}
+
+// PeersOf returns the enabled clients which connect to the given server
+// (the main server is named after the vpn)
+func (vpn *WGVPN) PeersOf(server string) []*WGClientAsPeer {
+	peers := make([]*WGClientAsPeer, 0, len(vpn.peers))
+	for _, peer := range vpn.peers {
+		if peer.disabled {
+			continue
+		}
+		if gw := vpn.serverOf(peer); gw == server || gw == AllGateways {
+			peers = append(peers, peer)
+		}
+	}
+	return peers
+}
+
+// Relay turns a server into a peer of the other servers: its addresses
+// and the ones of the clients which only connect to it are routed
+// through it
+func (vpn *WGVPN) Relay(gw *WGGateway) *WGServerAsPeer {
+	relay := gw.ToRelay()
 	for _, peer := range vpn.peers {
+		if !peer.disabled && vpn.serverOf(peer) == gw.name {
+			relay.allowedIPs = append(relay.allowedIPs, peer.allowedIPs...)
+		}
+	}
+	return relay
+}
+
+// PopulateGateway writes the config of a gateway into a file: the other
+// gateways (including the main server) and the clients which connect to
+// it are its peers
+func (vpn *WGVPN) PopulateGateway(name string, f *utils.File) error {
+	gw, err := vpn.Gateway(name)
+	if err != nil {
+		return err
+	}
+	def := f.GetorCreateSection(utils.DEFAULT_SECTION)
+	def.AddComment(gw.name)
+
+	section := f.AddSection("Interface")
+	gw.WGServer.Populate(section)
+
+	for _, other := range vpn.Servers() {
+		if other.name == gw.name {
+			continue
+		}
+		section = f.AddSection("Peer")
+		section.AddComment(other.name)
+		vpn.Relay(other).Populate(section)
+	}
+
+	for _, peer := range vpn.PeersOf(gw.name) {
 		section = f.AddSection("Peer")
 		peer.Populate(section)
 	}
+	return nil
 }
 
-// Populate writes the full vpn config into a file
+// Populate writes the full vpn config into a file. With a state file,
+// the metadata are replaced by a reference to it. The gateways are
+// referenced too once they have their own file (see Save).
 func (vpn *WGVPN) Populate(f *utils.File) {
 	def := f.GetorCreateSection(utils.DEFAULT_SECTION)
+	if vpn.statePath != "" {
+		def.AddComment("The state of the vpn is stored in " + vpn.statePath)
+		def.AddComment("This file is rendered from it by wg-easy-vpn")
+		def.Set("Version", strconv.Itoa(ConfigVersion))
+		def.Set("State", vpn.statePath)
+		vpn.PopulateServer(f)
+		return
+	}
 	def.AddComment("The top-level config is generated by wg-easy-vpn")
 	def.AddComment("It is ignored by wireguard (wg, wg-quick, etc.)")
+	def.Set("Version", strconv.Itoa(ConfigVersion))
 	// def.Set("Name", vpn.name)
 	def.Set("Endpoint", vpn.endpoint)
 	if len(vpn.dns) > 0 {
@@ -145,9 +416,142 @@ func (vpn *WGVPN) Populate(f *utils.File) {
 	if len(vpn.routes) > 0 {
 		def.Set("Routes", strings.Join(utils.StringifyNetworks(vpn.routes), ","))
 	}
+	if len(vpn.excludes) > 0 {
+		def.Set("ExcludeRoutes", strings.Join(utils.StringifyNetworks(vpn.excludes), ","))
+	}
+	if len(vpn.advertised) > 0 {
+		def.Set("AdvertisedRoutes", strings.Join(utils.StringifyNetworks(vpn.advertised), ","))
+	}
+	vpn.options.Populate(def)
+	if vpn.gwPath != "" {
+		def.Set("Gateways", vpn.gwPath)
+	}
 
 	// now fills with the server info
 	vpn.PopulateServer(f)
+
+	if vpn.gwPath == "" && vpn.hasGateways() {
+		// not saved yet: in the same file
+		vpn.PopulateGateways(f)
+	}
+}
+
+// hasGateways returns whether the vpn has gateways or clients which are
+// not peers of the main server (other gateway or disabled)
+func (vpn *WGVPN) hasGateways() bool {
+	return len(vpn.gateways) > 0 || len(vpn.PeersOf(vpn.name)) < len(vpn.peers)
+}
+
+// StatePath returns the path of the state file (empty when the metadata
+// are stored in the server file)
+func (vpn *WGVPN) StatePath() string {
+	return vpn.statePath
+}
+
+// GatewaysPath returns the path of the gateways file (empty when the vpn
+// has never been saved with gateways)
+func (vpn *WGVPN) GatewaysPath() string {
+	return vpn.gwPath
+}
+
+// SetStatePath stores the vpn state into the given file (json or yaml)
+// instead of the server file
+func (vpn *WGVPN) SetStatePath(path string) {
+	vpn.statePath = path
+}
+
+// SetExcludedRoutes sets the networks removed from the routes
+// tunneled by every client (split tunnelling)
+func (vpn *WGVPN) SetExcludedRoutes(excludes []net.IPNet) {
+	vpn.excludes = excludes
+}
+
+// SetOptions sets the default options of the client configs
+func (vpn *WGVPN) SetOptions(options WGOptions) {
+	vpn.options = options
+}
+
+// Networks returns the networks the addresses are picked up from
+func (vpn *WGVPN) Networks() []net.IPNet {
+	return vpn.networks
+}
+
+// Advertise pushes client subnets to the routes of the other
+// clients (site-to-site)
+func (vpn *WGVPN) Advertise(subnets []net.IPNet) {
+	for _, subnet := range subnets {
+		if utils.FindNetwork(subnet, vpn.advertised) < 0 {
+			vpn.advertised = append(vpn.advertised, subnet)
+		}
+	}
+}
+
+// Servers returns all the servers of the vpn: the main server (named
+// after the vpn) first, then the additional gateways
+func (vpn *WGVPN) Servers() []*WGGateway {
+	main := &WGGateway{
+		WGServer: *vpn.server,
+		name:     vpn.name,
+		endpoint: vpn.endpoint,
+	}
+	return append([]*WGGateway{main}, vpn.gateways...)
+}
+
+// Gateway returns a server given its name (the main server is
+// named after the vpn)
+func (vpn *WGVPN) Gateway(name string) (*WGGateway, error) {
+	for _, gw := range vpn.Servers() {
+		if gw.name == name {
+			return gw, nil
+		}
+	}
+	return nil, fmt.Errorf("this gateway (%s) is not in the VPN", name)
+}
+
+// AddGateway provides addresses to a new gateway and appends it
+// to the vpn
+func (vpn *WGVPN) AddGateway(gw *WGGateway) error {
+	if gw.name == "" || gw.name == AllGateways {
+		return fmt.Errorf("a gateway must have a name")
+	}
+	if _, err := vpn.Gateway(gw.name); err == nil {
+		return fmt.Errorf("a gateway named %s already exists in the VPN", gw.name)
+	}
+	ips, err := vpn.ProvideNetworks()
+	if err != nil {
+		return err
+	}
+	gw.address = ips
+	vpn.gateways = append(vpn.gateways, gw)
+	return nil
+}
+
+// RemoveGateway removes an additional gateway (the main server
+// cannot be removed)
+func (vpn *WGVPN) RemoveGateway(name string) error {
+	for _, peer := range vpn.peers {
+		if peer.gateway == name {
+			return fmt.Errorf("this gateway (%s) is used by the client %s", name, peer.name)
+		}
+	}
+	for i, gw := range vpn.gateways {
+		if gw.name == name {
+			vpn.gateways = append(vpn.gateways[:i], vpn.gateways[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("this gateway (%s) is not in the VPN", name)
+}
+
+// isGatewayKey checks whether the public key belongs to an
+// additional gateway
+func (vpn *WGVPN) isGatewayKey(public string) bool {
+	for _, gw := range vpn.gateways {
+		if gw.private.Public().Base64() == public {
+			return true
+		}
+	}
+	return false
 }
 
 // PeerPublicKeys returns a list of the public keys of the clients
@@ -167,6 +571,12 @@ func (vpn *WGVPN) ReservedIPs() []net.IP {
 	for _, n := range vpn.server.address {
 		reserved = append(reserved, utils.CopyIP(n.IP))
 	}
+	// loop over the gateways addresses
+	for _, gw := range vpn.gateways {
+		for _, n := range gw.address {
+			reserved = append(reserved, utils.CopyIP(n.IP))
+		}
+	}
 	// loop over the clients addresses
 	for _, client := range vpn.peers {
 		for _, n := range client.allowedIPs {
@@ -180,95 +590,144 @@ func (vpn *WGVPN) ReservedIPs() []net.IP {
 // for example). It ensures that there is no overlap. An error
 // is raised whan no ip are available
 func (vpn *WGVPN) ProvideNetworks() ([]net.IPNet, error) {
-	reserved := vpn.ReservedIPs()
+	return provideNetworks(vpn.networks, vpn.ReservedIPs())
+}
+
+// provideNetworks picks up the first free address (not in reserved)
+// of every network. An error is raised when a network is exhausted.
+func provideNetworks(networks []net.IPNet, reserved []net.IP) ([]net.IPNet, error) {
 	out := make([]net.IPNet, 0)
 	// loop over the networks
-	for _, n := range vpn.networks {
-		// create a context with cancel for early termination
-		ctx, cancel := context.WithCancel(context.Background())
-		defer cancel()
-
-		// loop over the addresses within each network
-		for ip := range utils.Iterate(ctx, &n) {
-			// check if the ip is reserved
-			// and if it is a special address
-			special := ip.IsMulticast() || ip.IsUnspecified()
-			if !special && utils.FindIP(ip, reserved) < 0 {
-				// fmt.Println("IP:", ip)
-				out = append(out, net.IPNet{
-					IP:   ip,
-					Mask: n.Mask,
-				})
-
-				// cancel the context to stop iteration
-				cancel()
-				break
-			}
+	for _, n := range networks {
+		ip := nextFree(n, reserved)
+		if ip == nil {
+			return nil, fmt.Errorf("%w: no address left in %s", ErrPoolExhausted, n.String())
 		}
+		out = append(out, net.IPNet{
+			IP:   ip,
+			Mask: n.Mask,
+		})
 	}
 	return out, nil
 }
 
-// type addClientOptions struct {
-// 	noPSK  bool
-// 	dns    []net.IP
-// 	routes []net.IPNet
-// }
-
-// type AddClientOption func(*addClientOptions)
-
-// func WithoutPSK() AddClientOption {
-// 	return func(options *addClientOptions) {
-// 		options.noPSK = true
-// 	}
-// }
-
-// func WithDNS(dns []net.IP) AddClientOption {
-// 	return func(options *addClientOptions) {
-// 		options.dns = dns
-// 	}
-// }
-
-// func WithRoutes(routes []net.IPNet) AddClientOption {
-// 	return func(options *addClientOptions) {
-// 		options.routes = routes
-// 	}
-// }
-
-// func (vpn *WGVPN) AddClient(options ...AddClientOption) (*WGClient, error) {
-// 	ips, err := vpn.ProvideNetworks()
-// 	if err != nil {
-// 		return nil, err
-// 	}
-
-// 	opts := &addClientOptions{
-// 		noPSK:  false,
-// 		dns:    vpn.dns,
-// 		routes: vpn.routes,
-// 	}
-// 	for _, o := range options {
-// 		o(opts)
-// 	}
-
-// 	client := NewWGClient(ips, opts.noPSK, opts.dns)
-// 	peer := client.ToPeer()
-// 	vpn.peers = append(vpn.peers, peer)
-// 	return client, nil
-// }
+// nextFree returns the first free address (not in reserved) of the
+// network (nil if it is exhausted)
+func nextFree(n net.IPNet, reserved []net.IP) net.IP {
+	// create a context with cancel for early termination
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// loop over the addresses within the network
+	for ip := range utils.Iterate(ctx, &n) {
+		// check if the ip is reserved
+		// and if it is a special address
+		special := ip.IsMulticast() || ip.IsUnspecified()
+		if !special && utils.FindIP(ip, reserved) < 0 {
+			return ip
+		}
+	}
+	return nil
+}
+
+// checkSubnets ensures that the subnets routed behind a client do not
+// overlap the vpn networks nor the addresses of the other peers
+func (vpn *WGVPN) checkSubnets(subnets []net.IPNet) error {
+	for _, subnet := range subnets {
+		for _, n := range vpn.networks {
+			if utils.NetworksOverlap(subnet, n) {
+				return fmt.Errorf("subnet %s overlaps the vpn network %s", subnet.String(), n.String())
+			}
+		}
+		for _, peer := range vpn.peers {
+			for _, n := range peer.allowedIPs {
+				if utils.NetworksOverlap(subnet, n) {
+					return fmt.Errorf("subnet %s overlaps %s (peer %s)", subnet.String(), n.String(), peer.Public())
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// checkPublicKey ensures that a public key is not already used by a peer
+// or a server of the vpn
+func (vpn *WGVPN) checkPublicKey(public crypto.Key) error {
+	b64 := public.Base64()
+	if slices.Contains(vpn.PeerPublicKeys(), b64) {
+		return fmt.Errorf("public key %s is already used by a peer", b64)
+	}
+	for _, gw := range vpn.Servers() {
+		if gw.private.Public().Base64() == b64 {
+			return fmt.Errorf("public key %s is the one of the server %s", b64, gw.name)
+		}
+	}
+	return nil
+}
 
+// withStaticIP replaces the provided address of the network containing ip
+func (vpn *WGVPN) withStaticIP(ips []net.IPNet, ip net.IP) ([]net.IPNet, error) {
+	network, ok := networkOf(vpn.networks, ip)
+	if !ok {
+		return nil, fmt.Errorf("address %s is outside of the vpn networks", ip.String())
+	}
+	if ip.Equal(network.IP.Mask(network.Mask)) || ip.IsMulticast() {
+		return nil, fmt.Errorf("address %s cannot be assigned", ip.String())
+	}
+	if utils.FindIP(ip, vpn.ReservedIPs()) >= 0 {
+		return nil, fmt.Errorf("address %s is already used", ip.String())
+	}
+	static := net.IPNet{IP: ip, Mask: network.Mask}
+	for i, n := range ips {
+		if network.Contains(n.IP) {
+			ips[i] = static
+			return ips, nil
+		}
+	}
+	return append(ips, static), nil
+}
+
+// AddClient assigns addresses to the client (the first free ones unless
+// it has a static address) and appends it to the peers
 func (vpn *WGVPN) AddClient(client *WGClient) error {
+	if client.gateway == vpn.name {
+		client.gateway = ""
+	}
+	if client.gateway != "" && client.gateway != AllGateways {
+		if _, err := vpn.Gateway(client.gateway); err != nil {
+			return err
+		}
+	}
+	if err := vpn.checkSubnets(client.subnets); err != nil {
+		return err
+	}
+	if client.private == nil {
+		if err := vpn.checkPublicKey(client.public); err != nil {
+			return err
+		}
+	}
 	ips, err := vpn.ProvideNetworks()
 	if err != nil {
 		return err
 	}
+	if client.static != nil {
+		if ips, err = vpn.withStaticIP(ips, client.static); err != nil {
+			return err
+		}
+	}
 	// assign provided ips to the client
 	client.address = ips
 	peer := client.ToPeer()
+	peer.createdAt = time.Now().UTC().Truncate(time.Second)
 	vpn.peers = append(vpn.peers, peer)
 	return nil
 }
 
 func (vpn *WGVPN) Log(event *zerolog.Event) *zerolog.Event {
+	gateways := make([]string, len(vpn.gateways))
+	for i, gw := range vpn.gateways {
+		gateways[i] = gw.name
+	}
 	return event.
 		Str("name", vpn.name).
 		Str("endpoint", vpn.endpoint).
@@ -276,7 +735,12 @@ func (vpn *WGVPN) Log(event *zerolog.Event) *zerolog.Event {
 		Uint16("port", vpn.server.port).
 		Strs("networks", utils.StringifyNetworks(vpn.networks)).
 		Strs("routes", utils.StringifyNetworks(vpn.routes)).
+		Strs("exclude_routes", utils.StringifyNetworks(vpn.excludes)).
+		Strs("advertised_routes", utils.StringifyNetworks(vpn.advertised)).
 		Strs("dns", utils.StringifyIPs(vpn.dns)).
+		Strs("gateways", gateways).
+		Uint16("keepalive", vpn.options.Keepalive).
+		Uint16("mtu", vpn.options.MTU).
 		Int("peers", vpn.NumberOfPeers())
 
 }
@@ -2,6 +2,7 @@ package models
 
 import (
 	"net"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -264,6 +265,94 @@ func TestWGVPNAddClient(t *testing.T) {
 			t.Errorf("expected client IP '10.0.0.3', got '%s'", client.address[0].IP.String())
 		}
 	})
+
+	t.Run("add client routing a subnet", func(t *testing.T) {
+		client := NewWGClient(nil, true, nil, nil)
+		client.SetSubnets([]net.IPNet{{IP: net.ParseIP("192.168.50.0"), Mask: net.CIDRMask(24, 32)}})
+		err := vpn.AddClient(client)
+		if err != nil {
+			t.Fatalf("failed to add client: %v", err)
+		}
+
+		peer := vpn.peers[len(vpn.peers)-1]
+		if peer.AllowedIPs() != "10.0.0.4/32, 192.168.50.0/24" {
+			t.Errorf("expected AllowedIPs '10.0.0.4/32, 192.168.50.0/24', got '%s'", peer.AllowedIPs())
+		}
+	})
+
+	t.Run("reject overlapping subnets", func(t *testing.T) {
+		for _, subnet := range []string{"192.168.50.128/25", "10.0.0.0/16"} {
+			_, n, _ := net.ParseCIDR(subnet)
+			client := NewWGClient(nil, true, nil, nil)
+			client.SetSubnets([]net.IPNet{*n})
+			if err := vpn.AddClient(client); err == nil {
+				t.Errorf("expected error for overlapping subnet %s", subnet)
+			}
+		}
+		if vpn.NumberOfPeers() != 3 {
+			t.Errorf("expected 3 peers, got %d", vpn.NumberOfPeers())
+		}
+	})
+}
+
+func TestWGVPNAdvertise(t *testing.T) {
+	server := NewWGServer(nil, true, 51820)
+	networks := []net.IPNet{{IP: net.ParseIP("10.0.0.0"), Mask: net.CIDRMask(24, 32)}}
+	routes := []net.IPNet{{IP: net.ParseIP("10.0.0.0"), Mask: net.CIDRMask(24, 32)}}
+	vpn, _ := NewWGVPN("test", server, "vpn.example.com:51820", networks, nil, routes)
+
+	subnets := []net.IPNet{{IP: net.ParseIP("192.168.50.0"), Mask: net.CIDRMask(24, 32)}}
+	branch := NewWGClient(nil, true, nil, nil)
+	branch.SetSubnets(subnets)
+	if err := vpn.AddClient(branch); err != nil {
+		t.Fatalf("failed to add client: %v", err)
+	}
+	vpn.Advertise(subnets)
+	vpn.Advertise(subnets)
+	if len(vpn.advertised) != 1 {
+		t.Fatalf("expected 1 advertised subnet, got %d", len(vpn.advertised))
+	}
+
+	t.Run("other clients route the subnet", func(t *testing.T) {
+		client := NewWGClient(nil, true, nil, nil)
+		vpn.AddClient(client)
+		file := utils.NewFile()
+		client.PopulateClient(file, vpn)
+		allowedIPs, _ := file.Sections()[1].Get("AllowedIPs")
+		if allowedIPs != "10.0.0.0/24, 192.168.50.0/24" {
+			t.Errorf("expected AllowedIPs '10.0.0.0/24, 192.168.50.0/24', got '%s'", allowedIPs)
+		}
+	})
+
+	t.Run("the router does not route its own subnet", func(t *testing.T) {
+		file := utils.NewFile()
+		branch.PopulateClient(file, vpn)
+		allowedIPs, _ := file.Sections()[1].Get("AllowedIPs")
+		if allowedIPs != "10.0.0.0/24" {
+			t.Errorf("expected AllowedIPs '10.0.0.0/24', got '%s'", allowedIPs)
+		}
+	})
+
+	t.Run("persisted in the DEFAULT section", func(t *testing.T) {
+		file := utils.NewFile()
+		vpn.Populate(file)
+		parsed, err := VPNFromFile("test", file)
+		if err != nil {
+			t.Fatalf("failed to parse VPN: %v", err)
+		}
+		if len(parsed.advertised) != 1 || parsed.advertised[0].String() != "192.168.50.0/24" {
+			t.Errorf("expected advertised subnet 192.168.50.0/24, got %v", parsed.advertised)
+		}
+	})
+
+	t.Run("removing the router withdraws the subnet", func(t *testing.T) {
+		if err := vpn.RemovePeer(branch.private.Public()); err != nil {
+			t.Fatalf("failed to remove peer: %v", err)
+		}
+		if len(vpn.advertised) != 0 {
+			t.Errorf("expected no advertised subnet, got %v", vpn.advertised)
+		}
+	})
 }
 
 func TestWGVPNPeerPublicKeys(t *testing.T) {
@@ -387,6 +476,7 @@ func TestVPNFromFile(t *testing.T) {
 		def.Set("DNS", "1.1.1.1,8.8.8.8")
 		def.Set("Network", "10.0.0.0/24")
 		def.Set("Routes", "0.0.0.0/0")
+		def.Set("ExcludeRoutes", "192.168.0.0/16,10.0.0.0/8")
 
 		// Add Interface section
 		iface := file.AddSection("Interface")
@@ -419,6 +509,9 @@ func TestVPNFromFile(t *testing.T) {
 		if len(vpn.routes) != 1 {
 			t.Errorf("expected 1 route, got %d", len(vpn.routes))
 		}
+		if len(vpn.excludes) != 2 {
+			t.Errorf("expected 2 excluded routes, got %d", len(vpn.excludes))
+		}
 		if vpn.server == nil {
 			t.Fatal("expected server to be parsed")
 		}
@@ -532,3 +625,127 @@ func TestVPNRoundTrip(t *testing.T) {
 		t.Errorf("server port mismatch: expected %d, got %d", original.server.port, parsed.server.port)
 	}
 }
+
+func TestWGVPNReissueClient(t *testing.T) {
+	server := NewWGServer(nil, false, 51820)
+	networks := []net.IPNet{{IP: net.ParseIP("10.0.0.0"), Mask: net.CIDRMask(24, 32)}}
+	vpn, _ := NewWGVPN("test", server, "vpn.example.com:51820", networks, nil, nil)
+
+	first := NewWGClient(nil, false, []net.IP{net.ParseIP("9.9.9.9")}, []net.IPNet{utils.IPv4ZeroNet})
+	first.SetName("laptop")
+	first.SetSubnets([]net.IPNet{{IP: net.ParseIP("192.168.50.0"), Mask: net.CIDRMask(24, 32)}})
+	first.SetExcludedRoutes([]net.IPNet{{IP: net.ParseIP("192.168.1.0"), Mask: net.CIDRMask(24, 32)}})
+	first.SetOptions(WGOptions{MTU: 1280})
+	if err := vpn.AddClient(first); err != nil {
+		t.Fatalf("failed to add client: %v", err)
+	}
+	second := NewWGClient(nil, false, nil, nil)
+	second.SetName("phone")
+	if err := vpn.AddClient(second); err != nil {
+		t.Fatalf("failed to add client: %v", err)
+	}
+	old := vpn.peers[0].Public()
+
+	// the server file keeps the settings of the client
+	file := utils.NewFile()
+	vpn.Populate(file)
+	vpn, err := VPNFromFile("test", file)
+	if err != nil {
+		t.Fatalf("failed to parse VPN: %v", err)
+	}
+
+	// as it was added: the private key is not known
+	current, err := vpn.Client("laptop")
+	if err != nil {
+		t.Fatalf("Client failed: %v", err)
+	}
+	if current.HasPrivateKey() || current.ToPeer().Public() != old || current.PSK() != first.PSK() {
+		t.Error("expected the keys of the client (without private key)")
+	}
+	rendered := utils.NewFile()
+	current.PopulateClient(rendered, vpn)
+	for _, line := range []string{"DNS = 9.9.9.9", "MTU = 1280", "PresharedKey = " + first.PSK()} {
+		if !strings.Contains(rendered.String(), line) {
+			t.Errorf("expected %q in the config of the client:\n%s", line, rendered.String())
+		}
+	}
+	if strings.Contains(rendered.String(), "0.0.0.0/0") {
+		t.Errorf("expected the excluded routes:\n%s", rendered.String())
+	}
+
+	client, err := vpn.ReissueClient("laptop")
+	if err != nil {
+		t.Fatalf("ReissueClient failed: %v", err)
+	}
+	if !client.HasPrivateKey() || client.PSK() == first.PSK() || client.PSK() == "" {
+		t.Error("expected new keys and a new preshared key")
+	}
+	if client.DNS() != "9.9.9.9" || client.ToPeer().Options().MTU != 1280 {
+		t.Errorf("expected the settings of the client, got %s %+v", client.DNS(), client.ToPeer().Options())
+	}
+	if client.Address() != first.Address() {
+		t.Errorf("expected address %s, got %s", first.Address(), client.Address())
+	}
+	peer := vpn.peers[0]
+	if peer.Public() == old || peer.Public() != client.ToPeer().Public() {
+		t.Errorf("expected the new public key on the server side")
+	}
+	if peer.Name() != "laptop" || peer.AllowedIPs() != "10.0.0.2/32, 192.168.50.0/24" {
+		t.Errorf("unexpected peer %s (%s)", peer.Name(), peer.AllowedIPs())
+	}
+	if vpn.NumberOfPeers() != 2 {
+		t.Errorf("expected 2 peers, got %d", vpn.NumberOfPeers())
+	}
+
+	if _, err := vpn.ReissueClient("tablet"); err == nil {
+		t.Error("expected error for an unknown client")
+	}
+}
+
+func TestWGVPNDisabledClient(t *testing.T) {
+	server := NewWGServer(nil, false, 51820)
+	networks := []net.IPNet{{IP: net.ParseIP("10.0.0.0"), Mask: net.CIDRMask(24, 32)}}
+	vpn, _ := NewWGVPN("test", server, "vpn.example.com:51820", networks, nil, nil)
+	for _, name := range []string{"laptop", "phone"} {
+		client := NewWGClient(nil, false, nil, nil)
+		client.SetName(name)
+		if err := vpn.AddClient(client); err != nil {
+			t.Fatalf("failed to add client: %v", err)
+		}
+	}
+	vpn.peers[1].disabled = true
+
+	// the disabled client is kept out of the server file
+	path := filepath.Join(t.TempDir(), "test.conf")
+	if err := vpn.Save(path); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	file, err := utils.ParseFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(file.String(), "phone") {
+		t.Errorf("expected the disabled client out of the server file:\n%s", file.String())
+	}
+	parsed, err := VPNFromFile("test", file)
+	if err != nil {
+		t.Fatalf("failed to parse VPN: %v", err)
+	}
+	if parsed.NumberOfPeers() != 2 || len(parsed.PeersOf("test")) != 1 || !parsed.Peers()[1].Disabled() {
+		t.Fatalf("expected 2 clients, 1 enabled, got %d", parsed.NumberOfPeers())
+	}
+	// its address is still reserved
+	provided, err := parsed.ProvideNetworks()
+	if err != nil || provided[0].IP.String() != "10.0.0.4" {
+		t.Errorf("expected 10.0.0.4, got %v (%v)", provided, err)
+	}
+
+	// kept in the state
+	restored, err := VPNFromState("test", parsed.State())
+	if err != nil {
+		t.Fatalf("VPNFromState failed: %v", err)
+	}
+	if peers := restored.PeersOf("test"); len(peers) != 1 || peers[0].Name() != "laptop" {
+		t.Errorf("expected laptop only, got %d peers", len(peers))
+	}
+}
@@ -0,0 +1,206 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+
+	"github.com/asiffer/wg-easy-vpn/crypto"
+)
+
+// WGEasySettings are the settings of a wg-easy server which are not
+// stored in its database (environment variables like WG_HOST)
+type WGEasySettings struct {
+	Endpoint string      // WG_HOST (and WG_PORT)
+	Port     uint16      // WG_PORT
+	Networks []net.IPNet // WG_DEFAULT_ADDRESS (default: the /24 of the server address)
+	DNS      []net.IP    // WG_DEFAULT_DNS
+	Routes   []net.IPNet // WG_ALLOWED_IPS
+}
+
+// wgEasyDatabase is the JSON database of wg-easy (wg0.json)
+type wgEasyDatabase struct {
+	Server struct {
+		PrivateKey string `json:"privateKey"`
+		PublicKey  string `json:"publicKey"`
+		Address    string `json:"address"`
+	} `json:"server"`
+	Clients map[string]wgEasyClient `json:"clients"`
+}
+
+type wgEasyClient struct {
+	ID           string  `json:"id"`
+	Name         string  `json:"name"`
+	Address      string  `json:"address"`
+	PrivateKey   string  `json:"privateKey"`
+	PublicKey    string  `json:"publicKey"`
+	PreSharedKey string  `json:"preSharedKey"`
+	CreatedAt    string  `json:"createdAt"`
+	UpdatedAt    string  `json:"updatedAt"`
+	ExpiredAt    *string `json:"expiredAt"`
+	OneTimeLink  *string `json:"oneTimeLink"`
+	Enabled      *bool   `json:"enabled"`
+}
+
+// VPNFromWGEasy reads a wg-easy database (wg0.json). It returns the vpn,
+// its clients (with their private keys so that their configs can be
+// generated, the disabled ones included) and what could not be carried
+// over.
+func VPNFromWGEasy(name string, r io.Reader, settings WGEasySettings) (*WGVPN, []*WGClient, []string, error) {
+	var db wgEasyDatabase
+	if err := json.NewDecoder(r).Decode(&db); err != nil {
+		return nil, nil, nil, fmt.Errorf("error while decoding wg-easy database (%w)", err)
+	}
+	if settings.Endpoint == "" {
+		return nil, nil, nil, fmt.Errorf("an endpoint is required")
+	}
+
+	report := make([]string, 0)
+
+	// server
+	private := crypto.NewKey()
+	if err := private.UpdateFromBase64(db.Server.PrivateKey); err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid server private key (%w)", err)
+	}
+	if db.Server.PublicKey != "" && private.Public().Base64() != db.Server.PublicKey {
+		return nil, nil, nil, fmt.Errorf("the server public key does not match its private key")
+	}
+	serverIP := parseIP(db.Server.Address)
+	if serverIP == nil {
+		return nil, nil, nil, fmt.Errorf("invalid server address %q", db.Server.Address)
+	}
+	networks := settings.Networks
+	if len(networks) == 0 {
+		// wg-easy only supports /24 networks
+		mask := net.CIDRMask(24, 32)
+		networks = []net.IPNet{{IP: serverIP.Mask(mask), Mask: mask}}
+	}
+	serverNet, ok := networkOf(networks, serverIP)
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("server address %s is outside of the networks", serverIP.String())
+	}
+	server := &WGServer{
+		WGNode: WGNode{
+			address: []net.IPNet{{IP: serverIP, Mask: serverNet.Mask}},
+			private: private,
+		},
+		port: settings.Port,
+	}
+
+	vpn := &WGVPN{
+		name:     name,
+		server:   server,
+		peers:    make([]*WGClientAsPeer, 0),
+		dns:      settings.DNS,
+		endpoint: settings.Endpoint,
+		networks: networks,
+		routes:   settings.Routes,
+	}
+
+	// clients (sorted by creation date like in the wg-easy UI)
+	ids := make([]string, 0, len(db.Clients))
+	for id := range db.Clients {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		a, b := db.Clients[ids[i]], db.Clients[ids[j]]
+		if a.CreatedAt != b.CreatedAt {
+			return a.CreatedAt < b.CreatedAt
+		}
+		return ids[i] < ids[j]
+	})
+
+	clients := make([]*WGClient, 0, len(ids))
+	for _, id := range ids {
+		c := db.Clients[id]
+		label := c.Name
+		if label == "" {
+			label = id
+		}
+		client, err := wgEasyClientToWGClient(c, networks)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("client %s: %w", label, err)
+		}
+		if c.ExpiredAt != nil {
+			report = append(report, fmt.Sprintf("client %s: expiration date %s dropped", label, *c.ExpiredAt))
+		}
+		if c.OneTimeLink != nil {
+			report = append(report, fmt.Sprintf("client %s: one-time link dropped", label))
+		}
+		peer := client.ToPeer()
+		if c.Enabled != nil && !*c.Enabled {
+			// kept out of the server config until it is enabled
+			peer.disabled = true
+			report = append(report, fmt.Sprintf("client %s is disabled: imported as disabled (see the enable command)", label))
+		}
+		clients = append(clients, client)
+		vpn.peers = append(vpn.peers, peer)
+	}
+	if len(clients) > 0 {
+		report = append(report, "creation and update dates of the clients dropped")
+	}
+
+	if err := vpn.checkOverlaps(); err != nil {
+		return nil, nil, nil, err
+	}
+	return vpn, clients, report, nil
+}
+
+// wgEasyClientToWGClient converts a client of the database
+func wgEasyClientToWGClient(c wgEasyClient, networks []net.IPNet) (*WGClient, error) {
+	ip := parseIP(c.Address)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid address %q", c.Address)
+	}
+	network, ok := networkOf(networks, ip)
+	if !ok {
+		return nil, fmt.Errorf("address %s is outside of the networks", ip.String())
+	}
+
+	private := crypto.NewKey()
+	if err := private.UpdateFromBase64(c.PrivateKey); err != nil {
+		return nil, fmt.Errorf("invalid private key (%w)", err)
+	}
+	if c.PublicKey != "" && private.Public().Base64() != c.PublicKey {
+		return nil, fmt.Errorf("the public key does not match the private key")
+	}
+
+	var psk crypto.PresharedKey
+	if c.PreSharedKey != "" {
+		psk = crypto.NewPresharedKey()
+		if err := psk.UpdateFromBase64(c.PreSharedKey); err != nil {
+			return nil, fmt.Errorf("invalid preshared key (%w)", err)
+		}
+	}
+
+	client := &WGClient{
+		WGNode: WGNode{
+			address: []net.IPNet{{IP: ip, Mask: network.Mask}},
+			private: private,
+			psk:     psk,
+		},
+	}
+	client.SetName(c.Name)
+	return client, nil
+}
+
+// parseIP parses an address (IPv4 addresses are stored on 4 bytes)
+func parseIP(s string) net.IP {
+	ip := net.ParseIP(s)
+	if v4 := ip.To4(); v4 != nil {
+		return v4
+	}
+	return ip
+}
+
+// networkOf returns the network containing the ip
+func networkOf(networks []net.IPNet, ip net.IP) (net.IPNet, bool) {
+	for _, n := range networks {
+		if n.Contains(ip) {
+			return n, true
+		}
+	}
+	return net.IPNet{}, false
+}
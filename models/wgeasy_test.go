@@ -0,0 +1,102 @@
+package models
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func loadWGEasyFixture(t *testing.T, settings WGEasySettings) (*WGVPN, []*WGClient, []string) {
+	t.Helper()
+	f, err := os.Open("../test/wg-easy.json")
+	if err != nil {
+		t.Fatalf("failed to open fixture: %v", err)
+	}
+	defer f.Close()
+	vpn, clients, report, err := VPNFromWGEasy("wg0", f, settings)
+	if err != nil {
+		t.Fatalf("VPNFromWGEasy failed: %v", err)
+	}
+	return vpn, clients, report
+}
+
+func TestVPNFromWGEasy(t *testing.T) {
+	vpn, clients, report := loadWGEasyFixture(t, WGEasySettings{Endpoint: "vpn.example.com", Port: 51820})
+
+	if vpn.server.Address() != "10.8.0.1/24" {
+		t.Errorf("expected server address 10.8.0.1/24, got %s", vpn.server.Address())
+	}
+	if pub := vpn.server.ToPeer(nil, "").Public(); pub != "SZQ04/Vr8F3B/QtIb3jrClkxrv1XS0uosW8rqsUrCzk=" {
+		t.Errorf("unexpected server public key %s", pub)
+	}
+	if len(vpn.networks) != 1 || vpn.networks[0].String() != "10.8.0.0/24" {
+		t.Errorf("expected network 10.8.0.0/24, got %v", vpn.networks)
+	}
+
+	// the disabled client is kept out of the server config
+	if len(clients) != 3 || vpn.NumberOfPeers() != 3 {
+		t.Fatalf("expected 3 clients, got %d", len(clients))
+	}
+	if peers := vpn.PeersOf("wg0"); len(peers) != 2 {
+		t.Errorf("expected 2 enabled clients, got %d", len(peers))
+	}
+	peers := vpn.Peers()
+	if peers[0].Name() != "Alice's phone" || peers[0].AllowedIPs() != "10.8.0.2/32" {
+		t.Errorf("unexpected first peer %s (%s)", peers[0].Name(), peers[0].AllowedIPs())
+	}
+	if peers[0].PSK() != "dHx7qhkvUVPxTK+doFUtSz972uYylXuHiRq0wA0V414=" {
+		t.Errorf("unexpected psk %s", peers[0].PSK())
+	}
+	if peers[1].Name() != "old tablet" || !peers[1].Disabled() || peers[0].Disabled() {
+		t.Errorf("expected old tablet to be disabled (only)")
+	}
+	if peers[2].Name() != "laptop" || peers[2].Public() != "tOcXQhlbOr+IvonOEpAgKbBIZnMogSLRupSAw66PKys=" {
+		t.Errorf("unexpected third peer %s (%s)", peers[2].Name(), peers[2].Public())
+	}
+	if clients[2].Address() != "10.8.0.4/24" {
+		t.Errorf("expected client address 10.8.0.4/24, got %s", clients[2].Address())
+	}
+
+	joined := strings.Join(report, "\n")
+	for _, expected := range []string{"old tablet is disabled", "laptop: expiration date"} {
+		if !strings.Contains(joined, expected) {
+			t.Errorf("expected %q in the report:\n%s", expected, joined)
+		}
+	}
+
+	// the next client gets the first free address (the disabled client
+	// keeps its own)
+	networks, err := vpn.ProvideNetworks()
+	if err != nil {
+		t.Fatalf("ProvideNetworks failed: %v", err)
+	}
+	if networks[0].IP.String() != "10.8.0.5" {
+		t.Errorf("expected 10.8.0.5, got %s", networks[0].IP.String())
+	}
+}
+
+func TestVPNFromWGEasyErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		endpoint string
+	}{
+		{"invalid json", "{", "vpn.example.com"},
+		{"missing endpoint", `{"server": {"privateKey": "9/3XGFfolu0J7EWdIda1kLfn+14q+UBDsHOVkUFSaGo=", "address": "10.8.0.1"}}`, ""},
+		{"invalid server key", `{"server": {"privateKey": "invalid", "address": "10.8.0.1"}}`, "vpn.example.com"},
+		{"mismatched server key", `{"server": {"privateKey": "9/3XGFfolu0J7EWdIda1kLfn+14q+UBDsHOVkUFSaGo=", "publicKey": "tOcXQhlbOr+IvonOEpAgKbBIZnMogSLRupSAw66PKys=", "address": "10.8.0.1"}}`, "vpn.example.com"},
+		{"invalid client address", `{"server": {"privateKey": "9/3XGFfolu0J7EWdIda1kLfn+14q+UBDsHOVkUFSaGo=", "address": "10.8.0.1"},
+			"clients": {"a": {"name": "a", "address": "10.9.0.2", "privateKey": "GlVme/Khob064WhRfA5c06CBE/Kr2p9APXsBehP50Go="}}}`, "vpn.example.com"},
+		{"duplicate address", `{"server": {"privateKey": "9/3XGFfolu0J7EWdIda1kLfn+14q+UBDsHOVkUFSaGo=", "address": "10.8.0.1"},
+			"clients": {"a": {"name": "a", "address": "10.8.0.2", "privateKey": "GlVme/Khob064WhRfA5c06CBE/Kr2p9APXsBehP50Go="},
+			"b": {"name": "b", "address": "10.8.0.2", "privateKey": "nU8bVx+cIociW5FgzAdxRuVTF+fgecspetjzj9gtn+E="}}}`, "vpn.example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, _, err := VPNFromWGEasy("wg0", strings.NewReader(tt.input), WGEasySettings{Endpoint: tt.endpoint})
+			if err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
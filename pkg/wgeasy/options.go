@@ -0,0 +1,98 @@
+package wgeasy
+
+import (
+	"net"
+
+	"github.com/asiffer/wg-easy-vpn/crypto"
+	"github.com/asiffer/wg-easy-vpn/models"
+)
+
+type addClientOptions struct {
+	noPSK    bool
+	dns      []net.IP
+	routes   []net.IPNet
+	excludes []net.IPNet
+	options  models.WGOptions
+	static   net.IP
+	public   crypto.Key
+	tags     []string
+	gateway  string
+	format   string
+}
+
+// AddClientOption customizes a new client (see VPN.AddClient)
+type AddClientOption func(*addClientOptions)
+
+// WithoutPSK does not generate a preshared key
+func WithoutPSK() AddClientOption {
+	return func(options *addClientOptions) {
+		options.noPSK = true
+	}
+}
+
+// WithDNS overrides the dns of the vpn
+func WithDNS(dns []net.IP) AddClientOption {
+	return func(options *addClientOptions) {
+		options.dns = dns
+	}
+}
+
+// WithRoutes overrides the routes of the vpn
+func WithRoutes(routes []net.IPNet) AddClientOption {
+	return func(options *addClientOptions) {
+		options.routes = routes
+	}
+}
+
+// WithExcludedRoutes removes networks from the routes of the client
+func WithExcludedRoutes(excludes []net.IPNet) AddClientOption {
+	return func(options *addClientOptions) {
+		options.excludes = excludes
+	}
+}
+
+// WithOptions overrides the client options of the vpn (keepalive, mtu...)
+func WithOptions(opts models.WGOptions) AddClientOption {
+	return func(options *addClientOptions) {
+		options.options = opts
+	}
+}
+
+// WithStaticIP requests an address (the other networks still provide the
+// first free address)
+func WithStaticIP(ip net.IP) AddClientOption {
+	return func(options *addClientOptions) {
+		options.static = ip
+	}
+}
+
+// WithPublicKey uses the public key of a client which keeps its private
+// key (the config has no PrivateKey)
+func WithPublicKey(public crypto.Key) AddClientOption {
+	return func(options *addClientOptions) {
+		options.public = public
+	}
+}
+
+// WithTags labels the client (kept in the state file)
+func WithTags(tags ...string) AddClientOption {
+	return func(options *addClientOptions) {
+		options.tags = tags
+	}
+}
+
+// WithGateway makes the client reach the vpn through a gateway
+// (models.AllGateways for every server)
+func WithGateway(name string) AddClientOption {
+	return func(options *addClientOptions) {
+		options.gateway = name
+	}
+}
+
+// WithFormat renders the config for another tool (models.FormatNM,
+// models.FormatOpenWrt or models.FormatRouterOS)
+func WithFormat(format string) AddClientOption {
+	return func(options *addClientOptions) {
+		options.format = format
+	}
+}
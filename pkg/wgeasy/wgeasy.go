@@ -0,0 +1,380 @@
+// Package wgeasy is the Go API of wg-easy-vpn: it manages the clients of a
+// server config like the wg-easy-vpn command does, without writing to the
+// standard output.
+//
+//	vpn, err := wgeasy.Open("/etc/wireguard/wg0.conf")
+//	if err != nil {
+//		return err
+//	}
+//	defer vpn.Close()
+//	config, err := vpn.AddClient("laptop", wgeasy.WithTags("staff"))
+//	if err != nil {
+//		return err
+//	}
+//	if err := vpn.Save(); err != nil {
+//		return err
+//	}
+//	os.WriteFile("laptop.conf", config.Config, 0600)
+package wgeasy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image/png"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/asiffer/wg-easy-vpn/crypto"
+	"github.com/asiffer/wg-easy-vpn/export"
+	"github.com/asiffer/wg-easy-vpn/models"
+	"github.com/asiffer/wg-easy-vpn/utils"
+)
+
+var (
+	// ErrNotFound is returned for an unknown client
+	ErrNotFound = errors.New("client not found")
+	// ErrExists is returned when a client has the name of another one
+	ErrExists = errors.New("client already exists")
+	// ErrClosed is returned when saving a closed vpn
+	ErrClosed = errors.New("vpn closed")
+)
+
+// VPN is a server config opened with Open. Its methods are safe for
+// concurrent use; the changes are written by Save. The config is locked
+// (the wg-easy-vpn command waits for it) until Close.
+type VPN struct {
+	mu   sync.Mutex
+	name string
+	path string
+	vpn  *models.WGVPN
+	lock *utils.FileLock // nil once closed
+}
+
+// Client is a client of the vpn
+type Client struct {
+	Name      string
+	PublicKey string
+	Addresses []net.IPNet
+	CreatedAt time.Time // zero when unknown (clients added by an older version)
+	Tags      []string
+}
+
+// ClientConfig is the config of a new client
+type ClientConfig struct {
+	Client
+	// PrivateKey is empty when the client keeps its private key
+	// (WithPublicKey)
+	PrivateKey string
+	// Format of the config (models.FormatWGQuick by default)
+	Format string
+	// Config is the rendered config, to give to the client
+	Config []byte
+}
+
+// Open locks and reads a server config (the connection is named after the
+// file). The configs of an older wg-easy-vpn and the plain wg-quick configs
+// must be migrated or adopted with the command first.
+func Open(path string) (v *VPN, err error) {
+	lock, err := utils.LockFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			lock.Unlock()
+		}
+	}()
+	file, err := utils.ParseFile(path)
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	vpn, err := models.VPNFromFile(name, file)
+	if err != nil {
+		return nil, err
+	}
+	if !vpn.IsManaged() {
+		return nil, fmt.Errorf("%s has no wg-easy-vpn metadata (run 'wg-easy-vpn adopt' or 'wg-easy-vpn migrate' first)", path)
+	}
+	return &VPN{name: name, path: path, vpn: vpn, lock: lock}, nil
+}
+
+// Close releases the lock of the config (the changes which are not saved
+// are lost)
+func (v *VPN) Close() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.lock == nil {
+		return nil
+	}
+	err := v.lock.Unlock()
+	v.lock = nil
+	return err
+}
+
+// Name returns the name of the connection
+func (v *VPN) Name() string {
+	return v.name
+}
+
+// Path returns the path of the server config
+func (v *VPN) Path() string {
+	return v.path
+}
+
+// Endpoint returns the public endpoint of the server
+func (v *VPN) Endpoint() string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.vpn.Endpoint()
+}
+
+// Networks returns the networks of the vpn
+func (v *VPN) Networks() []net.IPNet {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.vpn.Networks()
+}
+
+// Clients returns the clients of the vpn (in the order of the config)
+func (v *VPN) Clients() []Client {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	clients := make([]Client, 0, v.vpn.NumberOfPeers())
+	for _, peer := range v.vpn.Peers() {
+		clients = append(clients, clientOf(peer))
+	}
+	return clients
+}
+
+// Client returns a client given its name
+func (v *VPN) Client(name string) (Client, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	peer, err := v.peerByName(name)
+	if err != nil {
+		return Client{}, err
+	}
+	return clientOf(peer), nil
+}
+
+// AddClient adds a client (the first free addresses of the networks unless
+// WithStaticIP is given) and returns its config. The names are unique and
+// stored on a single line (see models.CleanClientName).
+func (v *VPN) AddClient(name string, opts ...AddClientOption) (*ClientConfig, error) {
+	if name == "" {
+		return nil, fmt.Errorf("a client must have a name")
+	}
+	if models.CleanClientName(name) != name {
+		return nil, fmt.Errorf("invalid client name %q (a single line without control characters or repeated spaces)", name)
+	}
+	options := &addClientOptions{format: models.FormatWGQuick}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if _, err := v.peerByName(name); err == nil {
+		return nil, fmt.Errorf("a client named %s already exists in the VPN (%w)", name, ErrExists)
+	}
+	if err := checkFormat(options.format); err != nil {
+		return nil, err
+	}
+
+	client := models.NewWGClient(nil, options.noPSK, options.dns, options.routes)
+	client.SetName(name)
+	client.SetExcludedRoutes(options.excludes)
+	client.SetOptions(options.options)
+	client.SetTags(options.tags)
+	client.SetGateway(options.gateway)
+	if options.static != nil {
+		client.SetStaticIP(options.static)
+	}
+	if options.public != nil {
+		client.SetPublicKey(options.public)
+	}
+	if err := v.vpn.AddClient(client); err != nil {
+		return nil, err
+	}
+	config, err := v.render(client, options)
+	if err != nil {
+		v.removeLast()
+		return nil, err
+	}
+	return config, nil
+}
+
+// Config returns the config of a client as it was added, without its
+// private key (the server does not keep it, PrivateKey is empty). Nothing
+// changes: only WithFormat is used.
+func (v *VPN) Config(name string, opts ...AddClientOption) (*ClientConfig, error) {
+	options := &addClientOptions{format: models.FormatWGQuick}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if err := checkFormat(options.format); err != nil {
+		return nil, err
+	}
+	if _, err := v.peerByName(name); err != nil {
+		return nil, err
+	}
+	client, err := v.vpn.Client(name)
+	if err != nil {
+		return nil, err
+	}
+	return v.render(client, options)
+}
+
+// ReissueClient generates new keys for a client and returns its new
+// config: the server does not keep the private keys, so this is the only
+// way to get a complete config of an existing client. Its previous config
+// stops working. Its addresses, settings and gateway are kept (only
+// WithFormat is used).
+func (v *VPN) ReissueClient(name string, opts ...AddClientOption) (*ClientConfig, error) {
+	options := &addClientOptions{format: models.FormatWGQuick}
+	for _, opt := range opts {
+		opt(options)
+	}
+	options.public = nil
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if err := checkFormat(options.format); err != nil {
+		return nil, err
+	}
+	peer, err := v.peerByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if options.gateway != "" && options.gateway != peer.Gateway() {
+		return nil, fmt.Errorf("the client %s cannot move to the gateway %s", name, options.gateway)
+	}
+	// keep the vpn unchanged if the config cannot be rendered
+	previous := v.vpn.Peers()
+	backup := make([]*models.WGClientAsPeer, len(previous))
+	copy(backup, previous)
+
+	client, err := v.vpn.ReissueClient(name)
+	if err != nil {
+		return nil, err
+	}
+	config, err := v.render(client, options)
+	if err != nil {
+		copy(v.vpn.Peers(), backup)
+		return nil, err
+	}
+	return config, nil
+}
+
+// render renders the config of a client of the vpn
+func (v *VPN) render(client *models.WGClient, options *addClientOptions) (*ClientConfig, error) {
+	file := utils.NewFile()
+	file.GetorCreateSection(utils.DEFAULT_SECTION).AddComment(client.Name())
+	if err := client.PopulateClientGateway(file, v.vpn); err != nil {
+		return nil, err
+	}
+	peer, err := v.peerByName(client.Name())
+	if err != nil {
+		return nil, err
+	}
+	config := &ClientConfig{Client: clientOf(peer), Format: options.format}
+	if options.public == nil && client.HasPrivateKey() {
+		config.PrivateKey = client.Private()
+	}
+	content, err := models.RenderClient(file, options.format, v.name)
+	if err != nil {
+		return nil, err
+	}
+	config.Config = []byte(content)
+	return config, nil
+}
+
+// RemoveClient removes a client given its name
+func (v *VPN) RemoveClient(name string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	peer, err := v.peerByName(name)
+	if err != nil {
+		return err
+	}
+	return v.removePeer(peer)
+}
+
+// Save writes the server config (and its state file, if any)
+func (v *VPN) Save() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.lock == nil {
+		return ErrClosed
+	}
+	return v.vpn.Save(v.path)
+}
+
+// peerByName returns the client with the given name
+func (v *VPN) peerByName(name string) (*models.WGClientAsPeer, error) {
+	for _, peer := range v.vpn.Peers() {
+		if peer.Name() == name {
+			return peer, nil
+		}
+	}
+	return nil, fmt.Errorf("this client (%s) is not in the VPN (%w)", name, ErrNotFound)
+}
+
+// removeLast removes the client which has just been added
+func (v *VPN) removeLast() {
+	peers := v.vpn.Peers()
+	v.removePeer(peers[len(peers)-1])
+}
+
+func (v *VPN) removePeer(peer *models.WGClientAsPeer) error {
+	public := crypto.NewKey()
+	if err := public.UpdateFromBase64(peer.Public()); err != nil {
+		return err
+	}
+	return v.vpn.RemovePeer(public)
+}
+
+// QRCode returns the config as a QR code (PNG image)
+func (c *ClientConfig) QRCode() ([]byte, error) {
+	if c.Format != models.FormatWGQuick {
+		return nil, fmt.Errorf("QR codes are only available with the %s format", models.FormatWGQuick)
+	}
+	img, err := export.EncodeImage(bytes.NewReader(c.Config))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("error while encoding QRCode to png (%w)", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// checkFormat checks the format of the client configs
+func checkFormat(format string) error {
+	switch format {
+	case models.FormatWGQuick, models.FormatNM, models.FormatOpenWrt, models.FormatRouterOS:
+		return nil
+	default:
+		return fmt.Errorf("unknown client format %q (expected %s, %s, %s or %s)", format,
+			models.FormatWGQuick, models.FormatNM, models.FormatOpenWrt, models.FormatRouterOS)
+	}
+}
+
+func clientOf(peer *models.WGClientAsPeer) Client {
+	return Client{
+		Name:      peer.Name(),
+		PublicKey: peer.Public(),
+		Addresses: peer.AllowedNetworks(),
+		CreatedAt: peer.CreatedAt(),
+		Tags:      peer.Tags(),
+	}
+}
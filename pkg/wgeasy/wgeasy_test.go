@@ -0,0 +1,218 @@
+package wgeasy
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/asiffer/wg-easy-vpn/crypto"
+	"github.com/asiffer/wg-easy-vpn/models"
+	"github.com/asiffer/wg-easy-vpn/utils"
+)
+
+// newServerFile writes a new vpn config in a temporary directory
+func newServerFile(t *testing.T) string {
+	t.Helper()
+	server := models.NewWGServer(nil, false, 51820)
+	networks := []net.IPNet{{IP: net.ParseIP("10.0.0.0"), Mask: net.CIDRMask(24, 32)}}
+	vpn, err := models.NewWGVPN("wg0", server, "vpn.example.com:51820", networks, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := utils.NewFile()
+	vpn.Populate(f)
+	path := filepath.Join(t.TempDir(), "wg0.conf")
+	if err := f.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestOpenAddSave(t *testing.T) {
+	path := newServerFile(t)
+	vpn, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer vpn.Close()
+	if vpn.Name() != "wg0" || vpn.Endpoint() != "vpn.example.com:51820" {
+		t.Errorf("unexpected vpn %s %s", vpn.Name(), vpn.Endpoint())
+	}
+
+	config, err := vpn.AddClient("laptop", WithTags("staff"), WithoutPSK())
+	if err != nil {
+		t.Fatalf("AddClient failed: %v", err)
+	}
+	content := string(config.Config)
+	if config.PrivateKey == "" || !strings.Contains(content, "PrivateKey = "+config.PrivateKey) {
+		t.Errorf("expected the private key in the config:\n%s", content)
+	}
+	if strings.Contains(content, "PresharedKey") {
+		t.Errorf("unexpected preshared key:\n%s", content)
+	}
+	if len(config.Addresses) != 1 || config.Addresses[0].IP.String() != "10.0.0.2" {
+		t.Errorf("unexpected addresses %v", config.Addresses)
+	}
+	if _, err := vpn.AddClient("laptop"); err == nil {
+		t.Error("expected an error for a duplicate name")
+	}
+	if err := vpn.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	// the config is locked until Close
+	if err := vpn.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := vpn.Save(); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+
+	// the client is in the saved config
+	vpn, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vpn.Close()
+	clients := vpn.Clients()
+	if len(clients) != 1 || clients[0].Name != "laptop" || clients[0].PublicKey != config.PublicKey {
+		t.Fatalf("unexpected clients %+v", clients)
+	}
+	if err := vpn.RemoveClient("laptop"); err != nil {
+		t.Fatalf("RemoveClient failed: %v", err)
+	}
+	if err := vpn.RemoveClient("laptop"); err == nil {
+		t.Error("expected an error for an unknown client")
+	}
+	if len(vpn.Clients()) != 0 {
+		t.Errorf("expected no clients, got %+v", vpn.Clients())
+	}
+}
+
+func TestAddClientOptions(t *testing.T) {
+	vpn, err := Open(newServerFile(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vpn.Close()
+
+	public := crypto.NewKey()
+	config, err := vpn.AddClient("router",
+		WithPublicKey(public.Public()),
+		WithStaticIP(net.ParseIP("10.0.0.42")),
+	)
+	if err != nil {
+		t.Fatalf("AddClient failed: %v", err)
+	}
+	if config.PrivateKey != "" || strings.Contains(string(config.Config), "PrivateKey =") {
+		t.Errorf("unexpected private key in %+v", config)
+	}
+	if config.Addresses[0].IP.String() != "10.0.0.42" {
+		t.Errorf("unexpected addresses %v", config.Addresses)
+	}
+
+	config, err = vpn.AddClient("mikrotik", WithFormat(models.FormatRouterOS))
+	if err != nil {
+		t.Fatalf("AddClient failed: %v", err)
+	}
+	if !strings.Contains(string(config.Config), "/interface wireguard add") {
+		t.Errorf("unexpected RouterOS script:\n%s", config.Config)
+	}
+
+	// invalid options do not add the client
+	if _, err := vpn.AddClient("phone", WithFormat("unknown")); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+	if _, err := vpn.AddClient("phone", WithGateway("unknown")); err == nil {
+		t.Error("expected an error for an unknown gateway")
+	}
+	if _, err := vpn.AddClient("phone\n[Interface]\nPostUp = id"); err == nil {
+		t.Error("expected an error for a multi-line name")
+	}
+	// the keys are required by RouterOS
+	if _, err := vpn.AddClient("phone", WithPublicKey(crypto.NewKey().Public()), WithFormat(models.FormatRouterOS)); err == nil {
+		t.Error("expected an error without private key")
+	}
+	if len(vpn.Clients()) != 2 {
+		t.Errorf("expected two clients, got %+v", vpn.Clients())
+	}
+}
+
+func TestOpenPlain(t *testing.T) {
+	// a copy: Open locks the config next to it
+	content, err := os.ReadFile("../../test/wg0.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "wg0.conf")
+	if err := os.WriteFile(path, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path); err == nil || !strings.Contains(err.Error(), "adopt") {
+		t.Errorf("expected an adopt error, got %v", err)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	vpn, err := Open(newServerFile(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vpn.Close()
+	created, err := vpn.AddClient("laptop", WithDNS([]net.IP{net.ParseIP("9.9.9.9")}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := vpn.Config("laptop")
+	if err != nil {
+		t.Fatalf("Config failed: %v", err)
+	}
+	if config.PublicKey != created.PublicKey || config.PrivateKey != "" {
+		t.Errorf("expected the same keys without private key, got %+v", config.Client)
+	}
+	content := string(config.Config)
+	if strings.Contains(content, "PrivateKey =") || !strings.Contains(content, "DNS = 9.9.9.9") {
+		t.Errorf("unexpected config:\n%s", content)
+	}
+	if _, err := vpn.Config("phone"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestReissueClient(t *testing.T) {
+	vpn, err := Open(newServerFile(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vpn.Close()
+	created, err := vpn.AddClient("laptop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reissued, err := vpn.ReissueClient("laptop")
+	if err != nil {
+		t.Fatalf("ReissueClient failed: %v", err)
+	}
+	if reissued.PublicKey == created.PublicKey || reissued.PrivateKey == created.PrivateKey {
+		t.Error("expected new keys")
+	}
+	if reissued.Addresses[0].String() != created.Addresses[0].String() {
+		t.Errorf("expected the same address, got %v", reissued.Addresses)
+	}
+	if img, err := reissued.QRCode(); err != nil || len(img) == 0 {
+		t.Errorf("QRCode failed: %v", err)
+	}
+
+	// a failed rendering keeps the keys
+	if _, err := vpn.ReissueClient("laptop", WithGateway("unknown")); err == nil {
+		t.Error("expected an error for an unknown gateway")
+	}
+	if client, _ := vpn.Client("laptop"); client.PublicKey != reissued.PublicKey {
+		t.Error("the keys changed after a failed reissue")
+	}
+	if _, err := vpn.ReissueClient("phone"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,299 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/asiffer/wg-easy-vpn/crypto"
+	"github.com/asiffer/wg-easy-vpn/models"
+	"github.com/asiffer/wg-easy-vpn/pkg/wgeasy"
+	"github.com/asiffer/wg-easy-vpn/utils"
+)
+
+// clientJSON is a client in the responses
+type clientJSON struct {
+	Name      string    `json:"name"`
+	PublicKey string    `json:"public_key"`
+	Addresses []string  `json:"addresses"`
+	CreatedAt time.Time `json:"created_at,omitzero"`
+	Tags      []string  `json:"tags,omitempty"`
+}
+
+// configJSON is a new client config in the responses
+type configJSON struct {
+	clientJSON
+	PrivateKey string `json:"private_key,omitempty"`
+	Format     string `json:"format"`
+	Config     string `json:"config"`
+}
+
+// configRequest are the settings of a client config
+type configRequest struct {
+	DNS           []string `json:"dns,omitempty"`
+	Routes        []string `json:"routes,omitempty"`
+	ExcludeRoutes []string `json:"exclude_routes,omitempty"`
+	NoPSK         bool     `json:"no_psk,omitempty"`
+	Gateway       string   `json:"gateway,omitempty"`
+	Format        string   `json:"format,omitempty"`
+}
+
+// rotateRequest is the body of a key rotation (the settings of the client
+// are kept)
+type rotateRequest struct {
+	Format string `json:"format,omitempty"`
+}
+
+// createRequest is the body of a new client
+type createRequest struct {
+	configRequest
+	Name      string   `json:"name"`
+	Tags      []string `json:"tags,omitempty"`
+	StaticIP  string   `json:"static_ip,omitempty"`
+	PublicKey string   `json:"public_key,omitempty"`
+}
+
+func (s *Server) listClients(w http.ResponseWriter, _ *http.Request) {
+	var clients []wgeasy.Client
+	err := s.withVPN(false, func(vpn *wgeasy.VPN) error {
+		clients = vpn.Clients()
+		return nil
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	out := make([]clientJSON, 0, len(clients))
+	for _, client := range clients {
+		out = append(out, toClientJSON(client))
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) getClient(w http.ResponseWriter, r *http.Request) {
+	var client wgeasy.Client
+	err := s.withVPN(false, func(vpn *wgeasy.VPN) (err error) {
+		client, err = vpn.Client(r.PathValue("name"))
+		return err
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toClientJSON(client))
+}
+
+func (s *Server) createClient(w http.ResponseWriter, r *http.Request) {
+	req := createRequest{}
+	if err := decodeBody(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	opts, err := req.options(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var config *wgeasy.ClientConfig
+	err = s.withVPN(true, func(vpn *wgeasy.VPN) (err error) {
+		config, err = vpn.AddClient(req.Name, opts...)
+		return err
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Location", API_PREFIX+"/clients/"+config.Name)
+	writeConfig(w, r, http.StatusCreated, config)
+}
+
+func (s *Server) getClientConfig(w http.ResponseWriter, r *http.Request) {
+	if acceptsPNG(r) {
+		// the config has no private key
+		writeError(w, http.StatusNotAcceptable, fmt.Errorf("the server does not keep the private keys, rotate the keys of the client to get a QR code"))
+		return
+	}
+	req := rotateRequest{Format: r.URL.Query().Get("format")}
+	opts, err := req.options(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var config *wgeasy.ClientConfig
+	err = s.withVPN(false, func(vpn *wgeasy.VPN) (err error) {
+		config, err = vpn.Config(r.PathValue("name"), opts...)
+		return err
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeConfig(w, r, http.StatusOK, config)
+}
+
+func (s *Server) rotateClient(w http.ResponseWriter, r *http.Request) {
+	req := rotateRequest{}
+	if err := decodeBody(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	opts, err := req.options(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var config *wgeasy.ClientConfig
+	err = s.withVPN(true, func(vpn *wgeasy.VPN) (err error) {
+		config, err = vpn.ReissueClient(r.PathValue("name"), opts...)
+		return err
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeConfig(w, r, http.StatusOK, config)
+}
+
+func (s *Server) deleteClient(w http.ResponseWriter, r *http.Request) {
+	err := s.withVPN(true, func(vpn *wgeasy.VPN) error {
+		return vpn.RemoveClient(r.PathValue("name"))
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// acceptsPNG returns whether the request asks for a QR code
+func acceptsPNG(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "image/png")
+}
+
+// writeConfig writes a client config as json, or as a QR code when the
+// request accepts image/png
+func writeConfig(w http.ResponseWriter, r *http.Request, status int, config *wgeasy.ClientConfig) {
+	if acceptsPNG(r) {
+		img, err := config.QRCode()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.WriteHeader(status)
+		w.Write(img)
+		return
+	}
+	writeJSON(w, status, configJSON{
+		clientJSON: toClientJSON(config.Client),
+		PrivateKey: config.PrivateKey,
+		Format:     config.Format,
+		Config:     string(config.Config),
+	})
+}
+
+// MAX_BODY_SIZE is the maximum size of the request bodies (bytes)
+const MAX_BODY_SIZE = 16 << 10
+
+// decodeBody decodes a json body (an empty body keeps the defaults)
+func decodeBody(w http.ResponseWriter, r *http.Request, value any) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, MAX_BODY_SIZE))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(value); err != nil && err != io.EOF {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return &statusError{status: http.StatusRequestEntityTooLarge, err: err}
+		}
+		return fmt.Errorf("invalid request body (%w)", err)
+	}
+	return nil
+}
+
+// options returns the options of the config (r is the request, QR codes
+// are only available for the wg-quick configs)
+func (req *configRequest) options(r *http.Request) ([]wgeasy.AddClientOption, error) {
+	if acceptsPNG(r) && req.Format != "" && req.Format != models.FormatWGQuick {
+		return nil, &statusError{
+			status: http.StatusNotAcceptable,
+			err:    fmt.Errorf("QR codes are only available with the %s format", models.FormatWGQuick),
+		}
+	}
+	opts := make([]wgeasy.AddClientOption, 0)
+	if req.NoPSK {
+		opts = append(opts, wgeasy.WithoutPSK())
+	}
+	if len(req.DNS) > 0 {
+		dns, err := utils.ParseIPList(req.DNS)
+		if err != nil {
+			return nil, fmt.Errorf("invalid dns (%w)", err)
+		}
+		opts = append(opts, wgeasy.WithDNS(dns))
+	}
+	if len(req.Routes) > 0 {
+		routes, err := utils.ParseIPNetList(req.Routes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid routes (%w)", err)
+		}
+		opts = append(opts, wgeasy.WithRoutes(routes))
+	}
+	if len(req.ExcludeRoutes) > 0 {
+		excludes, err := utils.ParseIPNetList(req.ExcludeRoutes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclude_routes (%w)", err)
+		}
+		opts = append(opts, wgeasy.WithExcludedRoutes(excludes))
+	}
+	if req.Gateway != "" {
+		opts = append(opts, wgeasy.WithGateway(req.Gateway))
+	}
+	if req.Format != "" {
+		opts = append(opts, wgeasy.WithFormat(req.Format))
+	}
+	return opts, nil
+}
+
+// options returns the options of a rotation (only the format)
+func (req *rotateRequest) options(r *http.Request) ([]wgeasy.AddClientOption, error) {
+	config := configRequest{Format: req.Format}
+	return config.options(r)
+}
+
+func (req *createRequest) options(r *http.Request) ([]wgeasy.AddClientOption, error) {
+	opts, err := req.configRequest.options(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(req.Tags) > 0 {
+		opts = append(opts, wgeasy.WithTags(req.Tags...))
+	}
+	if req.StaticIP != "" {
+		ip := net.ParseIP(req.StaticIP)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid static_ip %q", req.StaticIP)
+		}
+		opts = append(opts, wgeasy.WithStaticIP(ip))
+	}
+	if req.PublicKey != "" {
+		public := crypto.NewKey()
+		if err := public.UpdateFromBase64(req.PublicKey); err != nil {
+			return nil, fmt.Errorf("invalid public_key (%w)", err)
+		}
+		opts = append(opts, wgeasy.WithPublicKey(public))
+	}
+	return opts, nil
+}
+
+func toClientJSON(client wgeasy.Client) clientJSON {
+	return clientJSON{
+		Name:      client.Name,
+		PublicKey: client.PublicKey,
+		Addresses: utils.StringifyNetworks(client.Addresses),
+		CreatedAt: client.CreatedAt,
+		Tags:      client.Tags,
+	}
+}
@@ -0,0 +1,189 @@
+package server
+
+import (
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/asiffer/wg-easy-vpn/export"
+	"github.com/asiffer/wg-easy-vpn/pkg/wgeasy"
+	"github.com/rs/zerolog/log"
+)
+
+// API_PREFIX is the prefix of the routes of the REST API
+const API_PREFIX = "/api/v1"
+
+//go:embed openapi.json
+var openAPI []byte
+
+// Server manages the clients of a vpn over HTTP. The config is read for
+// every request (the command may edit it meanwhile) and the changes are
+// saved under the lock of the config.
+type Server struct {
+	path     string
+	token    string
+	sessions *sessions
+	shares   *export.ShareStore
+	mu       sync.Mutex
+}
+
+// New creates a server for the given config. The token authenticates the
+// requests of the API (Authorization: Bearer <token>) and the users log in
+// the web UI. The API (resp. the UI) is disabled without token (resp.
+// users); the one-time links of the shared configs are always served.
+func New(path string, token string, users []User) *Server {
+	return &Server{
+		path:     path,
+		token:    token,
+		sessions: newSessions(users),
+		shares:   export.NewShareStore(path),
+	}
+}
+
+// Handler returns the routes of the server
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	if s.token != "" {
+		mux.HandleFunc("GET "+API_PREFIX+"/openapi.json", s.getOpenAPI)
+		mux.Handle("GET "+API_PREFIX+"/clients", s.authenticated(s.listClients))
+		mux.Handle("POST "+API_PREFIX+"/clients", s.authenticated(s.createClient))
+		mux.Handle("GET "+API_PREFIX+"/clients/{name}", s.authenticated(s.getClient))
+		mux.Handle("DELETE "+API_PREFIX+"/clients/{name}", s.authenticated(s.deleteClient))
+		mux.Handle("GET "+API_PREFIX+"/clients/{name}/config", s.authenticated(s.getClientConfig))
+		mux.Handle("POST "+API_PREFIX+"/clients/{name}/rotate", s.authenticated(s.rotateClient))
+	}
+	if len(s.sessions.users) > 0 {
+		s.uiRoutes(mux)
+	}
+	s.shareRoutes(mux)
+	return logRequests(mux)
+}
+
+// name returns the name of the vpn (name of its config)
+func (s *Server) name() string {
+	base := filepath.Base(s.path)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// authenticated checks the token of the request
+func (s *Server) authenticated(handler http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="wg-easy-vpn"`)
+			writeError(w, http.StatusUnauthorized, fmt.Errorf("invalid or missing token"))
+			return
+		}
+		handler(w, r)
+	})
+}
+
+// statusError is an error with the status of its response
+type statusError struct {
+	status int
+	err    error
+}
+
+func (e *statusError) Error() string {
+	return e.err.Error()
+}
+
+func (e *statusError) Unwrap() error {
+	return e.err
+}
+
+// withVPN opens the vpn under the lock of its config and runs the given
+// function; the vpn is saved afterwards if save is true. The errors of
+// the function are errors of the request (400) unless they carry a status.
+func (s *Server) withVPN(save bool, fn func(vpn *wgeasy.VPN) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	vpn, err := wgeasy.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer vpn.Close()
+	if err := fn(vpn); err != nil {
+		var statusErr *statusError
+		switch {
+		case errors.As(err, &statusErr):
+			return err
+		case errors.Is(err, wgeasy.ErrNotFound):
+			return &statusError{status: http.StatusNotFound, err: err}
+		case errors.Is(err, wgeasy.ErrExists):
+			return &statusError{status: http.StatusConflict, err: err}
+		default:
+			return &statusError{status: http.StatusBadRequest, err: err}
+		}
+	}
+	if save {
+		return vpn.Save()
+	}
+	return nil
+}
+
+// writeJSON writes a json response
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		log.Error().Err(err).Msg("Error while writing the response")
+	}
+}
+
+// writeError writes an error response (json)
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, errorStatus(err, status), map[string]string{"error": err.Error()})
+}
+
+// errorStatus returns the status carried by the error (or the given one)
+func errorStatus(err error, status int) int {
+	var statusErr *statusError
+	if errors.As(err, &statusErr) {
+		return statusErr.status
+	}
+	return status
+}
+
+// statusRecorder keeps the status of a response (for the logs)
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// logRequests logs every request with its status and its duration
+func logRequests(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		handler.ServeHTTP(recorder, r)
+		event := log.Info()
+		if recorder.status >= http.StatusInternalServerError {
+			event = log.Error()
+		}
+		event.
+			Str("method", r.Method).
+			Str("path", r.URL.Path).
+			Str("remote", r.RemoteAddr).
+			Int("status", recorder.status).
+			Dur("duration", time.Since(start)).
+			Msg("HTTP request")
+	})
+}
+
+func (s *Server) getOpenAPI(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPI)
+}
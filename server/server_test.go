@@ -0,0 +1,239 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"image/png"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/asiffer/wg-easy-vpn/models"
+	"github.com/asiffer/wg-easy-vpn/utils"
+)
+
+const testToken = "secret"
+
+// newTestConfig writes a new vpn config
+func newTestConfig(t *testing.T) string {
+	t.Helper()
+	server := models.NewWGServer(nil, false, 51820)
+	networks := []net.IPNet{{IP: net.ParseIP("10.0.0.0"), Mask: net.CIDRMask(24, 32)}}
+	vpn, err := models.NewWGVPN("wg0", server, "vpn.example.com:51820", networks, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := utils.NewFile()
+	vpn.Populate(f)
+	path := filepath.Join(t.TempDir(), "wg0.conf")
+	if err := f.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// newTestServer serves the API of a new vpn config
+func newTestServer(t *testing.T) (*httptest.Server, string) {
+	t.Helper()
+	path := newTestConfig(t)
+	srv := New(path, testToken, nil)
+	ts := httptest.NewServer(srv.Handler())
+	t.Cleanup(ts.Close)
+	return ts, path
+}
+
+// request sends an authenticated request
+func request(t *testing.T, ts *httptest.Server, method, path, body string, headers ...string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, ts.URL+API_PREFIX+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func decode[T any](t *testing.T, resp *http.Response) T {
+	t.Helper()
+	var value T
+	if err := json.NewDecoder(resp.Body).Decode(&value); err != nil {
+		t.Fatalf("invalid json response: %v", err)
+	}
+	return value
+}
+
+func TestAuthentication(t *testing.T) {
+	ts, _ := newTestServer(t)
+	for _, header := range []string{"", "Bearer wrong", testToken} {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+API_PREFIX+"/clients", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized || resp.Header.Get("WWW-Authenticate") == "" {
+			t.Errorf("%q: expected 401, got %d", header, resp.StatusCode)
+		}
+	}
+
+	// the description is public
+	resp, err := http.Get(ts.URL + API_PREFIX + "/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	spec := decode[map[string]any](t, resp)
+	if resp.StatusCode != http.StatusOK || spec["openapi"] == nil {
+		t.Errorf("unexpected description (%d): %v", resp.StatusCode, spec)
+	}
+}
+
+func TestClientLifecycle(t *testing.T) {
+	ts, path := newTestServer(t)
+
+	resp := request(t, ts, http.MethodPost, "/clients", `{"name": "laptop", "tags": ["staff"], "no_psk": true}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", resp.StatusCode)
+	}
+	if resp.Header.Get("Location") != API_PREFIX+"/clients/laptop" {
+		t.Errorf("unexpected location %q", resp.Header.Get("Location"))
+	}
+	created := decode[configJSON](t, resp)
+	if created.PrivateKey == "" || !strings.Contains(created.Config, "PrivateKey = "+created.PrivateKey) {
+		t.Errorf("unexpected config %+v", created)
+	}
+	if strings.Join(created.Addresses, ",") != "10.0.0.2/32" || strings.Join(created.Tags, ",") != "staff" {
+		t.Errorf("unexpected client %+v", created.clientJSON)
+	}
+
+	// saved in the config
+	f, err := utils.ParseFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(f.String(), created.PublicKey) {
+		t.Errorf("the client is not in the config:\n%s", f.String())
+	}
+
+	resp = request(t, ts, http.MethodPost, "/clients", `{"name": "laptop"}`)
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("expected 409, got %d", resp.StatusCode)
+	}
+
+	resp = request(t, ts, http.MethodGet, "/clients", "")
+	clients := decode[[]clientJSON](t, resp)
+	if len(clients) != 1 || clients[0].Name != "laptop" {
+		t.Errorf("unexpected clients %+v", clients)
+	}
+	resp = request(t, ts, http.MethodGet, "/clients/laptop", "")
+	if client := decode[clientJSON](t, resp); client.PublicKey != created.PublicKey {
+		t.Errorf("unexpected client %+v", client)
+	}
+
+	// same keys, no private key
+	resp = request(t, ts, http.MethodGet, "/clients/laptop/config", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	config := decode[configJSON](t, resp)
+	if config.PublicKey != created.PublicKey || config.PrivateKey != "" || strings.Contains(config.Config, "PrivateKey =") {
+		t.Errorf("unexpected config %+v", config)
+	}
+	resp = request(t, ts, http.MethodGet, "/clients/laptop/config", "", "Accept", "image/png")
+	if resp.StatusCode != http.StatusNotAcceptable {
+		t.Errorf("expected 406 for a QR code without private key, got %d", resp.StatusCode)
+	}
+	resp = request(t, ts, http.MethodPost, "/clients/laptop/config", "")
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 (no rotation on the config), got %d", resp.StatusCode)
+	}
+
+	// new keys, same address and settings
+	resp = request(t, ts, http.MethodPost, "/clients/laptop/rotate", `{"dns": ["9.9.9.9"]}`)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for settings on a rotation, got %d", resp.StatusCode)
+	}
+	resp = request(t, ts, http.MethodPost, "/clients/laptop/rotate", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	reissued := decode[configJSON](t, resp)
+	if reissued.PublicKey == created.PublicKey || strings.Join(reissued.Addresses, ",") != "10.0.0.2/32" {
+		t.Errorf("unexpected reissued client %+v", reissued.clientJSON)
+	}
+	if reissued.PrivateKey == "" || strings.Contains(reissued.Config, "PresharedKey") != strings.Contains(config.Config, "PresharedKey") {
+		t.Errorf("expected a complete config with the same settings:\n%s", reissued.Config)
+	}
+
+	resp = request(t, ts, http.MethodDelete, "/clients/laptop", "")
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", resp.StatusCode)
+	}
+	for _, method := range []string{http.MethodGet, http.MethodDelete} {
+		resp = request(t, ts, method, "/clients/laptop", "")
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d", method, resp.StatusCode)
+		}
+	}
+}
+
+func TestClientQRCode(t *testing.T) {
+	ts, _ := newTestServer(t)
+	resp := request(t, ts, http.MethodPost, "/clients", `{"name": "phone"}`, "Accept", "image/png")
+	if resp.StatusCode != http.StatusCreated || resp.Header.Get("Content-Type") != "image/png" {
+		t.Fatalf("expected a png, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	var buf bytes.Buffer
+	buf.ReadFrom(resp.Body)
+	if _, err := png.Decode(&buf); err != nil {
+		t.Errorf("invalid png: %v", err)
+	}
+
+	resp = request(t, ts, http.MethodPost, "/clients", `{"name": "router", "format": "routeros"}`, "Accept", "image/png")
+	if resp.StatusCode != http.StatusNotAcceptable {
+		t.Errorf("expected 406, got %d", resp.StatusCode)
+	}
+}
+
+func TestInvalidRequests(t *testing.T) {
+	ts, _ := newTestServer(t)
+	for _, body := range []string{
+		`{"name": "laptop", "unknown": true}`,
+		`{"name": "laptop", "dns": ["not an ip"]}`,
+		`{"name": "laptop", "static_ip": "10.0.0.300"}`,
+		`{"name": "laptop", "public_key": "short"}`,
+		`{"name": "laptop", "format": "unknown"}`,
+		`{"name": ""}`,
+		`{"name": "laptop\n[Interface]\nPostUp = touch /tmp/pwned"}`,
+		`not json`,
+	} {
+		resp := request(t, ts, http.MethodPost, "/clients", body)
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", body, resp.StatusCode)
+		}
+	}
+	// the bodies are limited
+	tags := strings.Repeat(`"tag",`, MAX_BODY_SIZE/6)
+	resp := request(t, ts, http.MethodPost, "/clients", `{"name": "laptop", "tags": [`+tags+`"tag"]}`)
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413, got %d", resp.StatusCode)
+	}
+	resp = request(t, ts, http.MethodGet, "/clients", "")
+	if clients := decode[[]clientJSON](t, resp); len(clients) != 0 {
+		t.Errorf("expected no clients, got %+v", clients)
+	}
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/asiffer/wg-easy-vpn/export"
+	"github.com/asiffer/wg-easy-vpn/models"
+	"github.com/asiffer/wg-easy-vpn/pkg/wgeasy"
+	"github.com/rs/zerolog/log"
+)
+
+// SHARE_PURGE_INTERVAL is the period of the removal of the expired shares
+const SHARE_PURGE_INTERVAL = time.Minute
+
+// shareRoutes registers the one-time links. GET only shows a page (link
+// previews must not use the share), POST returns the config once.
+func (s *Server) shareRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET "+export.SHARE_PREFIX+"/{token}", s.sharePage)
+	mux.HandleFunc("POST "+export.SHARE_PREFIX+"/{token}", s.takeShare)
+}
+
+// PurgeShares wipes the expired shares until the context is done
+func (s *Server) PurgeShares(ctx context.Context) {
+	ticker := time.NewTicker(SHARE_PURGE_INTERVAL)
+	defer ticker.Stop()
+	for {
+		if purged, err := s.shares.Purge(); err != nil {
+			log.Error().Err(err).Msg("Error while purging the expired shares")
+		} else if purged > 0 {
+			log.Info().Int("shares", purged).Msg("Expired shares wiped")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// noShareLeaks keeps the links and the configs out of the caches and of
+// the referers
+func noShareLeaks(w http.ResponseWriter) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+}
+
+func (s *Server) sharePage(w http.ResponseWriter, r *http.Request) {
+	noShareLeaks(w)
+	expires, err := s.shares.Expires(r.PathValue("token"))
+	if err != nil {
+		s.render(w, http.StatusNotFound, "expired.html", page{Title: "Shared config"})
+		return
+	}
+	s.render(w, http.StatusOK, "share.html", page{
+		Title:   "Shared config",
+		Expires: expires.Local().Format(time.RFC1123),
+	})
+}
+
+// takeShare returns a shared config (an html page for the browsers, a QR
+// code with Accept: image/png, the raw config otherwise) and wipes it
+func (s *Server) takeShare(w http.ResponseWriter, r *http.Request) {
+	noShareLeaks(w)
+	html := strings.Contains(r.Header.Get("Accept"), "text/html")
+	share, err := s.shares.Take(r.PathValue("token"), func(share *export.Share) error {
+		if acceptsPNG(r) && share.Format != models.FormatWGQuick {
+			return &statusError{
+				status: http.StatusNotAcceptable,
+				err:    fmt.Errorf("QR codes are only available with the %s format", models.FormatWGQuick),
+			}
+		}
+		return nil
+	})
+	switch {
+	case errors.Is(err, export.ErrShareNotFound) && html:
+		s.render(w, http.StatusNotFound, "expired.html", page{Title: "Shared config"})
+		return
+	case errors.Is(err, export.ErrShareNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), errorStatus(err, http.StatusInternalServerError))
+		return
+	}
+	log.Info().Str("client", share.Name).Str("remote", r.RemoteAddr).Msg("Shared config downloaded")
+
+	config := &wgeasy.ClientConfig{
+		Client: wgeasy.Client{Name: share.Name},
+		Format: share.Format,
+		Config: share.Config,
+	}
+	switch {
+	case html:
+		s.renderConfig(w, nil, config)
+	case acceptsPNG(r):
+		img, err := config.QRCode()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(img)
+	default:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", s.name()+models.ClientConfigSuffix(share.Format)))
+		w.Write(share.Config)
+	}
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"bytes"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asiffer/wg-easy-vpn/export"
+	"github.com/asiffer/wg-easy-vpn/models"
+)
+
+// newTestShare serves the shares of a new vpn config (no API, no UI) and
+// stores a share
+func newTestShare(t *testing.T, format string) (*httptest.Server, string) {
+	t.Helper()
+	path := newTestConfig(t)
+	ts := httptest.NewServer(New(path, "", nil).Handler())
+	t.Cleanup(ts.Close)
+	share := &export.Share{Name: "laptop", Format: format, Config: []byte("[Interface]\nPrivateKey = secret\n")}
+	token, err := export.NewShareStore(path).Put(share, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ts, token
+}
+
+// shareRequest sends a request to a share link
+func shareRequest(t *testing.T, ts *httptest.Server, method, token, accept string) (int, http.Header, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(method, export.ShareURL(ts.URL, token), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var body bytes.Buffer
+	body.ReadFrom(resp.Body)
+	return resp.StatusCode, resp.Header, body.Bytes()
+}
+
+func TestShareOnce(t *testing.T) {
+	ts, token := newTestShare(t, models.FormatWGQuick)
+
+	// the page does not use the share (link previews)
+	for range 2 {
+		status, header, body := shareRequest(t, ts, http.MethodGet, token, "text/html")
+		if status != http.StatusOK || !strings.Contains(string(body), `<form method="post">`) {
+			t.Fatalf("expected the share page, got %d", status)
+		}
+		if header.Get("Referrer-Policy") != "no-referrer" || header.Get("Cache-Control") != "no-store" {
+			t.Errorf("unexpected headers %v", header)
+		}
+	}
+
+	status, header, body := shareRequest(t, ts, http.MethodPost, token, "")
+	if status != http.StatusOK || !strings.Contains(string(body), "PrivateKey = secret") {
+		t.Fatalf("expected the config, got %d: %s", status, body)
+	}
+	if !strings.Contains(header.Get("Content-Disposition"), `filename="wg0.conf"`) {
+		t.Errorf("unexpected Content-Disposition %q", header.Get("Content-Disposition"))
+	}
+
+	if status, _, _ = shareRequest(t, ts, http.MethodPost, token, ""); status != http.StatusNotFound {
+		t.Errorf("expected 404 for a used link, got %d", status)
+	}
+	status, _, body = shareRequest(t, ts, http.MethodGet, token, "text/html")
+	if status != http.StatusNotFound || !strings.Contains(string(body), "expired or was already used") {
+		t.Errorf("expected the expired page, got %d", status)
+	}
+	if status, _, _ = shareRequest(t, ts, http.MethodGet, "unknown", ""); status != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown link, got %d", status)
+	}
+}
+
+func TestShareHTML(t *testing.T) {
+	ts, token := newTestShare(t, models.FormatWGQuick)
+	status, _, body := shareRequest(t, ts, http.MethodPost, token, "text/html")
+	if status != http.StatusOK {
+		t.Fatalf("expected 200, got %d", status)
+	}
+	for _, expected := range []string{"PrivateKey = secret", `src="data:image/png;base64,`, `download="wg0.conf"`} {
+		if !strings.Contains(string(body), expected) {
+			t.Errorf("expected %q in the config page", expected)
+		}
+	}
+}
+
+func TestShareQRCode(t *testing.T) {
+	ts, token := newTestShare(t, models.FormatWGQuick)
+	status, header, body := shareRequest(t, ts, http.MethodPost, token, "image/png")
+	if status != http.StatusOK || header.Get("Content-Type") != "image/png" {
+		t.Fatalf("expected a QR code, got %d", status)
+	}
+	if _, err := png.Decode(bytes.NewReader(body)); err != nil {
+		t.Errorf("invalid png: %v", err)
+	}
+
+	// no QR code for the other formats: the share is kept
+	ts, token = newTestShare(t, models.FormatNM)
+	if status, _, _ = shareRequest(t, ts, http.MethodPost, token, "image/png"); status != http.StatusNotAcceptable {
+		t.Errorf("expected 406, got %d", status)
+	}
+	status, header, _ = shareRequest(t, ts, http.MethodPost, token, "")
+	if status != http.StatusOK || !strings.Contains(header.Get("Content-Disposition"), ".nmconnection") {
+		t.Errorf("expected the config after a refused QR code, got %d", status)
+	}
+}
@@ -0,0 +1,274 @@
+package server
+
+import (
+	"embed"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/asiffer/wg-easy-vpn/models"
+	"github.com/asiffer/wg-easy-vpn/pkg/wgeasy"
+	"github.com/asiffer/wg-easy-vpn/utils"
+	"github.com/rs/zerolog/log"
+)
+
+// UI_PREFIX is the prefix of the pages of the web UI
+const UI_PREFIX = "/ui"
+
+// SESSION_COOKIE is the cookie of the sessions of the web UI
+const SESSION_COOKIE = "wg_easy_vpn_session"
+
+//go:embed ui
+var uiFS embed.FS
+
+var templates = template.Must(template.ParseFS(uiFS, "ui/*.html"))
+
+// page is the data of the templates
+type page struct {
+	Title string
+	VPN   string
+	User  *User
+	Error string
+	Admin bool
+	// devices.html
+	Devices []device
+	// config.html
+	Device   string
+	Config   string
+	QRCode   template.URL
+	Download template.URL
+	Filename string
+	// share.html
+	Expires string
+}
+
+// device is a row of the devices page
+type device struct {
+	Name      string
+	Label     string // name without the owner
+	Addresses string
+	PublicKey string
+}
+
+// uiRoutes registers the pages of the web UI
+func (s *Server) uiRoutes(mux *http.ServeMux) {
+	static, _ := fs.Sub(uiFS, "ui")
+	mux.Handle("GET "+UI_PREFIX+"/static/", http.StripPrefix(UI_PREFIX+"/static/", http.FileServerFS(static)))
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, UI_PREFIX+"/", http.StatusSeeOther)
+	})
+	mux.HandleFunc("GET "+UI_PREFIX+"/login", s.loginPage)
+	mux.HandleFunc("POST "+UI_PREFIX+"/login", s.sameOrigin(s.login))
+	mux.HandleFunc("POST "+UI_PREFIX+"/logout", s.sameOrigin(s.logout))
+	mux.HandleFunc("GET "+UI_PREFIX+"/{$}", s.loggedIn(s.devicesPage))
+	mux.HandleFunc("POST "+UI_PREFIX+"/devices", s.sameOrigin(s.loggedIn(s.createDevice)))
+	mux.HandleFunc("POST "+UI_PREFIX+"/devices/{name}/reissue", s.sameOrigin(s.loggedIn(s.reissueDevice)))
+	mux.HandleFunc("POST "+UI_PREFIX+"/devices/{name}/revoke", s.sameOrigin(s.loggedIn(s.revokeDevice)))
+}
+
+// userHandler is a page of a logged in user
+type userHandler func(w http.ResponseWriter, r *http.Request, user *User)
+
+// loggedIn redirects the anonymous requests to the login page
+func (s *Server) loggedIn(handler userHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie(SESSION_COOKIE)
+		if err != nil {
+			http.Redirect(w, r, UI_PREFIX+"/login", http.StatusSeeOther)
+			return
+		}
+		user := s.sessions.get(cookie.Value)
+		if user == nil {
+			http.Redirect(w, r, UI_PREFIX+"/login", http.StatusSeeOther)
+			return
+		}
+		handler(w, r, user)
+	}
+}
+
+// sameOrigin rejects the forms posted from another site (the session
+// cookie is SameSite=Strict too)
+func (s *Server) sameOrigin(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if origin := r.Header.Get("Origin"); origin != "" {
+			if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+				http.Error(w, "cross-origin request", http.StatusForbidden)
+				return
+			}
+		}
+		handler(w, r)
+	}
+}
+
+// render writes a page
+func (s *Server) render(w http.ResponseWriter, status int, name string, data page) {
+	data.VPN = s.name()
+	if data.User != nil {
+		data.Admin = data.User.Role == RoleAdmin
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := templates.ExecuteTemplate(w, name, data); err != nil {
+		log.Error().Err(err).Str("template", name).Msg("Error while rendering the page")
+	}
+}
+
+func (s *Server) loginPage(w http.ResponseWriter, _ *http.Request) {
+	s.render(w, http.StatusOK, "login.html", page{Title: "Log in"})
+}
+
+func (s *Server) login(w http.ResponseWriter, r *http.Request) {
+	id, err := s.sessions.login(r.PostFormValue("user"), r.PostFormValue("password"))
+	if err != nil {
+		log.Warn().Str("user", r.PostFormValue("user")).Str("remote", r.RemoteAddr).Msg("Failed login")
+		s.render(w, http.StatusUnauthorized, "login.html", page{Title: "Log in", Error: err.Error()})
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     SESSION_COOKIE,
+		Value:    id,
+		Path:     UI_PREFIX,
+		MaxAge:   int(SESSION_TTL.Seconds()),
+		HttpOnly: true,
+		// only sent over HTTPS (or to localhost): serve uses TLS or
+		// listens on a loopback address behind a reverse proxy
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.Redirect(w, r, UI_PREFIX+"/", http.StatusSeeOther)
+}
+
+func (s *Server) logout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(SESSION_COOKIE); err == nil {
+		s.sessions.logout(cookie.Value)
+	}
+	http.SetCookie(w, &http.Cookie{Name: SESSION_COOKIE, Path: UI_PREFIX, MaxAge: -1, HttpOnly: true, Secure: true})
+	http.Redirect(w, r, UI_PREFIX+"/login", http.StatusSeeOther)
+}
+
+func (s *Server) devicesPage(w http.ResponseWriter, _ *http.Request, user *User) {
+	s.renderDevices(w, http.StatusOK, user, "")
+}
+
+// renderDevices writes the devices of the user (with an error message)
+func (s *Server) renderDevices(w http.ResponseWriter, status int, user *User, message string) {
+	var clients []wgeasy.Client
+	err := s.withVPN(false, func(vpn *wgeasy.VPN) error {
+		clients = vpn.Clients()
+		return nil
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	devices := make([]device, 0, len(clients))
+	for _, client := range clients {
+		if !user.owns(client.Name) {
+			continue
+		}
+		label := client.Name
+		if user.Role != RoleAdmin {
+			label = strings.TrimPrefix(label, user.Name+DEVICE_SEPARATOR)
+		}
+		devices = append(devices, device{
+			Name:      client.Name,
+			Label:     label,
+			Addresses: strings.Join(utils.StringifyNetworks(client.Addresses), ", "),
+			PublicKey: client.PublicKey,
+		})
+	}
+	s.render(w, status, "devices.html", page{Title: "Devices", User: user, Devices: devices, Error: message})
+}
+
+func (s *Server) createDevice(w http.ResponseWriter, r *http.Request, user *User) {
+	name := strings.TrimSpace(r.PostFormValue("name"))
+	// the names are written in the server config (whatever the role); the
+	// admins may name the devices of the other users (<user>.<device>)
+	parts := []string{name}
+	if user.Role == RoleAdmin {
+		parts = strings.Split(name, DEVICE_SEPARATOR)
+	}
+	for _, part := range parts {
+		if !userRex.MatchString(part) {
+			s.renderDevices(w, http.StatusBadRequest, user, fmt.Sprintf("invalid device name %q (letters, digits, - and _ only)", name))
+			return
+		}
+	}
+	if user.Role != RoleAdmin {
+		name = user.Name + DEVICE_SEPARATOR + name
+	}
+	var config *wgeasy.ClientConfig
+	err := s.withVPN(true, func(vpn *wgeasy.VPN) (err error) {
+		config, err = vpn.AddClient(name)
+		return err
+	})
+	if err != nil {
+		s.renderDevices(w, errorStatus(err, http.StatusInternalServerError), user, err.Error())
+		return
+	}
+	log.Info().Str("user", user.Name).Str("client", name).Msg("Client created from the web UI")
+	s.renderConfig(w, user, config)
+}
+
+func (s *Server) reissueDevice(w http.ResponseWriter, r *http.Request, user *User) {
+	name := r.PathValue("name")
+	if !user.owns(name) {
+		s.renderDevices(w, http.StatusForbidden, user, fmt.Sprintf("%s is not one of your devices", name))
+		return
+	}
+	var config *wgeasy.ClientConfig
+	err := s.withVPN(true, func(vpn *wgeasy.VPN) (err error) {
+		config, err = vpn.ReissueClient(name)
+		return err
+	})
+	if err != nil {
+		s.renderDevices(w, errorStatus(err, http.StatusInternalServerError), user, err.Error())
+		return
+	}
+	log.Info().Str("user", user.Name).Str("client", name).Msg("Client reissued from the web UI")
+	s.renderConfig(w, user, config)
+}
+
+func (s *Server) revokeDevice(w http.ResponseWriter, r *http.Request, user *User) {
+	name := r.PathValue("name")
+	if !user.owns(name) {
+		s.renderDevices(w, http.StatusForbidden, user, fmt.Sprintf("%s is not one of your devices", name))
+		return
+	}
+	err := s.withVPN(true, func(vpn *wgeasy.VPN) error {
+		return vpn.RemoveClient(name)
+	})
+	if err != nil {
+		s.renderDevices(w, errorStatus(err, http.StatusInternalServerError), user, err.Error())
+		return
+	}
+	log.Info().Str("user", user.Name).Str("client", name).Msg("Client revoked from the web UI")
+	http.Redirect(w, r, UI_PREFIX+"/", http.StatusSeeOther)
+}
+
+// renderConfig writes the page of a new config (shown only once)
+func (s *Server) renderConfig(w http.ResponseWriter, user *User, config *wgeasy.ClientConfig) {
+	data := page{
+		Title:    config.Name,
+		User:     user,
+		Device:   config.Name,
+		Config:   string(config.Config),
+		Download: template.URL("data:text/plain;base64," + base64.StdEncoding.EncodeToString(config.Config)),
+		Filename: s.name() + models.ClientConfigSuffix(config.Format),
+	}
+	if config.Format == models.FormatWGQuick {
+		img, err := config.QRCode()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		data.QRCode = template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(img))
+	}
+	// the pages of the configs must not be kept by the browser
+	w.Header().Set("Cache-Control", "no-store")
+	s.render(w, http.StatusOK, "config.html", data)
+}
@@ -0,0 +1,258 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// newTestUI serves the web UI of a new vpn config (users alice and bob,
+// admin root; the passwords are the names)
+func newTestUI(t *testing.T) *httptest.Server {
+	t.Helper()
+	users := make([]User, 0)
+	for _, name := range []string{"alice", "bob", "root"} {
+		hash, err := bcrypt.GenerateFromPassword([]byte(name), bcrypt.MinCost)
+		if err != nil {
+			t.Fatal(err)
+		}
+		role := RoleUser
+		if name == "root" {
+			role = RoleAdmin
+		}
+		users = append(users, User{Name: name, Password: string(hash), Role: role})
+	}
+	srv := New(newTestConfig(t), "", users)
+	ts := httptest.NewServer(srv.Handler())
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// browser is a client of the web UI with its cookies
+type browser struct {
+	t      *testing.T
+	ts     *httptest.Server
+	client *http.Client
+}
+
+func newBrowser(t *testing.T, ts *httptest.Server) *browser {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &browser{t: t, ts: ts, client: &http.Client{Jar: jar}}
+}
+
+// get returns the status and the body of a page
+func (b *browser) get(path string) (int, string) {
+	b.t.Helper()
+	resp, err := b.client.Get(b.ts.URL + path)
+	if err != nil {
+		b.t.Fatal(err)
+	}
+	return readPage(b.t, resp)
+}
+
+// post submits a form
+func (b *browser) post(path string, form url.Values) (int, string) {
+	b.t.Helper()
+	resp, err := b.client.PostForm(b.ts.URL+path, form)
+	if err != nil {
+		b.t.Fatal(err)
+	}
+	return readPage(b.t, resp)
+}
+
+func (b *browser) login(name string) {
+	b.t.Helper()
+	status, body := b.post(UI_PREFIX+"/login", url.Values{"user": {name}, "password": {name}})
+	if status != http.StatusOK || !strings.Contains(body, "Log out") {
+		b.t.Fatalf("login of %s failed: %d %s", name, status, body)
+	}
+}
+
+func readPage(t *testing.T, resp *http.Response) (int, string) {
+	t.Helper()
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+func TestUILogin(t *testing.T) {
+	ts := newTestUI(t)
+	b := newBrowser(t, ts)
+
+	status, body := b.get("/")
+	if status != http.StatusOK || !strings.Contains(body, `action="/ui/login"`) {
+		t.Errorf("expected the login page, got %d", status)
+	}
+	status, _ = b.post(UI_PREFIX+"/login", url.Values{"user": {"alice"}, "password": {"wrong"}})
+	if status != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %d", status)
+	}
+	status, _ = b.post(UI_PREFIX+"/login", url.Values{"user": {"nobody"}, "password": {"nobody"}})
+	if status != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %d", status)
+	}
+
+	b.login("alice")
+	status, body = b.post(UI_PREFIX+"/logout", nil)
+	if status != http.StatusOK || !strings.Contains(body, `action="/ui/login"`) {
+		t.Errorf("expected the login page after logout, got %d", status)
+	}
+	if _, body = b.get(UI_PREFIX + "/"); strings.Contains(body, "Log out") {
+		t.Error("the session is still valid after logout")
+	}
+
+	// the session cookie is never sent in plain HTTP (but to localhost)
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := noRedirect.PostForm(ts.URL+UI_PREFIX+"/login", url.Values{"user": {"alice"}, "password": {"alice"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	readPage(t, resp)
+	if cookies := resp.Cookies(); len(cookies) != 1 || !cookies[0].Secure || !cookies[0].HttpOnly {
+		t.Errorf("expected a secure session cookie, got %v", cookies)
+	}
+}
+
+func TestUIDevices(t *testing.T) {
+	ts := newTestUI(t)
+	alice := newBrowser(t, ts)
+	alice.login("alice")
+	bob := newBrowser(t, ts)
+	bob.login("bob")
+	root := newBrowser(t, ts)
+	root.login("root")
+
+	// create
+	status, body := alice.post(UI_PREFIX+"/devices", url.Values{"name": {"laptop"}})
+	if status != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", status, body)
+	}
+	for _, expected := range []string{"alice.laptop", "PrivateKey = ", `src="data:image/png;base64,`, `download="wg0.conf"`} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("expected %q in the config page", expected)
+		}
+	}
+	if status, _ = alice.post(UI_PREFIX+"/devices", url.Values{"name": {"bob.phone"}}); status != http.StatusBadRequest {
+		t.Errorf("expected 400 for a name with the separator, got %d", status)
+	}
+	if status, _ = alice.post(UI_PREFIX+"/devices", url.Values{"name": {"laptop"}}); status != http.StatusConflict {
+		t.Errorf("expected 409 for an existing device, got %d", status)
+	}
+	if status, _ = bob.post(UI_PREFIX+"/devices", url.Values{"name": {"phone"}}); status != http.StatusOK {
+		t.Errorf("expected 200, got %d", status)
+	}
+	if status, _ = root.post(UI_PREFIX+"/devices", url.Values{"name": {"bob.tablet"}}); status != http.StatusOK {
+		t.Errorf("expected 200 for an admin, got %d", status)
+	}
+	if status, _ = root.post(UI_PREFIX+"/devices", url.Values{"name": {"x\n[Interface]\nPostUp = id"}}); status != http.StatusBadRequest {
+		t.Errorf("expected 400 for a multi-line name, got %d", status)
+	}
+
+	// visibility
+	_, body = alice.get(UI_PREFIX + "/")
+	if !strings.Contains(body, "<td>laptop</td>") || strings.Contains(body, "bob.phone") {
+		t.Errorf("alice must only see her devices: %s", body)
+	}
+	_, body = root.get(UI_PREFIX + "/")
+	if !strings.Contains(body, "alice.laptop") || !strings.Contains(body, "bob.phone") {
+		t.Errorf("the admin must see all the clients: %s", body)
+	}
+
+	// the devices of the others
+	if status, _ = alice.post(UI_PREFIX+"/devices/bob.phone/reissue", nil); status != http.StatusForbidden {
+		t.Errorf("expected 403, got %d", status)
+	}
+	if status, _ = alice.post(UI_PREFIX+"/devices/bob.phone/revoke", nil); status != http.StatusForbidden {
+		t.Errorf("expected 403, got %d", status)
+	}
+
+	// reissue and revoke
+	status, body = alice.post(UI_PREFIX+"/devices/alice.laptop/reissue", nil)
+	if status != http.StatusOK || !strings.Contains(body, "PrivateKey = ") {
+		t.Errorf("expected a new config, got %d", status)
+	}
+	if status, _ = alice.post(UI_PREFIX+"/devices/alice.laptop/revoke", nil); status != http.StatusOK {
+		t.Errorf("expected 200, got %d", status)
+	}
+	if _, body = alice.get(UI_PREFIX + "/"); strings.Contains(body, "<td>laptop</td>") {
+		t.Error("the device is still listed after its revocation")
+	}
+	if status, _ = root.post(UI_PREFIX+"/devices/bob.phone/revoke", nil); status != http.StatusOK {
+		t.Errorf("expected 200 for the admin, got %d", status)
+	}
+}
+
+func TestUICrossOrigin(t *testing.T) {
+	ts := newTestUI(t)
+	b := newBrowser(t, ts)
+	b.login("alice")
+	req, err := http.NewRequest(http.MethodPost, ts.URL+UI_PREFIX+"/devices", strings.NewReader("name=laptop"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Origin", "https://evil.example.com")
+	resp, err := b.client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := readPage(t, resp); status != http.StatusForbidden {
+		t.Errorf("expected 403, got %d", status)
+	}
+
+	// login CSRF: the session of the attacker
+	other := newBrowser(t, ts)
+	req, err = http.NewRequest(http.MethodPost, ts.URL+UI_PREFIX+"/login", strings.NewReader("user=bob&password=bob"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Origin", "https://evil.example.com")
+	resp, err = other.client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := readPage(t, resp); status != http.StatusForbidden {
+		t.Errorf("expected 403 for a cross-origin login, got %d", status)
+	}
+}
+
+func TestUIDisabledRoutes(t *testing.T) {
+	// API only
+	api, _ := newTestServer(t)
+	resp, err := http.Get(api.URL + UI_PREFIX + "/login")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := readPage(t, resp); status != http.StatusNotFound {
+		t.Errorf("expected 404 without users, got %d", status)
+	}
+	// UI only
+	ui := newTestUI(t)
+	resp, err = http.Get(ui.URL + API_PREFIX + "/clients")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := readPage(t, resp); status != http.StatusNotFound {
+		t.Errorf("expected 404 without token, got %d", status)
+	}
+	resp, err = http.Get(ui.URL + UI_PREFIX + "/static/style.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := readPage(t, resp); status != http.StatusOK {
+		t.Errorf("expected the stylesheet, got %d", status)
+	}
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+)
+
+// roles of the users of the web UI
+const (
+	// RoleAdmin manages all the clients
+	RoleAdmin = "admin"
+	// RoleUser manages its own devices (clients named <user>.<device>)
+	RoleUser = "user"
+)
+
+// DEVICE_SEPARATOR separates the owner and the device in the name of the
+// clients of the users
+const DEVICE_SEPARATOR = "."
+
+// SESSION_TTL is the lifetime of the sessions of the web UI
+const SESSION_TTL = 12 * time.Hour
+
+var userRex = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// User is a user of the web UI
+type User struct {
+	Name     string `yaml:"name"`
+	Password string `yaml:"password"` // bcrypt hash
+	Role     string `yaml:"role"`
+}
+
+// ReadUsers reads the users of the web UI (yaml list)
+func ReadUsers(r io.Reader) ([]User, error) {
+	decoder := yaml.NewDecoder(r)
+	decoder.KnownFields(true)
+	users := make([]User, 0)
+	if err := decoder.Decode(&users); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("error while decoding users (%w)", err)
+	}
+	names := make(map[string]bool)
+	for i, user := range users {
+		switch {
+		case !userRex.MatchString(user.Name):
+			return nil, fmt.Errorf("user %d: invalid name %q (letters, digits, - and _ only)", i+1, user.Name)
+		case names[user.Name]:
+			return nil, fmt.Errorf("user %d: duplicate name %s", i+1, user.Name)
+		case user.Role != RoleAdmin && user.Role != RoleUser:
+			return nil, fmt.Errorf("user %s: unknown role %q (expected %s or %s)", user.Name, user.Role, RoleAdmin, RoleUser)
+		}
+		if _, err := bcrypt.Cost([]byte(user.Password)); err != nil {
+			return nil, fmt.Errorf("user %s: the password must be a bcrypt hash (%w)", user.Name, err)
+		}
+		names[user.Name] = true
+	}
+	return users, nil
+}
+
+// ReadUsersFile reads the users of the web UI from a file
+func ReadUsersFile(path string) ([]User, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error while opening users file (%w)", err)
+	}
+	defer f.Close()
+	return ReadUsers(f)
+}
+
+// owns returns whether a client belongs to the user
+func (user *User) owns(client string) bool {
+	if user.Role == RoleAdmin {
+		return true
+	}
+	return strings.HasPrefix(client, user.Name+DEVICE_SEPARATOR)
+}
+
+// session is a user logged in the web UI
+type session struct {
+	user    *User
+	expires time.Time
+}
+
+// sessions are the sessions of the web UI (in memory: a restart logs the
+// users out)
+type sessions struct {
+	mu    sync.Mutex
+	users map[string]*User
+	byID  map[string]session
+}
+
+func newSessions(users []User) *sessions {
+	s := &sessions{users: make(map[string]*User), byID: make(map[string]session)}
+	for i := range users {
+		s.users[users[i].Name] = &users[i]
+	}
+	return s
+}
+
+// dummyHash is compared when the user is unknown (same duration)
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("wg-easy-vpn"), bcrypt.DefaultCost)
+
+// login checks the credentials and returns the id of a new session
+func (s *sessions) login(name string, password string) (string, error) {
+	s.mu.Lock()
+	user, ok := s.users[name]
+	s.mu.Unlock()
+	if !ok {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return "", fmt.Errorf("invalid user or password")
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		return "", fmt.Errorf("invalid user or password")
+	}
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(raw)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.byID[id] = session{user: user, expires: time.Now().Add(SESSION_TTL)}
+	return id, nil
+}
+
+// get returns the user of a session (nil if unknown or expired)
+func (s *sessions) get(id string) *User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for other, sess := range s.byID {
+		if now.After(sess.expires) {
+			delete(s.byID, other)
+		}
+	}
+	if sess, ok := s.byID[id]; ok {
+		return sess.user
+	}
+	return nil
+}
+
+// logout removes a session
+func (s *sessions) logout(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.byID, id)
+}
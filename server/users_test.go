@@ -0,0 +1,37 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestReadUsers(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("pw"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := fmt.Sprintf("- name: alice\n  password: '%s'\n  role: user\n- name: root\n  password: '%s'\n  role: admin\n", hash, hash)
+	users, err := ReadUsers(strings.NewReader(valid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || users[0].Name != "alice" || users[1].Role != RoleAdmin {
+		t.Errorf("unexpected users: %+v", users)
+	}
+
+	invalid := map[string]string{
+		"name":      fmt.Sprintf("- name: al.ice\n  password: '%s'\n  role: user\n", hash),
+		"duplicate": fmt.Sprintf("- name: alice\n  password: '%s'\n  role: user\n- name: alice\n  password: '%s'\n  role: user\n", hash, hash),
+		"role":      fmt.Sprintf("- name: alice\n  password: '%s'\n  role: owner\n", hash),
+		"password":  "- name: alice\n  password: pw\n  role: user\n",
+		"field":     fmt.Sprintf("- name: alice\n  password: '%s'\n  role: user\n  email: a@b.c\n", hash),
+	}
+	for name, content := range invalid {
+		if _, err := ReadUsers(strings.NewReader(content)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package utils
+
+import (
+	"net"
+	"net/netip"
+	"slices"
+)
+
+// ExcludeNetworks returns the minimal list of networks covering the
+// include networks minus the exclude ones (split tunnelling).
+// IPv4 and IPv6 networks are handled independently: an IPv4 exclusion
+// never affects an IPv6 network and vice versa.
+func ExcludeNetworks(include []net.IPNet, exclude []net.IPNet) []net.IPNet {
+	prefixes := make([]netip.Prefix, 0, len(include))
+	for _, n := range include {
+		if p, ok := toPrefix(n); ok {
+			prefixes = append(prefixes, p)
+		}
+	}
+
+	for _, n := range exclude {
+		e, ok := toPrefix(n)
+		if !ok {
+			continue
+		}
+		remaining := make([]netip.Prefix, 0, len(prefixes))
+		for _, p := range prefixes {
+			remaining = append(remaining, subtractPrefix(p, e)...)
+		}
+		prefixes = remaining
+	}
+
+	prefixes = aggregatePrefixes(prefixes)
+	out := make([]net.IPNet, len(prefixes))
+	for i, p := range prefixes {
+		out[i] = fromPrefix(p)
+	}
+	return out
+}
+
+// SplitNetworks splits the networks into n non-overlapping groups
+// covering the same addresses (one group per gateway for instance).
+// Each family (IPv4, IPv6) is split independently, so that the default
+// routes 0.0.0.0/0 and ::/0 give 0.0.0.0/1 and ::/1 to the first group
+// and 128.0.0.0/1 and 8000::/1 to the second one.
+func SplitNetworks(nets []net.IPNet, n int) [][]net.IPNet {
+	groups := make([][]net.IPNet, n)
+	if n <= 0 {
+		return groups
+	}
+	for i := range groups {
+		groups[i] = make([]net.IPNet, 0)
+	}
+
+	v4 := make([]netip.Prefix, 0)
+	v6 := make([]netip.Prefix, 0)
+	for _, network := range nets {
+		if p, ok := toPrefix(network); ok {
+			if p.Addr().Is4() {
+				v4 = append(v4, p)
+			} else {
+				v6 = append(v6, p)
+			}
+		}
+	}
+
+	for _, family := range [][]netip.Prefix{v4, v6} {
+		prefixes := splitPrefixes(aggregatePrefixes(family), n)
+		// contiguous chunks of prefixes
+		for i := range n {
+			for _, p := range prefixes[i*len(prefixes)/n : (i+1)*len(prefixes)/n] {
+				groups[i] = append(groups[i], fromPrefix(p))
+			}
+		}
+	}
+	return groups
+}
+
+// splitPrefixes halves the largest prefixes until there are at least
+// n of them (or they cannot be split anymore). The order is kept.
+func splitPrefixes(prefixes []netip.Prefix, n int) []netip.Prefix {
+	for len(prefixes) > 0 && len(prefixes) < n {
+		largest := -1
+		for i, p := range prefixes {
+			if p.Bits() < p.Addr().BitLen() && (largest < 0 || p.Bits() < prefixes[largest].Bits()) {
+				largest = i
+			}
+		}
+		if largest < 0 {
+			break
+		}
+		low, high := halves(prefixes[largest])
+		prefixes = slices.Replace(prefixes, largest, largest+1, low, high)
+	}
+	return prefixes
+}
+
+// NetworksOverlap returns whether two networks share at least one address
+func NetworksOverlap(a net.IPNet, b net.IPNet) bool {
+	pa, okA := toPrefix(a)
+	pb, okB := toPrefix(b)
+	return okA && okB && pa.Overlaps(pb)
+}
+
+// toPrefix converts a net.IPNet into a masked netip.Prefix. The family
+// is given by the mask length so that IPv4 networks stored with a 16-byte
+// IP (like IPv4ZeroNet) are still seen as IPv4.
+func toPrefix(n net.IPNet) (netip.Prefix, bool) {
+	ones, bits := n.Mask.Size()
+	if bits == 0 {
+		return netip.Prefix{}, false
+	}
+	var addr netip.Addr
+	if bits == IPv4Len {
+		ip4 := n.IP.To4()
+		if ip4 == nil {
+			return netip.Prefix{}, false
+		}
+		addr = netip.AddrFrom4([4]byte(ip4))
+	} else {
+		ip16 := n.IP.To16()
+		if ip16 == nil {
+			return netip.Prefix{}, false
+		}
+		addr = netip.AddrFrom16([16]byte(ip16))
+	}
+	return netip.PrefixFrom(addr, ones).Masked(), true
+}
+
+// fromPrefix converts a netip.Prefix back to a net.IPNet
+func fromPrefix(p netip.Prefix) net.IPNet {
+	return net.IPNet{
+		IP:   p.Addr().AsSlice(),
+		Mask: net.CIDRMask(p.Bits(), p.Addr().BitLen()),
+	}
+}
+
+// halves splits a prefix into its two sub-prefixes (one bit longer)
+func halves(p netip.Prefix) (netip.Prefix, netip.Prefix) {
+	bits := p.Bits() + 1
+	low := netip.PrefixFrom(p.Addr(), bits)
+	high := p.Addr().AsSlice()
+	// set the first free bit of the parent prefix
+	high[p.Bits()/8] |= 0x80 >> (p.Bits() % 8)
+	addr, _ := netip.AddrFromSlice(high)
+	return low, netip.PrefixFrom(addr, bits)
+}
+
+// subtractPrefix returns the prefixes covering p minus e
+func subtractPrefix(p netip.Prefix, e netip.Prefix) []netip.Prefix {
+	if p.Addr().Is4() != e.Addr().Is4() || !p.Overlaps(e) {
+		return []netip.Prefix{p}
+	}
+	if e.Bits() <= p.Bits() {
+		// e contains p
+		return []netip.Prefix{}
+	}
+	// p strictly contains e: keep the half without e and
+	// recurse into the other one
+	low, high := halves(p)
+	if low.Overlaps(e) {
+		return append(subtractPrefix(low, e), high)
+	}
+	return append([]netip.Prefix{low}, subtractPrefix(high, e)...)
+}
+
+// comparePrefixes orders prefixes by family, address then length
+func comparePrefixes(a, b netip.Prefix) int {
+	if a.Addr().Is4() != b.Addr().Is4() {
+		if a.Addr().Is4() {
+			return -1
+		}
+		return 1
+	}
+	if c := a.Addr().Compare(b.Addr()); c != 0 {
+		return c
+	}
+	return a.Bits() - b.Bits()
+}
+
+// aggregatePrefixes removes the prefixes contained in others and
+// merges sibling prefixes until the list is minimal
+func aggregatePrefixes(prefixes []netip.Prefix) []netip.Prefix {
+	slices.SortFunc(prefixes, comparePrefixes)
+	out := make([]netip.Prefix, 0, len(prefixes))
+	for _, p := range prefixes {
+		if n := len(out); n > 0 && out[n-1].Overlaps(p) {
+			// sorted: the previous prefix contains p
+			continue
+		}
+		out = append(out, p)
+		// merge with the previous one while they are siblings
+		for n := len(out); n > 1; n = len(out) {
+			a, b := out[n-2], out[n-1]
+			if a.Bits() != b.Bits() || a.Bits() == 0 {
+				break
+			}
+			parent := netip.PrefixFrom(a.Addr(), a.Bits()-1).Masked()
+			if parent.Addr() != a.Addr() || !parent.Contains(b.Addr()) {
+				break
+			}
+			out = append(out[:n-2], parent)
+		}
+	}
+	return out
+}
@@ -0,0 +1,354 @@
+package utils
+
+import (
+	"math/rand/v2"
+	"net"
+	"net/netip"
+	"testing"
+)
+
+func mustParseNets(t *testing.T, l ...string) []net.IPNet {
+	t.Helper()
+	nets, err := ParseIPNetList(l)
+	if err != nil {
+		t.Fatalf("ParseIPNetList(%v) failed: %v", l, err)
+	}
+	return nets
+}
+
+func TestExcludeNetworks(t *testing.T) {
+	tests := []struct {
+		name     string
+		include  []string
+		exclude  []string
+		expected []string
+	}{
+		{
+			name:     "no exclusion",
+			include:  []string{"0.0.0.0/0", "::/0"},
+			exclude:  []string{},
+			expected: []string{"0.0.0.0/0", "::/0"},
+		},
+		{
+			name:    "everything except a LAN",
+			include: []string{"0.0.0.0/0"},
+			exclude: []string{"192.168.0.0/16"},
+			expected: []string{
+				"0.0.0.0/1", "128.0.0.0/2", "192.0.0.0/9", "192.128.0.0/11",
+				"192.160.0.0/13", "192.169.0.0/16", "192.170.0.0/15", "192.172.0.0/14",
+				"192.176.0.0/12", "192.192.0.0/10", "193.0.0.0/8", "194.0.0.0/7",
+				"196.0.0.0/6", "200.0.0.0/5", "208.0.0.0/4", "224.0.0.0/3",
+			},
+		},
+		{
+			name:     "exclusion outside of the routes",
+			include:  []string{"10.0.0.0/8"},
+			exclude:  []string{"192.168.0.0/16"},
+			expected: []string{"10.0.0.0/8"},
+		},
+		{
+			name:     "exclusion covering the routes",
+			include:  []string{"10.1.0.0/16"},
+			exclude:  []string{"10.0.0.0/8"},
+			expected: []string{},
+		},
+		{
+			name:     "single address",
+			include:  []string{"10.0.0.0/30"},
+			exclude:  []string{"10.0.0.2/32"},
+			expected: []string{"10.0.0.0/31", "10.0.0.3/32"},
+		},
+		{
+			name:     "families are independent",
+			include:  []string{"10.0.0.0/8", "fd00::/8"},
+			exclude:  []string{"fd00::/9", "0.0.0.0/0"},
+			expected: []string{"fd80::/9"},
+		},
+		{
+			name:     "overlapping routes are merged",
+			include:  []string{"10.0.0.0/9", "10.128.0.0/9", "10.1.0.0/16"},
+			exclude:  []string{},
+			expected: []string{"10.0.0.0/8"},
+		},
+		{
+			name:     "IPv6 default route minus ULA",
+			include:  []string{"::/0"},
+			exclude:  []string{"fc00::/7"},
+			expected: []string{"::/1", "8000::/2", "c000::/3", "e000::/4", "f000::/5", "f800::/6", "fe00::/7"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := StringifyNetworks(ExcludeNetworks(mustParseNets(t, tt.include...), mustParseNets(t, tt.exclude...)))
+			if len(result) != len(tt.expected) {
+				t.Fatalf("ExcludeNetworks() = %v, expected %v", result, tt.expected)
+			}
+			for i := range result {
+				if result[i] != tt.expected[i] {
+					t.Errorf("ExcludeNetworks()[%d] = %s, expected %s", i, result[i], tt.expected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestExcludeNetworksZeroNets(t *testing.T) {
+	// IPv4ZeroNet stores a 16-byte IP with a 4-byte mask
+	result := ExcludeNetworks(
+		[]net.IPNet{IPv4ZeroNet, IPv6ZeroNet},
+		mustParseNets(t, "128.0.0.0/1", "8000::/1"),
+	)
+	got := StringifyNetworks(result)
+	if len(got) != 2 || got[0] != "0.0.0.0/1" || got[1] != "::/1" {
+		t.Errorf("ExcludeNetworks() = %v, expected [0.0.0.0/1 ::/1]", got)
+	}
+}
+
+// randomPrefix returns a random prefix inside base whose length is
+// between base.Bits() and maxBits
+func randomPrefix(r *rand.Rand, base netip.Prefix, maxBits int) netip.Prefix {
+	raw := base.Addr().AsSlice()
+	for i := range raw {
+		raw[i] = byte(r.UintN(256))
+	}
+	// keep the base bits
+	fixed := base.Addr().AsSlice()
+	for i := range raw {
+		keep := min(max(base.Bits()-8*i, 0), 8)
+		mask := byte(0xff << (8 - keep))
+		raw[i] = (fixed[i] & mask) | (raw[i] &^ mask)
+	}
+	addr, _ := netip.AddrFromSlice(raw)
+	bits := base.Bits() + r.IntN(maxBits-base.Bits()+1)
+	return netip.PrefixFrom(addr, bits).Masked()
+}
+
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func toPrefixes(t *testing.T, nets []net.IPNet) []netip.Prefix {
+	t.Helper()
+	out := make([]netip.Prefix, len(nets))
+	for i, n := range nets {
+		p, ok := toPrefix(n)
+		if !ok {
+			t.Fatalf("invalid network %v", n)
+		}
+		out[i] = p
+	}
+	return out
+}
+
+// checkExcludeProperties checks that the result is exactly include minus
+// exclude on the given addresses, that the result prefixes are disjoint and
+// that no pair of them could be merged (minimality)
+func checkExcludeProperties(t *testing.T, include, exclude, result []netip.Prefix, addrs []netip.Addr) {
+	t.Helper()
+	for _, addr := range addrs {
+		expected := containsAddr(include, addr) && !containsAddr(exclude, addr)
+		if got := containsAddr(result, addr); got != expected {
+			t.Fatalf("address %s: covered=%v, expected %v (include=%v exclude=%v result=%v)",
+				addr, got, expected, include, exclude, result)
+		}
+	}
+	for i, a := range result {
+		for j, b := range result {
+			if i == j {
+				continue
+			}
+			if a.Overlaps(b) {
+				t.Fatalf("overlapping prefixes %s and %s in %v", a, b, result)
+			}
+			if a.Bits() == b.Bits() && a.Bits() > 0 {
+				parent := netip.PrefixFrom(a.Addr(), a.Bits()-1).Masked()
+				if parent.Contains(b.Addr()) {
+					t.Fatalf("sibling prefixes %s and %s should be merged in %v", a, b, result)
+				}
+			}
+		}
+	}
+}
+
+func TestExcludeNetworksPropertiesIPv4(t *testing.T) {
+	r := rand.New(rand.NewPCG(26, 4))
+	base := netip.MustParsePrefix("10.0.0.0/22")
+
+	// every address of the base network (exhaustive check)
+	addrs := make([]netip.Addr, 0, 1024)
+	for a := base.Addr(); base.Contains(a); a = a.Next() {
+		addrs = append(addrs, a)
+	}
+
+	for range 500 {
+		include := make([]netip.Prefix, 1+r.IntN(3))
+		for i := range include {
+			include[i] = randomPrefix(r, base, 26)
+		}
+		exclude := make([]netip.Prefix, r.IntN(5))
+		for i := range exclude {
+			exclude[i] = randomPrefix(r, base, 32)
+		}
+		result := toPrefixes(t, ExcludeNetworks(
+			mustParseNets(t, stringifyPrefixes(include)...),
+			mustParseNets(t, stringifyPrefixes(exclude)...),
+		))
+		checkExcludeProperties(t, include, exclude, result, addrs)
+	}
+}
+
+func TestExcludeNetworksPropertiesIPv6(t *testing.T) {
+	r := rand.New(rand.NewPCG(26, 6))
+	base := netip.MustParsePrefix("2001:db8::/64")
+
+	for range 500 {
+		include := make([]netip.Prefix, 1+r.IntN(3))
+		for i := range include {
+			include[i] = randomPrefix(r, base, 80)
+		}
+		exclude := make([]netip.Prefix, r.IntN(5))
+		for i := range exclude {
+			exclude[i] = randomPrefix(r, base, 128)
+		}
+		// sample addresses around the boundaries of every prefix
+		addrs := make([]netip.Addr, 0)
+		for _, p := range append(include, exclude...) {
+			first := p.Addr()
+			last := lastAddr(p)
+			addrs = append(addrs, first, last, first.Prev(), last.Next())
+		}
+		for range 200 {
+			addrs = append(addrs, randomPrefix(r, base, 128).Addr())
+		}
+		result := toPrefixes(t, ExcludeNetworks(
+			mustParseNets(t, stringifyPrefixes(include)...),
+			mustParseNets(t, stringifyPrefixes(exclude)...),
+		))
+		checkExcludeProperties(t, include, exclude, result, addrs)
+	}
+}
+
+func stringifyPrefixes(prefixes []netip.Prefix) []string {
+	out := make([]string, len(prefixes))
+	for i, p := range prefixes {
+		out[i] = p.String()
+	}
+	return out
+}
+
+func lastAddr(p netip.Prefix) netip.Addr {
+	raw := p.Addr().AsSlice()
+	for i := range raw {
+		free := min(max(8*(i+1)-p.Bits(), 0), 8)
+		raw[i] |= byte(0xff >> (8 - free))
+	}
+	addr, _ := netip.AddrFromSlice(raw)
+	return addr
+}
+
+func TestSplitNetworks(t *testing.T) {
+	tests := []struct {
+		name     string
+		nets     []string
+		n        int
+		expected [][]string
+	}{
+		{
+			name:     "one group",
+			nets:     []string{"0.0.0.0/0", "::/0"},
+			n:        1,
+			expected: [][]string{{"0.0.0.0/0", "::/0"}},
+		},
+		{
+			name:     "default routes in two groups",
+			nets:     []string{"0.0.0.0/0", "::/0"},
+			n:        2,
+			expected: [][]string{{"0.0.0.0/1", "::/1"}, {"128.0.0.0/1", "8000::/1"}},
+		},
+		{
+			name:     "three groups",
+			nets:     []string{"10.0.0.0/8"},
+			n:        3,
+			expected: [][]string{{"10.0.0.0/10"}, {"10.64.0.0/10"}, {"10.128.0.0/9"}},
+		},
+		{
+			name:     "more networks than groups",
+			nets:     []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16"},
+			n:        2,
+			expected: [][]string{{"10.0.0.0/8"}, {"172.16.0.0/12", "192.168.0.0/16"}},
+		},
+		{
+			name:     "single addresses cannot be split",
+			nets:     []string{"10.0.0.1/32"},
+			n:        2,
+			expected: [][]string{{}, {"10.0.0.1/32"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			groups := SplitNetworks(mustParseNets(t, tt.nets...), tt.n)
+			if len(groups) != len(tt.expected) {
+				t.Fatalf("SplitNetworks() returned %d groups, expected %d", len(groups), len(tt.expected))
+			}
+			for i, group := range groups {
+				got := StringifyNetworks(group)
+				if len(got) != len(tt.expected[i]) {
+					t.Errorf("group %d = %v, expected %v", i, got, tt.expected[i])
+					continue
+				}
+				for j := range got {
+					if got[j] != tt.expected[i][j] {
+						t.Errorf("group %d = %v, expected %v", i, got, tt.expected[i])
+						break
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestSplitNetworksProperties(t *testing.T) {
+	r := rand.New(rand.NewPCG(29, 2))
+	base := netip.MustParsePrefix("10.0.0.0/22")
+	addrs := make([]netip.Addr, 0, 1024)
+	for a := base.Addr(); base.Contains(a); a = a.Next() {
+		addrs = append(addrs, a)
+	}
+
+	for range 200 {
+		nets := make([]netip.Prefix, 1+r.IntN(4))
+		for i := range nets {
+			nets[i] = randomPrefix(r, base, 30)
+		}
+		n := 1 + r.IntN(5)
+		groups := SplitNetworks(mustParseNets(t, stringifyPrefixes(nets)...), n)
+		prefixes := make([][]netip.Prefix, len(groups))
+		for i, g := range groups {
+			prefixes[i] = toPrefixes(t, g)
+		}
+		// every address is in exactly one group if and only if
+		// it is in the input networks
+		for _, addr := range addrs {
+			count := 0
+			for _, g := range prefixes {
+				if containsAddr(g, addr) {
+					count++
+				}
+			}
+			expected := 0
+			if containsAddr(nets, addr) {
+				expected = 1
+			}
+			if count != expected {
+				t.Fatalf("address %s is in %d groups, expected %d (nets=%v, n=%d)", addr, count, expected, nets, n)
+			}
+		}
+	}
+}
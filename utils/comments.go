@@ -7,6 +7,17 @@ var (
 	CommentPrefixes = []string{"#", ";", "//"}
 )
 
+// extractComment returns the text of a comment line (without prefix)
+// and whether the line is a comment
+func extractComment(line string) (string, bool) {
+	for _, pre := range CommentPrefixes {
+		if strings.HasPrefix(line, pre) {
+			return strings.TrimSpace(strings.TrimPrefix(line, pre)), true
+		}
+	}
+	return "", false
+}
+
 func removeComment(line string) string {
 	for _, pre := range CommentPrefixes {
 		if strings.HasPrefix(line, pre) {
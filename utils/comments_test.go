@@ -49,3 +49,24 @@ func TestRemoveComment(t *testing.T) {
 		})
 	}
 }
+
+func TestExtractComment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		ok       bool
+	}{
+		{"# client0", "client0", true},
+		{";client0", "client0", true},
+		{"//  client0 ", "client0", true},
+		{"#", "", true},
+		{"ListenPort = 52820", "", false},
+	}
+
+	for _, tt := range tests {
+		comment, ok := extractComment(tt.input)
+		if comment != tt.expected || ok != tt.ok {
+			t.Errorf("extractComment(%q) = (%q, %v), expected (%q, %v)", tt.input, comment, ok, tt.expected, tt.ok)
+		}
+	}
+}
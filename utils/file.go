@@ -1,11 +1,10 @@
 package utils
 
 import (
-	"bufio"
 	"fmt"
+	"image/png"
 	"io"
 	"os"
-	"regexp"
 	"strings"
 
 	"github.com/asiffer/wg-easy-vpn/export"
@@ -24,51 +23,10 @@ func NewFile() *File {
 	return &File{sections: make([]*Section, 0)}
 }
 
-// ParseFile reads a file and store data to a File object
+// ParseFile reads a file and store data to a File object (lenient
+// mode, see Parse)
 func ParseFile(p string) (*File, error) {
-	buf, err := os.Open(p)
-	if err != nil {
-		return nil, err
-	}
-	reader := bufio.NewReader(buf)
-	file := NewFile()
-	rex, err := regexp.Compile(`\[(.*?)\]`)
-	if err != nil {
-		return nil, err
-	}
-
-	section := file.AddSection(DEFAULT_SECTION)
-	for {
-		// get line
-		line, err := reader.ReadString('\n')
-		if err == io.EOF {
-			return file, nil
-		} else if err != nil {
-			return file, err
-		}
-
-		// trim line
-		line = strings.TrimSpace(line)
-		// remove comments
-		line = removeComment(line)
-		// check
-		if len(line) > 0 {
-			if title := rex.FindString(line); title != "" {
-				// section case
-				// remove [ and ]
-				section = file.AddSection(title[1 : len(title)-1])
-			} else if index := strings.Index(line, "="); index > 0 {
-				// key - value pair case
-				key := strings.TrimSpace(line[:index])
-				value := strings.TrimSpace(line[index+1:])
-				// check if key is valid
-				if err := section.Set(key, value); err != nil {
-					return nil, err
-				}
-			}
-
-		}
-	}
+	return ParseFileWith(p, ParseOptions{})
 }
 
 // Sections returns the list of the sections
@@ -130,9 +88,9 @@ func (f *File) String() string {
 	return str
 }
 
-// Save stores the config to a file
+// Save stores the config to a file (atomically)
 func (f *File) Save(path string) error {
-	return os.WriteFile(path, []byte(f.String()), 0600)
+	return WriteFileAtomic(path, []byte(f.String()), 0600)
 }
 
 func (f *File) WriteTo(w io.Writer) (int64, error) {
@@ -150,6 +108,31 @@ func (f *File) WriteQRCodeTo(w io.Writer) (int64, error) {
 	return int64(n), err
 }
 
+// WriteQRCodePNGTo writes the config as a QR code (PNG image)
+func (f *File) WriteQRCodePNGTo(w io.Writer) error {
+	img, err := export.EncodeImage(strings.NewReader(f.String()))
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(w, img); err != nil {
+		return fmt.Errorf("error while encoding QRCode to png (%w)", err)
+	}
+	return nil
+}
+
+// SaveQRCode stores the config as a QR code (PNG image)
+func (f *File) SaveQRCode(path string) error {
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if err := f.WriteQRCodePNGTo(out); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
 func (f *File) Log(event *zerolog.Event) *zerolog.Event {
 	for _, s := range f.sections {
 		if s.name != DEFAULT_SECTION {
@@ -343,6 +343,115 @@ Address = 192.168.1.1/24
 	if !iface.HasKey("Address") {
 		t.Error("Interface section missing Address")
 	}
+
+	// comments right above the header belong to the section
+	comments := iface.Comments()
+	if len(comments) != 4 || comments[0] != "Hash comment" || comments[3] != "Another comment" {
+		t.Errorf("Interface comments = %v, expected 4 comments", comments)
+	}
+	def, _ := f.GetSection(DEFAULT_SECTION)
+	if len(def.Comments()) != 0 {
+		t.Errorf("DEFAULT comments = %v, expected none", def.Comments())
+	}
+}
+
+func TestParseFileHandWritten(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "wg0.conf")
+	// peer names above the headers, repeated keys and no final newline
+	configContent := `# managed by hand
+
+[Interface]
+Address = 10.0.0.1/24
+PostUp = iptables -A FORWARD -i %i -j ACCEPT
+PostUp = iptables -t nat -A POSTROUTING -o eth0 -j MASQUERADE
+
+# alice
+[Peer]
+PublicKey = alice
+AllowedIPs = 10.0.0.2/32
+[Peer]
+# bob
+PublicKey = bob
+AllowedIPs = 10.0.0.3/32`
+	if err := os.WriteFile(filePath, []byte(configContent), 0600); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	f, err := ParseFile(filePath)
+	if err != nil {
+		t.Fatalf("ParseFile() failed: %v", err)
+	}
+
+	def, _ := f.GetSection(DEFAULT_SECTION)
+	if len(def.Comments()) != 1 {
+		t.Errorf("DEFAULT comments = %v, expected [managed by hand]", def.Comments())
+	}
+	iface, _ := f.GetSection("Interface")
+	if len(iface.GetAll("PostUp")) != 2 {
+		t.Errorf("PostUp = %v, expected 2 values", iface.GetAll("PostUp"))
+	}
+	if len(iface.Comments()) != 0 {
+		t.Errorf("Interface comments = %v, expected none", iface.Comments())
+	}
+
+	peers := make([]*Section, 0)
+	for _, sec := range f.Sections() {
+		if sec.Name() == "Peer" {
+			peers = append(peers, sec)
+		}
+	}
+	if len(peers) != 2 {
+		t.Fatalf("expected 2 peers, got %d", len(peers))
+	}
+	for i, name := range []string{"alice", "bob"} {
+		if c := peers[i].Comments(); len(c) != 1 || c[0] != name {
+			t.Errorf("peer %d comments = %v, expected [%s]", i, c, name)
+		}
+	}
+	// the last line has no newline
+	if allowed, _ := peers[1].Get("AllowedIPs"); allowed != "10.0.0.3/32" {
+		t.Errorf("AllowedIPs = %q, expected 10.0.0.3/32", allowed)
+	}
+}
+
+func TestParseFileRepeatedKey(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "wg0.conf")
+	// a single-valued key written twice: the last one wins, as before
+	// the parser kept the repeated keys
+	configContent := `[Peer]
+PublicKey = alice
+Endpoint = old.example.com:51820
+Endpoint = new.example.com:51820
+PersistentKeepalive = 10
+PersistentKeepalive = 25
+`
+	if err := os.WriteFile(filePath, []byte(configContent), 0600); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	f, err := ParseFile(filePath)
+	if err != nil {
+		t.Fatalf("ParseFile() failed: %v", err)
+	}
+	peer, _ := f.GetSection("Peer")
+	if endpoint, _ := peer.Get("Endpoint"); endpoint != "new.example.com:51820" {
+		t.Errorf("Endpoint = %q, expected new.example.com:51820", endpoint)
+	}
+	if keepalive, _ := peer.GetInt("PersistentKeepalive"); keepalive != 25 {
+		t.Errorf("PersistentKeepalive = %d, expected 25", keepalive)
+	}
+	if line, _ := peer.Position("Endpoint"); line != 4 {
+		t.Errorf("Endpoint line = %d, expected 4", line)
+	}
+	if all := peer.GetAll("Endpoint"); len(all) != 2 {
+		t.Errorf("Endpoint = %v, expected 2 values", all)
+	}
+
+	// Set replaces the value returned by Get
+	peer.Set("Endpoint", "vpn.example.com:51820")
+	if endpoint, _ := peer.Get("Endpoint"); endpoint != "vpn.example.com:51820" {
+		t.Errorf("Endpoint = %q, expected vpn.example.com:51820", endpoint)
+	}
 }
 
 func TestParseFileEmptyLines(t *testing.T) {
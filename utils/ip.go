@@ -91,6 +91,16 @@ func FindIP(ip net.IP, slice []net.IP) int {
 	return -1
 }
 
+// FindNetwork returns the index of the network n in the slice (-1 if absent)
+func FindNetwork(n net.IPNet, slice []net.IPNet) int {
+	for i, other := range slice {
+		if n.String() == other.String() {
+			return i
+		}
+	}
+	return -1
+}
+
 func StringifyNetworks(nets []net.IPNet) []string {
 	strs := make([]string, len(nets))
 	for i, n := range nets {
@@ -100,33 +110,32 @@ func StringifyNetworks(nets []net.IPNet) []string {
 }
 
 // Iterate returns a channel yielding IP addresses
-// included in IP network. It accepts a context for cancellation.
-// When the context is cancelled, the iteration stops and the channel is closed.
+// included in IP network (except the network address). It accepts a
+// context for cancellation. When the context is cancelled, the iteration
+// stops and the channel is closed.
 func Iterate(ctx context.Context, n *net.IPNet) chan net.IP {
 	// create a copy of the IP address setting (.Mask() creates a new slice)
 	// free bits to zero
 	base := n.IP.Mask(n.Mask)
 	// init channels
 	c := make(chan net.IP)
-	//
-	size := len(base)
-	// get the mask
-	frozen, total := n.Mask.Size()
-	// number of IP (2^(n-k))
-	nIP := 1 << uint(total-frozen)
 	// run
 	go func() {
 		defer close(c)
 
-		for i := 0; i < nIP-1; i++ {
-			// byte index (starting from the end)
-			k := 1
-			// increment last byte
-			base[size-k]++
-			for base[size-k] == 0 {
-				// increment last byte if 255 is reached
-				k++
-				base[size-k]++
+		for {
+			// increment the last byte (and the previous ones when 255
+			// is reached), huge IPv6 networks included
+			k := len(base) - 1
+			for ; k >= 0; k-- {
+				base[k]++
+				if base[k] != 0 {
+					break
+				}
+			}
+			// stop at the end of the network
+			if k < 0 || !n.Contains(base) {
+				return
 			}
 			// send buffer
 			select {
@@ -3,6 +3,7 @@ package utils
 import (
 	"context"
 	"net"
+	"strings"
 	"testing"
 	"time"
 )
@@ -310,6 +311,7 @@ func TestIterateWithCancel(t *testing.T) {
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 	ipChan := Iterate(ctx, network)
 
 	// Read a few IPs then cancel
@@ -351,3 +353,33 @@ func TestIterateIPv6(t *testing.T) {
 		t.Errorf("Iterate() IPv6 yielded %d IPs, expected %d", len(ips), expectedCount)
 	}
 }
+
+func TestIterateLargeIPv6(t *testing.T) {
+	_, network, err := net.ParseCIDR("fd00::/64")
+	if err != nil {
+		t.Fatalf("Failed to parse IPv6 CIDR: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the first addresses of a /64 (2^64 addresses overflow the counters)
+	ip, ok := <-Iterate(ctx, network)
+	if !ok || ip.String() != "fd00::1" {
+		t.Errorf("Iterate() /64 yielded %v, expected fd00::1", ip)
+	}
+}
+
+func TestIterateEnd(t *testing.T) {
+	_, network, err := net.ParseCIDR("255.255.255.252/30")
+	if err != nil {
+		t.Fatalf("Failed to parse CIDR: %v", err)
+	}
+	ips := make([]string, 0)
+	for ip := range Iterate(context.Background(), network) {
+		ips = append(ips, ip.String())
+	}
+	if strings.Join(ips, ",") != "255.255.255.253,255.255.255.254,255.255.255.255" {
+		t.Errorf("Iterate() at the end of the address space yielded %v", ips)
+	}
+}
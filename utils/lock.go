@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// LOCK_SUFFIX is appended to the path of a config to get its lock file
+const LOCK_SUFFIX = ".lock"
+
+// FileLock is an exclusive lock on a config, shared by all the processes
+// editing it (flock on a lock file next to the config)
+type FileLock struct {
+	f *os.File
+}
+
+// LockFile waits for the lock of a config
+func LockFile(path string) (*FileLock, error) {
+	f, err := os.OpenFile(path+LOCK_SUFFIX, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("error while opening lock file (%w)", err)
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("error while locking %s (%w)", path, err)
+	}
+	return &FileLock{f: f}, nil
+}
+
+// Unlock releases the lock (the lock file is kept: removing it would let
+// another process lock a new file while one is waiting on the old one)
+func (l *FileLock) Unlock() error {
+	defer l.f.Close()
+	return syscall.Flock(int(l.f.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLockFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wg0.conf")
+	lock, err := LockFile(path)
+	if err != nil {
+		t.Fatalf("LockFile failed: %v", err)
+	}
+	if !FileExists(path + LOCK_SUFFIX) {
+		t.Error("expected a lock file")
+	}
+
+	locked := make(chan *FileLock)
+	go func() {
+		other, err := LockFile(path)
+		if err != nil {
+			t.Error(err)
+		}
+		locked <- other
+	}()
+	select {
+	case <-locked:
+		t.Fatal("the lock is exclusive")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if err := lock.Unlock(); err != nil {
+		t.Fatalf("Unlock failed: %v", err)
+	}
+	select {
+	case other := <-locked:
+		other.Unlock()
+	case <-time.After(time.Second):
+		t.Fatal("the lock was not released")
+	}
+}
@@ -0,0 +1,176 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// WireguardSections are the sections known by wg and wg-quick
+var WireguardSections = []string{"Interface", "Peer"}
+
+var sectionRex = regexp.MustCompile(`\[(.*?)\]`)
+
+// ParseOptions tune the parser
+type ParseOptions struct {
+	// Strict rejects the unknown sections and the lines which are neither
+	// comments, section headers nor key/value pairs (they are skipped
+	// otherwise)
+	Strict bool
+	// Sections are the known sections in strict mode (default to
+	// WireguardSections)
+	Sections []string
+}
+
+// ParseError is a problem at a given position of a file
+type ParseError struct {
+	Path   string // empty when the input is not a file
+	Line   int    // starts at 1
+	Column int    // starts at 1
+	Text   string // the offending line
+	Err    error
+}
+
+func (e *ParseError) Error() string {
+	pos := fmt.Sprintf("%d:%d", e.Line, e.Column)
+	if e.Path != "" {
+		pos = e.Path + ":" + pos
+	}
+	return fmt.Sprintf("%s: %v (%q)", pos, e.Err, e.Text)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// ParseErrors are all the problems found while parsing a file
+type ParseErrors []*ParseError
+
+func (errs ParseErrors) Error() string {
+	lines := make([]string, len(errs))
+	for i, err := range errs {
+		lines[i] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (errs ParseErrors) Unwrap() []error {
+	unwrapped := make([]error, len(errs))
+	for i, err := range errs {
+		unwrapped[i] = err
+	}
+	return unwrapped
+}
+
+// position is where a key/value pair was read
+type position struct {
+	path   string
+	line   int
+	column int // of the value
+	text   string
+}
+
+// ParseFileWith reads a file with the given options (see Parse)
+func ParseFileWith(p string, opts ParseOptions) (*File, error) {
+	buf, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer buf.Close()
+	return Parse(buf, p, opts)
+}
+
+// Parse reads a config (path only names the input in the errors). Comments
+// belong to the section they are written in, except the ones right above
+// a section header (no blank line) which belong to this section. All the
+// invalid lines are reported (as ParseErrors) and the file is returned
+// without them.
+func Parse(r io.Reader, path string, opts ParseOptions) (*File, error) {
+	known := opts.Sections
+	if len(known) == 0 {
+		known = WireguardSections
+	}
+	reader := bufio.NewReader(r)
+	file := NewFile()
+	errs := make(ParseErrors, 0)
+	report := func(line int, raw string, column int, err error) {
+		errs = append(errs, &ParseError{Path: path, Line: line, Column: column, Text: raw, Err: err})
+	}
+
+	section := file.AddSection(DEFAULT_SECTION)
+	// comments waiting for the next line to know their section
+	pending := make([]string, 0)
+	flush := func(sec *Section) {
+		for _, comment := range pending {
+			sec.AddComment(comment)
+		}
+		pending = pending[:0]
+	}
+	for lineNo := 1; ; lineNo++ {
+		// get line
+		raw, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return file, err
+		}
+		eof := err == io.EOF
+		raw = strings.TrimRight(raw, "\r\n")
+
+		// trim line
+		line := strings.TrimSpace(raw)
+		// column of the first character of the line
+		start := strings.Index(raw, line) + 1
+		// keep comments (peer names for instance)
+		if comment, ok := extractComment(line); ok {
+			if comment != "" {
+				pending = append(pending, comment)
+			}
+		} else if len(line) == 0 {
+			flush(section)
+		} else if title := sectionRex.FindString(line); title != "" {
+			// section case
+			name := title[1 : len(title)-1]
+			if opts.Strict && line != title {
+				report(lineNo, raw, start, fmt.Errorf("unexpected characters around the section header"))
+			} else if opts.Strict && !slices.Contains(known, name) {
+				report(lineNo, raw, start, fmt.Errorf("unknown section %s (expected %s)", name, strings.Join(known, ", ")))
+			}
+			section = file.AddSection(name)
+			flush(section)
+		} else if index := strings.Index(line, "="); index > 0 {
+			flush(section)
+			// key - value pair case
+			key := strings.TrimSpace(line[:index])
+			value := strings.TrimSpace(line[index+1:])
+			// check if key is valid (keys may be repeated, like PostUp)
+			if err := checkKey(key); err != nil {
+				report(lineNo, raw, start, err)
+			} else {
+				column := start + index + 1 + strings.Index(line[index+1:], value)
+				section.data = append(section.data, KeyValue{
+					Key:   key,
+					Value: value,
+					pos:   &position{path: path, line: lineNo, column: column, text: raw},
+				})
+			}
+		} else if opts.Strict {
+			report(lineNo, raw, start, fmt.Errorf("expected a comment, a section header or a key/value pair"))
+		} else {
+			log.Warn().Str("path", path).Int("line", lineNo).Str("text", raw).Msg("Ignoring invalid line")
+		}
+
+		if eof {
+			flush(section)
+			break
+		}
+	}
+	if len(errs) > 0 {
+		return file, errs
+	}
+	return file, nil
+}
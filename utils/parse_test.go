@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const badConfig = `[Interface]
+PrivateKey = djmXza7K0dVhLOihJQwvz8xxpI7JfJlWK+8TLqlBK+o=
+  Invalid-Key = value
+garbage line
+[Unknown]
+Address = 10.0.0.1/24
+[Peer]
+Other-Key = 1
+AllowedIPs =   10.0.0.300/32
+`
+
+func TestParseCollectsErrors(t *testing.T) {
+	f, err := Parse(strings.NewReader(badConfig), "wg0.conf", ParseOptions{})
+	var errs ParseErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected ParseErrors, got %v", err)
+	}
+	// lenient mode: only the invalid keys
+	if len(errs) != 2 {
+		t.Fatalf("expected 2 errors, got %d:\n%v", len(errs), err)
+	}
+	first := errs[0]
+	if first.Path != "wg0.conf" || first.Line != 3 || first.Column != 3 || first.Text != "  Invalid-Key = value" {
+		t.Errorf("unexpected error %+v", first)
+	}
+	if !strings.HasPrefix(first.Error(), "wg0.conf:3:3: ") {
+		t.Errorf("unexpected message %q", first.Error())
+	}
+	if errs[1].Line != 8 {
+		t.Errorf("expected line 8, got %d", errs[1].Line)
+	}
+	// the valid lines are kept
+	if f == nil || !f.HasSection("Unknown") {
+		t.Fatal("expected the partial file")
+	}
+	iface, _ := f.GetSection("Interface")
+	if !iface.HasKey("PrivateKey") || iface.HasKey("Invalid-Key") {
+		t.Errorf("unexpected interface:\n%s", iface.String())
+	}
+}
+
+func TestParseStrict(t *testing.T) {
+	_, err := Parse(strings.NewReader(badConfig), "", ParseOptions{Strict: true})
+	var errs ParseErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected ParseErrors, got %v", err)
+	}
+	lines := make([]int, 0)
+	for _, e := range errs {
+		lines = append(lines, e.Line)
+	}
+	expected := []int{3, 4, 5, 8}
+	if len(lines) != len(expected) {
+		t.Fatalf("expected errors at lines %v, got %v", expected, lines)
+	}
+	for i := range expected {
+		if lines[i] != expected[i] {
+			t.Errorf("expected errors at lines %v, got %v", expected, lines)
+		}
+	}
+	if !strings.HasPrefix(errs[0].Error(), "3:3: ") {
+		t.Errorf("unexpected message %q", errs[0].Error())
+	}
+
+	// known sections
+	_, err = Parse(strings.NewReader("[Gateway]\nName = london\n"), "", ParseOptions{Strict: true, Sections: []string{"Gateway"}})
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	_, err = Parse(strings.NewReader("[Interface] trailing\n"), "", ParseOptions{Strict: true})
+	if err == nil {
+		t.Error("expected an error for the trailing characters")
+	}
+}
+
+func TestSectionPositionedErrors(t *testing.T) {
+	f, _ := Parse(strings.NewReader(badConfig), "wg0.conf", ParseOptions{})
+	peer, _ := f.GetSection("Peer")
+	if line, column := peer.Position("AllowedIPs"); line != 9 || column != 16 {
+		t.Errorf("expected 9:16, got %d:%d", line, column)
+	}
+	_, err := peer.GetNetworks("AllowedIPs")
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("expected a ParseError, got %v", err)
+	}
+	if parseErr.Line != 9 || !strings.Contains(err.Error(), "10.0.0.300/32") {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	// the values set afterwards have no position
+	peer.Set("AllowedIPs", "bad")
+	_, err = peer.GetNetworks("AllowedIPs")
+	if err == nil || errors.As(err, &parseErr) {
+		t.Errorf("expected a plain error, got %v", err)
+	}
+}
@@ -13,8 +13,9 @@ import (
 
 // KeyValue represents a key-value pair in a section
 type KeyValue struct {
-	Key   string
-	Value string
+	Key   string    `json:"key" yaml:"key"`
+	Value string    `json:"value" yaml:"value"`
+	pos   *position // nil when not parsed from a file
 }
 
 // Section represents a basic block like [Interface] or [Peer]
@@ -53,11 +54,10 @@ func (s *Section) Set(key string, value string) error {
 	if err := checkKey(key); err != nil {
 		return err
 	}
-	for i, kv := range s.data {
-		if kv.Key == key {
-			s.data[i].Value = value
-			return nil
-		}
+	if i := s.last(key); i >= 0 {
+		s.data[i].Value = value
+		s.data[i].pos = nil
+		return nil
 	}
 	s.data = append(s.data, KeyValue{Key: key, Value: value})
 	return nil
@@ -72,14 +72,53 @@ func (s *Section) Add(key string, value string) error {
 	return nil
 }
 
-// Get returns the raw value (string) related to a key (first match)
+// Get returns the raw value (string) related to a key. When the key is
+// repeated, the last value wins.
 func (s *Section) Get(key string) (string, error) {
+	if i := s.last(key); i >= 0 {
+		return s.data[i].Value, nil
+	}
+	return "", fmt.Errorf("unknown key %s", key)
+}
+
+// last returns the index of the last pair with the given key (-1 if none)
+func (s *Section) last(key string) int {
+	for i := len(s.data) - 1; i >= 0; i-- {
+		if s.data[i].Key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// GetAll returns all the raw values related to a key (duplicate keys)
+func (s *Section) GetAll(key string) []string {
+	var values []string
 	for _, kv := range s.data {
 		if kv.Key == key {
-			return kv.Value, nil
+			values = append(values, kv.Value)
 		}
 	}
-	return "", fmt.Errorf("unknown key %s", key)
+	return values
+}
+
+// Items returns the key/value pairs of the section (in order)
+func (s *Section) Items() []KeyValue {
+	return s.data
+}
+
+// Keep removes all the keys except the given ones (order is preserved)
+func (s *Section) Keep(keys ...string) {
+	data := make([]KeyValue, 0, len(s.data))
+	for _, kv := range s.data {
+		for _, key := range keys {
+			if kv.Key == key {
+				data = append(data, kv)
+				break
+			}
+		}
+	}
+	s.data = data
 }
 
 // GetInt returns a value given a key and tries to convert it
@@ -90,7 +129,7 @@ func (s *Section) GetInt(key string) (int, error) {
 	}
 	i, err := strconv.Atoi(value)
 	if err != nil {
-		return 0, err
+		return 0, s.positioned(key, err)
 	}
 	return i, nil
 }
@@ -103,7 +142,7 @@ func (s *Section) GetUint16(key string) (uint16, error) {
 	}
 	i, err := strconv.ParseUint(value, 10, 16)
 	if err != nil {
-		return 0, err
+		return 0, s.positioned(key, err)
 	}
 	return uint16(i), nil
 }
@@ -116,7 +155,7 @@ func (s *Section) GetBytesFromBase64(key string) ([]byte, error) {
 	}
 	b, err := base64.StdEncoding.DecodeString(value)
 	if err != nil {
-		return nil, err
+		return nil, s.positioned(key, err)
 	}
 	return b, nil
 }
@@ -130,7 +169,7 @@ func (s *Section) GetKeyFromBase64(key string) (crypto.Key, error) {
 	k := crypto.NewKey()
 	err = k.UpdateFromBytes(value)
 	if err != nil {
-		return nil, err
+		return nil, s.positioned(key, err)
 	}
 	return k, nil
 }
@@ -149,7 +188,7 @@ func (s *Section) GetIPArray(key string) ([]net.IP, error) {
 		ip := net.ParseIP(strings.TrimSpace(v))
 		// ip, _, err := net.ParseCIDR(strings.TrimSpace(v))
 		if ip == nil {
-			return nil, fmt.Errorf("error while parsing IP %s", s)
+			return nil, s.positioned(key, fmt.Errorf("error while parsing IP %s", v))
 		}
 		ipList[i] = ip
 	}
@@ -171,7 +210,7 @@ func (s *Section) GetNetworks(key string) ([]net.IPNet, error) {
 		}
 		ip, network, err := net.ParseCIDR(strings.TrimSpace(rawnet))
 		if err != nil {
-			return nil, fmt.Errorf("error while parsing network %s", rawnet)
+			return nil, s.positioned(key, fmt.Errorf("error while parsing network %s", rawnet))
 		}
 		// re-set the initial IP (net.ParseCIDR sets it to the network address)
 		network.IP = ip
@@ -181,6 +220,31 @@ func (s *Section) GetNetworks(key string) ([]net.IPNet, error) {
 	return networks, nil
 }
 
+// Position returns the line and the column of the value of a key (0 when
+// the key was not read from a file)
+func (s *Section) Position(key string) (int, int) {
+	if i := s.last(key); i >= 0 && s.data[i].pos != nil {
+		return s.data[i].pos.line, s.data[i].pos.column
+	}
+	return 0, 0
+}
+
+// positioned adds the position of the key to an error about its value
+// (when the key was read from a file)
+func (s *Section) positioned(key string, err error) error {
+	if i := s.last(key); i >= 0 && s.data[i].pos != nil {
+		kv := s.data[i]
+		return &ParseError{
+			Path:   kv.pos.path,
+			Line:   kv.pos.line,
+			Column: kv.pos.column,
+			Text:   kv.pos.text,
+			Err:    err,
+		}
+	}
+	return err
+}
+
 func (s *Section) String() string {
 	str := fmt.Sprintf("[%s]\n", s.name)
 	return str + s.StringNoHeader()
@@ -197,6 +261,11 @@ func (s *Section) StringNoHeader() string {
 	return str
 }
 
+// Comments returns the comments of the section
+func (s *Section) Comments() []string {
+	return s.comments
+}
+
 func (s *Section) AddComment(comment string) {
 	s.comments = append(s.comments, comment)
 }
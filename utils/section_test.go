@@ -507,3 +507,36 @@ func TestSectionAddComment(t *testing.T) {
 		t.Error("String() does not contain second comment")
 	}
 }
+
+func TestSectionGetAll(t *testing.T) {
+	sec := NewSection("Interface")
+	sec.Add("PreUp", "first")
+	sec.Set("Address", "10.0.0.1/24")
+	sec.Add("PreUp", "second")
+
+	values := sec.GetAll("PreUp")
+	if len(values) != 2 || values[0] != "first" || values[1] != "second" {
+		t.Errorf("GetAll() = %v, expected [first second]", values)
+	}
+	if values := sec.GetAll("PostDown"); len(values) != 0 {
+		t.Errorf("GetAll() for non-existent key = %v, expected empty", values)
+	}
+}
+
+func TestSectionKeep(t *testing.T) {
+	sec := NewSection("Interface")
+	sec.Set("Address", "10.0.0.1/24")
+	sec.Add("PreUp", "first")
+	sec.Set("PrivateKey", "key")
+	sec.Add("PreUp", "second")
+	sec.AddComment("server")
+
+	sec.Keep("PrivateKey", "PreUp")
+
+	if sec.HasKey("Address") {
+		t.Error("Address should have been removed")
+	}
+	if got := sec.StringNoHeader(); got != "# server\nPreUp = first\nPrivateKey = key\nPreUp = second\n" {
+		t.Errorf("unexpected section after Keep():\n%s", got)
+	}
+}